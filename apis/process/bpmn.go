@@ -0,0 +1,189 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/pkg/service"
+	"ferry/tools"
+	"ferry/tools/app"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 仅支持 BPMN 2.0 XML 格式
+func checkProcessFormat(c *gin.Context) error {
+	if format := c.DefaultQuery("format", "bpmn"); format != "bpmn" {
+		return fmt.Errorf("不支持的格式 %v", format)
+	}
+	return nil
+}
+
+// 导出流程
+func ExportProcess(c *gin.Context) {
+	var (
+		err         error
+		processInfo process.Info
+		data        []byte
+	)
+
+	err = checkProcessFormat(c)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	processId, _ := strconv.Atoi(c.DefaultQuery("processId", "0"))
+	if processId == 0 {
+		app.Error(c, -1, errors.New("参数不正确，请确定参数processId是否传递"), "")
+		return
+	}
+
+	err = orm.Eloquent.Model(&process.Info{}).
+		Where("id = ?", processId).
+		Find(&processInfo).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询流程失败，%v", err.Error()))
+		return
+	}
+
+	data, err = service.ExportBpmn(&processInfo)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("导出流程失败，%v", err.Error()))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=process-%v.bpmn", processInfo.Id))
+	c.Data(200, "application/xml; charset=utf-8", data)
+}
+
+// 导入流程，传递 processId 时更新已有流程的结构，否则新建流程
+func ImportProcess(c *gin.Context) {
+	var (
+		err          error
+		data         []byte
+		name         string
+		processInfo  process.Info
+		processCount int
+	)
+
+	err = checkProcessFormat(c)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	// 支持上传文件或直接提交 XML
+	file, fileErr := c.FormFile("file")
+	if fileErr == nil {
+		f, openErr := file.Open()
+		if openErr != nil {
+			app.Error(c, -1, openErr, fmt.Sprintf("读取文件失败，%v", openErr.Error()))
+			return
+		}
+		data, err = ioutil.ReadAll(f)
+		_ = f.Close()
+	} else {
+		data, err = ioutil.ReadAll(c.Request.Body)
+	}
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("读取文件失败，%v", err.Error()))
+		return
+	}
+
+	name, processInfo.Structure, err = service.ImportBpmn(data)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+	err = validateProcessStructure(processInfo.Structure)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	processInfo.Id, _ = strconv.Atoi(c.DefaultQuery("processId", "0"))
+	tx := orm.Eloquent.Begin()
+
+	if processInfo.Id != 0 {
+		// 更新已有流程的结构，模版及任务保持不变
+		var stored process.Info
+		err = tx.Model(&process.Info{}).
+			Where("id = ?", processInfo.Id).
+			Find(&stored).Error
+		if err != nil {
+			tx.Rollback()
+			app.Error(c, -1, err, fmt.Sprintf("查询流程失败，%v", err.Error()))
+			return
+		}
+		stored.Structure = processInfo.Structure
+		processInfo = stored
+
+		_, err = service.PublishVersion(tx, &processInfo, tools.GetUserId(c))
+		if err != nil {
+			tx.Rollback()
+			app.Error(c, -1, err, "")
+			return
+		}
+		err = tx.Model(&process.Info{}).
+			Where("id = ?", processInfo.Id).
+			Update("structure", processInfo.Structure).Error
+		if err != nil {
+			tx.Rollback()
+			app.Error(c, -1, err, fmt.Sprintf("更新流程结构失败，%v", err.Error()))
+			return
+		}
+	} else {
+		processInfo.Name = c.DefaultQuery("name", name)
+		processInfo.Classify, _ = strconv.Atoi(c.DefaultQuery("classify", "0"))
+		if processInfo.Name == "" || processInfo.Classify == 0 {
+			tx.Rollback()
+			app.Error(c, -1, errors.New("新建流程时需要传递流程名称及分类"), "")
+			return
+		}
+
+		// 确定流程名称是否重复
+		err = tx.Model(&process.Info{}).
+			Where("name = ?", processInfo.Name).
+			Count(&processCount).Error
+		if err != nil {
+			tx.Rollback()
+			app.Error(c, -1, err, fmt.Sprintf("流程信息查询失败，%v", err.Error()))
+			return
+		}
+		if processCount > 0 {
+			tx.Rollback()
+			app.Error(c, -1, errors.New("流程名称重复"), "")
+			return
+		}
+
+		// 模版及任务在导入后配置
+		processInfo.Tpls = json.RawMessage("[]")
+		processInfo.Task = json.RawMessage("[]")
+		processInfo.Creator = tools.GetUserId(c)
+		err = tx.Create(&processInfo).Error
+		if err != nil {
+			tx.Rollback()
+			app.Error(c, -1, err, fmt.Sprintf("创建流程失败，%v", err.Error()))
+			return
+		}
+		_, err = service.PublishVersion(tx, &processInfo, tools.GetUserId(c))
+		if err != nil {
+			tx.Rollback()
+			app.Error(c, -1, err, "")
+			return
+		}
+	}
+	tx.Commit()
+
+	processInfo.Structure = nil
+	app.OK(c, processInfo, "流程导入成功")
+}
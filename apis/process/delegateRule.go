@@ -0,0 +1,141 @@
+package process
+
+import (
+	"errors"
+	"ferry/global/orm"
+	process2 "ferry/models/process"
+	"ferry/pkg/pagination"
+	"ferry/tools"
+	"ferry/tools/app"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 当前用户的委托规则列表，包含委托给当前用户的规则
+func DelegateRuleList(c *gin.Context) {
+	var (
+		err      error
+		ruleList []*struct {
+			process2.DelegateRule
+			ProcessName  string `json:"process_name"`
+			UserName     string `json:"user_name"`
+			DelegateName string `json:"delegate_name"`
+		}
+	)
+
+	SearchParams := map[string]map[string]interface{}{
+		"like": pagination.RequestParams(c),
+	}
+
+	db := orm.Eloquent.Model(&process2.DelegateRule{}).
+		Joins("left join p_process_info on p_process_info.id = p_delegate_rule.process").
+		Joins("left join sys_user as u on u.user_id = p_delegate_rule.user_id").
+		Joins("left join sys_user as d on d.user_id = p_delegate_rule.delegate").
+		Select("p_delegate_rule.*, p_process_info.name as process_name, u.nick_name as user_name, d.nick_name as delegate_name").
+		Where("p_delegate_rule.`delete_time` IS NULL").
+		Where("p_delegate_rule.user_id = ? or p_delegate_rule.delegate = ?", tools.GetUserId(c), tools.GetUserId(c))
+
+	result, err := pagination.Paging(&pagination.Param{
+		C:  c,
+		DB: db,
+	}, &ruleList, SearchParams, "p_delegate_rule")
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询委托规则失败，%v", err.Error()))
+		return
+	}
+	app.OK(c, result, "查询委托规则成功")
+}
+
+// 创建委托规则
+func CreateDelegateRule(c *gin.Context) {
+	var (
+		err       error
+		ruleValue process2.DelegateRule
+	)
+
+	err = c.ShouldBind(&ruleValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	ruleValue.UserId = tools.GetUserId(c)
+	err = ruleValue.Validate()
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = orm.Eloquent.Create(&ruleValue).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("创建委托规则失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, ruleValue, "创建委托规则成功")
+}
+
+// 更新委托规则，仅委托人可以修改
+func UpdateDelegateRule(c *gin.Context) {
+	var (
+		err       error
+		ruleValue process2.DelegateRule
+	)
+
+	err = c.ShouldBind(&ruleValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	ruleValue.UserId = tools.GetUserId(c)
+	err = ruleValue.Validate()
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	result := orm.Eloquent.Model(&process2.DelegateRule{}).
+		Where("id = ? and user_id = ?", ruleValue.Id, ruleValue.UserId).
+		Updates(map[string]interface{}{
+			"delegate":     ruleValue.Delegate,
+			"process":      ruleValue.Process,
+			"start_time":   ruleValue.StartTime,
+			"end_time":     ruleValue.EndTime,
+			"move_pending": ruleValue.MovePending,
+			"status":       ruleValue.Status,
+			"remarks":      ruleValue.Remarks,
+		})
+	if result.Error != nil {
+		app.Error(c, -1, result.Error, fmt.Sprintf("更新委托规则失败，%v", result.Error.Error()))
+		return
+	}
+	if result.RowsAffected == 0 {
+		app.Error(c, -1, errors.New("委托规则不存在或无权限修改"), "")
+		return
+	}
+
+	app.OK(c, ruleValue, "更新委托规则成功")
+}
+
+// 删除委托规则，仅委托人可以删除
+func DeleteDelegateRule(c *gin.Context) {
+	ruleId := c.DefaultQuery("ruleId", "")
+	if ruleId == "" {
+		app.Error(c, -1, errors.New("参数传递失败，请确认ruleId是否传递"), "")
+		return
+	}
+
+	err := orm.Eloquent.Delete(process2.DelegateRule{}, "id = ? and user_id = ?", ruleId, tools.GetUserId(c)).Error
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	app.OK(c, "", "删除委托规则成功")
+}
@@ -0,0 +1,115 @@
+package process
+
+import (
+	"errors"
+	"ferry/global/orm"
+	process2 "ferry/models/process"
+	"ferry/pkg/notify"
+	"ferry/pkg/pagination"
+	"ferry/tools/app"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 通知发件箱列表
+func NotifyOutboxList(c *gin.Context) {
+	var (
+		err        error
+		outboxList []*struct {
+			process2.NotifyOutbox
+			WorkOrderTitle string `json:"work_order_title"`
+		}
+		equalParams = make(map[string]interface{})
+	)
+
+	for _, key := range []string{"status", "channel", "work_order"} {
+		if value := c.DefaultQuery(key, ""); value != "" {
+			equalParams[key] = value
+		}
+	}
+
+	SearchParams := map[string]map[string]interface{}{
+		"equal": equalParams,
+	}
+
+	db := orm.Eloquent.Model(&process2.NotifyOutbox{}).
+		Joins("left join p_work_order_info on p_work_order_info.id = p_notify_outbox.work_order").
+		Select("p_notify_outbox.*, p_work_order_info.title as work_order_title").
+		Where("p_notify_outbox.`delete_time` IS NULL")
+
+	result, err := pagination.Paging(&pagination.Param{
+		C:       c,
+		DB:      db,
+		OrderBy: "p_notify_outbox.id desc",
+	}, &outboxList, SearchParams, "p_notify_outbox")
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询通知列表失败，%v", err.Error()))
+		return
+	}
+	app.OK(c, result, "查询通知列表成功")
+}
+
+// 通知详情及发送记录
+func NotifyOutboxDetails(c *gin.Context) {
+	var (
+		err         error
+		outboxId    int
+		outboxInfo  process2.NotifyOutbox
+		attemptList []*process2.NotifyAttempt
+	)
+
+	outboxId, err = strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.Error(c, -1, errors.New("参数不正确，请确认"), "")
+		return
+	}
+
+	err = orm.Eloquent.Model(&process2.NotifyOutbox{}).
+		Where("id = ?", outboxId).
+		Find(&outboxInfo).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询通知失败，%v", err.Error()))
+		return
+	}
+
+	err = orm.Eloquent.Model(&process2.NotifyAttempt{}).
+		Where("outbox = ?", outboxId).
+		Order("id").
+		Find(&attemptList).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询通知发送记录失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, map[string]interface{}{
+		"outbox":   outboxInfo,
+		"attempts": attemptList,
+	}, "查询通知成功")
+}
+
+// 重新发送通知
+func ResendNotify(c *gin.Context) {
+	var (
+		err      error
+		outboxId int
+	)
+
+	outboxId, err = strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.Error(c, -1, errors.New("参数不正确，请确认"), "")
+		return
+	}
+
+	err = notify.Resend(outboxId)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("重新发送通知失败，%v", err.Error()))
+		return
+	}
+	app.OK(c, nil, "通知已重新加入发送队列")
+}
@@ -0,0 +1,204 @@
+package process
+
+import (
+	"errors"
+	"ferry/global/orm"
+	process2 "ferry/models/process"
+	"ferry/pkg/notify"
+	"ferry/pkg/pagination"
+	"ferry/pkg/service"
+	"ferry/tools"
+	"ferry/tools/app"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 校验通知模版
+func validateNotifyTemplate(tpl *process2.NotifyTemplate) (err error) {
+	err = tpl.Validate()
+	if err != nil {
+		return
+	}
+	if _, err = notify.GetNotifier(tpl.Channel); err != nil {
+		return
+	}
+	if tpl.Event != "" {
+		if err = notify.ValidateEvents([]string{tpl.Event}); err != nil {
+			return
+		}
+	}
+	return notify.CheckTemplate(tpl)
+}
+
+// 通知模版列表
+func NotifyTemplateList(c *gin.Context) {
+	var (
+		err     error
+		tplList []*struct {
+			process2.NotifyTemplate
+			ProcessName string `json:"process_name"`
+			CreateName  string `json:"create_name"`
+		}
+	)
+
+	SearchParams := map[string]map[string]interface{}{
+		"like": pagination.RequestParams(c),
+	}
+
+	db := orm.Eloquent.Model(&process2.NotifyTemplate{}).
+		Joins("left join p_process_info on p_process_info.id = p_notify_template.process").
+		Joins("left join sys_user on sys_user.user_id = p_notify_template.creator").
+		Select("p_notify_template.*, p_process_info.name as process_name, sys_user.nick_name as create_name").
+		Where("p_notify_template.`delete_time` IS NULL")
+
+	result, err := pagination.Paging(&pagination.Param{
+		C:  c,
+		DB: db,
+	}, &tplList, SearchParams, "p_notify_template")
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询通知模版失败，%v", err.Error()))
+		return
+	}
+	app.OK(c, result, "查询通知模版成功")
+}
+
+// 创建通知模版
+func CreateNotifyTemplate(c *gin.Context) {
+	var (
+		err      error
+		tplValue process2.NotifyTemplate
+	)
+
+	err = c.ShouldBind(&tplValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = validateNotifyTemplate(&tplValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	tplValue.Creator = tools.GetUserId(c)
+
+	err = orm.Eloquent.Create(&tplValue).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("创建通知模版失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, tplValue, "创建通知模版成功")
+}
+
+// 更新通知模版
+func UpdateNotifyTemplate(c *gin.Context) {
+	var (
+		err      error
+		tplValue process2.NotifyTemplate
+	)
+
+	err = c.ShouldBind(&tplValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = validateNotifyTemplate(&tplValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = orm.Eloquent.Model(&process2.NotifyTemplate{}).
+		Where("id = ?", tplValue.Id).
+		Updates(map[string]interface{}{
+			"name":    tplValue.Name,
+			"event":   tplValue.Event,
+			"channel": tplValue.Channel,
+			"process": tplValue.Process,
+			"subject": tplValue.Subject,
+			"content": tplValue.Content,
+			"status":  tplValue.Status,
+			"remarks": tplValue.Remarks,
+		}).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("更新通知模版失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, tplValue, "更新通知模版成功")
+}
+
+// 删除通知模版
+func DeleteNotifyTemplate(c *gin.Context) {
+	templateId := c.DefaultQuery("templateId", "")
+	if templateId == "" {
+		app.Error(c, -1, errors.New("参数传递失败，请确认templateId是否传递"), "")
+		return
+	}
+
+	err := orm.Eloquent.Delete(process2.NotifyTemplate{}, "id = ?", templateId).Error
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	app.OK(c, "", "删除通知模版成功")
+}
+
+// 使用工单数据预览通知模版，模版内容为空时预览渠道的默认模版
+func PreviewNotifyTemplate(c *gin.Context) {
+	var (
+		err      error
+		bodyData *notify.BodyData
+		params   struct {
+			process2.NotifyTemplate
+			WorkOrder int `json:"work_order" form:"work_order"`
+		}
+	)
+
+	err = c.ShouldBind(&params)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+	if params.WorkOrder == 0 {
+		app.Error(c, -1, errors.New("请选择用于预览的工单"), "")
+		return
+	}
+
+	if params.Content != "" {
+		err = validateNotifyTemplate(&params.NotifyTemplate)
+		if err != nil {
+			app.Error(c, -1, err, "")
+			return
+		}
+	}
+
+	bodyData, err = service.WorkOrderNotifyData(orm.Eloquent, params.WorkOrder)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+	bodyData.Subject = "您有一条待办工单，请及时处理"
+	bodyData.Description = "您有一条待办工单请及时处理，工单描述如下"
+	bodyData.Event = params.Event
+
+	err = bodyData.Preview(params.Channel, &params.NotifyTemplate)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("模版渲染失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, map[string]interface{}{
+		"subject": bodyData.Subject,
+		"content": bodyData.Content,
+	}, "")
+}
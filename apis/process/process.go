@@ -1,11 +1,14 @@
 package process
 
 import (
+	"encoding/json"
 	"errors"
 	"ferry/global/orm"
 	"ferry/models/process"
 	process2 "ferry/models/process"
+	"ferry/pkg/notify"
 	"ferry/pkg/pagination"
+	"ferry/pkg/service"
 	"ferry/tools"
 	"ferry/tools/app"
 	"fmt"
@@ -77,14 +80,39 @@ func CreateProcess(c *gin.Context) {
 		return
 	}
 
+	// 校验流程结构
+	err = validateProcessStructure(processValue.Structure)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	// 校验通知配置
+	_, err = notify.ParseNotice(processValue.Notice)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
 	processValue.Creator = tools.GetUserId(c)
 
-	err = orm.Eloquent.Create(&processValue).Error
+	tx := orm.Eloquent.Begin()
+	err = tx.Create(&processValue).Error
 	if err != nil {
+		tx.Rollback()
 		app.Error(c, -1, err, fmt.Sprintf("创建流程失败，%v", err.Error()))
 		return
 	}
 
+	// 生成流程的第一个版本
+	_, err = service.PublishVersion(tx, &processValue, tools.GetUserId(c))
+	if err != nil {
+		tx.Rollback()
+		app.Error(c, -1, err, "")
+		return
+	}
+	tx.Commit()
+
 	app.OK(c, processValue, "流程创建成功")
 }
 
@@ -101,7 +129,31 @@ func UpdateProcess(c *gin.Context) {
 		return
 	}
 
-	err = orm.Eloquent.Model(&process2.Info{}).
+	// 校验流程结构
+	err = validateProcessStructure(processValue.Structure)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	// 校验通知配置
+	_, err = notify.ParseNotice(processValue.Notice)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	tx := orm.Eloquent.Begin()
+
+	// 流程定义发生变化时生成新版本，进行中的工单继续使用原有的版本
+	_, err = service.PublishVersion(tx, &processValue, tools.GetUserId(c))
+	if err != nil {
+		tx.Rollback()
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = tx.Model(&process2.Info{}).
 		Where("id = ?", processValue.Id).
 		Updates(map[string]interface{}{
 			"name":      processValue.Name,
@@ -110,17 +162,72 @@ func UpdateProcess(c *gin.Context) {
 			"classify":  processValue.Classify,
 			"task":      processValue.Task,
 			"notice":    processValue.Notice,
+			"withdraw":  processValue.Withdraw,
 			"icon":      processValue.Icon,
 			"remarks":   processValue.Remarks,
 		}).Error
 	if err != nil {
+		tx.Rollback()
 		app.Error(c, -1, err, fmt.Sprintf("更新流程信息失败，%v", err.Error()))
 		return
 	}
+	tx.Commit()
 
 	app.OK(c, processValue, "更新流程信息成功")
 }
 
+// 保存流程时校验流程结构，未设计流程结构时不校验
+func validateProcessStructure(structure json.RawMessage) (err error) {
+	if len(structure) == 0 || string(structure) == "null" || string(structure) == "{}" {
+		return
+	}
+	_, err = service.ValidateStructure(structure)
+	return
+}
+
+// 校验流程结构
+func ValidateProcess(c *gin.Context) {
+	var (
+		err    error
+		params struct {
+			Structure json.RawMessage `json:"structure" form:"structure"`
+		}
+		result = map[string]interface{}{
+			"valid": true,
+			"items": []*process2.StructureErrorItem{},
+			"nodes": []string{},
+			"edges": []string{},
+		}
+	)
+
+	err = c.ShouldBind(&params)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("参数绑定失败，%v", err.Error()))
+		return
+	}
+
+	_, err = service.ValidateStructure(params.Structure)
+	if err != nil {
+		structureErr, ok := err.(*process2.StructureError)
+		if !ok {
+			app.Error(c, -1, err, fmt.Sprintf("校验流程结构失败，%v", err.Error()))
+			return
+		}
+		result["valid"] = false
+		result["items"] = structureErr.Items
+		if nodeIds := structureErr.NodeIds(); len(nodeIds) > 0 {
+			result["nodes"] = nodeIds
+		}
+		if edgeIds := structureErr.EdgeIds(); len(edgeIds) > 0 {
+			result["edges"] = edgeIds
+		}
+		app.OK(c, result, structureErr.Error())
+		return
+	}
+
+	app.OK(c, result, "流程结构校验通过")
+}
+
 // 删除流程
 func DeleteProcess(c *gin.Context) {
 	processId := c.DefaultQuery("processId", "")
@@ -223,7 +330,7 @@ func CloneProcess(c *gin.Context) {
 		return
 	}
 
-	err = orm.Eloquent.Create(&process.Info{
+	newInfo := process.Info{
 		Name:        info.Name + "-copy",
 		Icon:        info.Icon,
 		Structure:   info.Structure,
@@ -234,11 +341,50 @@ func CloneProcess(c *gin.Context) {
 		Creator:     tools.GetUserId(c),
 		Notice:      info.Notice,
 		Remarks:     info.Remarks,
-	}).Error
+	}
+
+	tx := orm.Eloquent.Begin()
+	err = tx.Create(&newInfo).Error
 	if err != nil {
+		tx.Rollback()
 		app.Error(c, -1, err, "克隆流程失败")
 		return
 	}
 
+	// 生成克隆流程的第一个版本
+	_, err = service.PublishVersion(tx, &newInfo, tools.GetUserId(c))
+	if err != nil {
+		tx.Rollback()
+		app.Error(c, -1, err, "")
+		return
+	}
+	tx.Commit()
+
 	app.OK(c, nil, "")
 }
+
+// 模拟工单流转，不写入任何数据
+func SimulateProcess(c *gin.Context) {
+	var (
+		err    error
+		params service.SimulateParams
+		result *service.SimulateResult
+	)
+
+	err = c.ShouldBind(&params)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("参数绑定失败，%v", err.Error()))
+		return
+	}
+	if params.Creator == 0 {
+		params.Creator = tools.GetUserId(c)
+	}
+
+	result, err = service.SimulateProcess(&params)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("模拟流转失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, result, "")
+}
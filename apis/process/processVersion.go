@@ -0,0 +1,73 @@
+package process
+
+import (
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/pkg/engine"
+	"ferry/tools"
+	"ferry/tools/app"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 流程版本列表
+func ProcessVersionList(c *gin.Context) {
+	var (
+		err         error
+		versionList []*process.Version
+	)
+
+	processId, _ := strconv.Atoi(c.DefaultQuery("processId", "0"))
+	if processId == 0 {
+		app.Error(c, -1, errors.New("参数不正确，请确定参数processId是否传递"), "")
+		return
+	}
+
+	err = orm.Eloquent.Model(&process.Version{}).
+		Select("id, process, version, creator, remarks, create_time, update_time").
+		Where("process = ?", processId).
+		Order("version desc").
+		Find(&versionList).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询流程版本失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, versionList, "")
+}
+
+// 将未结束的工单迁移到流程的新版本
+func MigrateWorkOrderVersion(c *gin.Context) {
+	var (
+		err   error
+		actor *engine.Actor
+		cmd   engine.MigrateCommand
+	)
+
+	err = c.ShouldBind(&cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	actor, err = engine.LoadActor(tools.GetUserId(c))
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = engine.MigrateWorkOrders(actor, &cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	app.OK(c, nil, "工单迁移成功")
+}
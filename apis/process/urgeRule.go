@@ -0,0 +1,136 @@
+package process
+
+import (
+	"errors"
+	"ferry/global/orm"
+	process2 "ferry/models/process"
+	"ferry/pkg/pagination"
+	"ferry/tools"
+	"ferry/tools/app"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 催办规则列表
+func UrgeRuleList(c *gin.Context) {
+	var (
+		err      error
+		ruleList []*struct {
+			process2.UrgeRule
+			ProcessName string `json:"process_name"`
+			CreateName  string `json:"create_name"`
+		}
+	)
+
+	SearchParams := map[string]map[string]interface{}{
+		"like": pagination.RequestParams(c),
+	}
+
+	db := orm.Eloquent.Model(&process2.UrgeRule{}).
+		Joins("left join p_process_info on p_process_info.id = p_urge_rule.process").
+		Joins("left join sys_user on sys_user.user_id = p_urge_rule.creator").
+		Select("p_urge_rule.*, p_process_info.name as process_name, sys_user.nick_name as create_name").
+		Where("p_urge_rule.`delete_time` IS NULL")
+
+	result, err := pagination.Paging(&pagination.Param{
+		C:  c,
+		DB: db,
+	}, &ruleList, SearchParams, "p_urge_rule")
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询催办规则失败，%v", err.Error()))
+		return
+	}
+	app.OK(c, result, "查询催办规则成功")
+}
+
+// 创建催办规则
+func CreateUrgeRule(c *gin.Context) {
+	var (
+		err       error
+		ruleValue process2.UrgeRule
+	)
+
+	err = c.ShouldBind(&ruleValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = ruleValue.Validate()
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	ruleValue.Creator = tools.GetUserId(c)
+
+	err = orm.Eloquent.Create(&ruleValue).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("创建催办规则失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, ruleValue, "创建催办规则成功")
+}
+
+// 更新催办规则
+func UpdateUrgeRule(c *gin.Context) {
+	var (
+		err       error
+		ruleValue process2.UrgeRule
+	)
+
+	err = c.ShouldBind(&ruleValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = ruleValue.Validate()
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = orm.Eloquent.Model(&process2.UrgeRule{}).
+		Where("id = ?", ruleValue.Id).
+		Updates(map[string]interface{}{
+			"name":          ruleValue.Name,
+			"process":       ruleValue.Process,
+			"priority":      ruleValue.Priority,
+			"urge_interval": ruleValue.Interval,
+			"max_count":     ruleValue.MaxCount,
+			"quiet_start":   ruleValue.QuietStart,
+			"quiet_end":     ruleValue.QuietEnd,
+			"status":        ruleValue.Status,
+			"remarks":       ruleValue.Remarks,
+		}).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("更新催办规则失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, ruleValue, "更新催办规则成功")
+}
+
+// 删除催办规则
+func DeleteUrgeRule(c *gin.Context) {
+	ruleId := c.DefaultQuery("ruleId", "")
+	if ruleId == "" {
+		app.Error(c, -1, errors.New("参数传递失败，请确认ruleId是否传递"), "")
+		return
+	}
+
+	err := orm.Eloquent.Delete(process2.UrgeRule{}, "id = ?", ruleId).Error
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	app.OK(c, "", "删除催办规则成功")
+}
@@ -6,8 +6,7 @@ import (
 	"errors"
 	"ferry/global/orm"
 	"ferry/models/process"
-	"ferry/models/system"
-	"ferry/pkg/notify"
+	"ferry/pkg/engine"
 	"ferry/pkg/pagination"
 	"ferry/pkg/service"
 	"ferry/tools"
@@ -48,6 +47,7 @@ type ProjectListResult struct {
 	Process       int             `gorm:"column:process" json:"processId"`
 	State         json.RawMessage `json:"state"`
 	IsEnd         int             `gorm:"column:is_end" json:"isEnd"`
+	IsWithdrawn   int             `gorm:"column:is_withdrawn" json:"isWithdrawn"`
 	RelatedPerson json.RawMessage `gorm:"column:related_person" json:"relatedPerson"`
 	Creator       int             `json:"creator"`
 	Classify      int             `json:"classify"`
@@ -67,7 +67,12 @@ func ProcessStructure(c *gin.Context) {
 	}
 	workOrderIdInt, _ := strconv.Atoi(workOrderId)
 	processIdInt, _ := strconv.Atoi(processId)
-	result, err := service.ProcessStructure(c, processIdInt, workOrderIdInt)
+	actor, err := engine.LoadActor(tools.GetUserId(c))
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+	result, err := service.ProcessStructure(actor, processIdInt, workOrderIdInt)
 	if err != nil {
 		app.Error(c, -1, err, "")
 		return
@@ -75,9 +80,9 @@ func ProcessStructure(c *gin.Context) {
 
 	if workOrderIdInt != 0 {
 		currentState := result["workOrder"].(service.WorkOrderData).CurrentState
-		userAuthority, err := service.JudgeUserAuthority(c, workOrderIdInt, currentState)
+		userAuthority, err := engine.Authorize(actor, workOrderIdInt, currentState)
 		if err != nil {
-			app.Error(c, -1, err, fmt.Sprintf("判断用户是否有权限失败，%v", err.Error()))
+			app.Error(c, -1, err, "")
 			return
 		}
 		result["userAuthority"] = userAuthority
@@ -88,8 +93,21 @@ func ProcessStructure(c *gin.Context) {
 
 // 新建工单
 func CreateWorkOrder(c *gin.Context) {
+	var params engine.CreateCommand
 
-	err := service.CreateWorkOrder(c)
+	err := c.ShouldBind(&params)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	actor, err := engine.LoadActor(tools.GetUserId(c))
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	_, err = engine.CreateWorkOrder(actor, &params)
 	if err != nil {
 		app.Error(c, -1, err, "")
 		return
@@ -136,20 +154,9 @@ func WorkOrderList(c *gin.Context) {
 // 处理工单
 func ProcessWorkOrder(c *gin.Context) {
 	var (
-		err           error
-		userAuthority bool
-		handle        service.Handle
-		params        struct {
-			Tasks          []string
-			TargetState    string                   `json:"target_state"`    // 目标状态
-			SourceState    string                   `json:"source_state"`    // 源状态
-			WorkOrderId    int                      `json:"work_order_id"`   // 工单ID
-			Circulation    string                   `json:"circulation"`     // 流转ID
-			FlowProperties int                      `json:"flow_properties"` // 流转类型 0 拒绝，1 同意，2 其他
-			Remarks        string                   `json:"remarks"`         // 处理的备注信息
-			Tpls           []map[string]interface{} `json:"tpls"`            // 表单数据
-			IsExecTask     bool                     `json:"is_exec_task"`    // 是否执行任务
-		}
+		err    error
+		actor  *engine.Actor
+		params engine.HandleCommand
 	)
 
 	err = c.ShouldBind(&params)
@@ -158,31 +165,16 @@ func ProcessWorkOrder(c *gin.Context) {
 		return
 	}
 
-	// 处理工单
-	userAuthority, err = service.JudgeUserAuthority(c, params.WorkOrderId, params.SourceState)
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("判断用户是否有权限失败，%v", err.Error()))
-		return
-	}
-	if !userAuthority {
-		app.Error(c, -1, errors.New("当前用户没有权限进行此操作"), "")
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	err = handle.HandleWorkOrder(
-		c,
-		params.WorkOrderId,    // 工单ID
-		params.Tasks,          // 任务列表
-		params.TargetState,    // 目标节点
-		params.SourceState,    // 源节点
-		params.Circulation,    // 流转标题
-		params.FlowProperties, // 流转属性
-		params.Remarks,        // 备注信息
-		params.Tpls,           // 工单数据更新
-		params.IsExecTask,     // 是否执行任务
-	)
+	// 处理工单
+	err = engine.HandleWorkOrder(actor, &params)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("处理工单失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
@@ -192,200 +184,174 @@ func ProcessWorkOrder(c *gin.Context) {
 // 结束工单
 func UnityWorkOrder(c *gin.Context) {
 	var (
-		err           error
-		workOrderId   string
-		workOrderInfo process.WorkOrderInfo
-		userInfo      system.SysUser
+		err   error
+		actor *engine.Actor
+		cmd   engine.WorkOrderCommand
 	)
 
-	workOrderId = c.DefaultQuery("work_oroder_id", "")
-	if workOrderId == "" {
+	cmd.WorkOrderId, err = strconv.Atoi(c.DefaultQuery("work_oroder_id", ""))
+	if err != nil {
 		app.Error(c, -1, errors.New("参数不正确，work_oroder_id"), "")
 		return
 	}
-
-	tx := orm.Eloquent.Begin()
-
-	// 查询工单信息
-	err = tx.Model(&workOrderInfo).
-		Where("id = ?", workOrderId).
-		Find(&workOrderInfo).Error
+	cmd.Version, err = queryVersion(c)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("查询工单失败，%v", err.Error()))
-		return
-	}
-	if workOrderInfo.IsEnd == 1 {
-		app.Error(c, -1, errors.New("工单已结束"), "")
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 更新工单状态
-	err = tx.Model(&process.WorkOrderInfo{}).
-		Where("id = ?", workOrderId).
-		Update("is_end", 1).
-		Error
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
-		tx.Rollback()
-		app.Error(c, -1, err, fmt.Sprintf("结束工单失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 获取当前用户信息
-	err = tx.Model(&userInfo).
-		Where("user_id = ?", tools.GetUserId(c)).
-		Find(&userInfo).Error
+	err = engine.EndWorkOrder(actor, &cmd)
 	if err != nil {
-		tx.Rollback()
-		app.Error(c, -1, err, fmt.Sprintf("当前用户查询失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 写入历史
-	tx.Create(&process.CirculationHistory{
-		Title:       workOrderInfo.Title,
-		WorkOrder:   workOrderInfo.Id,
-		State:       "结束工单",
-		Circulation: "工单结束",
-		Processor:   userInfo.NickName,
-		ProcessorId: tools.GetUserId(c),
-		Remarks:     "手动结束工单。",
-		Status:      2,
-	})
-
-	tx.Commit()
-
 	app.OK(c, nil, "工单已结束")
 }
 
 // 转交工单
 func InversionWorkOrder(c *gin.Context) {
 	var (
-		cirHistoryValue   []process.CirculationHistory
-		err               error
-		workOrderInfo     process.WorkOrderInfo
-		stateList         []map[string]interface{}
-		stateValue        []byte
-		currentState      map[string]interface{}
-		userInfo          system.SysUser
-		currentUserInfo   system.SysUser
-		costDurationValue int64
-		handle            service.Handle
-		params            struct {
-			WorkOrderId int    `json:"work_order_id"`
-			NodeId      string `json:"node_id"`
-			UserId      int    `json:"user_id"`
-			Remarks     string `json:"remarks"`
-		}
+		err   error
+		actor *engine.Actor
+		cmd   engine.InversionCommand
 	)
 
-	// 获取当前用户信息
-	err = orm.Eloquent.Model(&currentUserInfo).
-		Where("user_id = ?", tools.GetUserId(c)).
-		Find(&currentUserInfo).Error
+	err = c.ShouldBind(&cmd)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("当前用户查询失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	err = c.ShouldBind(&params)
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
 		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 查询工单信息
-	err = orm.Eloquent.Model(&workOrderInfo).
-		Where("id = ?", params.WorkOrderId).
-		Find(&workOrderInfo).Error
+	err = engine.InversionWorkOrder(actor, &cmd)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("查询工单信息失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 序列化节点数据
-	err = json.Unmarshal(workOrderInfo.State, &stateList)
+	app.OK(c, nil, "工单已手动结单")
+}
+
+// 可退回的节点
+func ReturnableNodes(c *gin.Context) {
+	workOrderId, err := strconv.Atoi(c.DefaultQuery("work_order_id", ""))
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("节点数据反序列化失败，%v", err.Error()))
+		app.Error(c, -1, errors.New("参数不正确，work_order_id"), "")
 		return
 	}
 
-	for _, s := range stateList {
-		if s["id"].(string) == params.NodeId {
-			s["processor"] = []interface{}{params.UserId}
-			s["process_method"] = "person"
-			currentState = s
-			break
-		}
+	nodeList, err := service.ReturnableNodes(orm.Eloquent, workOrderId)
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("查询可退回的节点失败，%v", err.Error()))
+		return
 	}
 
-	stateValue, err = json.Marshal(stateList)
+	app.OK(c, nodeList, "")
+}
+
+// 退回工单
+func ReturnWorkOrder(c *gin.Context) {
+	var (
+		err   error
+		actor *engine.Actor
+		cmd   engine.ReturnCommand
+	)
+
+	err = c.ShouldBind(&cmd)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("节点数据序列化失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	tx := orm.Eloquent.Begin()
+	actor, err = engine.LoadActor(tools.GetUserId(c))
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
 
-	// 更新数据
-	err = tx.Model(&process.WorkOrderInfo{}).
-		Where("id = ?", params.WorkOrderId).
-		Update("state", stateValue).Error
+	err = engine.ReturnWorkOrder(actor, &cmd)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("更新节点信息失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 查询用户信息
-	err = tx.Model(&system.SysUser{}).
-		Where("user_id = ?", params.UserId).
-		Find(&userInfo).Error
+	app.OK(c, nil, "工单已退回")
+}
+
+// 加签
+func AddSigner(c *gin.Context) {
+	var (
+		err   error
+		actor *engine.Actor
+		cmd   engine.AddSignerCommand
+	)
+
+	err = c.ShouldBind(&cmd)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("查询用户信息失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 流转历史写入
-	err = orm.Eloquent.Model(&cirHistoryValue).
-		Where("work_order = ?", params.WorkOrderId).
-		Find(&cirHistoryValue).
-		Order("create_time desc").Error
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
-		tx.Rollback()
+		app.Error(c, -1, err, "")
 		return
 	}
-	for _, t := range cirHistoryValue {
-		if t.Source != currentState["id"].(string) {
-			costDuration := time.Since(t.CreatedAt.Time)
-			costDurationValue = int64(costDuration) / 1000 / 1000 / 1000
-		}
+
+	err = engine.AddSigner(actor, &cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
 	}
 
-	// 添加转交历史
-	tx.Create(&process.CirculationHistory{
-		Title:        workOrderInfo.Title,
-		WorkOrder:    workOrderInfo.Id,
-		State:        currentState["label"].(string),
-		Circulation:  "转交工单",
-		Processor:    currentUserInfo.NickName,
-		ProcessorId:  tools.GetUserId(c),
-		Remarks:      fmt.Sprintf("此阶段负责人已转交给《%v》", userInfo.NickName),
-		Status:       2, // 其他
-		CostDuration: costDurationValue,
-	})
+	app.OK(c, nil, "加签成功")
+}
+
+// 撤回工单
+func WithdrawWorkOrder(c *gin.Context) {
+	var (
+		err   error
+		actor *engine.Actor
+		cmd   engine.WithdrawCommand
+	)
 
-	tx.Commit()
+	err = c.ShouldBind(&cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
 
-	handle.SendEmail(workOrderInfo.Id)
-	app.OK(c, nil, "工单已手动结单")
+	actor, err = engine.LoadActor(tools.GetUserId(c))
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = engine.WithdrawWorkOrder(actor, &cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	app.OK(c, nil, "工单已撤回")
 }
 
 // 催办工单
 func UrgeWorkOrder(c *gin.Context) {
 	var (
-		workOrderInfo  process.WorkOrderInfo
-		sendToUserList []system.SysUser
-		stateList      []interface{}
-		userInfo       system.SysUser
+		workOrderInfo process.WorkOrderInfo
 	)
 	workOrderId := c.DefaultQuery("workOrderId", "")
 	if workOrderId == "" {
@@ -406,39 +372,10 @@ func UrgeWorkOrder(c *gin.Context) {
 		return
 	}
 
-	// 获取当前工单处理人信息
-	err = json.Unmarshal(workOrderInfo.State, &stateList)
-	if err != nil {
-		app.Error(c, -1, err, "")
-		return
-	}
-	sendToUserList, err = service.GetPrincipalUserInfo(stateList, workOrderInfo.Creator)
-
-	// 查询创建人信息
-	err = orm.Eloquent.Model(&system.SysUser{}).Where("user_id = ?", workOrderInfo.Creator).Find(&userInfo).Error
-	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("创建人信息查询失败，%v", err.Error()))
-		return
-	}
-
 	// 发送催办提醒
-	bodyData := notify.BodyData{
-		SendTo: map[string]interface{}{
-			"userList": sendToUserList,
-		},
-		Subject:     "您被催办工单了，请及时处理。",
-		Description: "您有一条待办工单，请及时处理，工单描述如下",
-		Classify:    []int{1}, // todo 1 表示邮箱，后续添加了其他的在重新补充
-		ProcessId:   workOrderInfo.Process,
-		Id:          workOrderInfo.Id,
-		Title:       workOrderInfo.Title,
-		Creator:     userInfo.NickName,
-		Priority:    workOrderInfo.Priority,
-		CreatedAt:   workOrderInfo.CreatedAt.Format("2006-01-02 15:04:05"),
-	}
-	err = bodyData.SendNotify()
+	err = service.SendUrgeNotify(&workOrderInfo, "您被催办工单了，请及时处理。")
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("催办提醒发送失败，%v", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
@@ -458,153 +395,133 @@ func UrgeWorkOrder(c *gin.Context) {
 // 主动处理
 func ActiveOrder(c *gin.Context) {
 	var (
-		workOrderId string
-		err         error
-		stateValue  []struct {
-			ID            string `json:"id"`
-			Label         string `json:"label"`
-			ProcessMethod string `json:"process_method"`
-			Processor     []int  `json:"processor"`
-		}
-		stateValueByte []byte
+		err   error
+		actor *engine.Actor
+		cmd   engine.ClaimCommand
 	)
 
-	workOrderId = c.Param("id")
-
-	err = c.ShouldBind(&stateValue)
+	cmd.WorkOrderId, err = strconv.Atoi(c.Param("id"))
 	if err != nil {
-		app.Error(c, -1, err, "")
+		app.Error(c, -1, errors.New("参数不正确，请确认"), "")
 		return
 	}
-
-	stateValueByte, err = json.Marshal(stateValue)
+	cmd.NodeId = c.DefaultQuery("node_id", "")
+	cmd.Version, err = queryVersion(c)
 	if err != nil {
-		app.Error(c, -1, fmt.Errorf("转byte失败，%v", err.Error()), "")
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	err = orm.Eloquent.Model(&process.WorkOrderInfo{}).
-		Where("id = ?", workOrderId).
-		Update("state", stateValueByte).Error
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
-		app.Error(c, -1, fmt.Errorf("接单失败，%v", err.Error()), "")
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	app.OK(c, "", "接单成功，请及时处理")
-}
-
-// 删除工单
-func DeleteWorkOrder(c *gin.Context) {
-
-	workOrderId := c.Param("id")
-
-	err := orm.Eloquent.Delete(&process.WorkOrderInfo{}, workOrderId).Error
+	err = engine.ClaimWorkOrder(actor, &cmd)
 	if err != nil {
 		app.Error(c, -1, err, "")
 		return
 	}
 
-	app.OK(c, "", "工单已删除")
+	app.OK(c, "", "接单成功，请及时处理")
 }
 
-// 重开工单
-func ReopenWorkOrder(c *gin.Context) {
+// 释放认领的工单
+func ReleaseOrder(c *gin.Context) {
 	var (
-		err           error
-		id            string
-		workOrder     process.WorkOrderInfo
-		processInfo   process.Info
-		structure     map[string]interface{}
-		startId       string
-		label         string
-		jsonState     []byte
-		relatedPerson []byte
-		newWorkOrder  process.WorkOrderInfo
-		workOrderData []*process.TplData
+		err         error
+		workOrderId int
+		actor       *engine.Actor
+		cmd         engine.ClaimCommand
 	)
 
-	id = c.Param("id")
-
-	// 查询当前ID的工单信息
-	err = orm.Eloquent.Find(&workOrder, id).Error
+	workOrderId, err = strconv.Atoi(c.Param("id"))
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("查询工单信息失败, %s", err.Error()))
+		app.Error(c, -1, errors.New("参数不正确，请确认"), "")
 		return
 	}
 
-	// 创建新的工单
-	err = orm.Eloquent.Find(&processInfo, workOrder.Process).Error
+	err = c.ShouldBind(&cmd)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("查询流程信息失败, %s", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
-	err = json.Unmarshal(processInfo.Structure, &structure)
+	cmd.WorkOrderId = workOrderId
+
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("Json序列化失败, %s", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
-	for _, node := range structure["nodes"].([]interface{}) {
-		if node.(map[string]interface{})["clazz"] == "start" {
-			startId = node.(map[string]interface{})["id"].(string)
-			label = node.(map[string]interface{})["label"].(string)
-		}
+
+	err = engine.ReleaseWorkOrder(actor, &cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
 	}
 
-	state := []map[string]interface{}{
-		{"id": startId, "label": label, "processor": []int{tools.GetUserId(c)}, "process_method": "person"},
+	app.OK(c, "", "工单已释放")
+}
+
+// 客户端读取到的工单版本，未传入时不校验
+func queryVersion(c *gin.Context) (version *int, err error) {
+	value := c.Query("version")
+	if value == "" {
+		return
 	}
-	jsonState, err = json.Marshal(state)
+	v, err := strconv.Atoi(value)
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("Json序列化失败, %s", err.Error()))
-		return
+		return nil, errors.New("工单版本不正确，请确认")
 	}
+	return &v, nil
+}
+
+// 删除工单
+func DeleteWorkOrder(c *gin.Context) {
 
-	relatedPerson, err = json.Marshal([]int{tools.GetUserId(c)})
+	workOrderId := c.Param("id")
+
+	err := orm.Eloquent.Delete(&process.WorkOrderInfo{}, workOrderId).Error
 	if err != nil {
-		app.Error(c, -1, err, fmt.Sprintf("Json序列化失败, %s", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	tx := orm.Eloquent.Begin()
+	app.OK(c, "", "工单已删除")
+}
+
+// 重开工单
+func ReopenWorkOrder(c *gin.Context) {
+	var (
+		err   error
+		actor *engine.Actor
+		cmd   engine.WorkOrderCommand
+	)
 
-	newWorkOrder = process.WorkOrderInfo{
-		Title:         workOrder.Title,
-		Priority:      workOrder.Priority,
-		Process:       workOrder.Process,
-		Classify:      workOrder.Classify,
-		State:         jsonState,
-		RelatedPerson: relatedPerson,
-		Creator:       tools.GetUserId(c),
+	cmd.WorkOrderId, err = strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.Error(c, -1, errors.New("参数不正确，请确认"), "")
+		return
 	}
-	err = tx.Create(&newWorkOrder).Error
+	cmd.Version, err = queryVersion(c)
 	if err != nil {
-		tx.Rollback()
-		app.Error(c, -1, err, fmt.Sprintf("新建工单失败, %s", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	// 查询工单数据
-	err = orm.Eloquent.Model(&process.TplData{}).Where("work_order = ?", id).Find(&workOrderData).Error
+	actor, err = engine.LoadActor(tools.GetUserId(c))
 	if err != nil {
-		tx.Rollback()
-		app.Error(c, -1, err, fmt.Sprintf("查询工单数据失败, %s", err.Error()))
+		app.Error(c, -1, err, "")
 		return
 	}
 
-	for _, d := range workOrderData {
-		d.WorkOrder = newWorkOrder.Id
-		d.Id = 0
-		err = tx.Create(d).Error
-		if err != nil {
-			tx.Rollback()
-			app.Error(c, -1, err, fmt.Sprintf("创建工单数据失败, %s", err.Error()))
-			return
-		}
+	_, err = engine.ReopenWorkOrder(actor, &cmd)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
 	}
 
-	tx.Commit()
-
 	app.OK(c, nil, "")
 }
 
@@ -637,6 +554,7 @@ func GetprojectList(c *gin.Context) {
 		p_work_order_info.process,
 		p_work_order_info.state,
 		p_work_order_info.is_end,
+		p_work_order_info.is_withdrawn,
 		p_work_order_info.related_person,
 		p_work_order_info.creator,
 		p_work_order_info.classify
@@ -3,11 +3,10 @@ package public
 
 import (
 	"encoding/json"
+	"ferry/pkg/notify/sms"
 	"fmt"
-	"os"
 	"strings"
 
-	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
 	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
 	console "github.com/alibabacloud-go/tea-console/client"
 	util "github.com/alibabacloud-go/tea-utils/v2/service"
@@ -22,19 +21,7 @@ import (
  * @throws Exception
  */
 func CreateClient() (_result *dysmsapi20170525.Client, _err error) {
-	// 工程代码泄露可能会导致 AccessKey 泄露，并威胁账号下所有资源的安全性。以下代码示例仅供参考。
-	// 建议使用更安全的 STS 方式，更多鉴权访问方式请参见：https://help.aliyun.com/document_detail/378661.html。
-	config := &openapi.Config{
-		// 必填，请确保代码运行环境设置了环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID。
-		AccessKeyId: tea.String(os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID")),
-		// 必填，请确保代码运行环境设置了环境变量 ALIBABA_CLOUD_ACCESS_KEY_SECRET。
-		AccessKeySecret: tea.String(os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET")),
-	}
-	// Endpoint 请参考 https://api.aliyun.com/product/Dysmsapi
-	config.Endpoint = tea.String("dysmsapi.aliyuncs.com")
-	_result = &dysmsapi20170525.Client{}
-	_result, _err = dysmsapi20170525.NewClient(config)
-	return _result, _err
+	return sms.CreateClient()
 }
 
 func _main(args []*string, phoneNumber string, msgCode string) (_err error) {
@@ -0,0 +1,110 @@
+package system
+
+import (
+	"ferry/global/orm"
+	"ferry/models/system"
+	"ferry/pkg/notify"
+	"ferry/tools"
+	"ferry/tools/app"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// @Summary 当前用户的通知偏好
+// @Description 获取JSON
+// @Tags 个人中心
+// @Success 200 {string} string "{"code": 200, "data": [...]}"
+// @Router /api/v1/user/notify-settings [get]
+// @Security Bearer
+func GetNotifySettings(c *gin.Context) {
+	var (
+		err     error
+		setting system.UserNotifySetting
+	)
+
+	err = orm.Eloquent.Model(&system.UserNotifySetting{}).
+		Where("user_id = ?", tools.GetUserId(c)).
+		Find(&setting).Error
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			app.Error(c, -1, err, fmt.Sprintf("查询通知偏好失败，%v", err.Error()))
+			return
+		}
+		setting.UserId = tools.GetUserId(c)
+	}
+
+	app.OK(c, map[string]interface{}{
+		"setting":  setting,
+		"channels": notify.NotifierList(),
+		"events":   notify.EventList,
+	}, "")
+}
+
+// @Summary 修改当前用户的通知偏好
+// @Description 获取JSON
+// @Tags 个人中心
+// @Success 200 {string} string "{"code": 200, "data": [...]}"
+// @Router /api/v1/user/notify-settings [put]
+// @Security Bearer
+func UpdateNotifySettings(c *gin.Context) {
+	var (
+		err          error
+		setting      system.UserNotifySetting
+		settingValue system.UserNotifySetting
+	)
+
+	err = c.ShouldBind(&settingValue)
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = settingValue.Parse()
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+	err = notify.ValidateChannels(settingValue.ChannelList())
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+	err = notify.ValidateEvents(settingValue.EventList())
+	if err != nil {
+		app.Error(c, -1, err, "")
+		return
+	}
+
+	err = orm.Eloquent.Model(&system.UserNotifySetting{}).
+		Where("user_id = ?", tools.GetUserId(c)).
+		Find(&setting).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		app.Error(c, -1, err, fmt.Sprintf("查询通知偏好失败，%v", err.Error()))
+		return
+	}
+
+	setting.UserId = tools.GetUserId(c)
+	setting.Channels = settingValue.Channels
+	setting.Events = settingValue.Events
+	setting.QuietStart = settingValue.QuietStart
+	setting.QuietEnd = settingValue.QuietEnd
+	setting.Digest = settingValue.Digest
+	setting.DigestTime = settingValue.DigestTime
+	if setting.Digest == system.DigestNone {
+		setting.LastDigest = nil
+	}
+
+	err = orm.Eloquent.Save(&setting).Error
+	if err != nil {
+		app.Error(c, -1, err, fmt.Sprintf("保存通知偏好失败，%v", err.Error()))
+		return
+	}
+
+	app.OK(c, setting, "通知偏好已保存")
+}
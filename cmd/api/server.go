@@ -4,7 +4,10 @@ import (
 	"context"
 	"ferry/database"
 	"ferry/global/orm"
+	"ferry/pkg/engine"
 	"ferry/pkg/logger"
+	"ferry/pkg/notify"
+	"ferry/pkg/service"
 	"ferry/pkg/task"
 	"ferry/router"
 	"ferry/tools"
@@ -58,6 +61,20 @@ func setup() {
 	database.Setup()
 	// 3. 启动异步任务队列
 	go task.Start()
+	// 4. 启动工单时效检查
+	go engine.StartSlaScheduler()
+	// 5. 启动自动催办
+	go service.StartUrgeScheduler()
+	// 6. 启动通知发送
+	go notify.StartOutboxWorker()
+	// 7. 启动汇总通知
+	go notify.StartDigestWorker()
+	// 8. 启动定时节点
+	go engine.StartTimerScheduler()
+	// 9. 释放超时的认领
+	go engine.StartClaimScheduler()
+	// 10. 启动阻塞任务节点
+	go engine.StartScriptScheduler()
 
 }
 
@@ -109,7 +126,7 @@ func run() error {
 	//	config2.ApplicationConfig.Port)
 	fmt.Printf("%s Enter Control + C Shutdown Server \r\n", tools.GetCurrntTimeStr())
 	// 等待中断信号以优雅地关闭服务器（设置 5 秒的超时时间）
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	fmt.Printf("%s Shutdown Server ... \r\n", tools.GetCurrntTimeStr())
@@ -21,6 +21,7 @@ func AutoMigrate(db *gorm.DB) error {
 		new(system.SysRole),
 		new(system.Post),
 		new(system.Settings),
+		new(system.UserNotifySetting),
 
 		// 流程中心
 		new(process.Classify),
@@ -29,7 +30,17 @@ func AutoMigrate(db *gorm.DB) error {
 		new(process.WorkOrderInfo),
 		new(process.TaskInfo),
 		new(process.Info),
+		new(process.Version),
 		new(process.History),
 		new(process.CirculationHistory),
+		new(process.UrgeRule),
+		new(process.WorkOrderTimer),
+		new(process.WorkOrderScript),
+		new(process.NotifyOutbox),
+		new(process.NotifyAttempt),
+		new(process.NotifyDigest),
+		new(process.NotifyTemplate),
+		new(process.DelegateRule),
+		new(process.AssigneeCursor),
 	).Error
 }
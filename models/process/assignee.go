@@ -0,0 +1,60 @@
+package process
+
+import (
+	"ferry/models/base"
+	"fmt"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 处理人解析配置
+*/
+
+// 角色成员分配方式
+const (
+	BalanceRoundRobin  = "roundRobin"  // 轮询
+	BalanceLeastLoaded = "leastLoaded" // 待办工单最少
+)
+
+// 处理人解析配置，部分处理人类型需要额外的配置
+type Assignee struct {
+	Field   string `json:"field"`   // 表单字段，formField 使用，字段值为用户ID或用户ID列表
+	Balance string `json:"balance"` // 分配方式，roleMember 使用，默认轮询
+}
+
+// 校验节点的处理人配置
+func (n *Node) ValidateAssignee() (err error) {
+	switch n.AssignType {
+	case "":
+		return fmt.Errorf("未配置处理人")
+	case AssignFormField:
+		if n.Assignee == nil || n.Assignee.Field == "" {
+			return fmt.Errorf("未配置选择处理人的表单字段")
+		}
+		return
+	case AssignRoleMember:
+		if n.Assignee != nil {
+			switch n.Assignee.Balance {
+			case "", BalanceRoundRobin, BalanceLeastLoaded:
+			default:
+				return fmt.Errorf("不支持的分配方式 %v", n.Assignee.Balance)
+			}
+		}
+	}
+	if len(n.AssignValue) == 0 {
+		return fmt.Errorf("未配置处理人")
+	}
+	return
+}
+
+// 角色成员轮询分配记录，记录节点上一次分配的处理人
+type AssigneeCursor struct {
+	base.Model
+	Process  int    `gorm:"column:process; type:int(11)" json:"process" form:"process"`    // 流程ID
+	Node     string `gorm:"column:node; type:varchar(128)" json:"node" form:"node"`        // 节点ID
+	Assignee int    `gorm:"column:assignee; type:int(11)" json:"assignee" form:"assignee"` // 上一次分配的处理人
+}
+
+func (AssigneeCursor) TableName() string {
+	return "p_assignee_cursor"
+}
@@ -20,6 +20,7 @@ type CirculationHistory struct {
 	Status       int    `gorm:"column:status; type: int(11)" json:"status" form:"status"`                      // 流转状态 1 同意， 0 拒绝， 2 其他
 	Processor    string `gorm:"column:processor; type: varchar(45)" json:"processor" form:"processor"`         // 处理人
 	ProcessorId  int    `gorm:"column:processor_id; type: int(11)" json:"processor_id" form:"processor_id"`    // 处理人ID
+	Delegator    int    `gorm:"column:delegator; type: int(11); default:0" json:"delegator" form:"delegator"`  // 委托人ID，代理他人处理时记录
 	CostDuration int64  `gorm:"column:cost_duration; type: int(11)" json:"cost_duration" form:"cost_duration"` // 处理时长
 	Remarks      string `gorm:"column:remarks; type: longtext" json:"remarks" form:"remarks"`                  // 备注
 }
@@ -27,3 +28,8 @@ type CirculationHistory struct {
 func (CirculationHistory) TableName() string {
 	return "p_work_order_circulation_history"
 }
+
+// 是否为指定用户的处理记录，包含他人代理处理的记录
+func (h *CirculationHistory) HandledBy(userId int) bool {
+	return userId != 0 && (h.ProcessorId == userId || h.Delegator == userId)
+}
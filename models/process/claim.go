@@ -0,0 +1,61 @@
+package process
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 角色、部门节点的认领
+*/
+
+// 认领信息，认领后节点的处理人为认领人，释放时恢复认领前的处理人
+type ClaimItem struct {
+	UserId        int    `json:"user_id"`        // 认领人
+	Processor     []int  `json:"processor"`      // 认领前的处理人
+	ProcessMethod string `json:"process_method"` // 认领前的处理人类型
+	ClaimedAt     int64  `json:"claimed_at"`     // 认领时间
+}
+
+// 是否为可认领的节点，处理人为角色或部门时可以认领
+func (s *StateItem) Claimable() bool {
+	return s.ProcessMethod == AssignRole || s.ProcessMethod == AssignDepartment
+}
+
+// 认领节点
+func (s *StateItem) ClaimBy(userId int, now time.Time) (err error) {
+	if s.Claim != nil {
+		return errors.New("节点已被认领")
+	}
+	if !s.Claimable() {
+		return errors.New("仅处理人为角色或部门的节点可以认领")
+	}
+	s.Claim = &ClaimItem{
+		UserId:        userId,
+		Processor:     s.Processor,
+		ProcessMethod: s.ProcessMethod,
+		ClaimedAt:     now.Unix(),
+	}
+	s.Processor = []int{userId}
+	s.ProcessMethod = AssignPerson
+	return
+}
+
+// 释放认领，恢复认领前的处理人
+func (s *StateItem) Release() {
+	if s.Claim == nil {
+		return
+	}
+	s.Processor = s.Claim.Processor
+	s.ProcessMethod = s.Claim.ProcessMethod
+	s.Claim = nil
+}
+
+// 认领是否已超时，timeout 为 0 时不会超时
+func (s *StateItem) ClaimExpired(now time.Time, timeout time.Duration) bool {
+	if s.Claim == nil || timeout <= 0 {
+		return false
+	}
+	return now.Sub(time.Unix(s.Claim.ClaimedAt, 0)) >= timeout
+}
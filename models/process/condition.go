@@ -0,0 +1,185 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流转条件表达式
+*/
+
+/*
+    -- 条件表达式 --
+	流转的 conditionExpression 为条件列表，列表中任意一个条件成立即视为流转成立（兼容原有格式）。
+
+	单个条件：{"key": "表单字段或工单信息", "sign": "判断符号", "value": "比较值", "type": "比较类型"}
+	条件分组：{"logic": "and/or", "conditions": [条件或条件分组]}
+
+    -- 工单信息 --
+	以 $ 开头的 key 表示引用工单信息，而非表单字段，支持的工单信息见 ConditionMetaKeys。
+
+    -- 比较类型 --
+	为空时根据表单数据自动判断，可选 string、number、date。
+*/
+
+const (
+	ConditionLogicAnd = "and"
+	ConditionLogicOr  = "or"
+
+	ConditionSignEq          = "=="
+	ConditionSignNe          = "!="
+	ConditionSignGt          = ">"
+	ConditionSignGte         = ">="
+	ConditionSignLt          = "<"
+	ConditionSignLte         = "<="
+	ConditionSignIn          = "in"
+	ConditionSignNotIn       = "notIn"
+	ConditionSignContains    = "contains"
+	ConditionSignNotContains = "notContains"
+	ConditionSignRegex       = "regex"
+	ConditionSignEmpty       = "empty"
+	ConditionSignNotEmpty    = "notEmpty"
+
+	ConditionTypeString = "string"
+	ConditionTypeNumber = "number"
+	ConditionTypeDate   = "date"
+
+	// 引用工单信息的前缀
+	ConditionMetaPrefix = "$"
+)
+
+// 支持的判断符号，兼容 "not in"、"not contains" 等写法
+var conditionSignAlias = map[string]string{
+	ConditionSignEq:          ConditionSignEq,
+	ConditionSignNe:          ConditionSignNe,
+	ConditionSignGt:          ConditionSignGt,
+	ConditionSignGte:         ConditionSignGte,
+	ConditionSignLt:          ConditionSignLt,
+	ConditionSignLte:         ConditionSignLte,
+	ConditionSignIn:          ConditionSignIn,
+	ConditionSignNotIn:       ConditionSignNotIn,
+	"not in":                 ConditionSignNotIn,
+	ConditionSignContains:    ConditionSignContains,
+	ConditionSignNotContains: ConditionSignNotContains,
+	"not contains":           ConditionSignNotContains,
+	ConditionSignRegex:       ConditionSignRegex,
+	ConditionSignEmpty:       ConditionSignEmpty,
+	ConditionSignNotEmpty:    ConditionSignNotEmpty,
+	"not empty":              ConditionSignNotEmpty,
+}
+
+// 条件中可引用的工单信息
+var ConditionMetaKeys = map[string]string{
+	"$title":             "工单标题",
+	"$priority":          "工单优先级",
+	"$process":           "流程ID",
+	"$classify":          "流程分类ID",
+	"$created_at":        "工单创建时间",
+	"$creator":           "创建人ID",
+	"$creator_name":      "创建人名称",
+	"$creator_dept":      "创建人部门ID",
+	"$creator_dept_name": "创建人部门名称",
+	"$creator_role":      "创建人角色ID",
+	"$creator_role_name": "创建人角色名称",
+	"$creator_role_key":  "创建人角色标识",
+	"$creator_post":      "创建人岗位ID",
+}
+
+// 流转条件
+type Condition struct {
+	Key        string       `json:"key,omitempty"`        // 表单字段或以 $ 开头的工单信息
+	Sign       string       `json:"sign,omitempty"`       // 判断符号
+	Value      interface{}  `json:"value,omitempty"`      // 比较值
+	Type       string       `json:"type,omitempty"`       // 比较类型
+	Logic      string       `json:"logic,omitempty"`      // 条件分组的逻辑关系，and 或 or
+	Conditions []*Condition `json:"conditions,omitempty"` // 条件分组
+
+	regex *regexp.Regexp
+}
+
+// 是否为条件分组
+func (c *Condition) IsGroup() bool {
+	return c.Logic != "" || len(c.Conditions) > 0
+}
+
+// 是否引用工单信息
+func (c *Condition) IsMeta() bool {
+	return strings.HasPrefix(c.Key, ConditionMetaPrefix)
+}
+
+// 正则表达式，仅在判断符号为 regex 时有效
+func (c *Condition) Regexp() *regexp.Regexp {
+	return c.regex
+}
+
+// 校验并规范化条件
+func (c *Condition) normalize() (err error) {
+	if c.IsGroup() {
+		c.Logic = strings.ToLower(strings.TrimSpace(c.Logic))
+		if c.Logic == "" {
+			c.Logic = ConditionLogicAnd
+		}
+		if c.Logic != ConditionLogicAnd && c.Logic != ConditionLogicOr {
+			return fmt.Errorf("不支持的条件逻辑关系 %v", c.Logic)
+		}
+		if len(c.Conditions) == 0 {
+			return fmt.Errorf("条件分组不能为空")
+		}
+		for _, condition := range c.Conditions {
+			if condition == nil {
+				return fmt.Errorf("条件分组中存在空条件")
+			}
+			err = condition.normalize()
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	if c.Key == "" || c.Sign == "" {
+		return fmt.Errorf("条件表达式缺少判断字段或判断符号")
+	}
+	if c.IsMeta() {
+		if _, ok := ConditionMetaKeys[c.Key]; !ok {
+			return fmt.Errorf("不支持的工单信息 %v", c.Key)
+		}
+	}
+
+	sign, ok := conditionSignAlias[strings.TrimSpace(c.Sign)]
+	if !ok {
+		return fmt.Errorf("条件表达式中不支持的判断符号 %v", c.Sign)
+	}
+	c.Sign = sign
+
+	switch c.Type {
+	case "", ConditionTypeString, ConditionTypeNumber, ConditionTypeDate:
+	default:
+		return fmt.Errorf("条件 %v 不支持的比较类型 %v", c.Key, c.Type)
+	}
+
+	switch c.Sign {
+	case ConditionSignIn, ConditionSignNotIn:
+		if _, ok := c.Value.([]interface{}); !ok {
+			return fmt.Errorf("条件 %v 的比较值必须为列表", c.Key)
+		}
+	case ConditionSignRegex:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return fmt.Errorf("条件 %v 的正则表达式必须为字符串", c.Key)
+		}
+		c.regex, err = regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("条件 %v 的正则表达式不正确，%v", c.Key, err.Error())
+		}
+	case ConditionSignEmpty, ConditionSignNotEmpty:
+	default:
+		if c.Value == nil {
+			return fmt.Errorf("条件 %v 缺少比较值", c.Key)
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package process
+
+import (
+	"fmt"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 会签策略
+*/
+
+// 会签策略
+const (
+	CounterSignAll        = "all"        // 所有处理人均需同意
+	CounterSignAny        = "any"        // 任意一个处理人同意即可
+	CounterSignPercent    = "percent"    // 同意的处理人达到指定比例
+	CounterSignQuorum     = "quorum"     // 同意的处理人达到指定人数
+	CounterSignSequential = "sequential" // 按照处理人的顺序依次处理
+)
+
+// 会签配置，未配置时所有处理人均需同意，且任意处理人拒绝时节点直接按照拒绝的流转流转
+type CounterSign struct {
+	Strategy string `json:"strategy"` // 会签策略
+	Percent  int    `json:"percent"`  // 同意比例，1-100，percent 策略使用
+	Count    int    `json:"count"`    // 同意人数，quorum 策略使用
+	Veto     bool   `json:"veto"`     // 一票否决，开启后任意处理人拒绝时节点直接按照拒绝的流转流转
+}
+
+var defaultCounterSign = &CounterSign{
+	Strategy: CounterSignAll,
+	Veto:     true,
+}
+
+func (s *CounterSign) validate() (err error) {
+	if s == nil {
+		return
+	}
+	switch s.Strategy {
+	case "", CounterSignAll, CounterSignAny, CounterSignSequential:
+	case CounterSignPercent:
+		if s.Percent <= 0 || s.Percent > 100 {
+			return fmt.Errorf("会签同意比例需要在 1 到 100 之间")
+		}
+	case CounterSignQuorum:
+		if s.Count <= 0 {
+			return fmt.Errorf("会签同意人数需要大于 0")
+		}
+	default:
+		return fmt.Errorf("不支持的会签策略 %v", s.Strategy)
+	}
+	return
+}
+
+// 节点流转需要同意的处理人数量，total 为需要参与会签的处理人数量
+func (s *CounterSign) Required(total int) (required int) {
+	switch s.Strategy {
+	case CounterSignAny:
+		required = 1
+	case CounterSignPercent:
+		required = (total*s.Percent + 99) / 100
+	case CounterSignQuorum:
+		required = s.Count
+	default:
+		required = total
+	}
+	if required > total {
+		required = total
+	}
+	return
+}
+
+// 节点的会签配置
+func (n *Node) CounterSignRule() *CounterSign {
+	if n.CounterSign == nil {
+		return defaultCounterSign
+	}
+	return n.CounterSign
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"ferry/models/base"
+	"fmt"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+const DelegateTimeLayout = "2006-01-02 15:04:05"
+
+// 处理人委托规则，委托人休假期间工单交由代理人处理
+type DelegateRule struct {
+	base.Model
+	UserId      int    `gorm:"column:user_id; type:int(11)" json:"user_id" form:"user_id"`                           // 委托人
+	Delegate    int    `gorm:"column:delegate; type:int(11)" json:"delegate" form:"delegate"`                        // 代理人
+	Process     int    `gorm:"column:process; type:int(11); default:0" json:"process" form:"process"`                // 流程ID，0 表示所有流程
+	StartTime   string `gorm:"column:start_time; type:varchar(20)" json:"start_time" form:"start_time"`              // 开始时间，格式 2006-01-02 15:04:05
+	EndTime     string `gorm:"column:end_time; type:varchar(20)" json:"end_time" form:"end_time"`                    // 结束时间，格式 2006-01-02 15:04:05
+	MovePending int    `gorm:"column:move_pending; type:int(11); default:0" json:"move_pending" form:"move_pending"` // 委托人已有的待办工单是否一并交由代理人处理 0，否 1，是
+	Status      int    `gorm:"column:status; type:int(11); default:1" json:"status" form:"status"`                   // 状态 0，停用 1，启用
+	Remarks     string `gorm:"column:remarks; type:varchar(1024)" json:"remarks" form:"remarks"`                     // 备注
+}
+
+func (DelegateRule) TableName() string {
+	return "p_delegate_rule"
+}
+
+// 校验规则
+func (r *DelegateRule) Validate() (err error) {
+	var startTime, endTime time.Time
+
+	if r.Delegate == 0 {
+		return fmt.Errorf("请选择代理人")
+	}
+	if r.Delegate == r.UserId {
+		return fmt.Errorf("代理人不能为委托人自己")
+	}
+	startTime, err = time.ParseInLocation(DelegateTimeLayout, r.StartTime, time.Local)
+	if err != nil {
+		return fmt.Errorf("开始时间 %v 格式不正确，格式为 %v", r.StartTime, DelegateTimeLayout)
+	}
+	endTime, err = time.ParseInLocation(DelegateTimeLayout, r.EndTime, time.Local)
+	if err != nil {
+		return fmt.Errorf("结束时间 %v 格式不正确，格式为 %v", r.EndTime, DelegateTimeLayout)
+	}
+	if !endTime.After(startTime) {
+		return fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	return
+}
@@ -0,0 +1,26 @@
+package process
+
+import (
+	"ferry/models/base"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 待汇总的通知，用户开启汇总后，待办类通知暂存于此，按用户设置的频率合并为一条通知发送
+type NotifyDigest struct {
+	base.Model
+	UserId    int    `gorm:"column:user_id; type:int(11); index" json:"user_id" form:"user_id"`   // 接收人
+	Event     string `gorm:"column:event; type:varchar(64)" json:"event" form:"event"`            // 通知事件
+	WorkOrder int    `gorm:"column:work_order; type:int(11)" json:"work_order" form:"work_order"` // 工单ID
+	ProcessId int    `gorm:"column:process_id; type:int(11)" json:"process_id" form:"process_id"` // 流程ID
+	Subject   string `gorm:"column:subject; type:varchar(255)" json:"subject" form:"subject"`     // 通知标题
+	Title     string `gorm:"column:title; type:varchar(512)" json:"title" form:"title"`           // 工单标题
+	Creator   string `gorm:"column:creator; type:varchar(128)" json:"creator" form:"creator"`     // 工单创建人
+	Priority  int    `gorm:"column:priority; type:int(11)" json:"priority" form:"priority"`       // 工单优先级
+}
+
+func (NotifyDigest) TableName() string {
+	return "p_notify_digest"
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"encoding/json"
+	"ferry/models/base"
+	"ferry/pkg/jsonTime"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 通知发送状态
+const (
+	NotifyStatusPending = 0 // 待发送
+	NotifyStatusSending = 1 // 发送中
+	NotifyStatusSuccess = 2 // 发送成功
+	NotifyStatusFailed  = 3 // 发送失败
+)
+
+// 通知发件箱，每个通知渠道一条记录，与工单流转在同一事务中写入，由后台任务负责发送
+type NotifyOutbox struct {
+	base.Model
+	WorkOrder   int                `gorm:"column:work_order; type:int(11); index" json:"work_order" form:"work_order"`           // 工单ID
+	Channel     string             `gorm:"column:channel; type:varchar(64)" json:"channel" form:"channel"`                       // 通知渠道
+	Config      json.RawMessage    `gorm:"column:config; type:json" json:"config" form:"config"`                                 // 渠道配置
+	Subject     string             `gorm:"column:subject; type:varchar(255)" json:"subject" form:"subject"`                      // 通知标题
+	Recipients  json.RawMessage    `gorm:"column:recipients; type:json" json:"recipients" form:"recipients"`                     // 接收人
+	Payload     json.RawMessage    `gorm:"column:payload; type:json" json:"payload" form:"payload"`                              // 通知数据
+	Status      int                `gorm:"column:status; type:int(11); default:0; index" json:"status" form:"status"`            // 状态 0，待发送 1，发送中 2，发送成功 3，发送失败
+	Attempts    int                `gorm:"column:attempts; type:int(11); default:0" json:"attempts" form:"attempts"`             // 已发送次数
+	MaxAttempts int                `gorm:"column:max_attempts; type:int(11); default:0" json:"max_attempts" form:"max_attempts"` // 最多发送次数
+	NextTime    jsonTime.JSONTime  `gorm:"column:next_time" json:"next_time" form:"next_time"`                                   // 下次发送时间
+	SentTime    *jsonTime.JSONTime `gorm:"column:sent_time" json:"sent_time" form:"sent_time"`                                   // 发送成功时间
+	LastError   string             `gorm:"column:last_error; type:varchar(1024)" json:"last_error" form:"last_error"`            // 最近一次的错误信息
+}
+
+func (NotifyOutbox) TableName() string {
+	return "p_notify_outbox"
+}
+
+// 通知发送记录
+type NotifyAttempt struct {
+	base.Model
+	Outbox   int    `gorm:"column:outbox; type:int(11); index" json:"outbox" form:"outbox"` // 发件箱ID
+	Attempt  int    `gorm:"column:attempt; type:int(11)" json:"attempt" form:"attempt"`     // 第几次发送
+	Status   int    `gorm:"column:status; type:int(11)" json:"status" form:"status"`        // 发送结果 2，成功 3，失败
+	Error    string `gorm:"column:error; type:varchar(1024)" json:"error" form:"error"`     // 错误信息
+	Duration int64  `gorm:"column:duration; type:int(11)" json:"duration" form:"duration"`  // 耗时，单位毫秒
+}
+
+func (NotifyAttempt) TableName() string {
+	return "p_notify_attempt"
+}
@@ -0,0 +1,42 @@
+package process
+
+import (
+	"ferry/models/base"
+	"fmt"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 通知模版，按通知事件、通知渠道及流程匹配，未匹配到时使用 static/template 中的默认模版
+type NotifyTemplate struct {
+	base.Model
+	Name    string `gorm:"column:name; type:varchar(128)" json:"name" form:"name"`                // 模版名称
+	Event   string `gorm:"column:event; type:varchar(64)" json:"event" form:"event"`              // 通知事件，为空时适用于所有事件
+	Channel string `gorm:"column:channel; type:varchar(64)" json:"channel" form:"channel"`        // 通知渠道
+	Process int    `gorm:"column:process; type:int(11); default:0" json:"process" form:"process"` // 流程ID，0 表示所有流程
+	Subject string `gorm:"column:subject; type:varchar(512)" json:"subject" form:"subject"`       // 通知标题模版，为空时使用默认标题
+	Content string `gorm:"column:content; type:longtext" json:"content" form:"content"`           // 通知内容模版
+	Status  int    `gorm:"column:status; type:int(11); default:1" json:"status" form:"status"`    // 状态 0，停用 1，启用
+	Creator int    `gorm:"column:creator; type:int(11)" json:"creator" form:"creator"`            // 创建者
+	Remarks string `gorm:"column:remarks; type:varchar(1024)" json:"remarks" form:"remarks"`      // 备注
+}
+
+func (NotifyTemplate) TableName() string {
+	return "p_notify_template"
+}
+
+// 校验模版
+func (t *NotifyTemplate) Validate() (err error) {
+	if t.Name == "" {
+		return fmt.Errorf("模版名称不能为空")
+	}
+	if t.Channel == "" {
+		return fmt.Errorf("通知渠道不能为空")
+	}
+	if t.Content == "" {
+		return fmt.Errorf("模版内容不能为空")
+	}
+	return
+}
@@ -21,9 +21,18 @@ type Info struct {
 	SubmitCount int             `gorm:"column:submit_count; type:int(11); default:0" json:"submit_count" form:"submit_count"` // 提交统计
 	Creator     int             `gorm:"column:creator; type:int(11)" json:"creator" form:"creator"`                           // 创建者
 	Notice      json.RawMessage `gorm:"column:notice; type:json" json:"notice" form:"notice"`                                 // 绑定通知
+	Withdraw    int             `gorm:"column:withdraw; type:int(11); default:0" json:"withdraw" form:"withdraw"`             // 撤回策略 0，无人处理前可撤回 1，不允许撤回 2，结束前均可撤回
+	Version     int             `gorm:"column:version; type:int(11); default:0" json:"version" form:"version"`                // 当前发布的版本，0 表示尚未生成版本
 	Remarks     string          `gorm:"column:remarks; type:varchar(1024)" json:"remarks" form:"remarks"`                     // 流程备注
 }
 
 func (Info) TableName() string {
 	return "p_process_info"
 }
+
+// 工单撤回策略
+const (
+	WithdrawUnhandled = 0 // 无人处理前可撤回
+	WithdrawDisabled  = 1 // 不允许撤回
+	WithdrawAnytime   = 2 // 工单结束前均可撤回
+)
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"ferry/models/base"
+	"ferry/pkg/jsonTime"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 阻塞的任务节点，进入节点时写入脚本任务，脚本执行完成后按照执行结果流转
+*/
+
+// 脚本任务状态
+const (
+	ScriptStatusPending   = 0 // 待执行
+	ScriptStatusRunning   = 1 // 执行中
+	ScriptStatusSucceeded = 2 // 执行成功
+	ScriptStatusFailed    = 3 // 执行失败
+	ScriptStatusCancelled = 4 // 已取消，工单已离开任务节点或已结束
+)
+
+// 任务节点的脚本配置，配置后工单停留在任务节点，直到脚本执行完成。
+// 流转的选择顺序为：脚本输出的 target、退出码对应的节点、流转的条件表达式
+type Script struct {
+	Task        string            `json:"task"`        // 执行的脚本，脚本目录下的文件名，仅支持 Python 与 Shell 脚本
+	Timeout     int               `json:"timeout"`     // 超时时间，单位秒，为 0 时使用默认的超时时间
+	ExitCodes   map[string]string `json:"exitCodes"`   // 退出码对应流转到的节点，未配置的非 0 退出码视为执行失败
+	MergeForm   bool              `json:"mergeForm"`   // 是否将脚本输出的 form 合并到工单的表单数据
+	ErrorTarget string            `json:"errorTarget"` // 执行失败时流转到的节点，可以是任务节点流转的目标节点或人工处理节点
+}
+
+// 脚本输出，脚本在标准输出中打印 JSON 对象时解析，其他输出仅记录
+type ScriptOutput struct {
+	Target string                 `json:"target"` // 流转到的节点
+	Form   map[string]interface{} `json:"form"`   // 需要合并到工单表单的数据
+}
+
+func (s *Script) validate() (err error) {
+	if s == nil {
+		return
+	}
+	if s.Task == "" {
+		return fmt.Errorf("任务节点未配置执行的脚本")
+	}
+	if !strings.HasSuffix(s.Task, ".py") && !strings.HasSuffix(s.Task, ".sh") {
+		return fmt.Errorf("任务脚本 %v 不正确，目前仅支持 Python 与 Shell 脚本", s.Task)
+	}
+	if strings.Contains(s.Task, "..") {
+		return fmt.Errorf("任务脚本 %v 需要在脚本目录下", s.Task)
+	}
+	if s.ErrorTarget == "" {
+		return fmt.Errorf("未配置任务脚本执行失败时流转到的节点")
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("任务脚本超时时间不能为负数")
+	}
+	for code := range s.ExitCodes {
+		if _, convErr := strconv.Atoi(code); convErr != nil {
+			return fmt.Errorf("退出码 %v 不是整数", code)
+		}
+	}
+	return
+}
+
+// 退出码对应流转到的节点
+func (s *Script) ExitTarget(exitCode int) (target string, ok bool) {
+	target, ok = s.ExitCodes[strconv.Itoa(exitCode)]
+	return
+}
+
+// 工单脚本任务，进入任务节点时写入，由后台任务执行后推进工单，服务重启后仍会继续执行
+type WorkOrderScript struct {
+	base.Model
+	WorkOrder int               `gorm:"column:work_order; type:int(11); index" json:"work_order" form:"work_order"`  // 工单ID
+	Node      string            `gorm:"column:node; type:varchar(128)" json:"node" form:"node"`                      // 任务节点ID
+	Task      string            `gorm:"column:task; type:varchar(256)" json:"task" form:"task"`                      // 执行的脚本
+	Status    int               `gorm:"column:status; type:int(11); default:0; index" json:"status" form:"status"`   // 状态 0，待执行 1，执行中 2，执行成功 3，执行失败 4，已取消
+	Deadline  jsonTime.JSONTime `gorm:"column:deadline" json:"deadline" form:"deadline"`                             // 执行的截止时间，超过后仍在执行中的任务视为执行中断
+	ExitCode  int               `gorm:"column:exit_code; type:int(11); default:0" json:"exit_code" form:"exit_code"` // 退出码
+	Output    string            `gorm:"column:output; type:longtext" json:"output" form:"output"`                    // 脚本输出
+	Target    string            `gorm:"column:target; type:varchar(128)" json:"target" form:"target"`                // 流转到的节点
+	LastError string            `gorm:"column:last_error; type:varchar(1024)" json:"last_error" form:"last_error"`   // 执行失败的原因
+}
+
+func (WorkOrderScript) TableName() string {
+	return "p_work_order_script"
+}
@@ -0,0 +1,89 @@
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 工单时效（SLA）
+*/
+
+const (
+	// 工单时效状态
+	SlaStatusNormal   = 0 // 正常
+	SlaStatusAtRisk   = 1 // 即将超时
+	SlaStatusBreached = 2 // 已超时
+
+	// 超时后的升级动作
+	SlaActionNotifyProcessor = "notifyProcessor" // 通知当前处理人
+	SlaActionNotifyLeader    = "notifyLeader"    // 通知处理人所在部门的负责人
+	SlaActionReassign        = "reassign"        // 自动转交给指定用户
+)
+
+var slaActionList = map[string]struct{}{
+	SlaActionNotifyProcessor: {},
+	SlaActionNotifyLeader:    {},
+	SlaActionReassign:        {},
+}
+
+// 时效配置，可配置在流程或节点上
+type Sla struct {
+	Duration   int      `json:"duration"`   // 处理时限，单位分钟
+	Warning    int      `json:"warning"`    // 到期前多少分钟标记为即将超时，单位分钟
+	Actions    []string `json:"actions"`    // 超时后的升级动作
+	ReassignTo int      `json:"reassignTo"` // 自动转交的用户ID
+}
+
+// 是否启用
+func (s *Sla) Enabled() bool {
+	return s != nil && s.Duration > 0
+}
+
+// 截止时间
+func (s *Sla) Deadline(start time.Time) time.Time {
+	return start.Add(time.Duration(s.Duration) * time.Minute)
+}
+
+// 根据截止时间计算时效状态
+func (s *Sla) Status(deadline time.Time, now time.Time) int {
+	if !now.Before(deadline) {
+		return SlaStatusBreached
+	}
+	if s.Warning > 0 && !now.Before(deadline.Add(-time.Duration(s.Warning)*time.Minute)) {
+		return SlaStatusAtRisk
+	}
+	return SlaStatusNormal
+}
+
+// 是否包含升级动作
+func (s *Sla) HasAction(action string) bool {
+	for _, a := range s.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sla) validate() (err error) {
+	if s == nil {
+		return
+	}
+	if s.Duration < 0 || s.Warning < 0 {
+		return fmt.Errorf("时效时长不能为负数")
+	}
+	if s.Duration > 0 && s.Warning >= s.Duration {
+		return fmt.Errorf("时效预警时间必须小于处理时限")
+	}
+	for _, action := range s.Actions {
+		if _, ok := slaActionList[action]; !ok {
+			return fmt.Errorf("不支持的时效升级动作 %v", action)
+		}
+	}
+	if s.HasAction(SlaActionReassign) && s.ReassignTo == 0 {
+		return fmt.Errorf("时效升级动作为自动转交时，必须指定转交用户")
+	}
+	return
+}
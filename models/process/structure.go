@@ -0,0 +1,603 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流程结构，对应 Info.Structure 中保存的节点与流转数据
+*/
+
+// 节点类型
+const (
+	NodeStart        = "start"            // 开始节点
+	NodeUserTask     = "userTask"         // 审批节点
+	NodeReceiveTask  = "receiveTask"      // 处理节点
+	NodeScriptTask   = "scriptTask"       // 任务节点
+	NodeSubProcess   = "subProcess"       // 子流程节点
+	NodeTimer        = "timerEvent"       // 定时节点
+	NodeEnd          = "end"              // 结束节点
+	GatewayExclusive = "exclusiveGateway" // 排他网关
+	GatewayParallel  = "parallelGateway"  // 并行网关
+	GatewayInclusive = "inclusiveGateway" // 包容网关
+)
+
+// 处理人类型
+const (
+	AssignPerson     = "person"     // 人员
+	AssignRole       = "role"       // 角色
+	AssignDepartment = "department" // 部门
+	AssignVariable   = "variable"   // 变量
+	AssignLeader     = "leader"     // 创建人的部门负责人，处理人为负责人的层级，1 为所在部门负责人，2 为上级部门负责人，依次类推
+	AssignPost       = "post"       // 岗位
+	AssignFormField  = "formField"  // 表单字段中选择的用户
+	AssignRoleMember = "roleMember" // 按照分配方式从角色成员中选择一人
+)
+
+var nodeClazzList = map[string]struct{}{
+	NodeStart:        {},
+	NodeUserTask:     {},
+	NodeReceiveTask:  {},
+	NodeScriptTask:   {},
+	NodeSubProcess:   {},
+	NodeTimer:        {},
+	NodeEnd:          {},
+	GatewayExclusive: {},
+	GatewayParallel:  {},
+	GatewayInclusive: {},
+}
+
+// 排序字段，流程设计器中可能保存为字符串或数字
+type Sort int
+
+func (s *Sort) UnmarshalJSON(data []byte) (err error) {
+	var (
+		value    interface{}
+		sortInt  int
+		sortText string
+	)
+
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case nil:
+		sortInt = 0
+	case float64:
+		sortInt = int(v)
+	case string:
+		sortText = strings.TrimSpace(v)
+		if sortText != "" {
+			sortInt, err = strconv.Atoi(sortText)
+			if err != nil {
+				return fmt.Errorf("排序值 %v 不是整数", v)
+			}
+		}
+	default:
+		return fmt.Errorf("排序值 %v 类型不正确", v)
+	}
+
+	*s = Sort(sortInt)
+	return
+}
+
+// 模版权限
+type TplPermission struct {
+	WriteTpls    []int `json:"writeTpls"`    // 可写模版
+	ReadonlyTpls []int `json:"readonlyTpls"` // 只读模版
+	HideTpls     []int `json:"hideTpls"`     // 隐藏模版
+}
+
+// 模版是否可写，隐藏的模版无法修改数据
+func (t *TplPermission) TplWritable(tplId int) bool {
+	for _, hideTplId := range t.HideTpls {
+		if hideTplId == tplId {
+			return false
+		}
+	}
+	for _, writeTplId := range t.WriteTpls {
+		if writeTplId == tplId {
+			return true
+		}
+	}
+	return false
+}
+
+// 节点
+type Node struct {
+	Id            string       `json:"id"`            // 节点ID
+	Label         string       `json:"label"`         // 节点名称
+	Clazz         string       `json:"clazz"`         // 节点类型
+	Sort          Sort         `json:"sort"`          // 排序
+	AssignType    string       `json:"assignType"`    // 处理人类型
+	AssignValue   []int        `json:"assignValue"`   // 处理人
+	IsCounterSign bool         `json:"isCounterSign"` // 是否会签
+	FullHandle    bool         `json:"fullHandle"`    // 角色或部门是否需要全员处理
+	ActiveOrder   bool         `json:"activeOrder"`   // 是否需要主动接单
+	Cc            []int        `json:"cc"`            // 抄送人
+	Task          []string     `json:"task"`          // 节点任务
+	Sla           *Sla         `json:"sla"`           // 节点时效
+	Assignee      *Assignee    `json:"assignee"`      // 处理人解析配置
+	CounterSign   *CounterSign `json:"counterSign"`   // 会签配置
+	SubProcess    *SubProcess  `json:"subProcess"`    // 子流程配置
+	Timer         *Timer       `json:"timer"`         // 定时配置
+	Script        *Script      `json:"script"`        // 任务节点的脚本配置，配置后工单等待脚本执行完成
+	TplPermission
+}
+
+// 是否是需要人工处理的节点
+func (n *Node) IsHumanTask() bool {
+	return n.Clazz == NodeUserTask || n.Clazz == NodeReceiveTask
+}
+
+// 是否是网关
+func (n *Node) IsGateway() bool {
+	return n.Clazz == GatewayExclusive || n.Clazz == GatewayParallel || n.Clazz == GatewayInclusive
+}
+
+// 流转
+type Edge struct {
+	Id                  string       `json:"id"`                  // 流转ID
+	Label               string       `json:"label"`               // 流转名称
+	Source              string       `json:"source"`              // 源节点
+	Target              string       `json:"target"`              // 目标节点
+	Sort                Sort         `json:"sort"`                // 排序
+	ConditionExpression string       `json:"conditionExpression"` // 条件表达式
+	Conditions          []*Condition `json:"-"`                   // 解析后的条件表达式
+}
+
+// 解析条件表达式
+func (e *Edge) parseConditions() (err error) {
+	e.Conditions = make([]*Condition, 0)
+	if strings.TrimSpace(e.ConditionExpression) == "" {
+		return
+	}
+
+	err = json.Unmarshal([]byte(e.ConditionExpression), &e.Conditions)
+	if err != nil {
+		return fmt.Errorf("条件表达式格式不正确，%v", err.Error())
+	}
+
+	for _, condition := range e.Conditions {
+		if condition == nil {
+			return fmt.Errorf("条件表达式缺少判断字段或判断符号")
+		}
+		err = condition.normalize()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 流程结构
+type Structure struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+	Sla   *Sla    `json:"sla"` // 流程时效，从工单创建开始计算
+}
+
+// 获取节点
+func (s *Structure) GetNode(nodeId string) *Node {
+	for _, node := range s.Nodes {
+		if node.Id == nodeId {
+			return node
+		}
+	}
+	return nil
+}
+
+// 获取开始节点
+func (s *Structure) StartNode() *Node {
+	for _, node := range s.Nodes {
+		if node.Clazz == NodeStart {
+			return node
+		}
+	}
+	return nil
+}
+
+// 获取流出的流转，按照排序字段排序
+func (s *Structure) SourceEdges(nodeId string) []*Edge {
+	return s.sortedEdges(func(e *Edge) bool { return e.Source == nodeId })
+}
+
+// 获取流入的流转，按照排序字段排序
+func (s *Structure) TargetEdges(nodeId string) []*Edge {
+	return s.sortedEdges(func(e *Edge) bool { return e.Target == nodeId })
+}
+
+// 是否可以从节点 from 沿流转到达节点 to，节点可以到达自身
+func (s *Structure) Reachable(from string, to string) bool {
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		nodeId := queue[0]
+		queue = queue[1:]
+		if nodeId == to {
+			return true
+		}
+		for _, edge := range s.Edges {
+			if edge.Source == nodeId && !visited[edge.Target] {
+				visited[edge.Target] = true
+				queue = append(queue, edge.Target)
+			}
+		}
+	}
+	return false
+}
+
+func (s *Structure) sortedEdges(match func(e *Edge) bool) (edges []*Edge) {
+	for _, edge := range s.Edges {
+		if match(edge) {
+			edges = append(edges, edge)
+		}
+	}
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].Sort < edges[j].Sort
+	})
+	return
+}
+
+// 流程结构错误项
+type StructureErrorItem struct {
+	Classify string `json:"classify"` // node 节点，edge 流转，process 流程
+	Id       string `json:"id"`       // 节点或流转ID
+	Message  string `json:"message"`  // 错误信息
+}
+
+// 流程结构错误，列出所有有问题的节点与流转
+type StructureError struct {
+	Items []*StructureErrorItem `json:"items"`
+}
+
+func (e *StructureError) Error() string {
+	var messages []string
+	for _, item := range e.Items {
+		switch item.Classify {
+		case "node":
+			messages = append(messages, fmt.Sprintf("节点<%v>：%v", item.Id, item.Message))
+		case "edge":
+			messages = append(messages, fmt.Sprintf("流转<%v>：%v", item.Id, item.Message))
+		default:
+			messages = append(messages, item.Message)
+		}
+	}
+	return fmt.Sprintf("流程结构不正确，%v", strings.Join(messages, "；"))
+}
+
+func (e *StructureError) AddNode(nodeId string, format string, a ...interface{}) {
+	e.Items = append(e.Items, &StructureErrorItem{Classify: "node", Id: nodeId, Message: fmt.Sprintf(format, a...)})
+}
+
+func (e *StructureError) AddEdge(edgeId string, format string, a ...interface{}) {
+	e.Items = append(e.Items, &StructureErrorItem{Classify: "edge", Id: edgeId, Message: fmt.Sprintf(format, a...)})
+}
+
+func (e *StructureError) AddProcess(format string, a ...interface{}) {
+	e.Items = append(e.Items, &StructureErrorItem{Classify: "process", Message: fmt.Sprintf(format, a...)})
+}
+
+// 节点ID列表
+func (e *StructureError) NodeIds() (ids []string) {
+	for _, item := range e.Items {
+		if item.Classify == "node" {
+			ids = append(ids, item.Id)
+		}
+	}
+	return
+}
+
+// 流转ID列表
+func (e *StructureError) EdgeIds() (ids []string) {
+	for _, item := range e.Items {
+		if item.Classify == "edge" {
+			ids = append(ids, item.Id)
+		}
+	}
+	return
+}
+
+func (e *StructureError) HasError() bool {
+	return len(e.Items) > 0
+}
+
+// 获取原始数据中的ID，用于在数据格式不正确时定位
+func rawId(data json.RawMessage) string {
+	var value struct {
+		Id interface{} `json:"id"`
+	}
+	if json.Unmarshal(data, &value) != nil || value.Id == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value.Id)
+}
+
+// 解析并校验流程结构
+func ParseStructure(data json.RawMessage) (structure *Structure, err error) {
+	var (
+		rawStructure struct {
+			Nodes []json.RawMessage `json:"nodes"`
+			Edges []json.RawMessage `json:"edges"`
+			Sla   *Sla              `json:"sla"`
+		}
+		structureErr = &StructureError{}
+		nodeIds      = make(map[string]struct{})
+		edgeIds      = make(map[string]struct{})
+	)
+
+	if len(data) == 0 || string(data) == "null" {
+		structureErr.AddProcess("流程结构为空")
+		return nil, structureErr
+	}
+
+	err = json.Unmarshal(data, &rawStructure)
+	if err != nil {
+		structureErr.AddProcess("流程结构格式不正确，%v", err.Error())
+		return nil, structureErr
+	}
+
+	structure = &Structure{
+		Nodes: make([]*Node, 0, len(rawStructure.Nodes)),
+		Edges: make([]*Edge, 0, len(rawStructure.Edges)),
+		Sla:   rawStructure.Sla,
+	}
+	err = structure.Sla.validate()
+	if err != nil {
+		structureErr.AddProcess(err.Error())
+	}
+
+	for i, rawNode := range rawStructure.Nodes {
+		var node Node
+		err = json.Unmarshal(rawNode, &node)
+		if err != nil {
+			nodeId := rawId(rawNode)
+			if nodeId == "" {
+				nodeId = fmt.Sprintf("#%d", i+1)
+			}
+			structureErr.AddNode(nodeId, "数据格式不正确，%v", err.Error())
+			continue
+		}
+		if node.Id == "" {
+			structureErr.AddNode(fmt.Sprintf("#%d", i+1), "节点ID不能为空")
+			continue
+		}
+		if _, ok := nodeIds[node.Id]; ok {
+			structureErr.AddNode(node.Id, "节点ID重复")
+			continue
+		}
+		nodeIds[node.Id] = struct{}{}
+		if _, ok := nodeClazzList[node.Clazz]; !ok {
+			structureErr.AddNode(node.Id, "不支持的节点类型 %v", node.Clazz)
+		}
+		if node.AssignValue == nil {
+			node.AssignValue = make([]int, 0)
+		}
+		err = node.Sla.validate()
+		if err != nil {
+			structureErr.AddNode(node.Id, err.Error())
+		}
+		err = node.CounterSign.validate()
+		if err != nil {
+			structureErr.AddNode(node.Id, err.Error())
+		}
+		switch node.Clazz {
+		case NodeSubProcess:
+			err = node.SubProcess.validate()
+			if err != nil {
+				structureErr.AddNode(node.Id, err.Error())
+			}
+		case NodeTimer:
+			err = node.Timer.validate()
+			if err != nil {
+				structureErr.AddNode(node.Id, err.Error())
+			}
+		case NodeScriptTask:
+			err = node.Script.validate()
+			if err != nil {
+				structureErr.AddNode(node.Id, err.Error())
+			}
+		}
+		structure.Nodes = append(structure.Nodes, &node)
+	}
+
+	for i, rawEdge := range rawStructure.Edges {
+		var edge Edge
+		err = json.Unmarshal(rawEdge, &edge)
+		if err != nil {
+			edgeId := rawId(rawEdge)
+			if edgeId == "" {
+				edgeId = fmt.Sprintf("#%d", i+1)
+			}
+			structureErr.AddEdge(edgeId, "数据格式不正确，%v", err.Error())
+			continue
+		}
+		if edge.Id == "" {
+			edge.Id = fmt.Sprintf("#%d", i+1)
+		}
+		if _, ok := edgeIds[edge.Id]; ok {
+			structureErr.AddEdge(edge.Id, "流转ID重复")
+			continue
+		}
+		edgeIds[edge.Id] = struct{}{}
+		if _, ok := nodeIds[edge.Source]; !ok {
+			structureErr.AddEdge(edge.Id, "源节点 %v 不存在", edge.Source)
+		}
+		if _, ok := nodeIds[edge.Target]; !ok {
+			structureErr.AddEdge(edge.Id, "目标节点 %v 不存在", edge.Target)
+		}
+		err = edge.parseConditions()
+		if err != nil {
+			structureErr.AddEdge(edge.Id, err.Error())
+		}
+		structure.Edges = append(structure.Edges, &edge)
+	}
+
+	if structureErr.HasError() {
+		return nil, structureErr
+	}
+	return structure, nil
+}
+
+// 流程结构的原始数据，保留流程设计器保存的全部字段，用于返回给前端
+type RawStructure struct {
+	Nodes []map[string]interface{} `json:"nodes"`
+	Edges []map[string]interface{} `json:"edges"`
+}
+
+// 解析流程结构的原始数据，数字保持原有格式
+func ParseRawStructure(data json.RawMessage) (raw *RawStructure, err error) {
+	raw = &RawStructure{}
+	if len(data) == 0 {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("流程结构格式不正确，%v", err.Error())
+	}
+	return
+}
+
+// 按照解析后节点的排序值排序原始节点，排序值相同时保持原有顺序
+func (r *RawStructure) SortNodes(structure *Structure) {
+	sortList := make(map[string]Sort, len(structure.Nodes))
+	for _, node := range structure.Nodes {
+		sortList[node.Id] = node.Sort
+	}
+	sort.SliceStable(r.Nodes, func(i, j int) bool {
+		return sortList[fmt.Sprintf("%v", r.Nodes[i]["id"])] < sortList[fmt.Sprintf("%v", r.Nodes[j]["id"])]
+	})
+}
+
+// 工单当前所处的节点信息，对应 WorkOrderInfo.State 中的每一项
+type StateItem struct {
+	Id            string          `json:"id"`                       // 节点ID
+	Label         string          `json:"label"`                    // 节点名称
+	Processor     []int           `json:"processor"`                // 处理人
+	ProcessMethod string          `json:"process_method"`           // 处理人类型
+	BeforeSigners []int           `json:"before_signers,omitempty"` // 前加签的处理人，全部处理完成后交还原处理人
+	AfterSigners  []int           `json:"after_signers,omitempty"`  // 后加签的处理人，全部处理完成后节点才会流转
+	Delegates     []*DelegateItem `json:"delegates,omitempty"`      // 委托代理，处理人已替换为代理人
+	Children      []int           `json:"children,omitempty"`       // 子流程节点创建的子工单
+	Claim         *ClaimItem      `json:"claim,omitempty"`          // 认领信息，认领后处理人为认领人
+}
+
+// 处理人委托记录
+type DelegateItem struct {
+	Delegator int `json:"delegator"` // 委托人
+	Delegate  int `json:"delegate"`  // 代理人
+}
+
+// 代理人所代理的委托人，未代理时返回 0
+func (s *StateItem) Delegator(userId int) int {
+	for _, item := range s.Delegates {
+		if item.Delegate == userId {
+			return item.Delegator
+		}
+	}
+	return 0
+}
+
+// 加签方式
+const (
+	AddSignerBefore = "before" // 前加签
+	AddSignerAfter  = "after"  // 后加签
+)
+
+// 是否有未处理的加签人
+func (s *StateItem) HasSigners() bool {
+	return len(s.BeforeSigners) > 0 || len(s.AfterSigners) > 0
+}
+
+// 当前需要处理的加签人，前加签的处理人优先
+func (s *StateItem) PendingSigners() []int {
+	if len(s.BeforeSigners) > 0 {
+		return s.BeforeSigners
+	}
+	return s.AfterSigners
+}
+
+// 加签人处理完成
+func (s *StateItem) RemoveSigner(userId int) {
+	s.BeforeSigners = removeInt(s.BeforeSigners, userId)
+	s.AfterSigners = removeInt(s.AfterSigners, userId)
+}
+
+func removeInt(list []int, value int) (result []int) {
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return
+}
+
+// 根据节点生成工单状态
+func NewStateItem(node *Node) *StateItem {
+	processor := make([]int, len(node.AssignValue))
+	copy(processor, node.AssignValue)
+	return &StateItem{
+		Id:            node.Id,
+		Label:         node.Label,
+		Processor:     processor,
+		ProcessMethod: node.AssignType,
+	}
+}
+
+// 解析工单状态
+func ParseState(data json.RawMessage) (stateList []*StateItem, err error) {
+	stateList = make([]*StateItem, 0)
+	if len(data) == 0 {
+		return
+	}
+	err = json.Unmarshal(data, &stateList)
+	if err != nil {
+		err = fmt.Errorf("工单状态格式不正确，%v", err.Error())
+		return
+	}
+	for _, state := range stateList {
+		if state.Processor == nil {
+			state.Processor = make([]int, 0)
+		}
+	}
+	return
+}
+
+// 获取指定节点的工单状态
+func GetStateItem(stateList []*StateItem, nodeId string) *StateItem {
+	for _, state := range stateList {
+		if state.Id == nodeId {
+			return state
+		}
+	}
+	return nil
+}
+
+// 退回记录，工单退回到 Target 节点且该节点处理完成后，直接返回 State 节点，跳过中间的审批节点
+type ReturnItem struct {
+	Target string     `json:"target"` // 退回到的节点
+	State  *StateItem `json:"state"`  // 退回前的节点及处理人
+}
+
+// 解析工单的退回记录
+func ParseReturnStack(data json.RawMessage) (returnStack []*ReturnItem, err error) {
+	returnStack = make([]*ReturnItem, 0)
+	if len(data) == 0 || string(data) == "null" {
+		return
+	}
+	err = json.Unmarshal(data, &returnStack)
+	if err != nil {
+		err = fmt.Errorf("工单退回记录格式不正确，%v", err.Error())
+	}
+	return
+}
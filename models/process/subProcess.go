@@ -0,0 +1,34 @@
+package process
+
+import (
+	"fmt"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 子流程配置，进入节点时按照配置创建子工单，所有子工单结束后父工单继续流转
+type SubProcess struct {
+	Items        []*SubProcessItem `json:"items"`        // 需要创建的子工单
+	DeniedTarget string            `json:"deniedTarget"` // 任意子工单被拒绝时流转到的节点，为空时按照正常流转
+}
+
+// 子工单
+type SubProcessItem struct {
+	Process int               `json:"process"` // 子流程ID
+	Title   string            `json:"title"`   // 子工单标题，为空时使用父工单标题
+	Mapping map[string]string `json:"mapping"` // 表单字段映射，键为子流程的表单字段，值为父工单的表单字段
+}
+
+func (s *SubProcess) validate() (err error) {
+	if s == nil || len(s.Items) == 0 {
+		return fmt.Errorf("未配置子流程")
+	}
+	for _, item := range s.Items {
+		if item == nil || item.Process == 0 {
+			return fmt.Errorf("子流程不能为空")
+		}
+	}
+	return
+}
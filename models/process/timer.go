@@ -0,0 +1,87 @@
+package process
+
+import (
+	"ferry/models/base"
+	"ferry/pkg/jsonTime"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 定时节点
+*/
+
+// 定时任务状态
+const (
+	TimerStatusPending   = 0 // 待触发
+	TimerStatusFired     = 1 // 已触发
+	TimerStatusCancelled = 2 // 已取消，工单已离开定时节点或已结束
+	TimerStatusFailed    = 3 // 触发失败
+)
+
+// 表单字段支持的日期格式
+var timerFieldLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC3339,
+}
+
+// 定时配置，等待固定时长或等待至表单字段中的时间，同时配置时在字段时间的基础上再等待固定时长
+type Timer struct {
+	Duration int    `json:"duration"` // 等待时长，单位分钟
+	Field    string `json:"field"`    // 表单字段，字段值为需要等待至的时间
+}
+
+func (t *Timer) validate() (err error) {
+	if t == nil || (t.Duration <= 0 && t.Field == "") {
+		return fmt.Errorf("未配置等待时长或等待至的表单字段")
+	}
+	if t.Duration < 0 {
+		return fmt.Errorf("等待时长不能为负数")
+	}
+	return
+}
+
+// 计算触发时间，start 为进入节点的时间
+func (t *Timer) FireTime(start time.Time, formData map[string]interface{}) (fireTime time.Time, err error) {
+	fireTime = start
+	if t.Field != "" {
+		value, ok := formData[t.Field].(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			return fireTime, fmt.Errorf("表单字段 %v 未填写", t.Field)
+		}
+		fireTime, err = parseTimerField(strings.TrimSpace(value))
+		if err != nil {
+			return fireTime, fmt.Errorf("表单字段 %v 不是有效的时间，%v", t.Field, value)
+		}
+	}
+	return fireTime.Add(time.Duration(t.Duration) * time.Minute), nil
+}
+
+func parseTimerField(value string) (t time.Time, err error) {
+	for _, layout := range timerFieldLayouts {
+		t, err = time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// 工单定时任务，进入定时节点时写入，由后台任务到期后推进工单，服务重启后仍会继续执行
+type WorkOrderTimer struct {
+	base.Model
+	WorkOrder int               `gorm:"column:work_order; type:int(11); index" json:"work_order" form:"work_order"` // 工单ID
+	Node      string            `gorm:"column:node; type:varchar(128)" json:"node" form:"node"`                     // 定时节点ID
+	FireTime  jsonTime.JSONTime `gorm:"column:fire_time" json:"fire_time" form:"fire_time"`                         // 触发时间
+	Status    int               `gorm:"column:status; type:int(11); default:0; index" json:"status" form:"status"`  // 状态 0，待触发 1，已触发 2，已取消 3，触发失败
+	Attempts  int               `gorm:"column:attempts; type:int(11); default:0" json:"attempts" form:"attempts"`   // 已触发次数
+	LastError string            `gorm:"column:last_error; type:varchar(1024)" json:"last_error" form:"last_error"`  // 最近一次的错误信息
+}
+
+func (WorkOrderTimer) TableName() string {
+	return "p_work_order_timer"
+}
@@ -0,0 +1,85 @@
+package process
+
+import (
+	"ferry/models/base"
+	"fmt"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 自动催办规则
+type UrgeRule struct {
+	base.Model
+	Name       string `gorm:"column:name; type:varchar(128)" json:"name" form:"name"`                      // 规则名称
+	Process    int    `gorm:"column:process; type:int(11); default:0" json:"process" form:"process"`       // 流程ID，0 表示所有流程
+	Priority   int    `gorm:"column:priority; type:int(11); default:0" json:"priority" form:"priority"`    // 工单优先级，0 表示所有优先级
+	Interval   int    `gorm:"column:urge_interval; type:int(11)" json:"interval" form:"interval"`          // 工单停留在同一节点时的催办间隔，单位分钟
+	MaxCount   int    `gorm:"column:max_count; type:int(11); default:0" json:"max_count" form:"max_count"` // 同一节点最多催办次数，0 表示不限制
+	QuietStart string `gorm:"column:quiet_start; type:varchar(8)" json:"quiet_start" form:"quiet_start"`   // 免打扰开始时间，格式 15:04
+	QuietEnd   string `gorm:"column:quiet_end; type:varchar(8)" json:"quiet_end" form:"quiet_end"`         // 免打扰结束时间，格式 15:04
+	Status     int    `gorm:"column:status; type:int(11); default:1" json:"status" form:"status"`          // 状态 0，停用 1，启用
+	Creator    int    `gorm:"column:creator; type:int(11)" json:"creator" form:"creator"`                  // 创建者
+	Remarks    string `gorm:"column:remarks; type:varchar(1024)" json:"remarks" form:"remarks"`            // 备注
+}
+
+func (UrgeRule) TableName() string {
+	return "p_urge_rule"
+}
+
+// 校验规则
+func (r *UrgeRule) Validate() (err error) {
+	if r.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if r.Interval <= 0 {
+		return fmt.Errorf("催办间隔必须大于0")
+	}
+	if r.MaxCount < 0 {
+		return fmt.Errorf("最多催办次数不能为负数")
+	}
+	if (r.QuietStart == "") != (r.QuietEnd == "") {
+		return fmt.Errorf("免打扰开始时间与结束时间必须同时设置")
+	}
+	for _, t := range []string{r.QuietStart, r.QuietEnd} {
+		if t == "" {
+			continue
+		}
+		if _, err = time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("免打扰时间 %v 格式不正确，格式为 15:04", t)
+		}
+	}
+	return
+}
+
+// 是否处于免打扰时间，支持跨天，如 22:00 至 08:00
+func (r *UrgeRule) InQuietHours(now time.Time) bool {
+	if r.QuietStart == "" || r.QuietEnd == "" || r.QuietStart == r.QuietEnd {
+		return false
+	}
+	current := now.Format("15:04")
+	if r.QuietStart < r.QuietEnd {
+		return current >= r.QuietStart && current < r.QuietEnd
+	}
+	return current >= r.QuietStart || current < r.QuietEnd
+}
+
+// 规则是否适用于工单，返回匹配程度，流程匹配优先于优先级匹配，-1 表示不适用
+func (r *UrgeRule) Match(workOrder *WorkOrderInfo) int {
+	score := 0
+	if r.Process != 0 {
+		if r.Process != workOrder.Process {
+			return -1
+		}
+		score += 2
+	}
+	if r.Priority != 0 {
+		if r.Priority != workOrder.Priority {
+			return -1
+		}
+		score += 1
+	}
+	return score
+}
@@ -0,0 +1,49 @@
+package process
+
+import (
+	"encoding/json"
+	"ferry/models/base"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 流程版本，保存流程时生成且不可修改，工单按照创建时绑定的版本流转
+type Version struct {
+	base.Model
+	Process   int             `gorm:"column:process; type:int(11); index" json:"process" form:"process"` // 流程ID
+	Version   int             `gorm:"column:version; type:int(11)" json:"version" form:"version"`        // 版本号，从 1 开始递增
+	Structure json.RawMessage `gorm:"column:structure; type:json" json:"structure" form:"structure"`     // 流程结构
+	Tpls      json.RawMessage `gorm:"column:tpls; type:json" json:"tpls" form:"tpls"`                    // 模版
+	Task      json.RawMessage `gorm:"column:task; type:json" json:"task" form:"task"`                    // 任务
+	Creator   int             `gorm:"column:creator; type:int(11)" json:"creator" form:"creator"`        // 创建者
+	Remarks   string          `gorm:"column:remarks; type:varchar(1024)" json:"remarks" form:"remarks"`  // 备注
+}
+
+func (Version) TableName() string {
+	return "p_process_version"
+}
+
+// 使用此版本的流程定义替换流程当前的定义
+func (v *Version) Apply(info *Info) {
+	info.Structure = v.Structure
+	info.Tpls = v.Tpls
+	info.Task = v.Task
+	info.Version = v.Version
+}
+
+// 流程定义是否与此版本相同
+func (v *Version) SameAs(info *Info) bool {
+	return jsonEqual(v.Structure, info.Structure) && jsonEqual(v.Tpls, info.Tpls) && jsonEqual(v.Task, info.Task)
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return string(a) == string(b)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
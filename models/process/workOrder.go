@@ -3,6 +3,7 @@ package process
 import (
 	"encoding/json"
 	"ferry/models/base"
+	"ferry/pkg/jsonTime"
 )
 
 /*
@@ -12,17 +13,26 @@ import (
 // 工单
 type WorkOrderInfo struct {
 	base.Model
-	Title         string          `gorm:"column:title; type:varchar(128)" json:"title" form:"title"`                                  // 工单标题
-	Priority      int             `gorm:"column:priority; type:int(11)" json:"priority" form:"priority"`                              // 工单优先级 1，正常 2，紧急 3，非常紧急
-	Process       int             `gorm:"column:process; type:int(11)" json:"process" form:"process"`                                 // 流程ID
-	Classify      int             `gorm:"column:classify; type:int(11)" json:"classify" form:"classify"`                              // 分类ID
-	IsEnd         int             `gorm:"column:is_end; type:int(11); default:0" json:"is_end" form:"is_end"`                         // 是否结束， 0 未结束，1 已结束
-	IsDenied      int             `gorm:"column:is_denied; type:int(11); default:0" json:"is_denied" form:"is_denied"`                // 是否被拒绝， 0 没有，1 有
-	State         json.RawMessage `gorm:"column:state; type:json" json:"state" form:"state"`                                          // 状态信息
-	RelatedPerson json.RawMessage `gorm:"column:related_person; type:json" json:"related_person" form:"related_person"`               // 工单所有处理人
-	Creator       int             `gorm:"column:creator; type:int(11)" json:"creator" form:"creator"`                                 // 创建人
-	UrgeCount     int             `gorm:"column:urge_count; type:int(11); default:0" json:"urge_count" form:"urge_count"`             // 催办次数
-	UrgeLastTime  int             `gorm:"column:urge_last_time; type:int(11); default:0" json:"urge_last_time" form:"urge_last_time"` // 上一次催促时间
+	Title          string             `gorm:"column:title; type:varchar(128)" json:"title" form:"title"`                                     // 工单标题
+	Priority       int                `gorm:"column:priority; type:int(11)" json:"priority" form:"priority"`                                 // 工单优先级 1，正常 2，紧急 3，非常紧急
+	Process        int                `gorm:"column:process; type:int(11)" json:"process" form:"process"`                                    // 流程ID
+	Classify       int                `gorm:"column:classify; type:int(11)" json:"classify" form:"classify"`                                 // 分类ID
+	IsEnd          int                `gorm:"column:is_end; type:int(11); default:0" json:"is_end" form:"is_end"`                            // 是否结束， 0 未结束，1 已结束
+	IsDenied       int                `gorm:"column:is_denied; type:int(11); default:0" json:"is_denied" form:"is_denied"`                   // 是否被拒绝， 0 没有，1 有
+	IsWithdrawn    int                `gorm:"column:is_withdrawn; type:int(11); default:0" json:"is_withdrawn" form:"is_withdrawn"`          // 是否被创建人撤回， 0 没有，1 已撤回，撤回的工单同时标记为已结束
+	State          json.RawMessage    `gorm:"column:state; type:json" json:"state" form:"state"`                                             // 状态信息
+	RelatedPerson  json.RawMessage    `gorm:"column:related_person; type:json" json:"related_person" form:"related_person"`                  // 工单所有处理人
+	Creator        int                `gorm:"column:creator; type:int(11)" json:"creator" form:"creator"`                                    // 创建人
+	UrgeCount      int                `gorm:"column:urge_count; type:int(11); default:0" json:"urge_count" form:"urge_count"`                // 催办次数
+	UrgeLastTime   int                `gorm:"column:urge_last_time; type:int(11); default:0" json:"urge_last_time" form:"urge_last_time"`    // 上一次催促时间
+	DueTime        *jsonTime.JSONTime `gorm:"column:due_time" json:"due_time" form:"due_time"`                                               // 处理截止时间
+	SlaNode        string             `gorm:"column:sla_node; type:varchar(128)" json:"sla_node" form:"sla_node"`                            // 截止时间对应的节点，为空时表示流程时效
+	SlaStatus      int                `gorm:"column:sla_status; type:int(11); default:0" json:"sla_status" form:"sla_status"`                // 时效状态 0，正常 1，即将超时 2，已超时
+	ReturnStack    json.RawMessage    `gorm:"column:return_stack; type:json" json:"return_stack" form:"return_stack"`                        // 退回记录，退回的节点处理后直接返回退回前的节点
+	ParentId       int                `gorm:"column:parent_id; type:int(11); default:0" json:"parent_id" form:"parent_id"`                   // 父工单ID，由子流程节点创建的工单
+	ParentNode     string             `gorm:"column:parent_node; type:varchar(128)" json:"parent_node" form:"parent_node"`                   // 父工单中创建此工单的子流程节点
+	ProcessVersion int                `gorm:"column:process_version; type:int(11); default:0" json:"process_version" form:"process_version"` // 工单绑定的流程版本，0 表示使用流程当前的定义
+	Version        int                `gorm:"column:version; type:int(11); default:0" json:"version" form:"version"`                         // 数据版本，每次修改节点数据时加一，用于检测并发处理的冲突
 }
 
 func (WorkOrderInfo) TableName() string {
@@ -0,0 +1,155 @@
+package system
+
+import (
+	"encoding/json"
+	"ferry/models/base"
+	"ferry/pkg/jsonTime"
+	"fmt"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+*/
+
+// 通知汇总方式
+const (
+	DigestNone   = ""       // 不汇总，逐条发送
+	DigestHourly = "hourly" // 每小时汇总
+	DigestDaily  = "daily"  // 每天汇总
+)
+
+// 用户通知偏好，未配置时按流程的通知设置发送
+type UserNotifySetting struct {
+	base.Model
+	UserId     int                `gorm:"column:user_id; type:int(11); unique_index" json:"user_id" form:"user_id"`  // 用户ID
+	Channels   json.RawMessage    `gorm:"column:channels; type:json" json:"channels" form:"channels"`                // 接收通知的渠道，为空时使用流程配置的渠道
+	Events     json.RawMessage    `gorm:"column:events; type:json" json:"events" form:"events"`                      // 接收通知的事件，为空时接收所有事件
+	QuietStart string             `gorm:"column:quiet_start; type:varchar(8)" json:"quiet_start" form:"quiet_start"` // 免打扰开始时间，格式 15:04
+	QuietEnd   string             `gorm:"column:quiet_end; type:varchar(8)" json:"quiet_end" form:"quiet_end"`       // 免打扰结束时间，格式 15:04
+	Digest     string             `gorm:"column:digest; type:varchar(16)" json:"digest" form:"digest"`               // 汇总方式，hourly 每小时，daily 每天
+	DigestTime string             `gorm:"column:digest_time; type:varchar(8)" json:"digest_time" form:"digest_time"` // 每天汇总的发送时间，格式 15:04
+	LastDigest *jsonTime.JSONTime `gorm:"column:last_digest" json:"last_digest" form:"last_digest"`                  // 最近一次发送汇总的时间
+	channels   []string
+	events     []string
+}
+
+func (UserNotifySetting) TableName() string {
+	return "sys_user_notify_setting"
+}
+
+// 解析并校验通知偏好
+func (s *UserNotifySetting) Parse() (err error) {
+	s.channels, err = parseStringList(s.Channels)
+	if err != nil {
+		return fmt.Errorf("通知渠道格式不正确，%v", err.Error())
+	}
+	s.events, err = parseStringList(s.Events)
+	if err != nil {
+		return fmt.Errorf("通知事件格式不正确，%v", err.Error())
+	}
+
+	if (s.QuietStart == "") != (s.QuietEnd == "") {
+		return fmt.Errorf("免打扰开始时间与结束时间必须同时设置")
+	}
+	for _, t := range []string{s.QuietStart, s.QuietEnd, s.DigestTime} {
+		if t == "" {
+			continue
+		}
+		if _, err = time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("时间 %v 格式不正确，格式为 15:04", t)
+		}
+	}
+
+	switch s.Digest {
+	case DigestNone, DigestHourly:
+	case DigestDaily:
+		if s.DigestTime == "" {
+			s.DigestTime = "09:00"
+		}
+	default:
+		return fmt.Errorf("不支持的汇总方式 %v", s.Digest)
+	}
+	return
+}
+
+// 用户选择的通知渠道
+func (s *UserNotifySetting) ChannelList() []string {
+	return s.channels
+}
+
+// 用户选择的通知事件
+func (s *UserNotifySetting) EventList() []string {
+	return s.events
+}
+
+// 是否通过此渠道接收通知
+func (s *UserNotifySetting) ChannelEnabled(channel string) bool {
+	return len(s.channels) == 0 || containsString(s.channels, channel)
+}
+
+// 是否接收此事件的通知
+func (s *UserNotifySetting) Subscribed(event string) bool {
+	return len(s.events) == 0 || containsString(s.events, event)
+}
+
+// 免打扰结束的时间，不在免打扰时间内时返回 now，支持跨天，如 22:00 至 08:00
+func (s *UserNotifySetting) QuietUntil(now time.Time) time.Time {
+	if s.QuietStart == "" || s.QuietEnd == "" || s.QuietStart == s.QuietEnd {
+		return now
+	}
+	current := now.Format("15:04")
+	if s.QuietStart < s.QuietEnd {
+		if current < s.QuietStart || current >= s.QuietEnd {
+			return now
+		}
+	} else if current < s.QuietStart && current >= s.QuietEnd {
+		return now
+	}
+
+	end := atClock(now, s.QuietEnd)
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// 是否到了发送汇总的时间，关闭汇总后暂存的通知立即发送
+func (s *UserNotifySetting) DigestDue(now time.Time) bool {
+	switch s.Digest {
+	case DigestNone:
+		return true
+	case DigestHourly:
+		return s.LastDigest == nil || now.Sub(s.LastDigest.Time) >= time.Hour
+	case DigestDaily:
+		sendTime := atClock(now, s.DigestTime)
+		if now.Before(sendTime) {
+			return false
+		}
+		return s.LastDigest == nil || s.LastDigest.Time.Before(sendTime)
+	}
+	return false
+}
+
+func parseStringList(value json.RawMessage) (list []string, err error) {
+	if len(value) == 0 || string(value) == "null" {
+		return
+	}
+	err = json.Unmarshal(value, &list)
+	return
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// 当天指定时刻，clock 格式为 15:04
+func atClock(day time.Time, clock string) time.Time {
+	t, _ := time.Parse("15:04", clock)
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location())
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/service"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 工单引擎，由引擎负责事务的开启、提交与回滚，定时任务、命令行及回调等均可驱动工单流转
+*/
+
+type (
+	Actor            = service.Actor            // 操作人
+	HandleCommand    = service.HandleCommand    // 处理工单
+	CreateCommand    = service.CreateCommand    // 新建工单
+	ReturnCommand    = service.ReturnCommand    // 退回工单
+	AddSignerCommand = service.AddSignerCommand // 加签
+	WithdrawCommand  = service.WithdrawCommand  // 撤回工单
+	InversionCommand = service.InversionCommand // 转交工单
+	ClaimCommand     = service.ClaimCommand     // 认领或释放工单
+	WorkOrderCommand = service.WorkOrderCommand // 手动结束或重开工单
+	MigrateCommand   = service.MigrateCommand   // 迁移工单的流程版本
+)
+
+// 当前用户没有节点的处理权限
+var ErrPermissionDenied = errors.New("当前用户没有权限进行此操作")
+
+func NewActor(user *system.SysUser) *Actor {
+	return service.NewActor(user)
+}
+
+// 根据用户ID查询操作人
+func LoadActor(userId int) (*Actor, error) {
+	return service.LoadActor(userId)
+}
+
+// 判断操作人是否可以处理工单的节点
+func Authorize(actor *Actor, workOrderId int, state string) (status bool, err error) {
+	status, err = service.JudgeUserAuthority(actor, workOrderId, state)
+	if err != nil {
+		err = fmt.Errorf("判断用户是否有权限失败，%v", err.Error())
+	}
+	return
+}
+
+// 处理工单，校验操作人的处理权限后在同一事务中完成流转，提交后执行任务
+func HandleWorkOrder(actor *Actor, cmd *HandleCommand) (err error) {
+	var handle service.Handle
+
+	err = authorize(actor, cmd.WorkOrderId, cmd.SourceState)
+	if err != nil {
+		return
+	}
+
+	err = transaction(func(tx *gorm.DB) error {
+		return handle.HandleWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		return fmt.Errorf("处理工单失败，%w", err)
+	}
+
+	if cmd.IsExecTask {
+		err = handle.ExecTasks(cmd)
+	}
+	return
+}
+
+// 新建工单，提交后执行任务
+func CreateWorkOrder(actor *Actor, cmd *CreateCommand) (workOrder *process.WorkOrderInfo, err error) {
+	err = transaction(func(tx *gorm.DB) (txErr error) {
+		workOrder, txErr = service.CreateWorkOrder(tx, actor, cmd)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	err = service.ExecCreateTasks(cmd, workOrder)
+	return
+}
+
+// 在事务中执行，返回错误或发生 panic 时回滚
+func transaction(fn func(tx *gorm.DB) error) (err error) {
+	tx := orm.Eloquent.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("开启事务失败，%v", tx.Error.Error())
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case string:
+				err = errors.New(e)
+			case error:
+				err = e
+			default:
+				err = errors.New("未知错误")
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit().Error
+	}()
+
+	err = fn(tx)
+	return
+}
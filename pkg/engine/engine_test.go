@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"errors"
+	"ferry/models/process"
+	"ferry/pkg/service"
+	"ferry/pkg/testdb"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 开始 -> 审批(用户 2) -> 结束
+var approveStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "approve", "label": "审批", "clazz": process.NodeUserTask, "sort": 2, "assignType": process.AssignPerson, "assignValue": []int{2}},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 3},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "approve"},
+		{"id": "e2", "source": "approve", "target": "end"},
+	},
+}
+
+func newApproveWorkOrder(t *testing.T) (db *gorm.DB, workOrder process.WorkOrderInfo) {
+	db = testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, approveStructure)
+	workOrder = testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{{
+		Id:            "approve",
+		Label:         "审批",
+		Processor:     []int{2},
+		ProcessMethod: process.AssignPerson,
+	}})
+	return
+}
+
+func approveCommand(workOrderId int, version int) *HandleCommand {
+	return &HandleCommand{
+		WorkOrderId:    workOrderId,
+		SourceState:    "approve",
+		TargetState:    "end",
+		Circulation:    "同意",
+		FlowProperties: 1,
+		Version:        &version,
+	}
+}
+
+// 不经过 HTTP 请求，由引擎完成权限校验、事务及流转
+func TestHandleWorkOrder(t *testing.T) {
+	db, workOrder := newApproveWorkOrder(t)
+
+	actor, err := LoadActor(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = HandleWorkOrder(actor, approveCommand(workOrder.Id, workOrder.Version))
+	if err != nil {
+		t.Fatalf("处理工单失败，%v", err)
+	}
+
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.IsEnd != 1 {
+		t.Errorf("工单未结束，当前节点 %s", result.State)
+	}
+	if result.Version <= workOrder.Version {
+		t.Errorf("工单版本未递增，处理前 %v，处理后 %v", workOrder.Version, result.Version)
+	}
+	historyList := testdb.Histories(t, db, workOrder.Id)
+	if len(historyList) != 2 {
+		t.Fatalf("期望 2 条流转历史，实际为 %v 条", len(historyList))
+	}
+	if historyList[0].Source != "approve" || historyList[0].Target != "end" || historyList[0].ProcessorId != 2 {
+		t.Errorf("流转历史不正确，%+v", historyList[0])
+	}
+}
+
+// 没有节点处理权限时不开启事务，工单保持不变
+func TestHandleWorkOrderPermissionDenied(t *testing.T) {
+	db, workOrder := newApproveWorkOrder(t)
+
+	actor, err := LoadActor(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = HandleWorkOrder(actor, approveCommand(workOrder.Id, workOrder.Version))
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("期望没有权限，实际为 %v", err)
+	}
+	assertUnchanged(t, db, workOrder)
+}
+
+// 客户端读取的工单版本已过期时回滚，返回 ErrWorkOrderChanged
+func TestHandleWorkOrderStaleVersion(t *testing.T) {
+	db, workOrder := newApproveWorkOrder(t)
+
+	actor, err := LoadActor(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = HandleWorkOrder(actor, approveCommand(workOrder.Id, workOrder.Version+1))
+	if !errors.Is(err, service.ErrWorkOrderChanged) {
+		t.Fatalf("期望工单版本冲突，实际为 %v", err)
+	}
+	assertUnchanged(t, db, workOrder)
+}
+
+func assertUnchanged(t *testing.T, db *gorm.DB, workOrder process.WorkOrderInfo) {
+	t.Helper()
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.Version != workOrder.Version || result.IsEnd != 0 {
+		t.Errorf("工单已被修改，版本 %v，是否结束 %v", result.Version, result.IsEnd)
+	}
+	if historyList := testdb.Histories(t, db, workOrder.Id); len(historyList) != 0 {
+		t.Errorf("期望没有流转历史，实际为 %v 条", len(historyList))
+	}
+}
+
+// 退回工单由引擎校验处理权限，没有权限时不开启事务
+func TestReturnWorkOrderPermissionDenied(t *testing.T) {
+	db, workOrder := newApproveWorkOrder(t)
+
+	actor, err := LoadActor(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ReturnWorkOrder(actor, &ReturnCommand{
+		WorkOrderId: workOrder.Id,
+		SourceState: "approve",
+		TargetState: "start",
+		Remarks:     "退回",
+		Version:     &workOrder.Version,
+	})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("期望没有权限，实际为 %v", err)
+	}
+	assertUnchanged(t, db, workOrder)
+}
+
+// 开始 -> 审批(用户 2，时效 60 分钟，超时转交用户 3) -> 结束
+var slaStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "approve", "label": "审批", "clazz": process.NodeUserTask, "sort": 2, "assignType": process.AssignPerson, "assignValue": []int{2},
+			"sla": map[string]interface{}{"duration": 60, "actions": []string{process.SlaActionReassign}, "reassignTo": 3}},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 3},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "approve"},
+		{"id": "e2", "source": "approve", "target": "end"},
+	},
+}
+
+// 定时检查时效时由引擎开启事务，时效状态及转交在同一事务中写入
+func TestCheckSla(t *testing.T) {
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, slaStructure)
+	workOrder := testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{{
+		Id:            "approve",
+		Label:         "审批",
+		Processor:     []int{2},
+		ProcessMethod: process.AssignPerson,
+	}})
+	err := db.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrder.Id).Updates(map[string]interface{}{
+		"due_time":   time.Now().Add(-time.Minute),
+		"sla_node":   "approve",
+		"sla_status": process.SlaStatusNormal,
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSla()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.SlaStatus != process.SlaStatusBreached {
+		t.Errorf("期望时效状态为已超时，实际为 %v", result.SlaStatus)
+	}
+	stateList, err := process.ParseState(result.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stateList) != 1 || len(stateList[0].Processor) != 1 || stateList[0].Processor[0] != 3 {
+		t.Errorf("期望转交给用户 3，实际节点为 %s", result.State)
+	}
+}
+
+// 开始 -> 任务(执行失败时转到修复) -> 复核(assignValue 为空时无法流转) -> 结束，修复 -> 结束
+func scriptStructure(reviewAssignee []int, fixAssignee []int) map[string]interface{} {
+	return map[string]interface{}{
+		"nodes": []map[string]interface{}{
+			{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+			{"id": "task", "label": "任务", "clazz": process.NodeScriptTask, "sort": 2,
+				"script": map[string]interface{}{"task": "deploy.sh", "errorTarget": "fix"}},
+			{"id": "review", "label": "复核", "clazz": process.NodeUserTask, "sort": 3, "assignType": process.AssignPerson, "assignValue": reviewAssignee},
+			{"id": "fix", "label": "修复", "clazz": process.NodeUserTask, "sort": 4, "assignType": process.AssignPerson, "assignValue": fixAssignee},
+			{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 5},
+		},
+		"edges": []map[string]interface{}{
+			{"id": "e1", "source": "start", "target": "task"},
+			{"id": "e2", "source": "task", "target": "review"},
+			{"id": "e3", "source": "review", "target": "end"},
+			{"id": "e4", "source": "fix", "target": "end"},
+		},
+	}
+}
+
+// 创建停留在任务节点且脚本正在执行的工单
+func newScriptWorkOrder(t *testing.T, structure map[string]interface{}) (db *gorm.DB, workOrder process.WorkOrderInfo, script *process.WorkOrderScript) {
+	db = testdb.Open(t)
+	testdb.Users(t, db, 1, 2)
+	processInfo := testdb.Process(t, db, structure)
+	workOrder = testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{{Id: "task", Label: "任务"}})
+	script = &process.WorkOrderScript{
+		WorkOrder: workOrder.Id,
+		Node:      "task",
+		Task:      "deploy.sh",
+		Status:    process.ScriptStatusRunning,
+	}
+	err := db.Create(script).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func getScript(t *testing.T, db *gorm.DB, id int) (script process.WorkOrderScript) {
+	t.Helper()
+	err := db.Where("id = ?", id).Find(&script).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// 执行成功但无法流转到后续节点时，任务标记为执行失败，工单停留在执行失败时的人工处理节点
+func TestFinishScriptRouteFailure(t *testing.T) {
+	db, workOrder, script := newScriptWorkOrder(t, scriptStructure([]int{}, []int{2}))
+
+	err := finishScript(script, &service.ScriptResult{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := getScript(t, db, script.Id)
+	if result.Status != process.ScriptStatusFailed || result.LastError == "" || result.Target != "fix" {
+		t.Errorf("期望任务执行失败并流转到修复节点，实际为 %+v", result)
+	}
+	stateList, err := process.ParseState(testdb.GetWorkOrder(t, db, workOrder.Id).State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stateList) != 1 || stateList[0].Id != "fix" || len(stateList[0].Processor) != 1 || stateList[0].Processor[0] != 2 {
+		t.Errorf("期望工单停留在修复节点，实际为 %+v", stateList)
+	}
+	if historyList := testdb.Histories(t, db, workOrder.Id); len(historyList) != 1 || historyList[0].Target != "fix" {
+		t.Errorf("期望一条流转到修复节点的历史，实际为 %+v", historyList)
+	}
+}
+
+// 执行失败时的节点同样无法处理时，任务标记为执行失败，工单停留在任务节点，不会重复执行
+func TestFinishScriptErrorTargetFailure(t *testing.T) {
+	db, workOrder, script := newScriptWorkOrder(t, scriptStructure([]int{2}, []int{}))
+
+	err := finishScript(script, &service.ScriptResult{ExitCode: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := getScript(t, db, script.Id)
+	if result.Status != process.ScriptStatusFailed || result.LastError == "" || result.Target != "" {
+		t.Errorf("期望任务执行失败，实际为 %+v", result)
+	}
+	stateList, err := process.ParseState(testdb.GetWorkOrder(t, db, workOrder.Id).State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stateList) != 1 || stateList[0].Id != "task" {
+		t.Errorf("期望工单停留在任务节点，实际为 %+v", stateList)
+	}
+	if historyList := testdb.Histories(t, db, workOrder.Id); len(historyList) != 1 {
+		t.Errorf("期望一条执行失败的历史，实际为 %v 条", len(historyList))
+	}
+
+	// 任务已不在执行中，再次处理时不会重复流转
+	err = finishScript(script, &service.ScriptResult{ExitCode: 1})
+	if err == nil {
+		t.Error("已处理的任务不应再次流转")
+	}
+}
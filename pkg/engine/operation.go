@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"ferry/models/process"
+	"ferry/pkg/service"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 退回、加签、撤回、转交、认领等工单操作，均在引擎开启的事务中完成
+*/
+
+// 退回工单，操作人需要有当前节点的处理权限
+func ReturnWorkOrder(actor *Actor, cmd *ReturnCommand) (err error) {
+	err = authorize(actor, cmd.WorkOrderId, cmd.SourceState)
+	if err != nil {
+		return
+	}
+
+	err = transaction(func(tx *gorm.DB) error {
+		return service.ReturnWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("退回工单失败，%w", err)
+	}
+	return
+}
+
+// 加签，操作人需要有当前节点的处理权限
+func AddSigner(actor *Actor, cmd *AddSignerCommand) (err error) {
+	err = authorize(actor, cmd.WorkOrderId, cmd.SourceState)
+	if err != nil {
+		return
+	}
+
+	err = transaction(func(tx *gorm.DB) error {
+		return service.AddSigner(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("加签失败，%w", err)
+	}
+	return
+}
+
+// 创建人撤回工单
+func WithdrawWorkOrder(actor *Actor, cmd *WithdrawCommand) (err error) {
+	err = transaction(func(tx *gorm.DB) error {
+		return service.WithdrawWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("撤回工单失败，%w", err)
+	}
+	return
+}
+
+// 转交工单，actor 为空时表示由系统转交
+func InversionWorkOrder(actor *Actor, cmd *InversionCommand) (err error) {
+	err = transaction(func(tx *gorm.DB) error {
+		return service.InversionWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("转交工单失败，%w", err)
+	}
+	return
+}
+
+// 认领工单
+func ClaimWorkOrder(actor *Actor, cmd *ClaimCommand) (err error) {
+	err = transaction(func(tx *gorm.DB) error {
+		return service.ClaimWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("接单失败，%w", err)
+	}
+	return
+}
+
+// 释放认领的工单
+func ReleaseWorkOrder(actor *Actor, cmd *ClaimCommand) (err error) {
+	err = transaction(func(tx *gorm.DB) error {
+		return service.ReleaseWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("释放工单失败，%w", err)
+	}
+	return
+}
+
+// 手动结束工单
+func EndWorkOrder(actor *Actor, cmd *WorkOrderCommand) (err error) {
+	err = transaction(func(tx *gorm.DB) error {
+		return service.EndWorkOrder(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("结束工单失败，%w", err)
+	}
+	return
+}
+
+// 重开工单，返回新建的工单
+func ReopenWorkOrder(actor *Actor, cmd *WorkOrderCommand) (workOrder *process.WorkOrderInfo, err error) {
+	err = transaction(func(tx *gorm.DB) (txErr error) {
+		workOrder, txErr = service.ReopenWorkOrder(tx, actor, cmd)
+		return
+	})
+	if err != nil {
+		err = fmt.Errorf("重开工单失败，%w", err)
+	}
+	return
+}
+
+// 将未结束的工单迁移到流程的新版本，任意工单迁移失败时全部回滚
+func MigrateWorkOrders(actor *Actor, cmd *MigrateCommand) (err error) {
+	err = transaction(func(tx *gorm.DB) error {
+		return service.MigrateWorkOrders(tx, actor, cmd)
+	})
+	if err != nil {
+		err = fmt.Errorf("迁移工单失败，%w", err)
+	}
+	return
+}
+
+// 校验操作人是否可以处理工单的节点
+func authorize(actor *Actor, workOrderId int, state string) (err error) {
+	status, err := Authorize(actor, workOrderId, state)
+	if err != nil {
+		return
+	}
+	if !status {
+		return ErrPermissionDenied
+	}
+	return
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/pkg/logger"
+	"ferry/pkg/service"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 后台任务驱动的工单流转，时效升级、定时节点、认领超时及阻塞任务节点均由引擎开启事务
+*/
+
+// 按照配置的间隔定时执行 check，未配置时使用 defaultInterval
+func schedule(key string, defaultInterval time.Duration, name string, check func() error) {
+	interval := viper.GetDuration(key)
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := check()
+		if err != nil {
+			logger.Errorf("%v失败，%v", name, err.Error())
+		}
+	}
+}
+
+// 定时检查工单时效
+func StartSlaScheduler() {
+	schedule("settings.sla.interval", time.Minute, "工单时效检查", CheckSla)
+}
+
+// 检查所有未结束工单的时效，每个工单的升级在单独的事务中执行，升级失败时回滚，下次检查时重新升级
+func CheckSla() (err error) {
+	escalationList, err := service.SlaEscalations(orm.Eloquent)
+	if err != nil {
+		return
+	}
+
+	for _, escalation := range escalationList {
+		err = transaction(func(tx *gorm.DB) error {
+			return service.EscalateSla(tx, escalation)
+		})
+		if err != nil {
+			logger.Errorf("工单 %v 的时效升级失败，%v", escalation.WorkOrder.Id, err.Error())
+		}
+	}
+	return nil
+}
+
+// 定时触发到期的定时任务
+func StartTimerScheduler() {
+	schedule("settings.timer.interval", time.Minute, "定时节点检查", CheckTimers)
+}
+
+// 触发所有到期的定时任务，失败时回滚并按次数推迟重试
+func CheckTimers() (err error) {
+	timerList, err := service.DueTimers(orm.Eloquent)
+	if err != nil {
+		return
+	}
+
+	for _, timer := range timerList {
+		err = transaction(func(tx *gorm.DB) error {
+			return service.FireTimer(tx, timer)
+		})
+		if err == nil {
+			continue
+		}
+		logger.Errorf("工单 %v 的定时任务 %v 触发失败，%v", timer.WorkOrder, timer.Id, err.Error())
+		err = service.RetryTimer(orm.Eloquent, timer, err)
+		if err != nil {
+			logger.Errorf("更新定时任务 %v 失败，%v", timer.Id, err.Error())
+		}
+	}
+	return nil
+}
+
+// 定时释放超时的认领
+func StartClaimScheduler() {
+	schedule("settings.claim.interval", time.Minute, "释放超时的认领", CheckClaims)
+}
+
+// 释放超过空闲时间的认领，超时时间为 0 时不会自动释放
+func CheckClaims() (err error) {
+	timeout := service.ClaimTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	workOrderIds, err := service.ClaimedWorkOrders(orm.Eloquent)
+	if err != nil {
+		return
+	}
+
+	for _, workOrderId := range workOrderIds {
+		err = transaction(func(tx *gorm.DB) error {
+			return service.ReleaseExpiredClaims(tx, workOrderId, timeout)
+		})
+		if err != nil {
+			logger.Errorf("工单 %v 释放超时的认领失败，%v", workOrderId, err.Error())
+		}
+	}
+	return nil
+}
+
+// 定时执行待执行的脚本任务
+func StartScriptScheduler() {
+	schedule("settings.scripttask.interval", 10*time.Second, "任务节点检查", CheckScripts)
+}
+
+// 执行待执行的脚本任务，脚本在事务外执行，执行完成后在事务中按照执行结果流转工单。
+// 服务停止时仍在执行中的任务在超过截止时间后按照执行失败处理
+func CheckScripts() (err error) {
+	var wg sync.WaitGroup
+
+	interruptedList, err := service.InterruptedScripts(orm.Eloquent)
+	if err != nil {
+		return
+	}
+	for _, script := range interruptedList {
+		err = finishScript(script, &service.ScriptResult{Err: service.ErrScriptInterrupted})
+		if err != nil {
+			logger.Errorf("工单 %v 的脚本任务 %v 处理失败，%v", script.WorkOrder, script.Id, err.Error())
+		}
+	}
+
+	scriptList, err := service.PendingScripts(orm.Eloquent)
+	if err != nil {
+		return
+	}
+	for _, script := range scriptList {
+		wg.Add(1)
+		go func(script *process.WorkOrderScript) {
+			defer wg.Done()
+			res, runErr := service.RunScript(orm.Eloquent, script)
+			if runErr == nil && res != nil {
+				runErr = finishScript(script, res)
+			}
+			if runErr != nil {
+				logger.Errorf("工单 %v 的脚本任务 %v 执行失败，%v", script.WorkOrder, script.Id, runErr.Error())
+			}
+		}(script)
+	}
+	wg.Wait()
+	return nil
+}
+
+// 按照执行结果流转工单，无法流转时回滚后在新的事务中将任务标记为执行失败，任务不会停留在执行中被重复处理
+func finishScript(script *process.WorkOrderScript, res *service.ScriptResult) error {
+	err := transaction(func(tx *gorm.DB) error {
+		return service.FinishScript(tx, script, process.ScriptStatusRunning, res)
+	})
+	if errors.Is(err, service.ErrScriptRoute) {
+		cause := err
+		err = transaction(func(tx *gorm.DB) error {
+			return service.FailScript(tx, script, process.ScriptStatusRunning, cause)
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("流转工单失败，%w", err)
+	}
+	return nil
+}
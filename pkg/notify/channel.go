@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 通知渠道配置，对应 process.Info.Notice
+*/
+
+const (
+	ChannelEmail    = "email"    // 邮件
+	ChannelSms      = "sms"      // 阿里云短信
+	ChannelWebhook  = "webhook"  // 通用 Webhook
+	ChannelDingTalk = "dingtalk" // 钉钉机器人
+	ChannelWeCom    = "wecom"    // 企业微信机器人
+	ChannelFeiShu   = "feishu"   // 飞书机器人
+)
+
+// 兼容原有的通知类型编号
+var classifyChannel = map[int]string{
+	1: ChannelEmail,
+	2: ChannelSms,
+	3: ChannelWebhook,
+	4: ChannelDingTalk,
+	5: ChannelWeCom,
+	6: ChannelFeiShu,
+}
+
+// 流程中的通知配置，兼容原有的编号列表，如 [1]，也可以配置为对象以指定渠道参数，如
+// [1, {"type": "dingtalk", "webhook": "https://oapi.dingtalk.com/robot/send?access_token=xxx", "secret": "SECxxx"}]。
+// 未在流程中配置的 webhook、secret 及 options 从配置文件 settings.notify.<渠道> 中读取。
+type Channel struct {
+	Type     string            `json:"type"`               // 通知渠道
+	Webhook  string            `json:"webhook,omitempty"`  // 机器人或 Webhook 地址
+	Secret   string            `json:"secret,omitempty"`   // 签名密钥
+	Template string            `json:"template,omitempty"` // 模版文件，为空时使用渠道默认模版
+	Options  map[string]string `json:"options,omitempty"`  // 渠道的其他参数
+}
+
+// 获取参数，流程中未配置时从配置文件中读取
+func (c *Channel) Option(key string) string {
+	if value, ok := c.Options[key]; ok && value != "" {
+		return value
+	}
+	return viper.GetString(fmt.Sprintf("settings.notify.%v.%v", c.Type, strings.ToLower(key)))
+}
+
+// 机器人或 Webhook 地址
+func (c *Channel) WebhookUrl() string {
+	if c.Webhook != "" {
+		return c.Webhook
+	}
+	return c.Option("webhook")
+}
+
+// 签名密钥
+func (c *Channel) SecretKey() string {
+	if c.Secret != "" {
+		return c.Secret
+	}
+	return c.Option("secret")
+}
+
+// 解析流程中的通知配置
+func ParseNotice(notice json.RawMessage) (channels []*Channel, err error) {
+	var itemList []json.RawMessage
+
+	if len(notice) == 0 || string(notice) == "null" {
+		return
+	}
+
+	err = json.Unmarshal(notice, &itemList)
+	if err != nil {
+		return nil, fmt.Errorf("通知配置格式不正确，%v", err.Error())
+	}
+
+	for _, item := range itemList {
+		var (
+			classify int
+			name     string
+			channel  = &Channel{}
+		)
+
+		if json.Unmarshal(item, &classify) == nil {
+			name, ok := classifyChannel[classify]
+			if !ok {
+				return nil, fmt.Errorf("不支持的通知类型 %v", classify)
+			}
+			channel.Type = name
+		} else if json.Unmarshal(item, &name) == nil {
+			channel.Type = name
+		} else {
+			err = json.Unmarshal(item, channel)
+			if err != nil {
+				return nil, fmt.Errorf("通知配置格式不正确，%v", err.Error())
+			}
+		}
+
+		if _, err = GetNotifier(channel.Type); err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return
+}
+
+// 默认通知渠道
+func DefaultChannels() []*Channel {
+	return []*Channel{{Type: ChannelEmail}}
+}
@@ -47,3 +47,8 @@ func SendMail(mailTo []string, ccTo []string, subject, body string) {
 	}
 	logger.Info("send successfully")
 }
+
+// 发送邮件并返回发送结果
+func Send(mailTo []string, ccTo []string, subject, body string) error {
+	return server(mailTo, ccTo, subject, body)
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"errors"
+	"ferry/pkg/notify/email"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 邮件通知
+*/
+
+type emailNotifier struct{}
+
+func (n *emailNotifier) Name() string {
+	return ChannelEmail
+}
+
+func (n *emailNotifier) Send(b *BodyData, channel *Channel) (err error) {
+	var emailList []string
+
+	for _, user := range b.UserList() {
+		if user.Email != "" {
+			emailList = append(emailList, user.Email)
+		}
+	}
+	if len(emailList) == 0 {
+		return
+	}
+
+	err = b.ParsingTemplate(channel, defaultTemplates[ChannelEmail])
+	if err != nil {
+		return errors.New("模版内容解析失败，" + err.Error())
+	}
+
+	return email.Send(emailList, b.EmailCcTo, b.Subject, b.Content)
+}
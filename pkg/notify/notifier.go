@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 通知渠道注册
+*/
+
+// 通知渠道，新增渠道时实现此接口并调用 Register 注册即可
+type Notifier interface {
+	// 渠道名称，对应 Channel.Type
+	Name() string
+	// 发送通知
+	Send(b *BodyData, channel *Channel) error
+}
+
+var (
+	notifierLock sync.RWMutex
+	notifierMap  = make(map[string]Notifier)
+)
+
+// 注册通知渠道，同名渠道会被覆盖
+func Register(n Notifier) {
+	notifierLock.Lock()
+	defer notifierLock.Unlock()
+	notifierMap[n.Name()] = n
+}
+
+// 获取通知渠道
+func GetNotifier(name string) (n Notifier, err error) {
+	notifierLock.RLock()
+	defer notifierLock.RUnlock()
+	n, ok := notifierMap[name]
+	if !ok {
+		err = fmt.Errorf("不支持的通知渠道 %v", name)
+	}
+	return
+}
+
+// 已注册的通知渠道
+func NotifierList() (nameList []string) {
+	notifierLock.RLock()
+	defer notifierLock.RUnlock()
+	for name := range notifierMap {
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+	return
+}
+
+func init() {
+	Register(&emailNotifier{})
+	Register(&smsNotifier{})
+	Register(&webhookNotifier{})
+	Register(&dingTalkNotifier{})
+	Register(&weComNotifier{})
+	Register(&feiShuNotifier{})
+}
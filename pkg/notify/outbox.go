@@ -0,0 +1,330 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/jsonTime"
+	"ferry/pkg/logger"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 通知发件箱，通知先写入发件箱，由后台任务按照指数退避重试发送
+*/
+
+const (
+	outboxBatchSize     = 100
+	outboxBaseBackoff   = 30 * time.Second
+	outboxMaxBackoff    = time.Hour
+	outboxSendingExpire = 10 * time.Minute
+)
+
+// 将通知写入发件箱，每个通知渠道一条记录，db 传入事务时与事务一同提交。
+// 通知设置了事件时按接收人的通知偏好筛选渠道、推迟到免打扰时间之后或暂存为汇总通知。
+func Enqueue(db *gorm.DB, b *BodyData) (err error) {
+	type outboxKey struct {
+		channel  *Channel
+		nextTime time.Time
+	}
+
+	var (
+		settings  map[int]*system.UserNotifySetting
+		keyList   []outboxKey
+		batches   = make(map[outboxKey][]system.SysUser)
+		ccChannel = make(map[string]bool)
+		defaults  = make(map[string]*Channel)
+		now       = time.Now()
+		userList  = b.UserList()
+	)
+
+	if len(b.Channels) == 0 || len(userList) == 0 {
+		return
+	}
+
+	if b.Event != "" {
+		settings, err = userSettings(db, userList)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, user := range userList {
+		var (
+			setting  = settings[user.UserId]
+			nextTime = now
+		)
+
+		if setting != nil {
+			if !setting.Subscribed(b.Event) {
+				continue
+			}
+			if setting.Digest != system.DigestNone && digestEvents[b.Event] {
+				err = addDigest(db, user.UserId, b)
+				if err != nil {
+					return
+				}
+				continue
+			}
+			nextTime = setting.QuietUntil(now)
+		}
+
+		for _, channel := range userChannels(setting, b.Channels, defaults) {
+			key := outboxKey{channel: channel, nextTime: nextTime}
+			if _, ok := batches[key]; !ok {
+				keyList = append(keyList, key)
+			}
+			batches[key] = append(batches[key], user)
+		}
+	}
+
+	maxAttempts := viper.GetInt("settings.notify.outbox.maxattempts")
+	if maxAttempts <= 0 {
+		maxAttempts = 6
+	}
+
+	for _, key := range keyList {
+		var (
+			recipients []byte
+			payload    []byte
+			config     []byte
+			data       = *b
+		)
+
+		data.SendTo = map[string]interface{}{
+			"userList": batches[key],
+		}
+		recipients, err = json.Marshal(data.Recipients())
+		if err != nil {
+			return
+		}
+
+		// 接收人单独保存，通知数据中不保存用户信息，同一渠道仅抄送一次
+		data.SendTo = nil
+		data.Channels = nil
+		if ccChannel[key.channel.Type] {
+			data.EmailCcTo = nil
+		}
+		ccChannel[key.channel.Type] = true
+		payload, err = json.Marshal(data)
+		if err != nil {
+			return
+		}
+
+		config, err = json.Marshal(key.channel)
+		if err != nil {
+			return
+		}
+
+		err = db.Create(&process.NotifyOutbox{
+			WorkOrder:   b.Id,
+			Channel:     key.channel.Type,
+			Config:      config,
+			Subject:     b.Subject,
+			Recipients:  recipients,
+			Payload:     payload,
+			Status:      process.NotifyStatusPending,
+			MaxAttempts: maxAttempts,
+			NextTime:    jsonTime.JSONTime{Time: key.nextTime},
+		}).Error
+		if err != nil {
+			return fmt.Errorf("写入通知发件箱失败，%v", err.Error())
+		}
+	}
+	return
+}
+
+// 重新发送通知
+func Resend(outboxId int) (err error) {
+	result := orm.Eloquent.Model(&process.NotifyOutbox{}).
+		Where("id = ? and status != ?", outboxId, process.NotifyStatusSending).
+		Updates(map[string]interface{}{
+			"status":    process.NotifyStatusPending,
+			"attempts":  0,
+			"next_time": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("通知不存在或正在发送中")
+	}
+	return
+}
+
+// 定时发送发件箱中的通知
+func StartOutboxWorker() {
+	interval := viper.GetDuration("settings.notify.outbox.interval")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := DeliverOutbox()
+		if err != nil {
+			logger.Errorf("发送通知失败，%v", err.Error())
+		}
+	}
+}
+
+// 发送所有到期的通知
+func DeliverOutbox() (err error) {
+	var outboxList []*process.NotifyOutbox
+
+	// 发送中的状态长时间未更新，说明发送过程中服务已停止，重新发送
+	err = orm.Eloquent.Model(&process.NotifyOutbox{}).
+		Where("status = ? and update_time < ?", process.NotifyStatusSending, time.Now().Add(-outboxSendingExpire)).
+		Update("status", process.NotifyStatusPending).Error
+	if err != nil {
+		return
+	}
+
+	err = orm.Eloquent.Model(&process.NotifyOutbox{}).
+		Where("status = ? and next_time <= ?", process.NotifyStatusPending, time.Now()).
+		Order("next_time").
+		Limit(outboxBatchSize).
+		Find(&outboxList).Error
+	if err != nil {
+		return
+	}
+
+	for _, outbox := range outboxList {
+		deliver(outbox)
+	}
+	return
+}
+
+// 发送单条通知并记录发送结果
+func deliver(outbox *process.NotifyOutbox) {
+	var (
+		sendErr     error
+		startTime   = time.Now()
+		status      = process.NotifyStatusSuccess
+		updateValue map[string]interface{}
+	)
+
+	// 仅发送未被其他实例领取的通知
+	result := orm.Eloquent.Model(&process.NotifyOutbox{}).
+		Where("id = ? and status = ?", outbox.Id, process.NotifyStatusPending).
+		Updates(map[string]interface{}{
+			"status":   process.NotifyStatusSending,
+			"attempts": gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	outbox.Attempts++
+
+	sendErr = send(outbox)
+	if sendErr != nil {
+		status = process.NotifyStatusFailed
+	}
+
+	err := orm.Eloquent.Create(&process.NotifyAttempt{
+		Outbox:   outbox.Id,
+		Attempt:  outbox.Attempts,
+		Status:   status,
+		Error:    errorText(sendErr),
+		Duration: int64(time.Since(startTime) / time.Millisecond),
+	}).Error
+	if err != nil {
+		logger.Errorf("写入通知发送记录失败，%v", err.Error())
+	}
+
+	if sendErr == nil {
+		updateValue = map[string]interface{}{
+			"status":     process.NotifyStatusSuccess,
+			"sent_time":  time.Now(),
+			"last_error": "",
+		}
+	} else if outbox.Attempts < outbox.MaxAttempts {
+		updateValue = map[string]interface{}{
+			"status":     process.NotifyStatusPending,
+			"next_time":  time.Now().Add(backoff(outbox.Attempts)),
+			"last_error": errorText(sendErr),
+		}
+	} else {
+		updateValue = map[string]interface{}{
+			"status":     process.NotifyStatusFailed,
+			"last_error": errorText(sendErr),
+		}
+		logger.Errorf("通知 %v 发送失败，已达到最多发送次数，%v", outbox.Id, sendErr.Error())
+	}
+
+	err = orm.Eloquent.Model(&process.NotifyOutbox{}).
+		Where("id = ?", outbox.Id).
+		Updates(updateValue).Error
+	if err != nil {
+		logger.Errorf("更新通知状态失败，%v", err.Error())
+	}
+}
+
+// 还原通知数据并通过对应渠道发送
+func send(outbox *process.NotifyOutbox) (err error) {
+	var (
+		bodyData   BodyData
+		channel    Channel
+		recipients []Recipient
+		userList   []system.SysUser
+	)
+
+	err = json.Unmarshal(outbox.Payload, &bodyData)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(outbox.Config, &channel)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(outbox.Recipients, &recipients)
+	if err != nil {
+		return
+	}
+
+	for _, r := range recipients {
+		user := system.SysUser{}
+		user.UserId = r.UserId
+		user.NickName = r.NickName
+		user.Email = r.Email
+		user.Phone = r.Phone
+		userList = append(userList, user)
+	}
+	bodyData.SendTo = map[string]interface{}{
+		"userList": userList,
+	}
+
+	return bodyData.SendChannel(&channel)
+}
+
+// 第 n 次发送失败后的等待时间
+func backoff(attempts int) time.Duration {
+	wait := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return wait
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	text := []rune(err.Error())
+	if len(text) > 1000 {
+		text = text[:1000]
+	}
+	return string(text)
+}
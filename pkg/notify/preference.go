@@ -0,0 +1,303 @@
+package notify
+
+import (
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/logger"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 用户通知偏好及汇总通知
+*/
+
+// 通知事件
+const (
+	EventCreated     = "created"     // 新工单待处理
+	EventAssigned    = "assigned"    // 工单流转至当前用户
+	EventUrged       = "urged"       // 工单催办
+	EventTransferred = "transferred" // 工单转交
+	EventEnded       = "ended"       // 工单结束
+	EventDenied      = "denied"      // 工单被拒绝
+	EventWithdrawn   = "withdrawn"   // 工单被创建人撤回
+)
+
+// 用户可订阅的通知事件
+var EventList = []string{
+	EventCreated,
+	EventAssigned,
+	EventUrged,
+	EventTransferred,
+	EventEnded,
+	EventDenied,
+	EventWithdrawn,
+}
+
+// 待办类通知，用户开启汇总后合并发送
+var digestEvents = map[string]bool{
+	EventCreated:     true,
+	EventAssigned:    true,
+	EventUrged:       true,
+	EventTransferred: true,
+	EventDenied:      true,
+}
+
+// 汇总通知使用的模版，未配置的渠道使用渠道默认模版
+var digestTemplate = map[string]string{
+	ChannelEmail:    "./static/template/digest.html",
+	ChannelDingTalk: "./static/template/digest.md",
+	ChannelWeCom:    "./static/template/digest.md",
+	ChannelFeiShu:   "./static/template/digest.md",
+}
+
+// 汇总通知中的工单
+type DigestItem struct {
+	WorkOrder int    `json:"work_order"`
+	ProcessId int    `json:"process_id"`
+	Title     string `json:"title"`
+	Creator   string `json:"creator"`
+	Subject   string `json:"subject"`
+	Event     string `json:"event"`
+	CreatedAt string `json:"created_at"`
+}
+
+// 校验通知事件
+func ValidateEvents(events []string) error {
+	for _, event := range events {
+		if !containsEvent(event) {
+			return fmt.Errorf("不支持的通知事件 %v", event)
+		}
+	}
+	return nil
+}
+
+// 校验通知渠道
+func ValidateChannels(channels []string) (err error) {
+	for _, channel := range channels {
+		if _, err = GetNotifier(channel); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func containsEvent(event string) bool {
+	for _, e := range EventList {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// 查询接收人的通知偏好
+func userSettings(db *gorm.DB, userList []system.SysUser) (settings map[int]*system.UserNotifySetting, err error) {
+	var (
+		userIds     []int
+		settingList []*system.UserNotifySetting
+	)
+
+	settings = make(map[int]*system.UserNotifySetting)
+	for _, user := range userList {
+		userIds = append(userIds, user.UserId)
+	}
+
+	err = db.Model(&system.UserNotifySetting{}).
+		Where("user_id in (?)", userIds).
+		Find(&settingList).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询用户通知偏好失败，%v", err.Error())
+	}
+
+	for _, setting := range settingList {
+		if err := setting.Parse(); err != nil {
+			logger.Errorf("用户 %v 的通知偏好不正确，%v", setting.UserId, err.Error())
+			continue
+		}
+		settings[setting.UserId] = setting
+	}
+	return
+}
+
+// 按用户偏好筛选通知渠道，用户选择了流程未配置的渠道时使用渠道的默认配置，
+// 默认配置的渠道保存在 defaults 中，使相同渠道的接收人可以合并发送
+func userChannels(setting *system.UserNotifySetting, channels []*Channel, defaults map[string]*Channel) (result []*Channel) {
+	if setting == nil || len(setting.ChannelList()) == 0 {
+		return channels
+	}
+
+	for _, name := range setting.ChannelList() {
+		var matched bool
+		for _, channel := range channels {
+			if channel.Type == name {
+				result = append(result, channel)
+				matched = true
+			}
+		}
+		if !matched {
+			if _, ok := defaults[name]; !ok {
+				defaults[name] = &Channel{Type: name}
+			}
+			result = append(result, defaults[name])
+		}
+	}
+	return
+}
+
+// 暂存待汇总的通知
+func addDigest(db *gorm.DB, userId int, b *BodyData) error {
+	err := db.Create(&process.NotifyDigest{
+		UserId:    userId,
+		Event:     b.Event,
+		WorkOrder: b.Id,
+		ProcessId: b.ProcessId,
+		Subject:   b.Subject,
+		Title:     b.Title,
+		Creator:   b.Creator,
+		Priority:  b.Priority,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("写入汇总通知失败，%v", err.Error())
+	}
+	return nil
+}
+
+// 定时发送汇总通知
+func StartDigestWorker() {
+	interval := viper.GetDuration("settings.notify.digest.interval")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := SendDigest()
+		if err != nil {
+			logger.Errorf("发送汇总通知失败，%v", err.Error())
+		}
+	}
+}
+
+// 发送所有到期的汇总通知
+func SendDigest() (err error) {
+	var (
+		settingList []*system.UserNotifySetting
+		now         = time.Now()
+	)
+
+	err = orm.Eloquent.Model(&system.UserNotifySetting{}).
+		Where("digest != ? or user_id in (?)", system.DigestNone,
+			orm.Eloquent.Model(&process.NotifyDigest{}).Select("distinct user_id").QueryExpr()).
+		Find(&settingList).Error
+	if err != nil {
+		return
+	}
+
+	for _, setting := range settingList {
+		if err := setting.Parse(); err != nil {
+			logger.Errorf("用户 %v 的通知偏好不正确，%v", setting.UserId, err.Error())
+			continue
+		}
+		if !setting.DigestDue(now) {
+			continue
+		}
+		if err := sendUserDigest(setting, now); err != nil {
+			logger.Errorf("用户 %v 的汇总通知发送失败，%v", setting.UserId, err.Error())
+		}
+	}
+	return
+}
+
+// 将用户暂存的通知合并为一条通知写入发件箱
+func sendUserDigest(setting *system.UserNotifySetting, now time.Time) (err error) {
+	var (
+		digestList []*process.NotifyDigest
+		userList   []system.SysUser
+		itemList   []*DigestItem
+		digestIds  []int
+		channels   []*Channel
+	)
+
+	err = orm.Eloquent.Model(&process.NotifyDigest{}).
+		Where("user_id = ? and create_time <= ?", setting.UserId, now).
+		Order("id").
+		Find(&digestList).Error
+	if err != nil {
+		return
+	}
+
+	tx := orm.Eloquent.Begin()
+
+	if len(digestList) > 0 {
+		err = tx.Model(&system.SysUser{}).
+			Where("user_id = ?", setting.UserId).
+			Find(&userList).Error
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		for _, digest := range digestList {
+			digestIds = append(digestIds, digest.Id)
+			itemList = append(itemList, &DigestItem{
+				WorkOrder: digest.WorkOrder,
+				ProcessId: digest.ProcessId,
+				Title:     digest.Title,
+				Creator:   digest.Creator,
+				Subject:   digest.Subject,
+				Event:     digest.Event,
+				CreatedAt: digest.CreatedAt.Format("2006-01-02 15:04:05"),
+			})
+		}
+
+		for _, channel := range userChannels(setting, DefaultChannels(), make(map[string]*Channel)) {
+			channels = append(channels, &Channel{
+				Type:     channel.Type,
+				Template: digestTemplate[channel.Type],
+			})
+		}
+
+		subject := fmt.Sprintf("您有 %v 条待办工单提醒", len(itemList))
+		err = Enqueue(tx, &BodyData{
+			SendTo: map[string]interface{}{
+				"userList": userList,
+			},
+			Subject:     subject,
+			Title:       subject,
+			Description: "以下工单等待您处理",
+			Channels:    channels,
+			Digest:      itemList,
+			CreatedAt:   now.Format("2006-01-02 15:04:05"),
+		})
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Unscoped().
+			Where("id in (?)", digestIds).
+			Delete(&process.NotifyDigest{}).Error
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Model(&system.UserNotifySetting{}).
+		Where("id = ?", setting.Id).
+		Update("last_digest", now).Error
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	return tx.Commit().Error
+}
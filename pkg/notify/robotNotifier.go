@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 钉钉、企业微信、飞书群机器人通知
+*/
+
+// 钉钉机器人
+type dingTalkNotifier struct{}
+
+func (n *dingTalkNotifier) Name() string {
+	return ChannelDingTalk
+}
+
+func (n *dingTalkNotifier) Send(b *BodyData, channel *Channel) (err error) {
+	var phoneList []string
+
+	webhook := channel.WebhookUrl()
+	if webhook == "" {
+		return errors.New("未配置钉钉机器人地址")
+	}
+
+	err = b.ParsingTemplate(channel, defaultTemplates[ChannelDingTalk])
+	if err != nil {
+		return errors.New("模版内容解析失败，" + err.Error())
+	}
+
+	// 加签
+	if secret := channel.SecretKey(); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/1e6, 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "\n" + secret))
+		sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		webhook = fmt.Sprintf("%v&timestamp=%v&sign=%v", webhook, timestamp, sign)
+	}
+
+	// @ 处理人
+	content := b.Content
+	for _, user := range b.UserList() {
+		if user.Phone != "" {
+			phoneList = append(phoneList, user.Phone)
+			content += " @" + user.Phone
+		}
+	}
+
+	return postRobot(webhook, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]interface{}{
+			"title": b.Subject,
+			"text":  content,
+		},
+		"at": map[string]interface{}{
+			"atMobiles": phoneList,
+		},
+	})
+}
+
+// 企业微信机器人
+type weComNotifier struct{}
+
+func (n *weComNotifier) Name() string {
+	return ChannelWeCom
+}
+
+func (n *weComNotifier) Send(b *BodyData, channel *Channel) (err error) {
+	webhook := channel.WebhookUrl()
+	if webhook == "" {
+		return errors.New("未配置企业微信机器人地址")
+	}
+
+	err = b.ParsingTemplate(channel, defaultTemplates[ChannelWeCom])
+	if err != nil {
+		return errors.New("模版内容解析失败，" + err.Error())
+	}
+
+	return postRobot(webhook, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]interface{}{
+			"content": b.Content,
+		},
+	})
+}
+
+// 飞书机器人
+type feiShuNotifier struct{}
+
+func (n *feiShuNotifier) Name() string {
+	return ChannelFeiShu
+}
+
+func (n *feiShuNotifier) Send(b *BodyData, channel *Channel) (err error) {
+	var nameList []string
+
+	webhook := channel.WebhookUrl()
+	if webhook == "" {
+		return errors.New("未配置飞书机器人地址")
+	}
+
+	err = b.ParsingTemplate(channel, defaultTemplates[ChannelFeiShu])
+	if err != nil {
+		return errors.New("模版内容解析失败，" + err.Error())
+	}
+
+	content := b.Content
+	for _, user := range b.UserList() {
+		nameList = append(nameList, user.NickName)
+	}
+	if len(nameList) > 0 {
+		content += "\n处理人：" + strings.Join(nameList, "、")
+	}
+
+	payload := map[string]interface{}{
+		"msg_type": "interactive",
+		"card": map[string]interface{}{
+			"header": map[string]interface{}{
+				"title": map[string]interface{}{
+					"tag":     "plain_text",
+					"content": b.Subject,
+				},
+			},
+			"elements": []map[string]interface{}{{
+				"tag":     "markdown",
+				"content": content,
+			}},
+		},
+	}
+
+	// 签名校验
+	if secret := channel.SecretKey(); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	return postRobot(webhook, payload)
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"ferry/models/system"
 	"ferry/pkg/logger"
-	"ferry/pkg/notify/email"
+	"fmt"
 	"text/template"
 
 	"github.com/spf13/viper"
@@ -16,37 +16,56 @@ import (
 */
 
 type BodyData struct {
-	SendTo        interface{} // 接受人
-	EmailCcTo     []string    // 抄送人邮箱列表
-	Subject       string      // 标题
-	Classify      []int       // 通知类型
-	Id            int         // 工单ID
-	Title         string      // 工单标题
-	Creator       string      // 工单创建人
-	Priority      int         // 工单优先级
-	PriorityValue string      // 工单优先级
-	CreatedAt     string      // 工单创建时间
-	Content       string      // 通知的内容
-	Description   string      // 表格上面的描述信息
-	ProcessId     int         // 流程ID
-	Domain        string      // 域名地址
-	PhoneNumber   string      // 联系方式
-	ProblemText   string      // 问题描述
+	SendTo        interface{}            // 接受人
+	EmailCcTo     []string               // 抄送人邮箱列表
+	Subject       string                 // 标题
+	Channels      []*Channel             // 通知渠道
+	Id            int                    // 工单ID
+	Title         string                 // 工单标题
+	Creator       string                 // 工单创建人
+	Priority      int                    // 工单优先级
+	PriorityValue string                 // 工单优先级
+	CreatedAt     string                 // 工单创建时间
+	Content       string                 // 通知的内容
+	Description   string                 // 表格上面的描述信息
+	ProcessId     int                    // 流程ID
+	Domain        string                 // 域名地址
+	PhoneNumber   string                 // 联系方式
+	ProblemText   string                 // 问题描述
+	FormData      map[string]interface{} // 工单表单数据，以字段标识为键
+	Form          map[string]interface{} // 工单表单数据，以字段名称为键
+	Event         string                 // 通知事件，为空时不使用用户的通知偏好
+	Digest        []*DigestItem          // 汇总通知中的工单列表
 }
 
-func (b *BodyData) ParsingTemplate() (err error) {
+// 解析渠道模版，渠道指定了模版文件时使用指定的模版文件，
+// 否则优先使用数据库中配置的模版，均未配置时使用默认模版
+func (b *BodyData) ParsingTemplate(channel *Channel, defaultTemplate string) (err error) {
 	// 读取模版数据
 	var (
-		buf bytes.Buffer
+		buf          bytes.Buffer
+		templateFile = defaultTemplate
 	)
 
-	tmpl, err := template.ParseFiles("./static/template/email.html")
+	b.setDomain()
+
+	if channel != nil && channel.Template != "" {
+		templateFile = channel.Template
+	} else if channel != nil {
+		tpl, err := FindTemplate(channel.Type, b.Event, b.ProcessId)
+		if err != nil {
+			logger.Errorf("查询通知模版失败，使用默认模版，%v", err.Error())
+		} else if tpl != nil {
+			return b.renderTemplate(tpl)
+		}
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncMap).ParseFiles(templateFile)
 	if err != nil {
 		return
 	}
 
-	b.Domain = viper.GetString("settings.domain.url")
-	err = tmpl.Execute(&buf, b)
+	err = tmpl.ExecuteTemplate(&buf, tmpl.Templates()[0].Name(), b)
 	if err != nil {
 		return
 	}
@@ -56,11 +75,11 @@ func (b *BodyData) ParsingTemplate() (err error) {
 	return
 }
 
-func (b *BodyData) SendNotify() (err error) {
-	var (
-		emailList []string
-	)
+func (b *BodyData) setDomain() {
+	b.Domain = viper.GetString("settings.domain.url")
+}
 
+func (b *BodyData) setPriorityValue() {
 	switch b.Priority {
 	case 1:
 		b.PriorityValue = "正常"
@@ -69,22 +88,59 @@ func (b *BodyData) SendNotify() (err error) {
 	case 3:
 		b.PriorityValue = "非常紧急"
 	}
+}
+
+// 接收通知的用户列表
+func (b *BodyData) UserList() []system.SysUser {
+	if sendTo, ok := b.SendTo.(map[string]interface{}); ok {
+		if users, ok := sendTo["userList"].([]system.SysUser); ok {
+			return users
+		}
+	}
+	return nil
+}
+
+// 通知接收人，仅包含发送通知所需的用户信息
+type Recipient struct {
+	UserId   int    `json:"user_id"`
+	NickName string `json:"nick_name"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+}
+
+// 接收通知的用户，用于在模版中输出
+func (b *BodyData) Recipients() (recipients []Recipient) {
+	recipients = make([]Recipient, 0)
+	for _, user := range b.UserList() {
+		recipients = append(recipients, Recipient{
+			UserId:   user.UserId,
+			NickName: user.NickName,
+			Email:    user.Email,
+			Phone:    user.Phone,
+		})
+	}
+	return
+}
 
-	for _, c := range b.Classify {
-		switch c {
-		case 1: // 邮件
-			users := b.SendTo.(map[string]interface{})["userList"].([]system.SysUser)
-			if len(users) > 0 {
-				for _, user := range users {
-					emailList = append(emailList, user.Email)
-				}
-				err = b.ParsingTemplate()
-				if err != nil {
-					logger.Errorf("模版内容解析失败，%v", err.Error())
-					return
-				}
-				go email.SendMail(emailList, b.EmailCcTo, b.Subject, b.Content)
-			}
+// 通过单个渠道发送通知
+func (b *BodyData) SendChannel(channel *Channel) (err error) {
+	b.setPriorityValue()
+
+	notifier, err := GetNotifier(channel.Type)
+	if err != nil {
+		return
+	}
+	return notifier.Send(b, channel)
+}
+
+func (b *BodyData) SendNotify() (err error) {
+	for _, channel := range b.Channels {
+		// 每个渠道使用独立的数据，避免模版内容相互覆盖
+		data := *b
+		sendErr := data.SendChannel(channel)
+		if sendErr != nil {
+			err = fmt.Errorf("%v 通知发送失败，%v", channel.Type, sendErr.Error())
+			logger.Error(err)
 		}
 	}
 	return
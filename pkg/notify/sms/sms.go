@@ -0,0 +1,61 @@
+package sms
+
+/*
+  @Author : lanyulei
+  @Desc : 阿里云短信
+*/
+
+import (
+	"fmt"
+	"os"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// 使用环境变量中的 AccessKey 初始化短信客户端
+func CreateClient() (_result *dysmsapi20170525.Client, _err error) {
+	config := &openapi.Config{
+		// 必填，请确保代码运行环境设置了环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID。
+		AccessKeyId: tea.String(os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID")),
+		// 必填，请确保代码运行环境设置了环境变量 ALIBABA_CLOUD_ACCESS_KEY_SECRET。
+		AccessKeySecret: tea.String(os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET")),
+	}
+	// Endpoint 请参考 https://api.aliyun.com/product/Dysmsapi
+	config.Endpoint = tea.String("dysmsapi.aliyuncs.com")
+	return dysmsapi20170525.NewClient(config)
+}
+
+// 发送短信，phoneNumbers 为逗号分隔的手机号，templateParam 为 JSON 格式的模版参数
+func Send(phoneNumbers string, signName string, templateCode string, templateParam string) (err error) {
+	client, err := CreateClient()
+	if err != nil {
+		return
+	}
+
+	sendSmsRequest := &dysmsapi20170525.SendSmsRequest{
+		SignName:      tea.String(signName),
+		TemplateCode:  tea.String(templateCode),
+		PhoneNumbers:  tea.String(phoneNumbers),
+		TemplateParam: tea.String(templateParam),
+	}
+
+	err = func() (_e error) {
+		defer func() {
+			if r := tea.Recover(recover()); r != nil {
+				_e = r
+			}
+		}()
+		resp, _err := client.SendSmsWithOptions(sendSmsRequest, &util.RuntimeOptions{})
+		if _err != nil {
+			return _err
+		}
+		if resp.Body != nil && tea.StringValue(resp.Body.Code) != "OK" {
+			return fmt.Errorf("%v", tea.StringValue(resp.Body.Message))
+		}
+		return nil
+	}()
+	return
+}
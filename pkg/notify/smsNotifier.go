@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"errors"
+	"ferry/pkg/notify/sms"
+	"strings"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 阿里云短信通知，模版渲染结果为短信模版参数（JSON）
+*/
+
+type smsNotifier struct{}
+
+func (n *smsNotifier) Name() string {
+	return ChannelSms
+}
+
+func (n *smsNotifier) Send(b *BodyData, channel *Channel) (err error) {
+	var phoneList []string
+
+	for _, user := range b.UserList() {
+		if user.Phone != "" {
+			phoneList = append(phoneList, user.Phone)
+		}
+	}
+	if len(phoneList) == 0 {
+		return
+	}
+
+	signName := channel.Option("signName")
+	templateCode := channel.Option("templateCode")
+	if signName == "" || templateCode == "" {
+		return errors.New("未配置短信签名或短信模版")
+	}
+
+	err = b.ParsingTemplate(channel, defaultTemplates[ChannelSms])
+	if err != nil {
+		return errors.New("模版内容解析失败，" + err.Error())
+	}
+
+	return sms.Send(strings.Join(phoneList, ","), signName, templateCode, strings.TrimSpace(b.Content))
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"fmt"
+	"text/template"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 通知模版，优先使用数据库中配置的模版，未配置时使用默认模版文件
+*/
+
+// 各渠道的默认模版文件
+var defaultTemplates = map[string]string{
+	ChannelEmail:    "./static/template/email.html",
+	ChannelSms:      "./static/template/sms.json",
+	ChannelWebhook:  "./static/template/webhook.json",
+	ChannelDingTalk: "./static/template/dingtalk.md",
+	ChannelWeCom:    "./static/template/wecom.md",
+	ChannelFeiShu:   "./static/template/feishu.md",
+}
+
+// 模版中可使用的函数
+var templateFuncMap = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// 查询适用的通知模版，流程匹配优先于事件匹配，未配置时返回 nil
+func FindTemplate(channel string, event string, processId int) (tpl *process.NotifyTemplate, err error) {
+	var tplList []*process.NotifyTemplate
+
+	err = orm.Eloquent.Model(&process.NotifyTemplate{}).
+		Where("channel = ? and status = 1", channel).
+		Where("event in (?)", []string{event, ""}).
+		Where("process in (?)", []int{processId, 0}).
+		Order("process desc, event desc, id desc").
+		Limit(1).
+		Find(&tplList).Error
+	if err != nil {
+		return
+	}
+	if len(tplList) > 0 {
+		tpl = tplList[0]
+	}
+	return
+}
+
+// 校验模版语法
+func CheckTemplate(tpl *process.NotifyTemplate) (err error) {
+	if _, err = template.New("subject").Funcs(templateFuncMap).Parse(tpl.Subject); err != nil {
+		return fmt.Errorf("通知标题模版不正确，%v", err.Error())
+	}
+	if _, err = template.New("content").Funcs(templateFuncMap).Parse(tpl.Content); err != nil {
+		return fmt.Errorf("通知内容模版不正确，%v", err.Error())
+	}
+	return
+}
+
+// 使用数据库中的模版渲染通知标题及内容
+func (b *BodyData) renderTemplate(tpl *process.NotifyTemplate) (err error) {
+	if tpl.Subject != "" {
+		b.Subject, err = executeTemplate(template.New("subject"), tpl.Subject, b)
+		if err != nil {
+			return
+		}
+	}
+	b.Content, err = executeTemplate(template.New("content"), tpl.Content, b)
+	return
+}
+
+// 预览通知，tpl 内容为空时使用渠道的默认模版文件
+func (b *BodyData) Preview(channel string, tpl *process.NotifyTemplate) (err error) {
+	b.setPriorityValue()
+	b.setDomain()
+
+	if tpl != nil && tpl.Content != "" {
+		return b.renderTemplate(tpl)
+	}
+
+	templateFile, ok := defaultTemplates[channel]
+	if !ok {
+		return errors.New("不支持的通知渠道 " + channel)
+	}
+	return b.ParsingTemplate(&Channel{Type: channel, Template: templateFile}, templateFile)
+}
+
+func executeTemplate(tmpl *template.Template, text string, data interface{}) (result string, err error) {
+	var buf bytes.Buffer
+
+	tmpl, err = tmpl.Funcs(templateFuncMap).Parse(text)
+	if err != nil {
+		return
+	}
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return
+	}
+	return buf.String(), nil
+}
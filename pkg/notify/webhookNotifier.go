@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 通用 Webhook 通知，模版渲染结果即为请求内容
+*/
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+type webhookNotifier struct{}
+
+func (n *webhookNotifier) Name() string {
+	return ChannelWebhook
+}
+
+func (n *webhookNotifier) Send(b *BodyData, channel *Channel) (err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+	)
+
+	url := channel.WebhookUrl()
+	if url == "" {
+		return errors.New("未配置 Webhook 地址")
+	}
+
+	err = b.ParsingTemplate(channel, defaultTemplates[ChannelWebhook])
+	if err != nil {
+		return errors.New("模版内容解析失败，" + err.Error())
+	}
+
+	req, err = http.NewRequest(http.MethodPost, url, bytes.NewBufferString(b.Content))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// 配置了密钥时，使用 HMAC-SHA256 对请求内容签名
+	if secret := channel.SecretKey(); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(b.Content))
+		req.Header.Set("X-Ferry-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err = webhookClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("请求失败，状态码 %v，%v", resp.StatusCode, string(body))
+	}
+	return
+}
+
+// 发送 JSON 请求，并根据机器人接口的返回码判断是否成功
+func postRobot(url string, payload interface{}) (err error) {
+	var (
+		data   []byte
+		resp   *http.Response
+		result struct {
+			ErrCode *int   `json:"errcode"` // 钉钉、企业微信
+			ErrMsg  string `json:"errmsg"`
+			Code    *int   `json:"code"` // 飞书
+			Msg     string `json:"msg"`
+		}
+	)
+
+	data, err = json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	resp, err = webhookClient.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("请求失败，状态码 %v", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("解析返回结果失败，%v", err.Error())
+	}
+	if result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("%v", result.ErrMsg)
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return fmt.Errorf("%v", result.Msg)
+	}
+	return
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/notify"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 工单加签
+*/
+
+// 在工单当前所在的节点加签。
+// 前加签：加签人全部处理完成后，交还节点原处理人处理；
+// 后加签：加签时记录操作人的同意意见，加签人全部同意后节点才会流转。
+// 在调用方的事务中写入，actor 为空时表示由系统加签
+func AddSigner(tx *gorm.DB, actor *Actor, cmd *AddSignerCommand) (err error) {
+	var (
+		workOrderInfo     process.WorkOrderInfo
+		processInfo       process.Info
+		stateList         []*process.StateItem
+		currentState      *process.StateItem
+		signerList        []system.SysUser
+		signerIds         []int
+		signerNames       []string
+		relatedPersonList []int
+		stateValue        []byte
+		relatedPerson     []byte
+		noticeList        []*notify.Channel
+		bodyData          *notify.BodyData
+		workOrderId       = cmd.WorkOrderId
+		nodeId            = cmd.SourceState
+		mode              = cmd.Mode
+	)
+
+	if mode != process.AddSignerBefore && mode != process.AddSignerAfter {
+		return fmt.Errorf("不支持的加签方式 %v", mode)
+	}
+
+	for _, userId := range cmd.Users {
+		if actor != nil && userId == actor.UserId {
+			continue
+		}
+		signerIds = appendUnique(signerIds, userId)
+	}
+	if len(signerIds) == 0 {
+		return errors.New("请选择加签人，且加签人不能为自己")
+	}
+
+	// 查询工单信息
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", workOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询工单信息失败，%v", err.Error())
+	}
+	if workOrderInfo.IsEnd == 1 {
+		return errors.New("工单已结束，无法加签")
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		return
+	}
+	currentState = process.GetStateItem(stateList, nodeId)
+	if currentState == nil {
+		return errors.New("工单当前不在此节点，无法加签")
+	}
+
+	err = tx.Model(&system.SysUser{}).
+		Where("user_id in (?)", signerIds).
+		Find(&signerList).Error
+	if err != nil {
+		return fmt.Errorf("查询加签人失败，%v", err.Error())
+	}
+	if len(signerList) != len(signerIds) {
+		return errors.New("加签人不存在")
+	}
+
+	for _, signer := range signerList {
+		signerNames = append(signerNames, signer.NickName)
+	}
+
+	if mode == process.AddSignerBefore {
+		for _, userId := range signerIds {
+			currentState.BeforeSigners = appendUnique(currentState.BeforeSigners, userId)
+		}
+	} else {
+		for _, userId := range signerIds {
+			currentState.AfterSigners = appendUnique(currentState.AfterSigners, userId)
+		}
+	}
+
+	err = json.Unmarshal(workOrderInfo.RelatedPerson, &relatedPersonList)
+	if err != nil {
+		return
+	}
+	if actor != nil {
+		relatedPersonList = appendUnique(relatedPersonList, actor.UserId)
+	}
+
+	stateValue, err = json.Marshal(stateList)
+	if err != nil {
+		return
+	}
+	relatedPerson, err = json.Marshal(relatedPersonList)
+	if err != nil {
+		return
+	}
+
+	err = tx.Model(&process.Info{}).
+		Where("id = ?", workOrderInfo.Process).
+		Find(&processInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询流程信息失败，%v", err.Error())
+	}
+	noticeList, err = notify.ParseNotice(processInfo.Notice)
+	if err != nil {
+		return
+	}
+
+	err = UpdateWorkOrder(tx, &workOrderInfo, map[string]interface{}{
+		"state":          stateValue,
+		"related_person": relatedPerson,
+	})
+	if err != nil {
+		return
+	}
+
+	// 后加签时操作人的意见记为同意，计入会签的处理记录；
+	// 前加签的记录不记录源节点，避免被计入会签的处理记录
+	history := process.CirculationHistory{
+		Title:       workOrderInfo.Title,
+		WorkOrder:   workOrderInfo.Id,
+		State:       currentState.Label,
+		Target:      nodeId,
+		Circulation: fmt.Sprintf("前加签《%v》", strings.Join(signerNames, "，")),
+		Remarks:     cmd.Remarks,
+		Status:      2, // 其他
+	}
+	if mode == process.AddSignerAfter {
+		history.Source = nodeId
+		history.Circulation = fmt.Sprintf("后加签《%v》", strings.Join(signerNames, "，"))
+		history.Status = 1 // 同意
+	}
+	history.ProcessorId, history.Processor = actor.processor()
+	err = tx.Create(&history).Error
+	if err != nil {
+		return fmt.Errorf("新建加签历史失败，%v", err.Error())
+	}
+
+	// 通知加签人
+	if len(noticeList) > 0 {
+		bodyData, err = WorkOrderNotifyData(tx, workOrderId)
+		if err != nil {
+			return
+		}
+		bodyData.SendTo = map[string]interface{}{
+			"userList": signerList,
+		}
+		bodyData.Subject = "您有一条加签的工单，请及时处理"
+		bodyData.Description = "您被邀请处理一条工单，工单描述如下"
+		bodyData.Channels = noticeList
+		bodyData.Event = notify.EventAssigned
+		err = notify.Enqueue(tx, bodyData)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 处理人解析
+*/
+
+// 负责人层级的最大值，防止部门数据存在循环时无限查询
+const maxLeaderLevel = 20
+
+// 处理人解析上下文
+type AssigneeContext struct {
+	DB        *gorm.DB           // 数据库连接，流转时为当前事务
+	Process   int                // 流程ID
+	Creator   int                // 工单创建人
+	FormData  [][]byte           // 工单表单数据
+	Structure *process.Structure // 流程结构，用于获取节点的处理人配置
+	DryRun    bool               // 仅预览处理人，不记录分配结果
+}
+
+func (ctx *AssigneeContext) db() *gorm.DB {
+	if ctx.DB != nil {
+		return ctx.DB
+	}
+	return orm.Eloquent
+}
+
+// 表单字段的值
+func (ctx *AssigneeContext) formValue(field string) (value interface{}, err error) {
+	for _, data := range ctx.FormData {
+		var formData map[string]interface{}
+		err = json.Unmarshal(data, &formData)
+		if err != nil {
+			return
+		}
+		if formValue, ok := formData[field]; ok {
+			return formValue, nil
+		}
+	}
+	return
+}
+
+// 处理人解析器，processor 为节点配置的处理人，返回实际处理的用户ID
+type AssigneeResolver func(ctx *AssigneeContext, node *process.Node, processor []int) (users []int, err error)
+
+var assigneeResolvers = map[string]AssigneeResolver{
+	process.AssignVariable:   resolveVariable,
+	process.AssignLeader:     resolveLeader,
+	process.AssignPost:       resolvePost,
+	process.AssignFormField:  resolveFormField,
+	process.AssignRoleMember: resolveRoleMember,
+}
+
+// 注册处理人解析器，相同类型的解析器会被覆盖
+func RegisterAssigneeResolver(assignType string, resolver AssigneeResolver) {
+	assigneeResolvers[assignType] = resolver
+}
+
+// 将节点的处理人解析为实际的用户，人员、角色、部门无需解析。
+// 解析后节点的处理人类型为 person，待办查询及处理权限验证均按照人员匹配
+func ResolveAssignees(ctx *AssigneeContext, stateList []*process.StateItem) (err error) {
+	for _, stateItem := range stateList {
+		if _, ok := assigneeResolvers[stateItem.ProcessMethod]; !ok {
+			continue
+		}
+		stateItem.Processor, err = resolveProcessor(ctx, stateItem)
+		if err != nil {
+			return
+		}
+		if len(stateItem.Processor) == 0 {
+			return fmt.Errorf("节点《%v》未找到对应的处理人", stateItem.Label)
+		}
+		stateItem.ProcessMethod = process.AssignPerson
+	}
+	return
+}
+
+// 使用处理人类型对应的解析器解析节点的处理人，未注册解析器的类型返回空
+func resolveProcessor(ctx *AssigneeContext, stateItem *process.StateItem) (users []int, err error) {
+	var node *process.Node
+
+	resolver, ok := assigneeResolvers[stateItem.ProcessMethod]
+	if !ok {
+		return
+	}
+	if ctx.Structure != nil {
+		node = ctx.Structure.GetNode(stateItem.Id)
+	}
+
+	users, err = resolver(ctx, node, stateItem.Processor)
+	if err != nil {
+		return
+	}
+	return uniqueUsers(users), nil
+}
+
+// 去除重复及无效的用户
+func uniqueUsers(users []int) (result []int) {
+	result = make([]int, 0, len(users))
+	seen := make(map[int]struct{}, len(users))
+	for _, user := range users {
+		if _, ok := seen[user]; ok || user == 0 {
+			continue
+		}
+		seen[user] = struct{}{}
+		result = append(result, user)
+	}
+	return
+}
+
+// 变量，1 为创建者，2 为创建者的部门负责人
+func resolveVariable(ctx *AssigneeContext, node *process.Node, processor []int) (users []int, err error) {
+	for _, p := range processor {
+		switch p {
+		case 1:
+			users = append(users, ctx.Creator)
+		case 2:
+			var leaders []int
+			leaders, err = resolveLeader(ctx, node, []int{1})
+			if err != nil {
+				return
+			}
+			users = append(users, leaders...)
+		}
+	}
+	return
+}
+
+// 创建人的部门负责人，沿上级部门逐级查找，processor 为需要的负责人层级
+func resolveLeader(ctx *AssigneeContext, node *process.Node, processor []int) (users []int, err error) {
+	var (
+		userInfo system.SysUser
+		leaders  []int
+		deptId   int
+	)
+
+	err = ctx.db().Model(&system.SysUser{}).Where("user_id = ?", ctx.Creator).Find(&userInfo).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工单创建人信息失败，%v", err.Error())
+	}
+
+	// 按照层级查询部门负责人，leaders[0] 为所在部门负责人
+	maxLevel := 0
+	for _, level := range processor {
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+	if maxLevel > maxLeaderLevel {
+		maxLevel = maxLeaderLevel
+	}
+	deptId = userInfo.DeptId
+	for len(leaders) < maxLevel && deptId != 0 {
+		var deptInfo system.Dept
+		err = ctx.db().Model(&system.Dept{}).Where("dept_id = ?", deptId).Find(&deptInfo).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				err = nil
+				break
+			}
+			return nil, fmt.Errorf("查询部门信息失败，%v", err.Error())
+		}
+		leaders = append(leaders, deptInfo.Leader)
+		deptId = deptInfo.ParentId
+	}
+
+	for _, level := range processor {
+		if level >= 1 && level <= len(leaders) {
+			users = append(users, leaders[level-1])
+		}
+	}
+	return
+}
+
+// 岗位下的所有用户
+func resolvePost(ctx *AssigneeContext, node *process.Node, processor []int) (users []int, err error) {
+	err = ctx.db().Model(&system.SysUser{}).
+		Where("post_id in (?)", processor).
+		Order("user_id").
+		Pluck("user_id", &users).Error
+	if err != nil {
+		err = fmt.Errorf("查询岗位用户失败，%v", err.Error())
+	}
+	return
+}
+
+// 表单字段中选择的用户，字段值可以是用户ID或用户ID列表
+func resolveFormField(ctx *AssigneeContext, node *process.Node, processor []int) (users []int, err error) {
+	var value interface{}
+
+	if node == nil || node.Assignee == nil || node.Assignee.Field == "" {
+		return
+	}
+	value, err = ctx.formValue(node.Assignee.Field)
+	if err != nil {
+		return
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		switch userId := v.(type) {
+		case float64:
+			users = append(users, int(userId))
+		case string:
+			for _, item := range strings.Split(userId, ",") {
+				id, convErr := strconv.Atoi(strings.TrimSpace(item))
+				if convErr != nil {
+					return nil, fmt.Errorf("表单字段 %v 的值 %v 不是有效的用户", node.Assignee.Field, userId)
+				}
+				users = append(users, id)
+			}
+		}
+	}
+	return
+}
+
+// 按照分配方式从角色成员中选择一人
+func resolveRoleMember(ctx *AssigneeContext, node *process.Node, processor []int) (users []int, err error) {
+	var members []int
+
+	err = ctx.db().Model(&system.SysUser{}).
+		Where("role_id in (?)", processor).
+		Order("user_id").
+		Pluck("user_id", &members).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询角色成员失败，%v", err.Error())
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	balance := process.BalanceRoundRobin
+	if node != nil && node.Assignee != nil && node.Assignee.Balance != "" {
+		balance = node.Assignee.Balance
+	}
+
+	var assignee int
+	switch balance {
+	case process.BalanceLeastLoaded:
+		assignee, err = leastLoadedMember(ctx, members)
+	default:
+		if node == nil {
+			assignee = members[0]
+			break
+		}
+		assignee, err = roundRobinMember(ctx, node, members)
+	}
+	if err != nil {
+		return
+	}
+	return []int{assignee}, nil
+}
+
+// 轮询，选择上一次分配的处理人之后的成员
+func roundRobinMember(ctx *AssigneeContext, node *process.Node, members []int) (assignee int, err error) {
+	var cursor process.AssigneeCursor
+
+	err = ctx.db().Model(&process.AssigneeCursor{}).
+		Where("process = ? and node = ?", ctx.Process, node.Id).
+		Find(&cursor).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return 0, fmt.Errorf("查询轮询分配记录失败，%v", err.Error())
+	}
+
+	assignee = members[0]
+	for _, member := range members {
+		if member > cursor.Assignee {
+			assignee = member
+			break
+		}
+	}
+	if ctx.DryRun {
+		return assignee, nil
+	}
+
+	if cursor.Id == 0 {
+		err = ctx.db().Create(&process.AssigneeCursor{
+			Process:  ctx.Process,
+			Node:     node.Id,
+			Assignee: assignee,
+		}).Error
+	} else {
+		err = ctx.db().Model(&process.AssigneeCursor{}).
+			Where("id = ?", cursor.Id).
+			Update("assignee", assignee).Error
+	}
+	if err != nil {
+		err = fmt.Errorf("更新轮询分配记录失败，%v", err.Error())
+	}
+	return
+}
+
+// 选择未结束的待办工单最少的成员
+func leastLoadedMember(ctx *AssigneeContext, members []int) (assignee int, err error) {
+	minCount := -1
+	for _, member := range members {
+		var count int
+		err = ctx.db().Model(&process.WorkOrderInfo{}).
+			Where(fmt.Sprintf("JSON_CONTAINS(state, JSON_OBJECT('processor', %v)) and JSON_CONTAINS(state, JSON_OBJECT('process_method', 'person'))", member)).
+			Where("is_end = 0").
+			Count(&count).Error
+		if err != nil {
+			return 0, fmt.Errorf("查询成员待办工单数量失败，%v", err.Error())
+		}
+		if minCount == -1 || count < minCount {
+			minCount = count
+			assignee = member
+		}
+	}
+	return
+}
+
+// 工单的处理人解析上下文
+func workOrderAssigneeContext(db *gorm.DB, workOrder *process.WorkOrderInfo, structure *process.Structure) (ctx *AssigneeContext, err error) {
+	ctx = &AssigneeContext{
+		DB:        db,
+		Process:   workOrder.Process,
+		Creator:   workOrder.Creator,
+		Structure: structure,
+	}
+	err = db.Model(&process.TplData{}).
+		Where("work_order = ?", workOrder.Id).
+		Pluck("form_data", &ctx.FormData).Error
+	if err != nil {
+		err = fmt.Errorf("获取工单表单数据失败，%v", err.Error())
+	}
+	return
+}
+
+// 流转时的处理人解析上下文
+func (h *Handle) assigneeContext() *AssigneeContext {
+	ctx := &AssigneeContext{
+		DB:       h.tx,
+		Process:  h.workOrderDetails.Process,
+		Creator:  h.workOrderDetails.Creator,
+		FormData: h.WorkOrderData,
+	}
+	if h.processState != nil {
+		ctx.Structure = h.processState.Structure
+	}
+	return ctx
+}
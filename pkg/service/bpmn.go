@@ -0,0 +1,635 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"ferry/models/process"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流程结构与 BPMN 2.0 XML 相互转换，ferry 特有的配置保存在扩展命名空间中
+*/
+
+const (
+	bpmnModelNS = "http://www.omg.org/spec/BPMN/20100524/MODEL"
+	bpmnDINS    = "http://www.omg.org/spec/BPMN/20100524/DI"
+	bpmnDCNS    = "http://www.omg.org/spec/DD/20100524/DC"
+	bpmnDDINS   = "http://www.omg.org/spec/DD/20100524/DI"
+	bpmnXsiNS   = "http://www.w3.org/2001/XMLSchema-instance"
+	bpmnFerryNS = "http://ferry.fdevops.com/schema/bpmn"
+)
+
+// 节点类型与 BPMN 元素的对应关系
+var bpmnElementMap = map[string]string{
+	process.NodeStart:        "startEvent",
+	process.NodeEnd:          "endEvent",
+	process.NodeUserTask:     "userTask",
+	process.NodeReceiveTask:  "receiveTask",
+	process.NodeScriptTask:   "scriptTask",
+	process.NodeSubProcess:   "callActivity",
+	process.NodeTimer:        "intermediateCatchEvent",
+	process.GatewayExclusive: "exclusiveGateway",
+	process.GatewayParallel:  "parallelGateway",
+	process.GatewayInclusive: "inclusiveGateway",
+}
+
+// 导入时支持的 BPMN 元素，task 及 serviceTask 分别按照审批节点及任务节点导入
+var bpmnClazzMap = map[string]string{
+	"startEvent":       process.NodeStart,
+	"endEvent":         process.NodeEnd,
+	"task":             process.NodeUserTask,
+	"userTask":         process.NodeUserTask,
+	"receiveTask":      process.NodeReceiveTask,
+	"scriptTask":       process.NodeScriptTask,
+	"serviceTask":      process.NodeScriptTask,
+	"callActivity":     process.NodeSubProcess,
+	"exclusiveGateway": process.GatewayExclusive,
+	"parallelGateway":  process.GatewayParallel,
+	"inclusiveGateway": process.GatewayInclusive,
+}
+
+// 导入时忽略的 BPMN 元素
+var bpmnIgnoreElements = map[string]struct{}{
+	"documentation":     {},
+	"extensionElements": {},
+	"laneSet":           {},
+	"textAnnotation":    {},
+	"association":       {},
+	"dataObject":        {},
+}
+
+// 流程设计器中各节点类型的图形
+var bpmnShapeMap = map[string]string{
+	process.NodeStart:        "start-node",
+	process.NodeEnd:          "end-node",
+	process.NodeUserTask:     "user-task-node",
+	process.NodeReceiveTask:  "receive-task-node",
+	process.NodeScriptTask:   "script-task-node",
+	process.NodeSubProcess:   "sub-process-node",
+	process.NodeTimer:        "timer-event-node",
+	process.GatewayExclusive: "exclusive-gateway-node",
+	process.GatewayParallel:  "parallel-gateway-node",
+	process.GatewayInclusive: "inclusive-gateway-node",
+}
+
+const bpmnEdgeShape = "flow-polyline-round"
+
+// 节点及流转中作为 BPMN 标准属性或扩展属性输出的字段，其余字段保存在扩展配置中
+var (
+	bpmnNodeKeys = map[string]struct{}{
+		"id": {}, "label": {}, "clazz": {}, "x": {}, "y": {}, "size": {},
+		"assignType": {}, "assignValue": {}, "isCounterSign": {}, "sort": {},
+	}
+	bpmnEdgeKeys = map[string]struct{}{
+		"id": {}, "label": {}, "source": {}, "target": {}, "conditionExpression": {}, "sort": {},
+	}
+)
+
+var bpmnDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// 流程结构中的原始数据，保留流程设计器使用的坐标等字段
+type bpmnRawStructure struct {
+	Nodes  []map[string]interface{}
+	Edges  []map[string]interface{}
+	Extras map[string]interface{}
+}
+
+func parseRawStructure(data json.RawMessage) (raw *bpmnRawStructure, err error) {
+	var values map[string]interface{}
+
+	raw = &bpmnRawStructure{Extras: make(map[string]interface{})}
+	if len(data) == 0 {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("流程结构格式不正确，%v", err.Error())
+	}
+	for key, value := range values {
+		switch key {
+		case "nodes", "edges":
+			list, _ := value.([]interface{})
+			for _, item := range list {
+				if m, ok := item.(map[string]interface{}); ok {
+					if key == "nodes" {
+						raw.Nodes = append(raw.Nodes, m)
+					} else {
+						raw.Edges = append(raw.Edges, m)
+					}
+				}
+			}
+		default:
+			raw.Extras[key] = value
+		}
+	}
+	return
+}
+
+// 导出 BPMN 2.0 XML
+func ExportBpmn(processInfo *process.Info) (data []byte, err error) {
+	var (
+		raw       *bpmnRawStructure
+		structure *process.Structure
+		buf       bytes.Buffer
+		bounds    = make(map[string][4]float64)
+	)
+
+	structure, err = process.ParseStructure(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	raw, err = parseRawStructure(processInfo.Structure)
+	if err != nil {
+		return
+	}
+
+	processId := fmt.Sprintf("Process_%v", processInfo.Id)
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<bpmn:definitions xmlns:bpmn="` + bpmnModelNS + `" xmlns:bpmndi="` + bpmnDINS +
+		`" xmlns:dc="` + bpmnDCNS + `" xmlns:di="` + bpmnDDINS + `" xmlns:xsi="` + bpmnXsiNS +
+		`" xmlns:ferry="` + bpmnFerryNS + `" id="Definitions_` + strconv.Itoa(processInfo.Id) +
+		`" targetNamespace="` + bpmnFerryNS + `" exporter="ferry">` + "\n")
+	buf.WriteString(`  <bpmn:process id="` + processId + `"` + bpmnAttr("name", processInfo.Name) + ` isExecutable="true">` + "\n")
+	writeBpmnExtension(&buf, "    ", raw.Extras)
+
+	for _, rawNode := range raw.Nodes {
+		node := structure.GetNode(bpmnString(rawNode["id"]))
+		if node == nil {
+			continue
+		}
+		element := bpmnElementMap[node.Clazz]
+
+		buf.WriteString(`    <bpmn:` + element + bpmnAttr("id", node.Id) + bpmnAttr("name", node.Label))
+		if node.AssignType != "" {
+			buf.WriteString(bpmnAttr("ferry:assignType", node.AssignType))
+		}
+		if len(node.AssignValue) > 0 {
+			buf.WriteString(bpmnAttr("ferry:assignValue", joinInts(node.AssignValue)))
+		}
+		if node.IsCounterSign {
+			buf.WriteString(bpmnAttr("ferry:isCounterSign", "true"))
+		}
+		if sortValue := bpmnString(rawNode["sort"]); sortValue != "" {
+			buf.WriteString(bpmnAttr("ferry:sort", sortValue))
+		}
+		if node.Clazz == process.NodeSubProcess && node.SubProcess != nil && len(node.SubProcess.Items) == 1 {
+			buf.WriteString(bpmnAttr("calledElement", fmt.Sprintf("Process_%v", node.SubProcess.Items[0].Process)))
+		}
+		buf.WriteString(">\n")
+
+		writeBpmnExtension(&buf, "      ", bpmnExtras(rawNode, bpmnNodeKeys))
+		for _, edge := range structure.TargetEdges(node.Id) {
+			buf.WriteString(`      <bpmn:incoming>` + bpmnText(edge.Id) + `</bpmn:incoming>` + "\n")
+		}
+		for _, edge := range structure.SourceEdges(node.Id) {
+			buf.WriteString(`      <bpmn:outgoing>` + bpmnText(edge.Id) + `</bpmn:outgoing>` + "\n")
+		}
+		if node.Clazz == process.NodeTimer && node.Timer != nil {
+			buf.WriteString(`      <bpmn:timerEventDefinition>` + "\n")
+			if node.Timer.Field != "" {
+				buf.WriteString(`        <bpmn:timeDate xsi:type="bpmn:tFormalExpression">${` + bpmnText(node.Timer.Field) + `}</bpmn:timeDate>` + "\n")
+			} else {
+				buf.WriteString(`        <bpmn:timeDuration xsi:type="bpmn:tFormalExpression">PT` + strconv.Itoa(node.Timer.Duration) + `M</bpmn:timeDuration>` + "\n")
+			}
+			buf.WriteString(`      </bpmn:timerEventDefinition>` + "\n")
+		}
+		buf.WriteString(`    </bpmn:` + element + ">\n")
+
+		bounds[node.Id] = bpmnBounds(rawNode, node.Clazz)
+	}
+
+	for _, rawEdge := range raw.Edges {
+		edgeId := bpmnString(rawEdge["id"])
+		buf.WriteString(`    <bpmn:sequenceFlow` + bpmnAttr("id", edgeId) +
+			bpmnAttr("sourceRef", bpmnString(rawEdge["source"])) +
+			bpmnAttr("targetRef", bpmnString(rawEdge["target"])))
+		if label := bpmnString(rawEdge["label"]); label != "" {
+			buf.WriteString(bpmnAttr("name", label))
+		}
+		if sortValue := bpmnString(rawEdge["sort"]); sortValue != "" {
+			buf.WriteString(bpmnAttr("ferry:sort", sortValue))
+		}
+
+		var inner bytes.Buffer
+		writeBpmnExtension(&inner, "      ", bpmnExtras(rawEdge, bpmnEdgeKeys))
+		if condition := strings.TrimSpace(bpmnString(rawEdge["conditionExpression"])); condition != "" {
+			inner.WriteString(`      <bpmn:conditionExpression xsi:type="bpmn:tFormalExpression" language="application/json">` +
+				bpmnCData(condition) + `</bpmn:conditionExpression>` + "\n")
+		}
+		if inner.Len() == 0 {
+			buf.WriteString(" />\n")
+			continue
+		}
+		buf.WriteString(">\n")
+		buf.Write(inner.Bytes())
+		buf.WriteString(`    </bpmn:sequenceFlow>` + "\n")
+	}
+	buf.WriteString(`  </bpmn:process>` + "\n")
+
+	// 图形信息，节点坐标为中心点
+	buf.WriteString(`  <bpmndi:BPMNDiagram id="BPMNDiagram_` + strconv.Itoa(processInfo.Id) + `">` + "\n")
+	buf.WriteString(`    <bpmndi:BPMNPlane id="BPMNPlane_` + strconv.Itoa(processInfo.Id) + `" bpmnElement="` + processId + `">` + "\n")
+	for _, node := range structure.Nodes {
+		b, ok := bounds[node.Id]
+		if !ok {
+			continue
+		}
+		buf.WriteString(`      <bpmndi:BPMNShape` + bpmnAttr("id", node.Id+"_di") + bpmnAttr("bpmnElement", node.Id) + ">\n")
+		buf.WriteString(fmt.Sprintf(`        <dc:Bounds x="%v" y="%v" width="%v" height="%v" />`+"\n",
+			b[0]-b[2]/2, b[1]-b[3]/2, b[2], b[3]))
+		buf.WriteString(`      </bpmndi:BPMNShape>` + "\n")
+	}
+	for _, edge := range structure.Edges {
+		source, sourceOk := bounds[edge.Source]
+		target, targetOk := bounds[edge.Target]
+		if !sourceOk || !targetOk {
+			continue
+		}
+		buf.WriteString(`      <bpmndi:BPMNEdge` + bpmnAttr("id", edge.Id+"_di") + bpmnAttr("bpmnElement", edge.Id) + ">\n")
+		buf.WriteString(fmt.Sprintf(`        <di:waypoint x="%v" y="%v" />`+"\n", source[0], source[1]))
+		buf.WriteString(fmt.Sprintf(`        <di:waypoint x="%v" y="%v" />`+"\n", target[0], target[1]))
+		buf.WriteString(`      </bpmndi:BPMNEdge>` + "\n")
+	}
+	buf.WriteString(`    </bpmndi:BPMNPlane>` + "\n")
+	buf.WriteString(`  </bpmndi:BPMNDiagram>` + "\n")
+	buf.WriteString(`</bpmn:definitions>` + "\n")
+
+	return buf.Bytes(), nil
+}
+
+// BPMN XML 的通用元素
+type bpmnElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr     `xml:",any,attr"`
+	Content  string         `xml:",chardata"`
+	Children []*bpmnElement `xml:",any"`
+}
+
+func (e *bpmnElement) attr(space, local string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == local && a.Name.Space == space {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *bpmnElement) child(local string) *bpmnElement {
+	for _, c := range e.Children {
+		if c.XMLName.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// 遍历所有子孙元素
+func (e *bpmnElement) walk(f func(*bpmnElement)) {
+	for _, c := range e.Children {
+		f(c)
+		c.walk(f)
+	}
+}
+
+// 导入 BPMN 2.0 XML，返回流程名称及流程结构
+func ImportBpmn(data []byte) (name string, structure json.RawMessage, err error) {
+	var (
+		definitions bpmnElement
+		processElem *bpmnElement
+		nodes       = make([]map[string]interface{}, 0)
+		edges       = make([]map[string]interface{}, 0)
+		result      = make(map[string]interface{})
+		bounds      = make(map[string][4]float64)
+	)
+
+	err = xml.Unmarshal(data, &definitions)
+	if err != nil {
+		return "", nil, fmt.Errorf("BPMN 文件格式不正确，%v", err.Error())
+	}
+	if definitions.XMLName.Local != "definitions" {
+		return "", nil, errors.New("BPMN 文件缺少 definitions 元素")
+	}
+	for _, c := range definitions.Children {
+		if c.XMLName.Local == "process" {
+			if processElem != nil {
+				return "", nil, errors.New("暂不支持包含多个流程的 BPMN 文件")
+			}
+			processElem = c
+		}
+	}
+	if processElem == nil {
+		return "", nil, errors.New("BPMN 文件中未定义流程")
+	}
+	name = processElem.attr("", "name")
+
+	// 图形信息
+	definitions.walk(func(e *bpmnElement) {
+		if e.XMLName.Local != "BPMNShape" {
+			return
+		}
+		b := e.child("Bounds")
+		if b == nil {
+			return
+		}
+		x, _ := strconv.ParseFloat(b.attr("", "x"), 64)
+		y, _ := strconv.ParseFloat(b.attr("", "y"), 64)
+		w, _ := strconv.ParseFloat(b.attr("", "width"), 64)
+		h, _ := strconv.ParseFloat(b.attr("", "height"), 64)
+		bounds[e.attr("", "bpmnElement")] = [4]float64{x + w/2, y + h/2, w, h}
+	})
+
+	err = mergeBpmnExtension(processElem, result)
+	if err != nil {
+		return
+	}
+
+	for _, e := range processElem.Children {
+		local := e.XMLName.Local
+		if _, ok := bpmnIgnoreElements[local]; ok {
+			continue
+		}
+		if local == "sequenceFlow" {
+			edge, edgeErr := importBpmnEdge(e)
+			if edgeErr != nil {
+				return "", nil, edgeErr
+			}
+			edges = append(edges, edge)
+			continue
+		}
+
+		node, nodeErr := importBpmnNode(e, bounds)
+		if nodeErr != nil {
+			return "", nil, nodeErr
+		}
+		nodes = append(nodes, node)
+	}
+
+	result["nodes"] = nodes
+	result["edges"] = edges
+	structure, err = json.Marshal(result)
+	return
+}
+
+func importBpmnNode(e *bpmnElement, bounds map[string][4]float64) (node map[string]interface{}, err error) {
+	local := e.XMLName.Local
+	id := e.attr("", "id")
+	if id == "" {
+		return nil, fmt.Errorf("BPMN 元素 %v 缺少 id", local)
+	}
+
+	clazz, ok := bpmnClazzMap[local]
+	if local == "intermediateCatchEvent" && e.child("timerEventDefinition") != nil {
+		clazz, ok = process.NodeTimer, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("不支持的 BPMN 元素 %v（%v）", local, id)
+	}
+
+	node = make(map[string]interface{})
+	err = mergeBpmnExtension(e, node)
+	if err != nil {
+		return nil, fmt.Errorf("节点 %v 的扩展配置不正确，%v", id, err.Error())
+	}
+	node["id"] = id
+	node["label"] = e.attr("", "name")
+	node["clazz"] = clazz
+	if _, ok := node["shape"]; !ok {
+		node["shape"] = bpmnShapeMap[clazz]
+	}
+
+	if v := e.attr(bpmnFerryNS, "assignType"); v != "" {
+		node["assignType"] = v
+	}
+	if v := e.attr(bpmnFerryNS, "assignValue"); v != "" {
+		assignValue, splitErr := splitInts(v)
+		if splitErr != nil {
+			return nil, fmt.Errorf("节点 %v 的处理人格式不正确，%v", id, v)
+		}
+		node["assignValue"] = assignValue
+	}
+	if v := e.attr(bpmnFerryNS, "isCounterSign"); v != "" {
+		node["isCounterSign"] = v == "true"
+	}
+	if v := e.attr(bpmnFerryNS, "sort"); v != "" {
+		node["sort"] = v
+	}
+
+	// 其他工具设计的定时节点，使用标准的定时配置
+	if timerDef := e.child("timerEventDefinition"); timerDef != nil {
+		if _, ok := node["timer"]; !ok {
+			node["timer"], err = importBpmnTimer(timerDef)
+			if err != nil {
+				return nil, fmt.Errorf("定时节点 %v 的定时配置不正确，%v", id, err.Error())
+			}
+		}
+	}
+
+	if b, ok := bounds[id]; ok {
+		node["x"], node["y"] = b[0], b[1]
+		if _, ok := node["size"]; !ok && b[2] > 0 && b[3] > 0 {
+			node["size"] = []float64{b[2], b[3]}
+		}
+	}
+	return
+}
+
+func importBpmnEdge(e *bpmnElement) (edge map[string]interface{}, err error) {
+	id := e.attr("", "id")
+	if id == "" {
+		return nil, errors.New("BPMN 流转缺少 id")
+	}
+
+	edge = make(map[string]interface{})
+	err = mergeBpmnExtension(e, edge)
+	if err != nil {
+		return nil, fmt.Errorf("流转 %v 的扩展配置不正确，%v", id, err.Error())
+	}
+	edge["id"] = id
+	edge["source"] = e.attr("", "sourceRef")
+	edge["target"] = e.attr("", "targetRef")
+	edge["label"] = e.attr("", "name")
+	edge["conditionExpression"] = ""
+	if condition := e.child("conditionExpression"); condition != nil {
+		edge["conditionExpression"] = strings.TrimSpace(condition.Content)
+	}
+	if v := e.attr(bpmnFerryNS, "sort"); v != "" {
+		edge["sort"] = v
+	}
+	if _, ok := edge["shape"]; !ok {
+		edge["shape"] = bpmnEdgeShape
+	}
+	if _, ok := edge["clazz"]; !ok {
+		edge["clazz"] = "flow"
+	}
+	return
+}
+
+// 标准定时配置仅支持 ISO 8601 时长，以及 ${字段} 形式引用表单字段的时间
+func importBpmnTimer(e *bpmnElement) (timer *process.Timer, err error) {
+	if timeDate := e.child("timeDate"); timeDate != nil {
+		value := strings.TrimSpace(timeDate.Content)
+		if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+			return &process.Timer{Field: value[2 : len(value)-1]}, nil
+		}
+		return nil, fmt.Errorf("仅支持引用表单字段的时间，%v", value)
+	}
+	if timeDuration := e.child("timeDuration"); timeDuration != nil {
+		value := strings.TrimSpace(timeDuration.Content)
+		match := bpmnDurationRegexp.FindStringSubmatch(value)
+		if match == nil || value == "P" || value == "PT" {
+			return nil, fmt.Errorf("时长格式不正确，%v", value)
+		}
+		minutes := 0
+		for i, unit := range []int{24 * 60, 60, 1} {
+			n, _ := strconv.Atoi(match[i+1])
+			minutes += n * unit
+		}
+		seconds, _ := strconv.Atoi(match[4])
+		minutes += (seconds + 59) / 60
+		return &process.Timer{Duration: minutes}, nil
+	}
+	return nil, errors.New("未配置定时时间")
+}
+
+// 将元素扩展配置中的字段合并到 values
+func mergeBpmnExtension(e *bpmnElement, values map[string]interface{}) (err error) {
+	ext := e.child("extensionElements")
+	if ext == nil {
+		return
+	}
+	for _, c := range ext.Children {
+		if c.XMLName.Space != bpmnFerryNS || c.XMLName.Local != "config" {
+			continue
+		}
+		var config map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(c.Content))
+		decoder.UseNumber()
+		err = decoder.Decode(&config)
+		if err != nil {
+			return
+		}
+		for key, value := range config {
+			values[key] = value
+		}
+	}
+	return
+}
+
+func writeBpmnExtension(buf *bytes.Buffer, indent string, extras map[string]interface{}) {
+	if len(extras) == 0 {
+		return
+	}
+	config, err := json.Marshal(extras)
+	if err != nil {
+		return
+	}
+	buf.WriteString(indent + "<bpmn:extensionElements>\n")
+	buf.WriteString(indent + "  <ferry:config>" + bpmnCData(string(config)) + "</ferry:config>\n")
+	buf.WriteString(indent + "</bpmn:extensionElements>\n")
+}
+
+// 未作为标准属性输出的字段
+func bpmnExtras(values map[string]interface{}, keys map[string]struct{}) map[string]interface{} {
+	extras := make(map[string]interface{})
+	for key, value := range values {
+		if _, ok := keys[key]; !ok {
+			extras[key] = value
+		}
+	}
+	return extras
+}
+
+// 节点的中心点坐标及宽高
+func bpmnBounds(rawNode map[string]interface{}, clazz string) (b [4]float64) {
+	b[0], _ = bpmnFloat(rawNode["x"])
+	b[1], _ = bpmnFloat(rawNode["y"])
+	b[2], b[3] = 80, 44
+	switch {
+	case clazz == process.NodeStart || clazz == process.NodeEnd || clazz == process.NodeTimer:
+		b[2], b[3] = 36, 36
+	case strings.HasSuffix(clazz, "Gateway"):
+		b[2], b[3] = 40, 40
+	}
+	if size, ok := rawNode["size"].([]interface{}); ok && len(size) == 2 {
+		w, wOk := bpmnFloat(size[0])
+		h, hOk := bpmnFloat(size[1])
+		if wOk && hOk {
+			b[2], b[3] = w, h
+		}
+	}
+	return
+}
+
+func bpmnFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func bpmnString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func bpmnText(value string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+// JSON 等内容使用 CDATA 输出，便于阅读
+func bpmnCData(value string) string {
+	return "<![CDATA[" + strings.ReplaceAll(value, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+func bpmnAttr(name, value string) string {
+	return " " + name + `="` + bpmnText(value) + `"`
+}
+
+func joinInts(values []int) string {
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		list = append(list, strconv.Itoa(v))
+	}
+	return strings.Join(list, ",")
+}
+
+func splitInts(value string) (values []int, err error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var v int
+		v, err = strconv.Atoi(item)
+		if err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	return
+}
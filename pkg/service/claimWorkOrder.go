@@ -0,0 +1,209 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 认领与释放工单，处理人为角色或部门的节点由认领人独占处理
+*/
+
+// 认领工单，同一节点仅第一个认领的用户可以认领成功，在调用方的事务中写入
+func ClaimWorkOrder(tx *gorm.DB, actor *Actor, cmd *ClaimCommand) (err error) {
+	workOrderInfo, stateList, err := lockWorkOrderState(tx, cmd.WorkOrderId)
+	if err != nil {
+		return
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+	currentState, err := claimState(stateList, cmd.NodeId)
+	if err != nil {
+		return
+	}
+
+	if currentState.Claim != nil {
+		if currentState.Claim.UserId == actor.UserId {
+			return errors.New("您已认领此工单")
+		}
+		var claimer system.SysUser
+		err = tx.Model(&system.SysUser{}).
+			Where("user_id = ?", currentState.Claim.UserId).
+			Find(&claimer).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return fmt.Errorf("查询认领人信息失败，%v", err.Error())
+		}
+		return fmt.Errorf("工单已被《%v》认领", claimer.NickName)
+	}
+
+	// 认领人需要属于节点的角色或部门
+	inPool := false
+	for _, processor := range currentState.Processor {
+		if (currentState.ProcessMethod == process.AssignRole && processor == actor.RoleId) ||
+			(currentState.ProcessMethod == process.AssignDepartment && processor == actor.DeptId) {
+			inPool = true
+			break
+		}
+	}
+	if !inPool {
+		return errors.New("您不是此节点的处理人，无法认领")
+	}
+
+	err = currentState.ClaimBy(actor.UserId, time.Now())
+	if err != nil {
+		return
+	}
+	return saveClaimState(tx, &workOrderInfo, stateList, currentState, "认领工单", actor, cmd.Remarks)
+}
+
+// 释放认领的工单，工单重新回到角色或部门的待办中，在调用方的事务中写入
+func ReleaseWorkOrder(tx *gorm.DB, actor *Actor, cmd *ClaimCommand) (err error) {
+	workOrderInfo, stateList, err := lockWorkOrderState(tx, cmd.WorkOrderId)
+	if err != nil {
+		return
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+	currentState, err := claimState(stateList, cmd.NodeId)
+	if err != nil {
+		return
+	}
+	if currentState.Claim == nil {
+		return errors.New("工单未被认领，无需释放")
+	}
+	if currentState.Claim.UserId != actor.UserId {
+		return errors.New("仅认领人可以释放工单")
+	}
+
+	currentState.Release()
+	return saveClaimState(tx, &workOrderInfo, stateList, currentState, "释放工单", actor, cmd.Remarks)
+}
+
+// 锁定工单并解析节点数据，事务提交前其他认领或释放的操作需要等待
+func lockWorkOrderState(tx *gorm.DB, workOrderId int) (workOrderInfo process.WorkOrderInfo, stateList []*process.StateItem, err error) {
+	err = forUpdate(tx).
+		Model(&process.WorkOrderInfo{}).
+		Where("id = ?", workOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		err = fmt.Errorf("查询工单信息失败，%v", err.Error())
+		return
+	}
+	if workOrderInfo.IsEnd == 1 {
+		err = errors.New("工单已结束")
+		return
+	}
+
+	stateList, err = process.ParseState(workOrderInfo.State)
+	return
+}
+
+// 需要认领或释放的节点，未指定节点时工单需要只有一个可认领的节点
+func claimState(stateList []*process.StateItem, nodeId string) (state *process.StateItem, err error) {
+	if nodeId != "" {
+		state = process.GetStateItem(stateList, nodeId)
+		if state == nil {
+			return nil, errors.New("工单当前不在此节点")
+		}
+		if state.Claim == nil && !state.Claimable() {
+			return nil, errors.New("仅处理人为角色或部门的节点可以认领")
+		}
+		return
+	}
+
+	for _, item := range stateList {
+		if item.Claim == nil && !item.Claimable() {
+			continue
+		}
+		if state != nil {
+			return nil, errors.New("工单有多个可认领的节点，请指定节点")
+		}
+		state = item
+	}
+	if state == nil {
+		return nil, errors.New("工单当前没有可认领的节点")
+	}
+	return
+}
+
+// 保存认领后的节点数据并记录流转历史，actor 为空时表示由系统释放
+func saveClaimState(tx *gorm.DB, workOrderInfo *process.WorkOrderInfo, stateList []*process.StateItem, state *process.StateItem, circulation string, actor *Actor, remarks string) (err error) {
+	var stateValue []byte
+
+	stateValue, err = json.Marshal(stateList)
+	if err != nil {
+		return fmt.Errorf("节点数据序列化失败，%v", err.Error())
+	}
+	err = UpdateWorkOrder(tx, workOrderInfo, map[string]interface{}{
+		"state": stateValue,
+	})
+	if err != nil {
+		return
+	}
+
+	// 认领记录不记录源节点，避免被计入会签及并行节点的处理记录
+	history := process.CirculationHistory{
+		Title:       workOrderInfo.Title,
+		WorkOrder:   workOrderInfo.Id,
+		State:       state.Label,
+		Circulation: circulation,
+		Remarks:     remarks,
+		Status:      2, // 其他
+	}
+	history.ProcessorId, history.Processor = actor.processor()
+	err = tx.Create(&history).Error
+	if err != nil {
+		return fmt.Errorf("新建%v历史失败，%v", circulation, err.Error())
+	}
+	return
+}
+
+// 认领的空闲超时时间，为 0 时不会自动释放
+func ClaimTimeout() time.Duration {
+	return viper.GetDuration("settings.claim.timeout")
+}
+
+// 存在认领的未结束工单
+func ClaimedWorkOrders(db *gorm.DB) (workOrderIds []int, err error) {
+	err = db.Model(&process.WorkOrderInfo{}).
+		Where("is_end = 0 and JSON_CONTAINS_PATH(state, 'one', '$[*].claim')").
+		Pluck("id", &workOrderIds).Error
+	if err != nil {
+		err = fmt.Errorf("查询已认领的工单失败，%v", err.Error())
+	}
+	return
+}
+
+// 释放工单中超过空闲时间的认领，在调用方的事务中写入
+func ReleaseExpiredClaims(tx *gorm.DB, workOrderId int, timeout time.Duration) (err error) {
+	workOrderInfo, stateList, err := lockWorkOrderState(tx, workOrderId)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, state := range stateList {
+		if !state.ClaimExpired(now, timeout) {
+			continue
+		}
+		state.Release()
+		err = saveClaimState(tx, &workOrderInfo, stateList, state, "认领超时释放", nil,
+			fmt.Sprintf("认领超过 %v 未处理，工单已自动释放", timeout))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
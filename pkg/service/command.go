@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 工单流转的操作人及命令，不依赖 HTTP 请求
+*/
+
+// 操作人
+type Actor struct {
+	UserId int    // 用户ID
+	RoleId int    // 角色ID
+	DeptId int    // 部门ID
+	Name   string // 用户昵称
+}
+
+func NewActor(user *system.SysUser) *Actor {
+	return &Actor{
+		UserId: user.UserId,
+		RoleId: user.RoleId,
+		DeptId: user.DeptId,
+		Name:   user.NickName,
+	}
+}
+
+// 记录到流转历史中的处理人，actor 为空时表示由系统处理
+func (a *Actor) processor() (id int, name string) {
+	if a == nil {
+		return 0, systemProcessor
+	}
+	return a.UserId, a.Name
+}
+
+// 根据用户ID查询操作人
+func LoadActor(userId int) (actor *Actor, err error) {
+	var user system.SysUser
+
+	err = orm.Eloquent.Model(&system.SysUser{}).
+		Where("user_id = ?", userId).
+		Find(&user).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询操作人信息失败，%v", err.Error())
+	}
+	return NewActor(&user), nil
+}
+
+// 处理工单
+type HandleCommand struct {
+	Tasks          []string
+	TargetState    string                   `json:"target_state"`    // 目标状态
+	SourceState    string                   `json:"source_state"`    // 源状态
+	WorkOrderId    int                      `json:"work_order_id"`   // 工单ID
+	Circulation    string                   `json:"circulation"`     // 流转ID
+	FlowProperties int                      `json:"flow_properties"` // 流转类型 0 拒绝，1 同意，2 其他
+	Remarks        string                   `json:"remarks"`         // 处理的备注信息
+	Tpls           []map[string]interface{} `json:"tpls"`            // 表单数据
+	IsExecTask     bool                     `json:"is_exec_task"`    // 是否执行任务
+	Version        *int                     `json:"version"`         // 读取到的工单版本，工单已被修改时拒绝处理
+}
+
+// 新建工单
+type CreateCommand struct {
+	process.WorkOrderInfo
+	Tpls        map[string][]interface{} `json:"tpls"`
+	SourceState string                   `json:"source_state"`
+	Tasks       json.RawMessage          `json:"tasks"`
+	Source      string                   `json:"source"`
+	IsExecTask  bool                     `json:"is_exec_task"`
+}
+
+// 退回工单
+type ReturnCommand struct {
+	WorkOrderId int    `json:"work_order_id"` // 工单ID
+	SourceState string `json:"source_state"`  // 当前节点
+	TargetState string `json:"target_state"`  // 退回到的节点
+	Remarks     string `json:"remarks"`       // 退回原因
+	Resume      bool   `json:"resume"`        // 退回的节点处理后是否直接返回当前节点
+	Version     *int   `json:"version"`       // 读取到的工单版本
+}
+
+// 加签
+type AddSignerCommand struct {
+	WorkOrderId int    `json:"work_order_id"` // 工单ID
+	SourceState string `json:"source_state"`  // 当前节点
+	Mode        string `json:"mode"`          // 加签方式，before 前加签，after 后加签
+	Users       []int  `json:"users"`         // 加签人
+	Remarks     string `json:"remarks"`       // 备注
+	Version     *int   `json:"version"`       // 读取到的工单版本
+}
+
+// 撤回工单
+type WithdrawCommand struct {
+	WorkOrderId int    `json:"work_order_id"` // 工单ID
+	Remarks     string `json:"remarks"`       // 撤回原因
+	Version     *int   `json:"version"`       // 读取到的工单版本
+}
+
+// 转交工单
+type InversionCommand struct {
+	WorkOrderId int    `json:"work_order_id"` // 工单ID
+	NodeId      string `json:"node_id"`       // 转交的节点
+	UserId      int    `json:"user_id"`       // 转交给的用户
+	Remarks     string `json:"remarks"`       // 备注
+	Version     *int   `json:"version"`       // 读取到的工单版本
+}
+
+// 认领或释放工单
+type ClaimCommand struct {
+	WorkOrderId int    `json:"work_order_id"` // 工单ID
+	NodeId      string `json:"node_id"`       // 认领的节点，为空时工单需要只有一个可认领的节点
+	Remarks     string `json:"remarks"`       // 备注
+	Version     *int   `json:"version"`       // 读取到的工单版本
+}
+
+// 手动结束或重开工单
+type WorkOrderCommand struct {
+	WorkOrderId int  `json:"work_order_id"` // 工单ID
+	Version     *int `json:"version"`       // 读取到的工单版本
+}
+
+// 将工单迁移到流程的指定版本
+type MigrateCommand struct {
+	ProcessId    int               `json:"process_id"`     // 流程ID
+	WorkOrderIds []int             `json:"work_order_ids"` // 需要迁移的工单
+	Version      int               `json:"version"`        // 目标版本，0 表示当前发布的版本
+	NodeMapping  map[string]string `json:"node_mapping"`   // 节点映射，键为工单当前的节点，值为新版本中的节点
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流转条件判断
+*/
+
+// 日期比较支持的格式
+var conditionDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC3339,
+	"15:04:05",
+	"15:04",
+}
+
+// 条件列表中任意一个条件成立即视为流转成立
+func (h *Handle) matchConditions(conditions []*process.Condition) (result bool, err error) {
+	for _, condExpr := range conditions {
+		result, err = h.ConditionalJudgment(condExpr)
+		if err != nil || result {
+			return
+		}
+	}
+	return
+}
+
+// 条件判断
+func (h *Handle) ConditionalJudgment(condExpr *process.Condition) (result bool, err error) {
+	// 条件分组
+	if condExpr.IsGroup() {
+		for _, condition := range condExpr.Conditions {
+			result, err = h.ConditionalJudgment(condition)
+			if err != nil {
+				return
+			}
+			if condExpr.Logic == process.ConditionLogicOr && result {
+				return
+			}
+			if condExpr.Logic == process.ConditionLogicAnd && !result {
+				return
+			}
+		}
+		return
+	}
+
+	condExprValue, err := h.conditionValue(condExpr.Key)
+	if err != nil {
+		return
+	}
+
+	switch condExpr.Sign {
+	case process.ConditionSignEmpty:
+		return isEmptyValue(condExprValue), nil
+	case process.ConditionSignNotEmpty:
+		return !isEmptyValue(condExprValue), nil
+	}
+
+	if condExprValue == nil {
+		err = errors.New("未查询到对应的表单数据。")
+		return
+	}
+
+	switch condExpr.Sign {
+	case process.ConditionSignIn, process.ConditionSignNotIn:
+		result, err = inValues(condExpr, condExprValue, condExpr.Value.([]interface{}))
+		if condExpr.Sign == process.ConditionSignNotIn {
+			result = !result
+		}
+	case process.ConditionSignContains, process.ConditionSignNotContains:
+		result, err = containsValue(condExpr, condExprValue)
+		if condExpr.Sign == process.ConditionSignNotContains {
+			result = !result
+		}
+	case process.ConditionSignRegex:
+		result = condExpr.Regexp().MatchString(conditionString(condExprValue))
+	default:
+		var cmp int
+		cmp, err = compareValue(condExpr, condExprValue, condExpr.Value)
+		if err != nil {
+			return
+		}
+		switch condExpr.Sign {
+		case process.ConditionSignEq:
+			result = cmp == 0
+		case process.ConditionSignNe:
+			result = cmp != 0
+		case process.ConditionSignGt:
+			result = cmp > 0
+		case process.ConditionSignGte:
+			result = cmp >= 0
+		case process.ConditionSignLt:
+			result = cmp < 0
+		case process.ConditionSignLte:
+			result = cmp <= 0
+		default:
+			err = fmt.Errorf("不支持的判断符号 %v", condExpr.Sign)
+		}
+	}
+
+	return
+}
+
+// 获取条件对应的值，$ 开头的为工单信息，其余为表单数据
+func (h *Handle) conditionValue(key string) (value interface{}, err error) {
+	if strings.HasPrefix(key, process.ConditionMetaPrefix) {
+		if h.conditionMeta == nil {
+			err = h.loadConditionMeta()
+			if err != nil {
+				return
+			}
+		}
+		value = h.conditionMeta[key]
+		return
+	}
+
+	for _, data := range h.WorkOrderData {
+		var formData map[string]interface{}
+		err = json.Unmarshal(data, &formData)
+		if err != nil {
+			return
+		}
+		if formValue, ok := formData[key]; ok {
+			value = formValue
+			return
+		}
+	}
+	return
+}
+
+// 加载条件判断中可引用的工单信息
+func (h *Handle) loadConditionMeta() (err error) {
+	var (
+		creatorInfo system.SysUser
+		deptInfo    system.Dept
+		roleInfo    system.SysRole
+		createdAt   = h.workOrderDetails.CreatedAt.Time
+	)
+
+	// 新建工单时尚未写入创建时间
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	meta := map[string]interface{}{
+		"$title":      h.workOrderDetails.Title,
+		"$priority":   float64(h.workOrderDetails.Priority),
+		"$process":    float64(h.workOrderDetails.Process),
+		"$classify":   float64(h.workOrderDetails.Classify),
+		"$created_at": createdAt.Format("2006-01-02 15:04:05"),
+		"$creator":    float64(h.workOrderDetails.Creator),
+	}
+
+	err = orm.Eloquent.Model(&system.SysUser{}).
+		Where("user_id = ?", h.workOrderDetails.Creator).
+		Find(&creatorInfo).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return fmt.Errorf("查询工单创建人信息失败，%v", err.Error())
+	}
+	meta["$creator_name"] = creatorInfo.NickName
+	if creatorInfo.NickName == "" {
+		meta["$creator_name"] = creatorInfo.Username
+	}
+	meta["$creator_dept"] = float64(creatorInfo.DeptId)
+	meta["$creator_role"] = float64(creatorInfo.RoleId)
+	meta["$creator_post"] = float64(creatorInfo.PostId)
+
+	if creatorInfo.DeptId != 0 {
+		err = orm.Eloquent.Model(&system.Dept{}).
+			Where("dept_id = ?", creatorInfo.DeptId).
+			Find(&deptInfo).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return fmt.Errorf("查询工单创建人部门失败，%v", err.Error())
+		}
+	}
+	meta["$creator_dept_name"] = deptInfo.DeptName
+
+	if creatorInfo.RoleId != 0 {
+		err = orm.Eloquent.Model(&system.SysRole{}).
+			Where("role_id = ?", creatorInfo.RoleId).
+			Find(&roleInfo).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return fmt.Errorf("查询工单创建人角色失败，%v", err.Error())
+		}
+	}
+	meta["$creator_role_name"] = roleInfo.RoleName
+	meta["$creator_role_key"] = roleInfo.RoleKey
+
+	h.conditionMeta = meta
+	return nil
+}
+
+// 判断是否为空值，空字符串、空列表及未填写的字段均视为空
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// 判断值是否在列表中，值为列表（如多选）时，任意一项在列表中即成立
+func inValues(condExpr *process.Condition, value interface{}, valueList []interface{}) (result bool, err error) {
+	var cmp int
+
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			result, err = inValues(condExpr, item, valueList)
+			if err != nil || result {
+				return
+			}
+		}
+		return
+	}
+
+	for _, item := range valueList {
+		cmp, err = compareValue(condExpr, value, item)
+		if err != nil {
+			return
+		}
+		if cmp == 0 {
+			return true, nil
+		}
+	}
+	return
+}
+
+// 判断是否包含，值为列表时判断是否包含某一项，否则判断是否包含子串
+func containsValue(condExpr *process.Condition, value interface{}) (result bool, err error) {
+	if items, ok := value.([]interface{}); ok {
+		return inValues(condExpr, condExpr.Value, items)
+	}
+	return strings.Contains(conditionString(value), conditionString(condExpr.Value)), nil
+}
+
+// 比较两个值，返回 -1、0、1
+func compareValue(condExpr *process.Condition, formValue interface{}, value interface{}) (cmp int, err error) {
+	switch condExpr.Type {
+	case process.ConditionTypeString:
+		return strings.Compare(conditionString(formValue), conditionString(value)), nil
+	case process.ConditionTypeNumber:
+		var a, b float64
+		a, err = conditionNumber(formValue)
+		if err == nil {
+			b, err = conditionNumber(value)
+		}
+		if err != nil {
+			err = fmt.Errorf("条件 %v 无法按数字进行比较，%v", condExpr.Key, err.Error())
+			return
+		}
+		return compareFloat(a, b), nil
+	case process.ConditionTypeDate:
+		var a, b time.Time
+		a, err = conditionDate(formValue)
+		if err == nil {
+			b, err = conditionDate(value)
+		}
+		if err != nil {
+			err = fmt.Errorf("条件 %v 无法按日期进行比较，%v", condExpr.Key, err.Error())
+			return
+		}
+		return compareFloat(float64(a.UnixNano()), float64(b.UnixNano())), nil
+	}
+
+	// 未指定比较类型时，根据表单数据的类型进行比较
+	switch v := formValue.(type) {
+	case string:
+		switch value.(type) {
+		case string:
+			return strings.Compare(v, value.(string)), nil
+		case float64:
+			var a float64
+			a, err = conditionNumber(v)
+			if err == nil {
+				return compareFloat(a, value.(float64)), nil
+			}
+		}
+	case float64:
+		var b float64
+		b, err = conditionNumber(value)
+		if err == nil {
+			return compareFloat(v, b), nil
+		}
+	case bool:
+		if b, ok := value.(bool); ok {
+			if v == b {
+				return 0, nil
+			}
+			return 1, nil
+		}
+	default:
+		err = errors.New("条件判断目前仅支持字符串、数字、布尔及日期。")
+		return
+	}
+
+	err = fmt.Errorf("条件 %v 的比较值类型与表单数据类型不一致", condExpr.Key)
+	return
+}
+
+func compareFloat(a, b float64) int {
+	if a > b {
+		return 1
+	} else if a < b {
+		return -1
+	}
+	return 0
+}
+
+func conditionString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}, map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func conditionNumber(value interface{}) (number float64, err error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("不支持的数据类型 %v", reflect.TypeOf(value))
+}
+
+// 解析日期，字符串按照常用格式解析，数字视为时间戳（秒或毫秒）
+func conditionDate(value interface{}) (date time.Time, err error) {
+	switch v := value.(type) {
+	case float64:
+		if v > 1e12 {
+			return time.Unix(0, int64(v)*int64(time.Millisecond)), nil
+		}
+		return time.Unix(int64(v), 0), nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "now" {
+			return time.Now(), nil
+		}
+		for _, layout := range conditionDateLayouts {
+			date, err = time.ParseInLocation(layout, v, time.Local)
+			if err == nil {
+				return
+			}
+		}
+		return date, fmt.Errorf("无法解析的日期 %v", v)
+	}
+	return date, fmt.Errorf("不支持的数据类型 %v", reflect.TypeOf(value))
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 会签进度
+*/
+
+// 会签进度，按照处理单元统计处理结果。
+// 个人会签及角色、部门全员处理时处理单元为用户，其他角色、部门会签时处理单元为角色或部门，单元内任意用户处理即视为该单元已处理
+type counterSignProgress struct {
+	rule   *process.CounterSign
+	units  []int       // 处理单元，按照处理人的顺序排列
+	unitOf map[int]int // 用户所属的处理单元
+	votes  map[int]int // 处理单元的处理结果，1 同意，0 拒绝
+}
+
+// 根据节点当前的处理人及流转历史统计会签进度，historyList 需按照 id 倒序排列
+func newCounterSignProgress(
+	node *process.Node,
+	state *process.StateItem,
+	stateList []*process.StateItem,
+	historyList []process.CirculationHistory,
+) (p *counterSignProgress, err error) {
+	var userList []system.SysUser
+
+	p = &counterSignProgress{
+		rule:   node.CounterSignRule(),
+		unitOf: make(map[int]int),
+		votes:  make(map[int]int),
+	}
+
+	switch state.ProcessMethod {
+	case process.AssignRole, process.AssignDepartment:
+		db := orm.Eloquent.Model(&system.SysUser{})
+		if state.ProcessMethod == process.AssignRole {
+			db = db.Where("role_id in (?)", state.Processor)
+		} else {
+			db = db.Where("dept_id in (?)", state.Processor)
+		}
+		err = db.Order("user_id").Find(&userList).Error
+		if err != nil {
+			return
+		}
+		if !node.FullHandle {
+			p.addUnits(state.Processor)
+		}
+		for _, user := range userList {
+			unit := user.RoleId
+			if state.ProcessMethod == process.AssignDepartment {
+				unit = user.DeptId
+			}
+			if node.FullHandle {
+				unit = user.UserId
+				p.addUnits([]int{unit})
+			}
+			p.unitOf[user.UserId] = unit
+		}
+	default:
+		p.addUnits(state.Processor)
+		for _, processor := range state.Processor {
+			p.unitOf[processor] = processor
+		}
+	}
+
+	// 仅统计工单进入当前节点之后的处理记录
+	stateIds := make(map[string]struct{}, len(stateList))
+	for _, item := range stateList {
+		stateIds[item.Id] = struct{}{}
+	}
+	for _, history := range historyList {
+		// 转交、认领等记录不记录源节点
+		if history.Source == "" {
+			continue
+		}
+		if _, ok := stateIds[history.Source]; !ok {
+			break
+		}
+		if history.Source != state.Id || (history.Status != 0 && history.Status != 1) {
+			continue
+		}
+		unit, ok := p.historyUnit(&history)
+		if !ok {
+			continue
+		}
+		if _, voted := p.votes[unit]; !voted {
+			p.votes[unit] = history.Status
+		}
+	}
+	return
+}
+
+func (p *counterSignProgress) addUnits(units []int) {
+	for _, unit := range units {
+		exists := false
+		for _, u := range p.units {
+			if u == unit {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			p.units = append(p.units, unit)
+		}
+	}
+}
+
+// 用户所属的处理单元
+func (p *counterSignProgress) userUnit(userId int) (unit int, ok bool) {
+	unit, ok = p.unitOf[userId]
+	return
+}
+
+// 处理记录所属的处理单元，代理处理的记录计入委托人
+func (p *counterSignProgress) historyUnit(history *process.CirculationHistory) (unit int, ok bool) {
+	if history.Delegator != 0 {
+		if unit, ok = p.unitOf[history.Delegator]; ok {
+			return
+		}
+	}
+	unit, ok = p.unitOf[history.ProcessorId]
+	return
+}
+
+// 依次会签时下一个需要处理的处理单元
+func (p *counterSignProgress) next() (unit int, ok bool) {
+	for _, unit = range p.units {
+		if _, voted := p.votes[unit]; !voted {
+			return unit, true
+		}
+	}
+	return 0, false
+}
+
+// 处理单元当前是否可以处理，已处理或依次会签时未轮到的单元无法处理
+func (p *counterSignProgress) pending(unit int) bool {
+	if _, voted := p.votes[unit]; voted {
+		return false
+	}
+	if p.rule.Strategy == process.CounterSignSequential {
+		next, ok := p.next()
+		return ok && next == unit
+	}
+	return true
+}
+
+// 记录处理单元的处理结果，flowProperties 为 0 时表示拒绝
+func (p *counterSignProgress) vote(unit int, flowProperties int) {
+	if flowProperties != 0 {
+		flowProperties = 1
+	}
+	p.votes[unit] = flowProperties
+}
+
+func (p *counterSignProgress) count(status int) (count int) {
+	for _, unit := range p.units {
+		if vote, ok := p.votes[unit]; ok && vote == status {
+			count += 1
+		}
+	}
+	return
+}
+
+// 同意的处理单元是否已达到要求
+func (p *counterSignProgress) approved() bool {
+	return p.count(1) >= p.rule.Required(len(p.units))
+}
+
+// 是否已被拒绝，一票否决时任意处理单元拒绝即为拒绝，否则剩余处理单元全部同意也无法达到要求时为拒绝
+func (p *counterSignProgress) rejected() bool {
+	denied := p.count(0)
+	if denied == 0 {
+		return false
+	}
+	return p.rule.Veto || len(p.units)-denied < p.rule.Required(len(p.units))
+}
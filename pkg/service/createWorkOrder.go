@@ -7,91 +7,79 @@ import (
 	"ferry/models/process"
 	"ferry/models/system"
 	"ferry/pkg/notify"
-	"ferry/tools"
 	"fmt"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 /*
   @Author : lanyulei
 */
 
-func CreateWorkOrder(c *gin.Context) (err error) {
+// 新建工单，actor 为工单的创建人。在调用方的事务中写入工单数据，
+// 事务的提交与回滚由调用方负责，提交后再调用 ExecCreateTasks 执行任务
+func CreateWorkOrder(tx *gorm.DB, actor *Actor, workOrderValue *CreateCommand) (workOrder *process.WorkOrderInfo, err error) {
 	var (
-		taskList       []string
-		stateList      []interface{}
+		stateList      []*process.StateItem
 		userInfo       system.SysUser
-		variableValue  []interface{}
 		processValue   process.Info
 		sendToUserList []system.SysUser
-		noticeList     []int
+		noticeList     []*notify.Channel
 		handle         Handle
-		processState   ProcessState
-		condExprStatus bool
+		processState   *ProcessState
 		tpl            []byte
-		sourceEdges    []map[string]interface{}
-		targetEdges    []map[string]interface{}
-		currentNode    map[string]interface{}
-		workOrderValue struct {
-			process.WorkOrderInfo
-			Tpls        map[string][]interface{} `json:"tpls"`
-			SourceState string                   `json:"source_state"`
-			Tasks       json.RawMessage          `json:"tasks"`
-			Source      string                   `json:"source"`
-			IsExecTask  bool                     `json:"is_exec_task"`
-		}
-		paramsValue struct {
-			Id       int           `json:"id"`
-			Title    string        `json:"title"`
-			Priority int           `json:"priority"`
-			FormData []interface{} `json:"form_data"`
-		}
+		sourceEdges    []*process.Edge
+		targetEdges    []*process.Edge
+		currentNode    *process.Node
 	)
 
-	err = c.ShouldBind(&workOrderValue)
+	relatedPerson, err := json.Marshal([]int{actor.UserId})
 	if err != nil {
 		return
 	}
 
-	relatedPerson, err := json.Marshal([]int{tools.GetUserId(c)})
+	// 客户端提交的节点仅用于确定初始节点，处理人以流程定义为准
+	stateList, err = process.ParseState(workOrderValue.State)
 	if err != nil {
 		return
 	}
-
-	// 获取变量值
-	err = json.Unmarshal(workOrderValue.State, &variableValue)
-	if err != nil {
+	if len(stateList) == 0 {
+		err = errors.New("工单初始节点不能为空")
 		return
 	}
-	err = GetVariableValue(variableValue, tools.GetUserId(c))
+
+	// 查询流程当前发布版本的信息
+	processValue, err = LatestProcess(tx, workOrderValue.Process)
 	if err != nil {
-		err = fmt.Errorf("获取处理人变量值失败，%v", err.Error())
 		return
 	}
 
-	// 创建工单数据
-	tx := orm.Eloquent.Begin()
-
-	// 查询流程信息
-	err = tx.Model(&processValue).Where("id = ?", workOrderValue.Process).Find(&processValue).Error
+	processState, err = NewProcessState(processValue.Structure)
 	if err != nil {
 		return
 	}
 
-	err = json.Unmarshal(processValue.Structure, &processState.Structure)
+	currentNode = processState.Structure.StartNode()
+	if currentNode == nil {
+		err = errors.New("流程未定义开始节点，请确认")
+		return
+	}
 
-	for _, node := range processState.Structure["nodes"] {
-		if node["clazz"] == "start" {
-			currentNode = node
-		}
+	nodeValue, err := processState.GetNode(stateList[0].Id)
+	if err != nil {
+		return
 	}
 
-	nodeValue, err := processState.GetNode(variableValue[0].(map[string]interface{})["id"].(string))
+	// 初始节点必须由开始节点直接流转
+	sourceEdges, err = processState.GetEdge(currentNode.Id, "source")
 	if err != nil {
 		return
 	}
+	if !hasEdgeTarget(sourceEdges, nodeValue.Id) {
+		err = fmt.Errorf("节点《%v》不是流程的初始节点", nodeValue.Label)
+		return
+	}
 
 	for _, v := range workOrderValue.Tpls["form_data"] {
 		tpl, err = json.Marshal(v)
@@ -101,123 +89,137 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 		handle.WorkOrderData = append(handle.WorkOrderData, tpl)
 	}
 
-	switch nodeValue["clazz"] {
+	// 条件判断中引用的工单信息
+	handle.workOrderDetails = process.WorkOrderInfo{
+		Title:    workOrderValue.Title,
+		Priority: workOrderValue.Priority,
+		Process:  workOrderValue.Process,
+		Classify: workOrderValue.Classify,
+		Creator:  actor.UserId,
+	}
+
+	switch nodeValue.Clazz {
 	// 排他网关
-	case "exclusiveGateway":
-		var sourceEdges []map[string]interface{}
-		sourceEdges, err = processState.GetEdge(nodeValue["id"].(string), "source")
+	case process.GatewayExclusive:
+		var activeEdge *process.Edge
+		sourceEdges, err = processState.GetEdge(nodeValue.Id, "source")
+		if err != nil {
+			return
+		}
+		activeEdge, err = handle.ExclusiveEdge(sourceEdges)
 		if err != nil {
 			return
 		}
-	breakTag:
-		for _, edge := range sourceEdges {
-			edgeCondExpr := make([]map[string]interface{}, 0)
-			err = json.Unmarshal([]byte(edge["conditionExpression"].(string)), &edgeCondExpr)
-			if err != nil {
-				return
-			}
-			for _, condExpr := range edgeCondExpr {
-				// 条件判断
-				condExprStatus, err = handle.ConditionalJudgment(condExpr)
-				if err != nil {
-					return
-				}
-				if condExprStatus {
-					// 进行节点跳转
-					nodeValue, err = processState.GetNode(edge["target"].(string))
-					if err != nil {
-						return
-					}
 
-					if nodeValue["clazz"] == "userTask" || nodeValue["clazz"] == "receiveTask" {
-						if nodeValue["assignValue"] == nil || nodeValue["assignType"] == "" {
-							err = errors.New("处理人不能为空")
-							return
-						}
-					}
-					variableValue[0].(map[string]interface{})["id"] = nodeValue["id"].(string)
-					variableValue[0].(map[string]interface{})["label"] = nodeValue["label"]
-					variableValue[0].(map[string]interface{})["processor"] = nodeValue["assignValue"]
-					variableValue[0].(map[string]interface{})["process_method"] = nodeValue["assignType"]
-					break breakTag
-				}
-			}
+		// 进行节点跳转
+		nodeValue, err = processState.GetNode(activeEdge.Target)
+		if err != nil {
+			return
 		}
-		if !condExprStatus {
-			err = errors.New("所有流转均不符合条件，请确认。")
+
+		err = checkAssignee(nodeValue)
+		if err != nil {
 			return
 		}
-	case "parallelGateway":
+		stateList = []*process.StateItem{process.NewStateItem(nodeValue)}
+	case process.GatewayParallel, process.GatewayInclusive:
 		// 入口，判断
-		sourceEdges, err = processState.GetEdge(nodeValue["id"].(string), "source")
+		sourceEdges, err = processState.GetEdge(nodeValue.Id, "source")
 		if err != nil {
 			err = fmt.Errorf("查询流转信息失败，%v", err.Error())
 			return
 		}
 
-		targetEdges, err = processState.GetEdge(nodeValue["id"].(string), "target")
+		targetEdges, err = processState.GetEdge(nodeValue.Id, "target")
 		if err != nil {
 			err = fmt.Errorf("查询流转信息失败，%v", err.Error())
 			return
 		}
 
-		if len(sourceEdges) > 0 {
-			nodeValue, err = processState.GetNode(sourceEdges[0]["target"].(string))
-			if err != nil {
-				return
+		if len(sourceEdges) > 1 && len(targetEdges) == 1 {
+			// 入口，包容网关仅激活符合条件的分支
+			activeEdges := sourceEdges
+			if nodeValue.Clazz == process.GatewayInclusive {
+				activeEdges, err = handle.InclusiveEdges(sourceEdges)
+				if err != nil {
+					return
+				}
 			}
-		} else {
-			err = errors.New("并行网关流程不正确")
-			return
-		}
 
-		if len(sourceEdges) > 1 && len(targetEdges) == 1 {
-			// 入口
-			variableValue = []interface{}{}
-			for _, edge := range sourceEdges {
-				targetStateValue, err := processState.GetNode(edge["target"].(string))
+			stateList = make([]*process.StateItem, 0)
+			for _, edge := range activeEdges {
+				var targetStateValue *process.Node
+				targetStateValue, err = processState.GetNode(edge.Target)
+				if err != nil {
+					return
+				}
+				err = checkAssignee(targetStateValue)
 				if err != nil {
-					return err
+					return
 				}
-				variableValue = append(variableValue, map[string]interface{}{
-					"id":             edge["target"].(string),
-					"label":          targetStateValue["label"],
-					"processor":      targetStateValue["assignValue"],
-					"process_method": targetStateValue["assignType"],
-				})
+				stateList = append(stateList, process.NewStateItem(targetStateValue))
 			}
+		} else if nodeValue.Clazz == process.GatewayInclusive {
+			err = errors.New("包容网关流程配置不正确")
+			return
 		} else {
 			err = errors.New("并行网关流程配置不正确")
 			return
 		}
+	default:
+		err = checkAssignee(nodeValue)
+		if err != nil {
+			return
+		}
+		stateList = []*process.StateItem{process.NewStateItem(nodeValue)}
 	}
 
-	// 获取变量数据
-	err = GetVariableValue(variableValue, tools.GetUserId(c))
+	// 获取处理人变量值
+	err = ResolveAssignees(&AssigneeContext{
+		DB:        tx,
+		Process:   processValue.Id,
+		Creator:   actor.UserId,
+		FormData:  handle.WorkOrderData,
+		Structure: processState.Structure,
+	}, stateList)
 	if err != nil {
+		err = fmt.Errorf("获取处理人变量值失败，%v", err.Error())
 		return
 	}
 
-	workOrderValue.State, err = json.Marshal(variableValue)
+	// 按照委托规则交由代理人处理
+	err = DelegateState(tx, workOrderValue.Process, stateList)
+	if err != nil {
+		return
+	}
+
+	workOrderValue.State, err = json.Marshal(stateList)
 	if err != nil {
 		return
 	}
 
 	var workOrderInfo = process.WorkOrderInfo{
-		Title:         workOrderValue.Title,
-		Priority:      workOrderValue.Priority,
-		Process:       workOrderValue.Process,
-		Classify:      workOrderValue.Classify,
-		State:         workOrderValue.State,
-		RelatedPerson: relatedPerson,
-		Creator:       tools.GetUserId(c),
+		Title:          workOrderValue.Title,
+		Priority:       workOrderValue.Priority,
+		Process:        workOrderValue.Process,
+		ProcessVersion: processValue.Version,
+		Classify:       workOrderValue.Classify,
+		State:          workOrderValue.State,
+		RelatedPerson:  relatedPerson,
+		Creator:        actor.UserId,
 	}
 	err = tx.Create(&workOrderInfo).Error
 	if err != nil {
-		tx.Rollback()
 		err = fmt.Errorf("创建工单失败，%v", err.Error())
 		return
 	}
+
+	// 计算截止时间
+	err = RefreshDueTime(tx, &workOrderInfo, processState.Structure, stateList)
+	if err != nil {
+		return
+	}
+
 	foundValue := ""
 	problem_text := ""
 	phoneNumber := ""
@@ -231,14 +233,12 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 
 		formDataJson, err = json.Marshal(workOrderValue.Tpls["form_data"][i])
 		if err != nil {
-			tx.Rollback()
 			err = fmt.Errorf("生成json字符串错误，%v", err.Error())
 			return
 		}
 
 		formStructureJson, err = json.Marshal(workOrderValue.Tpls["form_structure"][i])
 		if err != nil {
-			tx.Rollback()
 			err = fmt.Errorf("生成json字符串错误，%v", err.Error())
 			return
 		}
@@ -258,7 +258,6 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 
 		err = tx.Create(&tplData).Error
 		if err != nil {
-			tx.Rollback()
 			err = fmt.Errorf("创建工单模版关联数据失败，%v", err.Error())
 			return
 		}
@@ -266,7 +265,6 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 		var formStructure FormStructure2
 		err = json.Unmarshal(formStructureJson, &formStructure)
 		if err != nil {
-			tx.Rollback()
 			err = fmt.Errorf("解析form_structure JSON失败，%v", err.Error())
 			return
 		}
@@ -277,7 +275,6 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 		err = json.Unmarshal(formDataJson, &formData)
 		fmt.Printf("找到的formDataJson项的值: %s\n", formDataJson)
 		if err != nil {
-			tx.Rollback()
 			err = fmt.Errorf("解析form_data JSON失败，%v", err.Error())
 			return
 		}
@@ -324,9 +321,8 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 	}
 
 	// 获取当前用户信息
-	err = tx.Model(&system.SysUser{}).Where("user_id = ?", tools.GetUserId(c)).Find(&userInfo).Error
+	err = tx.Model(&system.SysUser{}).Where("user_id = ?", actor.UserId).Find(&userInfo).Error
 	if err != nil {
-		tx.Rollback()
 		err = fmt.Errorf("查询用户信息失败，%v", err.Error())
 		return
 	}
@@ -337,25 +333,18 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 	}
 
 	// 创建历史记录
-	err = json.Unmarshal(workOrderInfo.State, &stateList)
-	if err != nil {
-		tx.Rollback()
-		err = fmt.Errorf("json序列化失败，%s", err.Error())
-		return
-	}
 	err = tx.Create(&process.CirculationHistory{
 		Title:       workOrderValue.Title,
 		WorkOrder:   workOrderInfo.Id,
 		State:       workOrderValue.SourceState,
 		Source:      workOrderValue.Source,
-		Target:      stateList[0].(map[string]interface{})["id"].(string),
+		Target:      stateList[0].Id,
 		Circulation: "新建",
 		Processor:   nameValue,
 		ProcessorId: userInfo.UserId,
 		Status:      2, // 其他
 	}).Error
 	if err != nil {
-		tx.Rollback()
 		err = fmt.Errorf("新建历史记录失败，%v", err.Error())
 		return
 	}
@@ -365,15 +354,12 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 		Where("id = ?", workOrderValue.Process).
 		Update("submit_count", processValue.SubmitCount+1).Error
 	if err != nil {
-		tx.Rollback()
 		err = fmt.Errorf("更新流程提交数量统计失败，%v", err.Error())
 		return
 	}
 
-	tx.Commit()
-
-	// 发送通知
-	err = json.Unmarshal(processValue.Notice, &noticeList)
+	// 通知写入发件箱，与工单一同提交
+	noticeList, err = notify.ParseNotice(processValue.Notice)
 	if err != nil {
 		return
 	}
@@ -386,62 +372,85 @@ func CreateWorkOrder(c *gin.Context) (err error) {
 
 		// 获取需要抄送的邮件
 		emailCCList := make([]string, 0)
-		if currentNode["cc"] != nil && len(currentNode["cc"].([]interface{})) > 0 {
+		if len(currentNode.Cc) > 0 {
 			err = orm.Eloquent.Model(&system.SysUser{}).
-				Where("user_id in (?)", currentNode["cc"]).
+				Where("user_id in (?)", currentNode.Cc).
 				Pluck("email", &emailCCList).Error
 			if err != nil {
 				err = errors.New("查询邮件抄送人失败")
 				return
 			}
 		}
-		// 发送通知
-		go func() {
-			bodyData := notify.BodyData{
-				SendTo: map[string]interface{}{
-					"userList": sendToUserList,
-				},
-				EmailCcTo:   emailCCList,
-				Subject:     "您有一条待办工单，请及时处理",
-				Description: "您有一条待办工单请及时处理，工单描述如下",
-				Classify:    noticeList,
-				ProcessId:   workOrderValue.Process,
-				Id:          workOrderInfo.Id,
-				Title:       workOrderValue.Title,
-				ProblemText: problem_text,
-				PhoneNumber: phoneNumber,
-				Creator:     userInfo.NickName,
-				Priority:    workOrderValue.Priority,
-				CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
-			}
-			err = bodyData.SendNotify()
-			if err != nil {
-				err = fmt.Errorf("通知发送失败，%v", err.Error())
-				return
-			}
-		}()
-	}
 
-	if workOrderValue.IsExecTask {
-		// 执行任务
-		err = json.Unmarshal(workOrderValue.Tasks, &taskList)
+		bodyData := notify.BodyData{
+			SendTo: map[string]interface{}{
+				"userList": sendToUserList,
+			},
+			EmailCcTo:   emailCCList,
+			Subject:     "您有一条待办工单，请及时处理",
+			Description: "您有一条待办工单请及时处理，工单描述如下",
+			Channels:    noticeList,
+			Event:       notify.EventCreated,
+			ProcessId:   workOrderValue.Process,
+			Id:          workOrderInfo.Id,
+			Title:       workOrderValue.Title,
+			ProblemText: problem_text,
+			PhoneNumber: phoneNumber,
+			Creator:     userInfo.NickName,
+			Priority:    workOrderValue.Priority,
+			CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
+		}
+		err = fillNotifyForm(tx, &bodyData)
 		if err != nil {
 			return
 		}
-		if len(taskList) > 0 {
-			paramsValue.Id = workOrderInfo.Id
-			paramsValue.Title = workOrderInfo.Title
-			paramsValue.Priority = workOrderInfo.Priority
-			paramsValue.FormData = workOrderValue.Tpls["form_data"]
-			var params []byte
-			params, err = json.Marshal(paramsValue)
-			if err != nil {
-				return
-			}
-
-			go ExecTask(taskList, string(params))
+		err = notify.Enqueue(tx, &bodyData)
+		if err != nil {
+			return
 		}
 	}
 
+	// 第一个节点为定时节点时写入定时任务
+	err = ScheduleTimers(tx, &workOrderInfo, processState, stateList)
+	if err != nil {
+		return
+	}
+
+	// 第一个节点为阻塞任务节点时写入脚本任务
+	err = ScheduleScripts(tx, &workOrderInfo, processState, stateList)
+	if err != nil {
+		return
+	}
+
+	// 第一个节点为子流程节点时创建子工单
+	err = startSubProcesses(tx, &workOrderInfo, processState, stateList, stateList)
+	if err != nil {
+		return
+	}
+
+	workOrder = &workOrderInfo
 	return
 }
+
+func hasEdgeTarget(edges []*process.Edge, target string) bool {
+	for _, edge := range edges {
+		if edge.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// 新建工单的事务提交后执行任务
+func ExecCreateTasks(workOrderValue *CreateCommand, workOrder *process.WorkOrderInfo) (err error) {
+	var taskList []string
+
+	if !workOrderValue.IsExecTask || len(workOrderValue.Tasks) == 0 {
+		return
+	}
+	err = json.Unmarshal(workOrderValue.Tasks, &taskList)
+	if err != nil {
+		return
+	}
+	return ExecWorkOrderTasks(taskList, workOrder, workOrderValue.Tpls["form_data"])
+}
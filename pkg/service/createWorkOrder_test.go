@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/models/process"
+	"ferry/pkg/testdb"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 开始 -> 审批(用户 2) -> 复核(用户 3) -> 结束
+var createStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "approve", "label": "审批", "clazz": process.NodeUserTask, "sort": 2, "assignType": process.AssignPerson, "assignValue": []int{2}},
+		{"id": "review", "label": "复核", "clazz": process.NodeUserTask, "sort": 3, "assignType": process.AssignPerson, "assignValue": []int{3}},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 4},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "approve"},
+		{"id": "e2", "source": "approve", "target": "review"},
+		{"id": "e3", "source": "review", "target": "end"},
+	},
+}
+
+func createWorkOrder(t *testing.T, db *gorm.DB, processId int, stateList []*process.StateItem) (workOrder *process.WorkOrderInfo, err error) {
+	t.Helper()
+	state, err := json.Marshal(stateList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &CreateCommand{Source: "start", SourceState: "开始"}
+	cmd.Title = "测试工单"
+	cmd.Process = processId
+	cmd.State = state
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	workOrder, err = CreateWorkOrder(tx, &Actor{UserId: 1}, cmd)
+	if err != nil {
+		return
+	}
+	err = tx.Commit().Error
+	return
+}
+
+// 处理人以流程定义为准，忽略客户端提交的处理人
+func TestCreateWorkOrderIgnoresClientProcessor(t *testing.T) {
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3, 4)
+	processInfo := testdb.Process(t, db, createStructure)
+
+	workOrder, err := createWorkOrder(t, db, processInfo.Id, []*process.StateItem{{
+		Id:            "approve",
+		Label:         "审批",
+		Processor:     []int{4},
+		ProcessMethod: process.AssignPerson,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateList, err := process.ParseState(testdb.GetWorkOrder(t, db, workOrder.Id).State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stateList) != 1 || stateList[0].Id != "approve" || len(stateList[0].Processor) != 1 || stateList[0].Processor[0] != 2 {
+		t.Errorf("期望由用户 2 处理审批节点，实际为 %+v", stateList[0])
+	}
+}
+
+// 初始节点必须由开始节点直接流转
+func TestCreateWorkOrderRejectsSkippedNode(t *testing.T) {
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, createStructure)
+
+	_, err := createWorkOrder(t, db, processInfo.Id, []*process.StateItem{{Id: "review", Label: "复核"}})
+	if err == nil {
+		t.Fatal("期望跳过审批节点时新建失败")
+	}
+	var count int
+	db.Model(&process.WorkOrderInfo{}).Count(&count)
+	if count != 0 {
+		t.Errorf("新建失败时不应写入工单，实际为 %v 条", count)
+	}
+}
@@ -40,6 +40,7 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 		total          int
 		overs          int
 		processing     int
+		withdrawn      int
 		sqlValue       string
 		rows           *sql.Rows
 		startTime      time.Time
@@ -72,7 +73,8 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 		a.click_date,
 		ifnull( b.total, 0 ) AS total,
 		ifnull( b.overs, 0 ) AS overs,
-		ifnull( b.processing, 0 ) AS processing 
+		ifnull( b.processing, 0 ) AS processing,
+		ifnull( b.withdrawn, 0 ) AS withdrawn 
 	FROM
 		(%s) a
 		LEFT JOIN (
@@ -80,7 +82,8 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 			a1.datetime AS datetime,
 			a1.count AS total,
 			b1.count AS overs,
-			c.count AS processing
+			c.count AS processing,
+			d.count AS withdrawn
 		FROM
 			(
 			SELECT
@@ -97,7 +100,7 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 			FROM
 				p_work_order_info 
 			WHERE
-				is_end = 1 
+				is_end = 1 AND is_withdrawn = 0 
 			GROUP BY
 			date( create_time )) b1 ON a1.datetime = b1.datetime
 			LEFT JOIN (
@@ -109,7 +112,17 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 			WHERE
 				is_end = 0 
 			GROUP BY
-			date( create_time )) c ON a1.datetime = c.datetime 
+			date( create_time )) c ON a1.datetime = c.datetime
+			LEFT JOIN (
+			SELECT
+				date( create_time ) AS datetime,
+				count(*) AS count 
+			FROM
+				p_work_order_info 
+			WHERE
+				is_withdrawn = 1 
+			GROUP BY
+			date( create_time )) d ON a1.datetime = d.datetime 
 		) b ON a.click_date = b.datetime order by a.click_date;`, sqlDataValue)
 	rows, err = orm.Eloquent.Raw(sqlValue).Rows()
 	if err != nil {
@@ -120,7 +133,7 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 	}()
 	statisticsData = map[string][]interface{}{}
 	for rows.Next() {
-		err = rows.Scan(&datetime, &total, &overs, &processing)
+		err = rows.Scan(&datetime, &total, &overs, &processing, &withdrawn)
 		if err != nil {
 			return
 		}
@@ -128,6 +141,7 @@ func (s *Statistics) DateRangeStatistics() (statisticsData map[string][]interfac
 		statisticsData["total"] = append(statisticsData["total"], total)
 		statisticsData["overs"] = append(statisticsData["overs"], overs)
 		statisticsData["processing"] = append(statisticsData["processing"], processing)
+		statisticsData["withdrawn"] = append(statisticsData["withdrawn"], withdrawn)
 	}
 	return
 }
@@ -178,8 +192,9 @@ func (s *Statistics) SubmitRanking() (submitRankingData map[string][]interface{}
 // 查询工单数量统计
 func (s *Statistics) WorkOrderCount(c *gin.Context) (countList map[string]int, err error) {
 	var (
-		w      *WorkOrder
-		result interface{}
+		w         *WorkOrder
+		result    interface{}
+		withdrawn int
 	)
 	countList = make(map[string]int)
 	for _, i := range []int{1, 2, 3, 4} {
@@ -208,6 +223,15 @@ func (s *Statistics) WorkOrderCount(c *gin.Context) (countList map[string]int, e
 		}
 	}
 
+	// 已撤回的工单
+	err = orm.Eloquent.Model(&process.WorkOrderInfo{}).
+		Where("is_withdrawn = 1").
+		Count(&withdrawn).Error
+	if err != nil {
+		return
+	}
+	countList["withdrawn"] = withdrawn
+
 	return
 }
 
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 处理人委托代理
+*/
+
+// 当前生效的委托规则
+func activeDelegateRules(db *gorm.DB) *gorm.DB {
+	now := time.Now().Format(process.DelegateTimeLayout)
+	return db.Model(&process.DelegateRule{}).
+		Where("status = 1 and start_time <= ? and end_time >= ?", now, now).
+		Order("process desc, id desc")
+}
+
+// 按照委托规则将节点的处理人替换为代理人，仅处理指定到个人的节点。
+// 同一委托人存在多条规则时，指定流程的规则优先。
+func DelegateState(db *gorm.DB, processId int, stateList []*process.StateItem) (err error) {
+	var (
+		userIds  []int
+		ruleList []*process.DelegateRule
+		rules    = make(map[int]*process.DelegateRule)
+	)
+
+	for _, state := range stateList {
+		if state.ProcessMethod == process.AssignPerson {
+			userIds = append(userIds, state.Processor...)
+		}
+	}
+	if len(userIds) == 0 {
+		return
+	}
+
+	err = activeDelegateRules(db).
+		Where("user_id in (?) and process in (?)", userIds, []int{0, processId}).
+		Find(&ruleList).Error
+	if err != nil {
+		return fmt.Errorf("查询委托规则失败，%v", err.Error())
+	}
+	for _, rule := range ruleList {
+		if _, ok := rules[rule.UserId]; !ok {
+			rules[rule.UserId] = rule
+		}
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	for _, state := range stateList {
+		if state.ProcessMethod != process.AssignPerson {
+			continue
+		}
+		processor := make([]int, 0, len(state.Processor))
+		for _, userId := range state.Processor {
+			if rule, ok := rules[userId]; ok {
+				state.Delegates = append(state.Delegates, &process.DelegateItem{
+					Delegator: userId,
+					Delegate:  rule.Delegate,
+				})
+				userId = rule.Delegate
+			}
+			processor = appendUnique(processor, userId)
+		}
+		state.Processor = processor
+	}
+	return
+}
+
+// 代理人可处理的委托人已有的待办工单对应的委托规则
+func PendingDelegateRules(delegate int) (ruleList []*process.DelegateRule, err error) {
+	err = activeDelegateRules(orm.Eloquent).
+		Where("delegate = ? and move_pending = 1", delegate).
+		Find(&ruleList).Error
+	if err != nil {
+		err = fmt.Errorf("查询委托规则失败，%v", err.Error())
+	}
+	return
+}
+
+// 用户处理节点时所代理的委托人，未代理他人时返回 0
+func OnBehalfOf(workOrder *process.WorkOrderInfo, state *process.StateItem, userId int) (delegator int, err error) {
+	var ruleList []*process.DelegateRule
+
+	if state.ProcessMethod != process.AssignPerson {
+		return
+	}
+	for _, processor := range state.Processor {
+		if processor == userId {
+			return state.Delegator(userId), nil
+		}
+	}
+
+	ruleList, err = PendingDelegateRules(userId)
+	if err != nil {
+		return
+	}
+	for _, rule := range ruleList {
+		if rule.Process != 0 && rule.Process != workOrder.Process {
+			continue
+		}
+		for _, processor := range state.Processor {
+			if processor == rule.UserId {
+				return rule.UserId, nil
+			}
+		}
+	}
+	return
+}
+
+// 流转历史中的处理人名称，代理处理时记录委托人
+func DelegateProcessorName(userInfo *system.SysUser, delegator int) (name string, err error) {
+	var delegatorInfo system.SysUser
+
+	name = userInfo.NickName
+	if delegator == 0 {
+		return
+	}
+	err = orm.Eloquent.Model(&system.SysUser{}).
+		Where("user_id = ?", delegator).
+		Find(&delegatorInfo).Error
+	if err != nil {
+		return "", fmt.Errorf("查询委托人信息失败，%v", err.Error())
+	}
+	name = fmt.Sprintf("%v（代%v处理）", userInfo.NickName, delegatorInfo.NickName)
+	return
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 手动结束及重开工单
+*/
+
+// 手动结束工单，子工单结束后父工单继续流转，在调用方的事务中写入
+func EndWorkOrder(tx *gorm.DB, actor *Actor, cmd *WorkOrderCommand) (err error) {
+	var workOrderInfo process.WorkOrderInfo
+
+	// 查询工单信息
+	err = tx.Model(&workOrderInfo).
+		Where("id = ?", cmd.WorkOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询工单失败，%v", err.Error())
+	}
+	if workOrderInfo.IsEnd == 1 {
+		return errors.New("工单已结束")
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+
+	// 更新工单状态
+	err = UpdateWorkOrder(tx, &workOrderInfo, map[string]interface{}{
+		"is_end": 1,
+	})
+	if err != nil {
+		return fmt.Errorf("结束工单失败，%w", err)
+	}
+
+	// 写入历史
+	history := process.CirculationHistory{
+		Title:       workOrderInfo.Title,
+		WorkOrder:   workOrderInfo.Id,
+		State:       "结束工单",
+		Circulation: "工单结束",
+		Remarks:     "手动结束工单。",
+		Status:      2,
+	}
+	history.ProcessorId, history.Processor = actor.processor()
+	err = tx.Create(&history).Error
+	if err != nil {
+		return fmt.Errorf("新建结束历史失败，%v", err.Error())
+	}
+
+	// 子工单结束后父工单继续流转
+	return CompleteSubWorkOrder(tx, &workOrderInfo)
+}
+
+// 重开工单，以流程当前发布的版本新建工单并复制原工单的表单数据，由操作人从开始节点重新提交。
+// 原工单版本加一，同一版本的工单仅能重开一次，在调用方的事务中写入
+func ReopenWorkOrder(tx *gorm.DB, actor *Actor, cmd *WorkOrderCommand) (newWorkOrder *process.WorkOrderInfo, err error) {
+	var (
+		workOrder     process.WorkOrderInfo
+		processInfo   process.Info
+		structure     *process.Structure
+		startNode     *process.Node
+		jsonState     []byte
+		relatedPerson []byte
+		workOrderData []*process.TplData
+	)
+
+	// 查询当前ID的工单信息
+	err = tx.Model(&workOrder).
+		Where("id = ?", cmd.WorkOrderId).
+		Find(&workOrder).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工单信息失败，%v", err.Error())
+	}
+	err = checkWorkOrderVersion(&workOrder, cmd.Version)
+	if err != nil {
+		return
+	}
+
+	// 创建新的工单，使用流程当前发布的版本
+	processInfo, err = LatestProcess(tx, workOrder.Process)
+	if err != nil {
+		return
+	}
+	structure, err = process.ParseStructure(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	startNode = structure.StartNode()
+	if startNode == nil {
+		return nil, errors.New("流程未定义开始节点，请确认")
+	}
+
+	state := []*process.StateItem{{
+		Id:            startNode.Id,
+		Label:         startNode.Label,
+		Processor:     []int{actor.UserId},
+		ProcessMethod: process.AssignPerson,
+	}}
+	jsonState, err = json.Marshal(state)
+	if err != nil {
+		return
+	}
+	relatedPerson, err = json.Marshal([]int{actor.UserId})
+	if err != nil {
+		return
+	}
+
+	err = UpdateWorkOrder(tx, &workOrder, map[string]interface{}{})
+	if err != nil {
+		return
+	}
+
+	newWorkOrder = &process.WorkOrderInfo{
+		Title:          workOrder.Title,
+		Priority:       workOrder.Priority,
+		Process:        workOrder.Process,
+		ProcessVersion: processInfo.Version,
+		Classify:       workOrder.Classify,
+		State:          jsonState,
+		RelatedPerson:  relatedPerson,
+		Creator:        actor.UserId,
+	}
+	err = tx.Create(newWorkOrder).Error
+	if err != nil {
+		return nil, fmt.Errorf("新建工单失败，%v", err.Error())
+	}
+
+	// 计算截止时间
+	err = RefreshDueTime(tx, newWorkOrder, structure, state)
+	if err != nil {
+		return nil, err
+	}
+
+	// 复制工单数据
+	err = tx.Model(&process.TplData{}).
+		Where("work_order = ?", workOrder.Id).
+		Find(&workOrderData).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工单数据失败，%v", err.Error())
+	}
+	for _, d := range workOrderData {
+		d.WorkOrder = newWorkOrder.Id
+		d.Id = 0
+		err = tx.Create(d).Error
+		if err != nil {
+			return nil, fmt.Errorf("创建工单数据失败，%v", err.Error())
+		}
+	}
+	return
+}
@@ -3,8 +3,9 @@ package service
 import (
 	"errors"
 	"ferry/global/orm"
+	"ferry/models/process"
 	"ferry/models/system"
-	"reflect"
+	"fmt"
 	"strings"
 )
 
@@ -52,84 +53,99 @@ func GetPrincipal(processor []int, processMethod string) (principals string, err
 				principalList = append(principalList, "创建者负责人")
 			}
 		}
+	case "leader":
+		for _, p := range processor {
+			principalList = append(principalList, fmt.Sprintf("创建者第%v级负责人", p))
+		}
+	case "post":
+		err = orm.Eloquent.Model(&system.Post{}).
+			Where("post_id in (?)", processor).
+			Pluck("post_name", &principalList).Error
+		if err != nil {
+			return
+		}
+	case "formField":
+		principalList = append(principalList, "表单中选择的处理人")
+	case "roleMember":
+		err = orm.Eloquent.Model(&system.SysRole{}).
+			Where("role_id in (?)", processor).
+			Pluck("role_name", &principalList).Error
+		if err != nil {
+			return
+		}
 	}
 	return strings.Join(principalList, ","), nil
 }
 
 // 获取用户对应
-func GetPrincipalUserInfo(stateList []interface{}, creator int) (userInfoList []system.SysUser, err error) {
+func GetPrincipalUserInfo(stateList []*process.StateItem, creator int) (userInfoList []system.SysUser, err error) {
 	var (
-		userInfo        system.SysUser
-		deptInfo        system.Dept
 		userInfoListTmp []system.SysUser // 临时保存查询的列表数据
-		processorList   []interface{}
 	)
 
-	err = orm.Eloquent.Model(&userInfo).Where("user_id = ?", creator).Find(&userInfo).Error
-	if err != nil {
-		return
-	}
-
 	for _, stateItem := range stateList {
-
-		if reflect.TypeOf(stateItem.(map[string]interface{})["processor"]) == nil {
+		if stateItem.Processor == nil {
 			err = errors.New("未找到对应的处理人，请确认。")
 			return
 		}
-		stateItemType := reflect.TypeOf(stateItem.(map[string]interface{})["processor"]).String()
-		if stateItemType == "[]int" {
-			for _, v := range stateItem.(map[string]interface{})["processor"].([]int) {
-				processorList = append(processorList, v)
+		if len(stateItem.Processor) == 0 {
+			continue
+		}
+
+		// 有未处理的加签人时，由加签人处理
+		if stateItem.HasSigners() {
+			err = orm.Eloquent.Model(&system.SysUser{}).
+				Where("user_id in (?)", stateItem.PendingSigners()).
+				Find(&userInfoListTmp).Error
+			if err != nil {
+				return
 			}
-		} else {
-			processorList = stateItem.(map[string]interface{})["processor"].([]interface{})
+			userInfoList = append(userInfoList, userInfoListTmp...)
+			continue
 		}
 
-		switch stateItem.(map[string]interface{})["process_method"] {
-		case "person":
+		switch stateItem.ProcessMethod {
+		case process.AssignPerson:
 			err = orm.Eloquent.Model(&system.SysUser{}).
-				Where("user_id in (?)", processorList).
+				Where("user_id in (?)", stateItem.Processor).
 				Find(&userInfoListTmp).Error
 			if err != nil {
 				return
 			}
 			userInfoList = append(userInfoList, userInfoListTmp...)
-		case "role":
+		case process.AssignRole:
 			err = orm.Eloquent.Model(&system.SysUser{}).
-				Where("role_id in (?)", processorList).
+				Where("role_id in (?)", stateItem.Processor).
 				Find(&userInfoListTmp).Error
 			if err != nil {
 				return
 			}
 			userInfoList = append(userInfoList, userInfoListTmp...)
-		case "department":
+		case process.AssignDepartment:
 			err = orm.Eloquent.Model(&system.SysUser{}).
-				Where("dept_id in (?)", processorList).
+				Where("dept_id in (?)", stateItem.Processor).
 				Find(&userInfoListTmp).Error
 			if err != nil {
 				return
 			}
 			userInfoList = append(userInfoList, userInfoListTmp...)
-		case "variable": // 变量
-			for _, processor := range processorList {
-				if int(processor.(float64)) == 1 {
-					// 创建者
-					userInfoList = append(userInfoList, userInfo)
-				} else if int(processor.(float64)) == 2 {
-					// 1. 查询部门信息
-					err = orm.Eloquent.Model(&deptInfo).Where("dept_id = ?", userInfo.DeptId).Find(&deptInfo).Error
-					if err != nil {
-						return
-					}
-
-					// 2. 查询Leader信息
-					err = orm.Eloquent.Model(&userInfo).Where("user_id = ?", deptInfo.Leader).Find(&userInfo).Error
-					if err != nil {
-						return
-					}
-					userInfoList = append(userInfoList, userInfo)
-				}
+		default:
+			// 未解析的处理人，按照流转时相同的方式解析，仅预览不记录分配结果
+			var users []int
+			users, err = resolveProcessor(&AssigneeContext{
+				Creator: creator,
+				DryRun:  true,
+			}, stateItem)
+			if err != nil {
+				return
 			}
+			err = orm.Eloquent.Model(&system.SysUser{}).
+				Where("user_id in (?)", users).
+				Find(&userInfoListTmp).Error
+			if err != nil {
+				return
+			}
+			userInfoList = append(userInfoList, userInfoListTmp...)
 		}
 	}
 
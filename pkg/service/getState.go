@@ -1,7 +1,9 @@
 package service
 
 import (
-	"strconv"
+	"encoding/json"
+	"ferry/models/process"
+	"fmt"
 )
 
 /*
@@ -10,48 +12,41 @@ import (
 */
 
 type ProcessState struct {
-	Structure map[string][]map[string]interface{}
+	Structure *process.Structure
+}
+
+// 解析流程结构
+func NewProcessState(structure json.RawMessage) (p *ProcessState, err error) {
+	p = &ProcessState{}
+	p.Structure, err = process.ParseStructure(structure)
+	return
 }
 
 // 获取节点信息
-func (p *ProcessState) GetNode(stateId string) (nodeValue map[string]interface{}, err error) {
-	for _, node := range p.Structure["nodes"] {
-		if node["id"] == stateId {
-			nodeValue = node
-		}
+func (p *ProcessState) GetNode(stateId string) (nodeValue *process.Node, err error) {
+	if p.Structure != nil {
+		nodeValue = p.Structure.GetNode(stateId)
+	}
+	if nodeValue == nil {
+		err = fmt.Errorf("未查询到节点 %v，请确认流程结构是否正确", stateId)
 	}
 	return
 }
 
-// 获取流转信息
-func (p *ProcessState) GetEdge(stateId string, classify string) (edgeValue []map[string]interface{}, err error) {
-	var (
-		leftSort  int
-		rightSort int
-	)
-
-	for _, edge := range p.Structure["edges"] {
-		if edge[classify] == stateId {
-			edgeValue = append(edgeValue, edge)
-		}
+// 获取流转信息，classify 为 source 时查询流出的流转，为 target 时查询流入的流转
+func (p *ProcessState) GetEdge(stateId string, classify string) (edgeValue []*process.Edge, err error) {
+	if p.Structure == nil {
+		err = fmt.Errorf("流程结构为空")
+		return
 	}
 
-	// 排序
-	if len(edgeValue) > 1 {
-		for i := 0; i < len(edgeValue)-1; i++ {
-			for j := i + 1; j < len(edgeValue); j++ {
-				if t, ok := edgeValue[i]["sort"]; ok {
-					leftSort, _ = strconv.Atoi(t.(string))
-				}
-				if t, ok := edgeValue[j]["sort"]; ok {
-					rightSort, _ = strconv.Atoi(t.(string))
-				}
-				if leftSort > rightSort {
-					edgeValue[j], edgeValue[i] = edgeValue[i], edgeValue[j]
-				}
-			}
-		}
+	switch classify {
+	case "source":
+		edgeValue = p.Structure.SourceEdges(stateId)
+	case "target":
+		edgeValue = p.Structure.TargetEdges(stateId)
+	default:
+		err = fmt.Errorf("不支持的流转查询类型 %v", classify)
 	}
-
 	return
 }
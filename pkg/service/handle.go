@@ -3,19 +3,14 @@ package service
 import (
 	"encoding/json"
 	"errors"
-	"ferry/global/orm"
 	"ferry/models/base"
 	"ferry/models/process"
 	"ferry/models/system"
 	"ferry/pkg/notify"
-	"ferry/tools"
 	"fmt"
-	"reflect"
 	"time"
 
 	"github.com/jinzhu/gorm"
-
-	"github.com/gin-gonic/gin"
 )
 
 /*
@@ -29,6 +24,8 @@ import (
 	userTask: 审批节点
 	receiveTask: 处理节点
 	scriptTask: 任务节点
+	subProcess: 子流程节点
+	timerEvent: 定时节点
 	end: 结束节点
 
     -- 网关 --
@@ -41,127 +38,74 @@ import (
 type Handle struct {
 	cirHistoryList   []process.CirculationHistory
 	workOrderId      int
-	updateValue      map[string]interface{}
-	stateValue       map[string]interface{}
-	targetStateValue map[string]interface{}
+	updateState      []*process.StateItem
+	stateList        []*process.StateItem // 流转后工单的节点列表
+	relatedPerson    []byte
+	stateValue       *process.Node
+	targetStateValue *process.Node
 	WorkOrderData    [][]byte
 	workOrderDetails process.WorkOrderInfo
 	endHistory       bool
 	flowProperties   int
 	circulationValue string
-	processState     ProcessState
+	processState     *ProcessState
+	conditionMeta    map[string]interface{}
+	returnStack      []*process.ReturnItem
+	signed           bool
+	circulated       bool
+	delegator        int
 	tx               *gorm.DB
+	actor            *Actor // 操作人，系统自动流转时为空
+}
+
+// 操作人的用户ID，系统自动流转时为 0
+func (h *Handle) actorId() int {
+	if h.actor == nil {
+		return 0
+	}
+	return h.actor.UserId
 }
 
-// 会签
-func (h *Handle) Countersign(c *gin.Context) (err error) {
+// 会签，按照节点配置的会签策略判断节点是否可以流转
+func (h *Handle) Countersign() (err error) {
 	var (
-		stateList         []map[string]interface{}
-		stateIdMap        map[string]interface{}
-		currentState      map[string]interface{}
-		cirHistoryCount   int
-		userInfoList      []system.SysUser
-		circulationStatus bool
+		stateList    []*process.StateItem
+		currentState *process.StateItem
+		progress     *counterSignProgress
 	)
 
-	err = json.Unmarshal(h.workOrderDetails.State, &stateList)
+	stateList, err = process.ParseState(h.workOrderDetails.State)
 	if err != nil {
 		return
 	}
 
-	stateIdMap = make(map[string]interface{})
-	for _, v := range stateList {
-		stateIdMap[v["id"].(string)] = v["label"]
-		if v["id"].(string) == h.stateValue["id"].(string) {
-			currentState = v
-		}
+	currentState = process.GetStateItem(stateList, h.stateValue.Id)
+	if currentState == nil {
+		err = fmt.Errorf("工单当前不在节点 %v，请确认", h.stateValue.Id)
+		return
 	}
-	userStatusCount := 0
-	circulationStatus = false
-	for _, cirHistoryValue := range h.cirHistoryList {
-		if len(currentState["processor"].([]interface{})) > 1 {
-			if _, ok := stateIdMap[cirHistoryValue.Source]; !ok {
-				break
-			}
-		}
 
-		if currentState["process_method"].(string) == "person" {
-			// 用户会签
-			for _, processor := range currentState["processor"].([]interface{}) {
-				if cirHistoryValue.ProcessorId != tools.GetUserId(c) &&
-					cirHistoryValue.Source == currentState["id"].(string) &&
-					cirHistoryValue.ProcessorId == int(processor.(float64)) {
-					cirHistoryCount += 1
-				}
-			}
-			if cirHistoryCount == len(currentState["processor"].([]interface{}))-1 {
-				circulationStatus = true
-				break
-			}
-		} else if currentState["process_method"].(string) == "role" || currentState["process_method"].(string) == "department" {
-			// 全员处理
-			var tmpUserList []system.SysUser
-			if h.stateValue["fullHandle"].(bool) {
-				db := orm.Eloquent.Model(&system.SysUser{})
-				if currentState["process_method"].(string) == "role" {
-					db = db.Where("role_id in (?)", currentState["processor"].([]interface{}))
-				} else if currentState["process_method"].(string) == "department" {
-					db = db.Where("dept_id in (?)", currentState["processor"].([]interface{}))
-				}
-				err = db.Find(&userInfoList).Error
-				if err != nil {
-					return
-				}
-				temp := map[string]struct{}{}
-				for _, user := range userInfoList {
-					if _, ok := temp[user.Username]; !ok {
-						temp[user.Username] = struct{}{}
-						tmpUserList = append(tmpUserList, user)
-					}
-				}
-				for _, user := range tmpUserList {
-					if cirHistoryValue.Source == currentState["id"].(string) &&
-						cirHistoryValue.ProcessorId != tools.GetUserId(c) &&
-						cirHistoryValue.ProcessorId == user.UserId {
-						userStatusCount += 1
-						break
-					}
-				}
-			} else {
-				// 普通会签
-				for _, processor := range currentState["processor"].([]interface{}) {
-					db := orm.Eloquent.Model(&system.SysUser{})
-					if currentState["process_method"].(string) == "role" {
-						db = db.Where("role_id = ?", processor)
-					} else if currentState["process_method"].(string) == "department" {
-						db = db.Where("dept_id = ?", processor)
-					}
-					err = db.Find(&userInfoList).Error
-					if err != nil {
-						return
-					}
-					for _, user := range userInfoList {
-						if user.UserId != tools.GetUserId(c) &&
-							cirHistoryValue.Source == currentState["id"].(string) &&
-							cirHistoryValue.ProcessorId == user.UserId {
-							userStatusCount += 1
-							break
-						}
-					}
-				}
-			}
-			if h.stateValue["fullHandle"].(bool) {
-				if userStatusCount == len(tmpUserList)-1 {
-					circulationStatus = true
-				}
-			} else {
-				if userStatusCount == len(currentState["processor"].([]interface{}))-1 {
-					circulationStatus = true
-				}
+	progress, err = newCounterSignProgress(h.stateValue, currentState, stateList, h.cirHistoryList)
+	if err != nil {
+		return
+	}
+
+	// 加签人不在原处理人中，处理结果不计入会签
+	if !h.isSigner(currentState) {
+		userId := h.actorId()
+		if h.delegator != 0 {
+			userId = h.delegator
+		}
+		if unit, ok := progress.userUnit(userId); ok {
+			if !progress.pending(unit) {
+				err = errors.New("您已处理过当前节点或尚未轮到您处理")
+				return
 			}
+			progress.vote(unit, h.flowProperties)
 		}
 	}
-	if circulationStatus {
+
+	if (h.flowProperties != 0 && progress.approved()) || (h.flowProperties == 0 && progress.rejected()) {
 		h.endHistory = true
 		err = h.circulation()
 		if err != nil {
@@ -171,648 +115,771 @@ func (h *Handle) Countersign(c *gin.Context) (err error) {
 	return
 }
 
+// 当前用户是否为节点的加签人
+func (h *Handle) isSigner(state *process.StateItem) bool {
+	for _, signerList := range [][]int{state.BeforeSigners, state.AfterSigners} {
+		for _, signer := range signerList {
+			if signer == h.actorId() {
+				return true
+			}
+		}
+	}
+	return h.signed
+}
+
+// 加签处理，返回 true 表示节点仍需等待其他加签人处理。
+// 前加签的处理人处理完成后交还原处理人，不进行流转；
+// 后加签时所有加签人同意后节点才会流转，拒绝时直接按照流程流转。
+func (h *Handle) signerProcessing() (handled bool, err error) {
+	var (
+		stateList  []*process.StateItem
+		stateValue []byte
+	)
+
+	stateList, err = process.ParseState(h.workOrderDetails.State)
+	if err != nil {
+		return
+	}
+	currentState := process.GetStateItem(stateList, h.stateValue.Id)
+	if currentState == nil || !currentState.HasSigners() {
+		return
+	}
+
+	before := len(currentState.BeforeSigners) > 0
+	if !before && h.flowProperties == 0 {
+		return
+	}
+
+	h.signed = h.isSigner(currentState)
+	currentState.RemoveSigner(h.actorId())
+	stateValue, err = json.Marshal(stateList)
+	if err != nil {
+		return
+	}
+	err = UpdateWorkOrder(h.tx, &h.workOrderDetails, map[string]interface{}{
+		"state":          stateValue,
+		"related_person": h.relatedPerson,
+	})
+	if err != nil {
+		return
+	}
+	h.workOrderDetails.State = stateValue
+
+	if before || len(currentState.AfterSigners) > 0 {
+		h.endHistory = false
+		return true, nil
+	}
+	return
+}
+
+// 工单在退回到的节点处理完成后，跳过中间的审批节点直接返回退回前的节点，
+// 拒绝时按照流程正常流转，并丢弃此退回记录
+func (h *Handle) resumeReturn() (resumed bool, err error) {
+	var returnStack []*process.ReturnItem
+
+	returnStack, err = process.ParseReturnStack(h.workOrderDetails.ReturnStack)
+	if err != nil || len(returnStack) == 0 {
+		return
+	}
+
+	returnItem := returnStack[len(returnStack)-1]
+	if returnItem.Target != h.stateValue.Id || returnItem.State == nil {
+		return
+	}
+	h.returnStack = returnStack[:len(returnStack)-1]
+	if h.flowProperties == 0 {
+		return
+	}
+
+	h.targetStateValue, err = h.processState.GetNode(returnItem.State.Id)
+	if err != nil {
+		return
+	}
+	h.updateState = []*process.StateItem{returnItem.State}
+	err = h.commonProcessing()
+	if err != nil {
+		err = fmt.Errorf("返回退回前的节点失败，%v", err.Error())
+		return
+	}
+	return true, nil
+}
+
+// 本次流转新进入的节点，仍停留在原节点时无需重复通知
+func (h *Handle) newStateItems() (stateList []*process.StateItem) {
+	if !h.circulated {
+		return
+	}
+	for _, item := range h.enteredStates() {
+		if len(item.Processor) > 0 {
+			stateList = append(stateList, item)
+		}
+	}
+	return
+}
+
+// 待更新的节点中工单当前不在的节点
+func (h *Handle) enteredStates() (stateList []*process.StateItem) {
+	currentState, _ := process.ParseState(h.workOrderDetails.State)
+	currentIds := make(map[string]struct{}, len(currentState))
+	for _, item := range currentState {
+		currentIds[item.Id] = struct{}{}
+	}
+	for _, item := range h.updateState {
+		if _, ok := currentIds[item.Id]; !ok {
+			stateList = append(stateList, item)
+		}
+	}
+	return
+}
+
+// 流转后工单的节点列表，只替换当前节点，其他并行的分支保持不变。
+// 其他分支的节点可以从新进入的节点到达时，说明工单回到了分支之前，这些分支不再保留；到达结束节点时结束所有分支
+func (h *Handle) nextStateList() (stateList []*process.StateItem, err error) {
+	var currentList []*process.StateItem
+
+	if h.targetStateValue.Clazz == process.NodeEnd {
+		return h.updateState, nil
+	}
+
+	currentList, err = process.ParseState(h.workOrderDetails.State)
+	if err != nil {
+		return
+	}
+
+	stateList = make([]*process.StateItem, 0, len(currentList)+len(h.updateState))
+continueTag:
+	for _, state := range currentList {
+		if state.Id == h.stateValue.Id {
+			continue
+		}
+		for _, item := range h.updateState {
+			if h.processState.Structure.Reachable(item.Id, state.Id) {
+				continue continueTag
+			}
+		}
+		stateList = append(stateList, state)
+	}
+	stateList = append(stateList, h.updateState...)
+	return
+}
+
 // 工单跳转
 func (h *Handle) circulation() (err error) {
 	var (
 		stateValue []byte
 	)
 
-	stateList := make([]interface{}, 0)
-	for _, v := range h.updateValue["state"].([]map[string]interface{}) {
-		stateList = append(stateList, v)
-	}
-	err = GetVariableValue(stateList, h.workOrderDetails.Creator)
+	err = ResolveAssignees(h.assigneeContext(), h.updateState)
 	if err != nil {
 		return
 	}
 
-	stateValue, err = json.Marshal(h.updateValue["state"])
+	// 新进入的节点按照委托规则交由代理人处理
+	err = DelegateState(h.tx, h.workOrderDetails.Process, h.enteredStates())
 	if err != nil {
 		return
 	}
 
-	err = h.tx.Model(&process.WorkOrderInfo{}).
-		Where("id = ?", h.workOrderId).
-		Updates(map[string]interface{}{
-			"state":          stateValue,
-			"is_denied":      h.flowProperties,
-			"related_person": h.updateValue["related_person"],
-		}).Error
+	h.stateList, err = h.nextStateList()
+	if err != nil {
+		return
+	}
+	stateValue, err = json.Marshal(h.stateList)
 	if err != nil {
-		h.tx.Rollback()
 		return
 	}
 
-	// 如果是跳转到结束节点，则需要修改节点状态
-	if h.targetStateValue["clazz"] == "end" {
-		err = h.tx.Model(&process.WorkOrderInfo{}).
-			Where("id = ?", h.workOrderId).
-			Update("is_end", 1).Error
+	updateValue := map[string]interface{}{
+		"state":          stateValue,
+		"is_denied":      h.flowProperties,
+		"related_person": h.relatedPerson,
+	}
+	if h.returnStack != nil {
+		updateValue["return_stack"], err = json.Marshal(h.returnStack)
 		if err != nil {
-			h.tx.Rollback()
 			return
 		}
 	}
+	// 如果是跳转到结束节点，则需要修改节点状态
+	if h.targetStateValue.Clazz == process.NodeEnd {
+		updateValue["is_end"] = 1
+	}
+
+	err = UpdateWorkOrder(h.tx, &h.workOrderDetails, updateValue)
+	if err != nil {
+		return
+	}
+	h.circulated = true
+
+	// 重新计算截止时间
+	err = RefreshDueTime(h.tx, &h.workOrderDetails, h.processState.Structure, h.stateList)
+	if err != nil {
+		return
+	}
+
+	// 新进入的定时节点写入定时任务
+	err = ScheduleTimers(h.tx, &h.workOrderDetails, h.processState, h.enteredStates())
+	if err != nil {
+		return
+	}
+
+	// 新进入的阻塞任务节点写入脚本任务
+	err = ScheduleScripts(h.tx, &h.workOrderDetails, h.processState, h.enteredStates())
+	if err != nil {
+		return
+	}
 
 	return
 }
 
-// 条件判断
-func (h *Handle) ConditionalJudgment(condExpr map[string]interface{}) (result bool, err error) {
+// 排他网关，返回第一个符合条件的流转
+func (h *Handle) ExclusiveEdge(sourceEdges []*process.Edge) (activeEdge *process.Edge, err error) {
 	var (
-		condExprOk    bool
-		condExprValue interface{}
+		condExprStatus bool
 	)
 
-	defer func() {
-		if r := recover(); r != nil {
-			switch e := r.(type) {
-			case string:
-				err = errors.New(e)
-			case error:
-				err = e
-			default:
-				err = errors.New("未知错误")
-			}
+	for _, edge := range sourceEdges {
+		// 条件判断
+		condExprStatus, err = h.matchConditions(edge.Conditions)
+		if err != nil {
 			return
 		}
-	}()
+		if condExprStatus {
+			activeEdge = edge
+			return
+		}
+	}
+
+	err = errors.New("所有流转均不符合条件，请确认。")
+	return
+}
 
-	for _, data := range h.WorkOrderData {
-		var formData map[string]interface{}
-		err = json.Unmarshal(data, &formData)
+// 包容网关，返回所有符合条件的流转，未配置条件的流转作为默认流转，仅在其他流转均不符合条件时使用
+func (h *Handle) InclusiveEdges(sourceEdges []*process.Edge) (activeEdges []*process.Edge, err error) {
+	var (
+		condExprStatus bool
+		defaultEdges   []*process.Edge
+	)
+
+	for _, edge := range sourceEdges {
+		if len(edge.Conditions) == 0 {
+			defaultEdges = append(defaultEdges, edge)
+			continue
+		}
+		// 条件判断
+		condExprStatus, err = h.matchConditions(edge.Conditions)
 		if err != nil {
 			return
 		}
-		if condExprValue, condExprOk = formData[condExpr["key"].(string)]; condExprOk {
-			break
+		if condExprStatus {
+			activeEdges = append(activeEdges, edge)
 		}
 	}
 
-	if condExprValue == nil {
-		err = errors.New("未查询到对应的表单数据。")
-		return
+	if len(activeEdges) == 0 {
+		activeEdges = defaultEdges
+	}
+	if len(activeEdges) == 0 {
+		err = errors.New("所有流转均不符合条件，请确认。")
 	}
+	return
+}
 
-	// todo 待优化
-	switch reflect.TypeOf(condExprValue).String() {
-	case "string":
-		switch condExpr["sign"] {
-		case "==":
-			if condExprValue.(string) == condExpr["value"].(string) {
-				result = true
-			}
-		case "!=":
-			if condExprValue.(string) != condExpr["value"].(string) {
-				result = true
-			}
-		case ">":
-			if condExprValue.(string) > condExpr["value"].(string) {
-				result = true
-			}
-		case ">=":
-			if condExprValue.(string) >= condExpr["value"].(string) {
-				result = true
-			}
-		case "<":
-			if condExprValue.(string) < condExpr["value"].(string) {
-				result = true
-			}
-		case "<=":
-			if condExprValue.(string) <= condExpr["value"].(string) {
-				result = true
-			}
-		default:
-			err = errors.New("目前仅支持6种常规判断类型，包括（等于、不等于、大于、大于等于、小于、小于等于）")
+// 校验人工处理节点是否配置了处理人
+func checkAssignee(node *process.Node) (err error) {
+	if node.IsHumanTask() {
+		if len(node.AssignValue) == 0 || node.AssignType == "" {
+			err = fmt.Errorf("节点 %v 处理人不能为空", node.Label)
 		}
-	case "float64":
-		switch condExpr["sign"] {
-		case "==":
-			if condExprValue.(float64) == condExpr["value"].(float64) {
-				result = true
-			}
-		case "!=":
-			if condExprValue.(float64) != condExpr["value"].(float64) {
-				result = true
-			}
-		case ">":
-			if condExprValue.(float64) > condExpr["value"].(float64) {
-				result = true
-			}
-		case ">=":
-			if condExprValue.(float64) >= condExpr["value"].(float64) {
-				result = true
-			}
-		case "<":
-			if condExprValue.(float64) < condExpr["value"].(float64) {
-				result = true
-			}
-		case "<=":
-			if condExprValue.(float64) <= condExpr["value"].(float64) {
-				result = true
-			}
-		default:
-			err = errors.New("目前仅支持6种常规判断类型，包括（等于、不等于、大于、大于等于、小于、小于等于）")
+	}
+	return
+}
+
+func (h *Handle) commonProcessing() (err error) {
+	counterSign := len(h.stateValue.AssignValue) > 0 && h.stateValue.IsCounterSign
+
+	// 如果是拒绝的流转则直接跳转，会签节点未开启一票否决时拒绝计入会签结果
+	if h.flowProperties == 0 && (!counterSign || h.stateValue.CounterSignRule().Veto) {
+		err = h.circulation()
+		if err != nil {
+			err = fmt.Errorf("工单跳转失败，%v", err.Error())
 		}
-	default:
-		err = errors.New("条件判断目前仅支持字符串、整型。")
+		return
 	}
 
+	// 会签
+	if counterSign {
+		h.endHistory = false
+		err = h.Countersign()
+		if err != nil {
+			return
+		}
+	} else {
+		err = h.circulation()
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
-// 并行网关，确认其他节点是否完成
-func (h *Handle) completeAllParallel(target string) (statusOk bool, err error) {
+// 网关出口，工单的节点列表中只保留了网关入口激活且尚未完成的分支，
+// 仍有其他分支可以到达网关时移除当前分支并等待，否则流转到网关之后的节点
+func (h *Handle) joinGateway(sourceEdges []*process.Edge) (err error) {
 	var (
-		stateList []map[string]interface{}
+		stateList  []*process.StateItem
+		stateValue []byte
+		waiting    bool
 	)
 
-	err = json.Unmarshal(h.workOrderDetails.State, &stateList)
+	stateList, err = process.ParseState(h.workOrderDetails.State)
 	if err != nil {
 		err = fmt.Errorf("反序列化失败，%v", err.Error())
 		return
 	}
 
-continueHistoryTag:
-	for _, v := range h.cirHistoryList {
-		status := false
-		for i, s := range stateList {
-			if v.Source == s["id"].(string) && v.Target == target {
-				status = true
-				stateList = append(stateList[:i], stateList[i+1:]...)
-				continue continueHistoryTag
-			}
+	remainList := make([]*process.StateItem, 0, len(stateList))
+	for _, state := range stateList {
+		if state.Id == h.stateValue.Id {
+			continue
 		}
-		if !status {
-			break
+		remainList = append(remainList, state)
+		if h.processState.Structure.Reachable(state.Id, h.targetStateValue.Id) {
+			waiting = true
 		}
 	}
 
-	if len(stateList) == 1 && stateList[0]["id"].(string) == h.stateValue["id"] {
-		statusOk = true
+	if waiting {
+		h.endHistory = false
+		stateValue, err = json.Marshal(remainList)
+		if err != nil {
+			return
+		}
+		err = UpdateWorkOrder(h.tx, &h.workOrderDetails, map[string]interface{}{
+			"state":          stateValue,
+			"related_person": h.relatedPerson,
+		})
+		if err != nil {
+			return
+		}
+		h.workOrderDetails.State = stateValue
+		return
 	}
 
+	// 所有分支均已完成
+	h.targetStateValue, err = h.processState.GetNode(sourceEdges[0].Target)
+	if err != nil {
+		return
+	}
+	h.endHistory = true
+	h.updateState = []*process.StateItem{process.NewStateItem(h.targetStateValue)}
+	err = h.circulation()
+	if err != nil {
+		err = fmt.Errorf("工单跳转失败，%v", err.Error())
+		return
+	}
 	return
 }
 
-func (h *Handle) commonProcessing(c *gin.Context) (err error) {
-	// 如果是拒绝的流转则直接跳转
-	if h.flowProperties == 0 {
-		err = h.circulation()
+// 网关入口，同时激活多个分支
+func (h *Handle) forkGateway(activeEdges []*process.Edge) (err error) {
+	var (
+		targetStateValue *process.Node
+	)
+
+	h.targetStateValue, err = h.processState.GetNode(activeEdges[0].Target)
+	if err != nil {
+		return
+	}
+
+	h.updateState = make([]*process.StateItem, 0)
+	for _, edge := range activeEdges {
+		targetStateValue, err = h.processState.GetNode(edge.Target)
 		if err != nil {
-			err = fmt.Errorf("工单跳转失败，%v", err.Error())
+			return
 		}
+		err = checkAssignee(targetStateValue)
+		if err != nil {
+			return
+		}
+		h.updateState = append(h.updateState, process.NewStateItem(targetStateValue))
+	}
+	err = h.circulation()
+	if err != nil {
+		err = fmt.Errorf("工单跳转失败，%v", err.Error())
 		return
 	}
+	return
+}
 
-	// 会签
-	if h.stateValue["assignValue"] != nil && len(h.stateValue["assignValue"].([]interface{})) > 0 {
-		if isCounterSign, ok := h.stateValue["isCounterSign"]; ok {
-			if isCounterSign.(bool) {
-				h.endHistory = false
-				err = h.Countersign(c)
-				if err != nil {
-					return
-				}
-			} else {
-				err = h.circulation()
-				if err != nil {
-					return
-				}
+// 根据目标节点的类型进行流转
+func (h *Handle) jump() (err error) {
+	var (
+		sourceEdges []*process.Edge
+		targetEdges []*process.Edge
+		activeEdge  *process.Edge
+		activeEdges []*process.Edge
+	)
+
+	sourceEdges, err = h.processState.GetEdge(h.targetStateValue.Id, "source")
+	if err != nil {
+		return
+	}
+
+	switch h.targetStateValue.Clazz {
+	case process.GatewayExclusive: // 排他网关
+		activeEdge, err = h.ExclusiveEdge(sourceEdges)
+		if err != nil {
+			return
+		}
+
+		// 进行节点跳转
+		h.targetStateValue, err = h.processState.GetNode(activeEdge.Target)
+		if err != nil {
+			return
+		}
+
+		err = checkAssignee(h.targetStateValue)
+		if err != nil {
+			return
+		}
+
+		h.updateState = []*process.StateItem{process.NewStateItem(h.targetStateValue)}
+		err = h.commonProcessing()
+		if err != nil {
+			err = fmt.Errorf("流程流程跳转失败，%v", err.Error())
+			return
+		}
+	case process.GatewayParallel: // 并行/聚合网关
+		// 入口，判断
+		targetEdges, err = h.processState.GetEdge(h.targetStateValue.Id, "target")
+		if err != nil {
+			err = fmt.Errorf("查询流转信息失败，%v", err.Error())
+			return
+		}
+
+		if len(sourceEdges) > 1 && len(targetEdges) == 1 {
+			// 入口
+			err = h.forkGateway(sourceEdges)
+			if err != nil {
+				return
+			}
+		} else if len(sourceEdges) == 1 && len(targetEdges) > 1 {
+			// 出口
+			err = h.joinGateway(sourceEdges)
+			if err != nil {
+				return
 			}
 		} else {
-			err = h.circulation()
+			err = errors.New("并行网关流程不正确")
+			return
+		}
+	case process.GatewayInclusive: // 包容/聚合网关
+		targetEdges, err = h.processState.GetEdge(h.targetStateValue.Id, "target")
+		if err != nil {
+			err = fmt.Errorf("查询流转信息失败，%v", err.Error())
+			return
+		}
+
+		if len(sourceEdges) > 1 && len(targetEdges) == 1 {
+			// 入口，激活所有符合条件的分支
+			activeEdges, err = h.InclusiveEdges(sourceEdges)
+			if err != nil {
+				return
+			}
+			err = h.forkGateway(activeEdges)
 			if err != nil {
 				return
 			}
+		} else if len(sourceEdges) == 1 && len(targetEdges) > 1 {
+			// 出口，当前工单的节点列表中只保留了被激活的分支，因此只需等待这些分支完成
+			err = h.joinGateway(sourceEdges)
+			if err != nil {
+				err = fmt.Errorf("包容检测失败，%v", err.Error())
+				return
+			}
+		} else {
+			err = errors.New("包容网关流程不正确")
+			return
 		}
-	} else {
+	case process.NodeStart:
+		h.updateState = []*process.StateItem{{
+			Id:            h.targetStateValue.Id,
+			Label:         h.targetStateValue.Label,
+			Processor:     []int{h.workOrderDetails.Creator},
+			ProcessMethod: process.AssignPerson,
+		}}
 		err = h.circulation()
 		if err != nil {
 			return
 		}
+	case process.NodeUserTask, process.NodeReceiveTask:
+		h.updateState = []*process.StateItem{process.NewStateItem(h.targetStateValue)}
+		err = h.commonProcessing()
+		if err != nil {
+			return
+		}
+	case process.NodeSubProcess, process.NodeTimer:
+		// 节点无处理人，子工单在本次流转提交前创建，定时节点由后台任务到期后流转
+		h.updateState = []*process.StateItem{process.NewStateItem(h.targetStateValue)}
+		err = h.commonProcessing()
+		if err != nil {
+			return
+		}
+	case process.NodeScriptTask:
+		h.updateState = []*process.StateItem{{
+			Id:        h.targetStateValue.Id,
+			Label:     h.targetStateValue.Label,
+			Processor: []int{},
+		}}
+		// 配置了脚本的任务节点，工单停留在节点直到脚本执行完成
+		if h.targetStateValue.Script != nil {
+			err = h.commonProcessing()
+			if err != nil {
+				return
+			}
+		}
+	case process.NodeEnd:
+		h.updateState = []*process.StateItem{{
+			Id:        h.targetStateValue.Id,
+			Label:     h.targetStateValue.Label,
+			Processor: []int{},
+		}}
+		err = h.commonProcessing()
+		if err != nil {
+			return
+		}
 	}
 	return
 }
 
-func (h *Handle) HandleWorkOrder(
-	c *gin.Context,
-	workOrderId int,
-	tasks []string,
-	targetState string,
-	sourceState string,
-	circulationValue string,
-	flowProperties int,
-	remarks string,
-	tpls []map[string]interface{},
-	isExecTask bool,
-) (err error) {
-	h.workOrderId = workOrderId
-	h.flowProperties = flowProperties
+// 处理工单，在调用方的事务中完成节点流转、表单更新、流转历史及通知的写入，
+// 事务的提交与回滚由调用方负责，提交后再调用 ExecTasks 执行任务
+func (h *Handle) HandleWorkOrder(tx *gorm.DB, actor *Actor, cmd *HandleCommand) (err error) {
+	h.tx = tx
+	h.actor = actor
+	h.workOrderId = cmd.WorkOrderId
+	h.flowProperties = cmd.FlowProperties
 	h.endHistory = true
 
 	var (
-		execTasks          []string
-		relatedPersonList  []int
-		cirHistoryValue    []process.CirculationHistory
-		cirHistoryData     process.CirculationHistory
-		costDurationValue  int64
-		sourceEdges        []map[string]interface{}
-		targetEdges        []map[string]interface{}
-		condExprStatus     bool
-		relatedPersonValue []byte
-		parallelStatusOk   bool
-		processInfo        process.Info
-		currentUserInfo    system.SysUser
-		applyUserInfo      system.SysUser
-		sendToUserList     []system.SysUser
-		noticeList         []int
-		sendSubject        string = "您有一条待办工单，请及时处理"
-		sendDescription    string = "您有一条待办工单请及时处理，工单描述如下"
-		paramsValue        struct {
-			Id       int           `json:"id"`
-			Title    string        `json:"title"`
-			Priority int           `json:"priority"`
-			FormData []interface{} `json:"form_data"`
-		}
+		relatedPersonList []int
+		cirHistoryValue   []process.CirculationHistory
+		cirHistoryData    process.CirculationHistory
+		costDurationValue int64
+		processInfo       process.Info
+		currentUserInfo   system.SysUser
+		currentStateList  []*process.StateItem
+		processorName     string
+		applyUserInfo     system.SysUser
+		sendToUserList    []system.SysUser
+		noticeList        []*notify.Channel
+		sendSubject       string = "您有一条待办工单，请及时处理"
+		sendDescription   string = "您有一条待办工单请及时处理，工单描述如下"
+		sendEvent         string = notify.EventAssigned
 	)
 
-	defer func() {
-		if r := recover(); r != nil {
-			switch e := r.(type) {
-			case string:
-				err = errors.New(e)
-			case error:
-				err = e
-			default:
-				err = errors.New("未知错误")
-			}
-			return
-		}
-	}()
-
 	// 获取工单信息
-	err = orm.Eloquent.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrderId).Find(&h.workOrderDetails).Error
+	err = h.tx.Model(&process.WorkOrderInfo{}).Where("id = ?", cmd.WorkOrderId).Find(&h.workOrderDetails).Error
 	if err != nil {
 		return
 	}
 
 	// 查询工单创建人信息
-	err = orm.Eloquent.Model(&system.SysUser{}).Where("user_id = ?", h.workOrderDetails.Creator).Find(&applyUserInfo).Error
+	err = h.tx.Model(&system.SysUser{}).Where("user_id = ?", h.workOrderDetails.Creator).Find(&applyUserInfo).Error
 	if err != nil {
 		return
 	}
 
-	// 获取流程信息
-	err = orm.Eloquent.Model(&process.Info{}).Where("id = ?", h.workOrderDetails.Process).Find(&processInfo).Error
+	// 获取工单绑定版本的流程信息
+	processInfo, err = WorkOrderProcess(h.tx, &h.workOrderDetails)
 	if err != nil {
 		return
 	}
-	err = json.Unmarshal(processInfo.Structure, &h.processState.Structure)
+	h.processState, err = NewProcessState(processInfo.Structure)
 	if err != nil {
 		return
 	}
 
 	// 获取当前节点
-	h.stateValue, err = h.processState.GetNode(sourceState)
+	h.stateValue, err = h.processState.GetNode(cmd.SourceState)
 	if err != nil {
 		return
 	}
 
 	// 目标状态
-	h.targetStateValue, err = h.processState.GetNode(targetState)
+	h.targetStateValue, err = h.processState.GetNode(cmd.TargetState)
 	if err != nil {
 		return
 	}
 
 	// 获取工单数据
-	err = orm.Eloquent.Model(&process.TplData{}).
-		Where("work_order = ?", workOrderId).
+	err = h.tx.Model(&process.TplData{}).
+		Where("work_order = ?", cmd.WorkOrderId).
 		Pluck("form_data", &h.WorkOrderData).Error
 	if err != nil {
 		return
 	}
 
 	// 根据处理人查询出需要会签的条数
-	err = orm.Eloquent.Model(&process.CirculationHistory{}).
-		Where("work_order = ?", workOrderId).
+	err = h.tx.Model(&process.CirculationHistory{}).
+		Where("work_order = ?", cmd.WorkOrderId).
 		Order("id desc").
 		Find(&h.cirHistoryList).Error
 	if err != nil {
 		return
 	}
 
+	// 代理他人处理时记录委托人
+	currentStateList, err = process.ParseState(h.workOrderDetails.State)
+	if err != nil {
+		return
+	}
+	if currentState := process.GetStateItem(currentStateList, h.stateValue.Id); currentState != nil {
+		h.delegator, err = OnBehalfOf(&h.workOrderDetails, currentState, actor.UserId)
+		if err != nil {
+			return
+		}
+	}
+
 	err = json.Unmarshal(h.workOrderDetails.RelatedPerson, &relatedPersonList)
 	if err != nil {
 		return
 	}
 	relatedPersonStatus := false
 	for _, r := range relatedPersonList {
-		if r == tools.GetUserId(c) {
+		if r == actor.UserId {
 			relatedPersonStatus = true
 			break
 		}
 	}
 	if !relatedPersonStatus {
-		relatedPersonList = append(relatedPersonList, tools.GetUserId(c))
+		relatedPersonList = append(relatedPersonList, actor.UserId)
 	}
 
-	relatedPersonValue, err = json.Marshal(relatedPersonList)
+	h.relatedPerson, err = json.Marshal(relatedPersonList)
 	if err != nil {
 		return
 	}
 
-	h.updateValue = map[string]interface{}{
-		"related_person": relatedPersonValue,
+	// 校验客户端读取到的工单版本
+	err = checkWorkOrderVersion(&h.workOrderDetails, cmd.Version)
+	if err != nil {
+		return
 	}
 
-	// 开启事务
-	h.tx = orm.Eloquent.Begin()
-
-	stateValue := map[string]interface{}{
-		"label": h.targetStateValue["label"].(string),
-		"id":    h.targetStateValue["id"].(string),
+	// 锁定工单并递增版本，同时处理同一工单时后提交的请求会因版本不一致而失败
+	err = UpdateWorkOrder(h.tx, &h.workOrderDetails, map[string]interface{}{
+		"related_person": h.relatedPerson,
+	})
+	if err != nil {
+		return
 	}
 
-	sourceEdges, err = h.processState.GetEdge(h.targetStateValue["id"].(string), "source")
+	// 加签的处理人未全部处理时节点不流转
+	handled, err := h.signerProcessing()
 	if err != nil {
 		return
 	}
 
-	switch h.targetStateValue["clazz"] {
-	case "exclusiveGateway": // 排他网关
-	breakTag:
-		for _, edge := range sourceEdges {
-			edgeCondExpr := make([]map[string]interface{}, 0)
-			err = json.Unmarshal([]byte(edge["conditionExpression"].(string)), &edgeCondExpr)
-			if err != nil {
-				return
-			}
-			for _, condExpr := range edgeCondExpr {
-				// 条件判断
-				condExprStatus, err = h.ConditionalJudgment(condExpr)
-				if err != nil {
-					return
-				}
-				if condExprStatus {
-					// 进行节点跳转
-					h.targetStateValue, err = h.processState.GetNode(edge["target"].(string))
-					if err != nil {
-						return
-					}
-
-					if h.targetStateValue["clazz"] == "userTask" || h.targetStateValue["clazz"] == "receiveTask" {
-						if h.targetStateValue["assignValue"] == nil || h.targetStateValue["assignType"] == "" {
-							err = errors.New("处理人不能为空")
-							return
-						}
-					}
-
-					h.updateValue["state"] = []map[string]interface{}{{
-						"id":             h.targetStateValue["id"].(string),
-						"label":          h.targetStateValue["label"],
-						"processor":      h.targetStateValue["assignValue"],
-						"process_method": h.targetStateValue["assignType"],
-					}}
-					err = h.commonProcessing(c)
-					if err != nil {
-						err = fmt.Errorf("流程流程跳转失败，%v", err.Error())
-						return
-					}
-
-					break breakTag
-				}
-			}
-		}
-		if !condExprStatus {
-			err = errors.New("所有流转均不符合条件，请确认。")
-			return
-		}
-	case "parallelGateway": // 并行/聚合网关
-		// 入口，判断
-		targetEdges, err = h.processState.GetEdge(h.targetStateValue["id"].(string), "target")
+	// 退回的工单，在退回到的节点处理完成后直接返回退回前的节点
+	if !handled {
+		handled, err = h.resumeReturn()
 		if err != nil {
-			err = fmt.Errorf("查询流转信息失败，%v", err.Error())
-			return
-		}
-
-		if len(sourceEdges) > 0 {
-			h.targetStateValue, err = h.processState.GetNode(sourceEdges[0]["target"].(string))
-			if err != nil {
-				return
-			}
-		} else {
-			err = errors.New("并行网关流程不正确")
 			return
 		}
+	}
 
-		if len(sourceEdges) > 1 && len(targetEdges) == 1 {
-			// 入口
-			h.updateValue["state"] = make([]map[string]interface{}, 0)
-			for _, edge := range sourceEdges {
-				targetStateValue, err := h.processState.GetNode(edge["target"].(string))
-				if err != nil {
-					return err
-				}
-				h.updateValue["state"] = append(h.updateValue["state"].([]map[string]interface{}), map[string]interface{}{
-					"id":             edge["target"].(string),
-					"label":          targetStateValue["label"],
-					"processor":      targetStateValue["assignValue"],
-					"process_method": targetStateValue["assignType"],
-				})
-			}
-			err = h.circulation()
-			if err != nil {
-				err = fmt.Errorf("工单跳转失败，%v", err.Error())
-				return
-			}
-		} else if len(sourceEdges) == 1 && len(targetEdges) > 1 {
-			// 出口
-			parallelStatusOk, err = h.completeAllParallel(sourceEdges[0]["target"].(string))
-			if err != nil {
-				err = fmt.Errorf("并行检测失败，%v", err.Error())
-				return
-			}
-			if parallelStatusOk {
-				h.endHistory = true
-				endAssignValue, ok := h.targetStateValue["assignValue"]
-				if !ok {
-					endAssignValue = []int{}
-				}
-
-				endAssignType, ok := h.targetStateValue["assignType"]
-				if !ok {
-					endAssignType = ""
-				}
-
-				h.updateValue["state"] = []map[string]interface{}{{
-					"id":             h.targetStateValue["id"].(string),
-					"label":          h.targetStateValue["label"],
-					"processor":      endAssignValue,
-					"process_method": endAssignType,
-				}}
-				err = h.circulation()
-				if err != nil {
-					err = fmt.Errorf("工单跳转失败，%v", err.Error())
-					return
-				}
-			} else {
-				h.endHistory = false
-			}
-
-		} else {
-			err = errors.New("并行网关流程不正确")
-			return
-		}
-	// 包容网关
-	case "inclusiveGateway":
-		return
-	case "start":
-		stateValue["processor"] = []int{h.workOrderDetails.Creator}
-		stateValue["process_method"] = "person"
-		h.updateValue["state"] = []map[string]interface{}{stateValue}
-		err = h.circulation()
-		if err != nil {
-			return
-		}
-	case "userTask":
-		stateValue["processor"] = h.targetStateValue["assignValue"].([]interface{})
-		stateValue["process_method"] = h.targetStateValue["assignType"].(string)
-		h.updateValue["state"] = []map[string]interface{}{stateValue}
-		err = h.commonProcessing(c)
-		if err != nil {
-			return
-		}
-	case "receiveTask":
-		stateValue["processor"] = h.targetStateValue["assignValue"].([]interface{})
-		stateValue["process_method"] = h.targetStateValue["assignType"].(string)
-		h.updateValue["state"] = []map[string]interface{}{stateValue}
-		err = h.commonProcessing(c)
-		if err != nil {
-			return
-		}
-	case "scriptTask":
-		stateValue["processor"] = []int{}
-		stateValue["process_method"] = ""
-		h.updateValue["state"] = []map[string]interface{}{stateValue}
-	case "end":
-		stateValue["processor"] = []int{}
-		stateValue["process_method"] = ""
-		h.updateValue["state"] = []map[string]interface{}{stateValue}
-		err = h.commonProcessing(c)
+	if !handled {
+		err = h.jump()
 		if err != nil {
 			return
 		}
 	}
 
 	// 更新表单数据
-	for _, t := range tpls {
+	for _, t := range cmd.Tpls {
 		var (
 			tplValue []byte
 		)
 		tplValue, err = json.Marshal(t["tplValue"])
 		if err != nil {
-			h.tx.Rollback()
 			return
 		}
 
-		paramsValue.FormData = append(paramsValue.FormData, t["tplValue"])
-
-		// 是否可写，只有可写的模版可以更新数据
+		// 是否可写，只有可写的模版可以更新数据，隐藏的模版无法修改数据
 		updateStatus := false
-		if h.stateValue["clazz"].(string) == "start" {
+		if h.stateValue.Clazz == process.NodeStart {
 			updateStatus = true
-		} else if writeTplList, writeOK := h.stateValue["writeTpls"]; writeOK {
-		tplListTag:
-			for _, writeTplId := range writeTplList.([]interface{}) {
-				if writeTplId == t["tplId"] { // 可写
-					// 是否隐藏，隐藏的模版无法修改数据
-					if hideTplList, hideOK := h.stateValue["hideTpls"]; hideOK {
-						if hideTplList != nil && len(hideTplList.([]interface{})) > 0 {
-							for _, hideTplId := range hideTplList.([]interface{}) {
-								if hideTplId == t["tplId"] { // 隐藏的
-									updateStatus = false
-									break tplListTag
-								} else {
-									updateStatus = true
-								}
-							}
-						} else {
-							updateStatus = true
-						}
-					} else {
-						updateStatus = true
-					}
-				}
-			}
-		} else {
-			// 不可写
-			updateStatus = false
+		} else if tplId, ok := t["tplId"].(float64); ok {
+			updateStatus = h.stateValue.TplWritable(int(tplId))
 		}
 		if updateStatus {
 			err = h.tx.Model(&process.TplData{}).Where("id = ?", t["tplDataId"]).Update("form_data", tplValue).Error
 			if err != nil {
-				h.tx.Rollback()
 				return
 			}
 		}
 	}
 
 	// 流转历史写入
-	err = orm.Eloquent.Model(&cirHistoryValue).
-		Where("work_order = ?", workOrderId).
+	err = h.tx.Model(&cirHistoryValue).
+		Where("work_order = ?", cmd.WorkOrderId).
 		Find(&cirHistoryValue).
 		Order("create_time desc").Error
 	if err != nil {
-		h.tx.Rollback()
 		return
 	}
 	for _, t := range cirHistoryValue {
-		if t.Source != h.stateValue["id"] {
+		if t.Source != h.stateValue.Id {
 			costDuration := time.Since(t.CreatedAt.Time)
 			costDurationValue = int64(costDuration) / 1000 / 1000 / 1000
 		}
 	}
 
 	// 获取当前用户信息
-	err = orm.Eloquent.Model(&currentUserInfo).
-		Where("user_id = ?", tools.GetUserId(c)).
+	err = h.tx.Model(&currentUserInfo).
+		Where("user_id = ?", actor.UserId).
 		Find(&currentUserInfo).Error
 	if err != nil {
 		return
 	}
+	processorName, err = DelegateProcessorName(&currentUserInfo, h.delegator)
+	if err != nil {
+		return
+	}
 
 	cirHistoryData = process.CirculationHistory{
 		Model:        base.Model{},
 		Title:        h.workOrderDetails.Title,
 		WorkOrder:    h.workOrderDetails.Id,
-		State:        h.stateValue["label"].(string),
-		Source:       h.stateValue["id"].(string),
-		Target:       h.targetStateValue["id"].(string),
-		Circulation:  circulationValue,
-		Processor:    currentUserInfo.NickName,
-		ProcessorId:  tools.GetUserId(c),
-		Status:       flowProperties,
+		State:        h.stateValue.Label,
+		Source:       h.stateValue.Id,
+		Target:       h.targetStateValue.Id,
+		Circulation:  cmd.Circulation,
+		Processor:    processorName,
+		ProcessorId:  actor.UserId,
+		Delegator:    h.delegator,
+		Status:       cmd.FlowProperties,
 		CostDuration: costDurationValue,
-		Remarks:      remarks,
+		Remarks:      cmd.Remarks,
 	}
 	err = h.tx.Create(&cirHistoryData).Error
 	if err != nil {
-		h.tx.Rollback()
 		return
 	}
 
 	// 获取流程通知类型列表
-	err = json.Unmarshal(processInfo.Notice, &noticeList)
+	noticeList, err = notify.ParseNotice(processInfo.Notice)
 	if err != nil {
 		return
 	}
 
 	// 获取需要抄送的邮件
 	emailCCList := make([]string, 0)
-	if h.stateValue["cc"] != nil && len(h.stateValue["cc"].([]interface{})) > 0 {
-		err = orm.Eloquent.Model(&system.SysUser{}).
-			Where("user_id in (?)", h.stateValue["cc"]).
+	if len(h.stateValue.Cc) > 0 {
+		err = h.tx.Model(&system.SysUser{}).
+			Where("user_id in (?)", h.stateValue.Cc).
 			Pluck("email", &emailCCList).Error
 		if err != nil {
 			err = errors.New("查询邮件抄送人失败")
@@ -821,13 +888,10 @@ func (h *Handle) HandleWorkOrder(
 	}
 
 	bodyData := notify.BodyData{
-		SendTo: map[string]interface{}{
-			"userList": sendToUserList,
-		},
 		EmailCcTo:   emailCCList,
 		Subject:     sendSubject,
 		Description: sendDescription,
-		Classify:    noticeList,
+		Channels:    noticeList,
 		ProcessId:   h.workOrderDetails.Process,
 		Id:          h.workOrderDetails.Id,
 		Title:       h.workOrderDetails.Title,
@@ -835,25 +899,30 @@ func (h *Handle) HandleWorkOrder(
 		Priority:    h.workOrderDetails.Priority,
 		CreatedAt:   h.workOrderDetails.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
+	err = fillNotifyForm(h.tx, &bodyData)
+	if err != nil {
+		return
+	}
 
 	// 判断目标是否是结束节点
-	if h.targetStateValue["clazz"] == "end" && h.endHistory == true {
+	if h.targetStateValue.Clazz == process.NodeEnd && h.endHistory == true {
 		sendSubject = "您的工单已处理完成"
 		sendDescription = "您的工单已处理完成，工单描述如下"
+		sendEvent = notify.EventEnded
 		err = h.tx.Create(&process.CirculationHistory{
 			Model:       base.Model{},
 			Title:       h.workOrderDetails.Title,
 			WorkOrder:   h.workOrderDetails.Id,
-			State:       h.targetStateValue["label"].(string),
-			Source:      h.targetStateValue["id"].(string),
-			Processor:   currentUserInfo.NickName,
-			ProcessorId: tools.GetUserId(c),
+			State:       h.targetStateValue.Label,
+			Source:      h.targetStateValue.Id,
+			Processor:   processorName,
+			ProcessorId: actor.UserId,
+			Delegator:   h.delegator,
 			Circulation: "工单结束",
 			Remarks:     "工单已结束",
 			Status:      2, // 其他状态
 		}).Error
 		if err != nil {
-			h.tx.Rollback()
 			return
 		}
 		if len(noticeList) > 0 {
@@ -864,223 +933,67 @@ func (h *Handle) HandleWorkOrder(
 			if err != nil {
 				return
 			}
-
-			bodyData.SendTo = map[string]interface{}{
-				"userList": sendToUserList,
-			}
-			bodyData.Subject = sendSubject
-			bodyData.Description = sendDescription
-
-			// 发送通知
-			// go func(bodyData notify.BodyData) {
-			// 	err = bodyData.SendNotify()
-			// 	if err != nil {
-			// 		return
-			// 	}
-			// }(bodyData)
-		}
-	}
-
-	h.tx.Commit() // 提交事务
-
-	// 发送通知
-	// if len(noticeList) > 0 {
-	// 	stateList := make([]interface{}, 0)
-	// 	for _, v := range h.updateValue["state"].([]map[string]interface{}) {
-	// 		stateList = append(stateList, v)
-	// 	}
-	// 	sendToUserList, err = GetPrincipalUserInfo(stateList, h.workOrderDetails.Creator)
-	// 	if err != nil {
-	// 		return
-	// 	}
-
-	// 	bodyData.SendTo = map[string]interface{}{
-	// 		"userList": sendToUserList,
-	// 	}
-	// 	bodyData.Subject = sendSubject
-	// 	bodyData.Description = sendDescription
-
-	// 	// 发送通知
-	// 	go func(bodyData notify.BodyData) {
-	// 		err = bodyData.SendNotify()
-	// 		if err != nil {
-	// 			return
-	// 		}
-	// 	}(bodyData)
-	// }
-
-	if isExecTask {
-		// 执行流程公共任务及节点任务
-		if h.stateValue["task"] != nil {
-			for _, task := range h.stateValue["task"].([]interface{}) {
-				tasks = append(tasks, task.(string))
-			}
 		}
-	continueTag:
-		for _, task := range tasks {
-			for _, t := range execTasks {
-				if t == task {
-					continue continueTag
-				}
-			}
-			execTasks = append(execTasks, task)
+	} else if len(noticeList) > 0 {
+		if h.flowProperties == 0 {
+			sendEvent = notify.EventDenied
 		}
 
-		paramsValue.Id = h.workOrderDetails.Id
-		paramsValue.Title = h.workOrderDetails.Title
-		paramsValue.Priority = h.workOrderDetails.Priority
-		params, err := json.Marshal(paramsValue)
+		// 通知新进入节点的处理人
+		sendToUserList, err = GetPrincipalUserInfo(h.newStateItems(), h.workOrderDetails.Creator)
 		if err != nil {
-			return err
+			return
 		}
-		go ExecTask(execTasks, string(params))
 	}
-	return
-}
 
-func (h *Handle) SendEmail(workOrderId int) (err error) {
-
-	type FormStructure struct {
-		List []struct {
-			Name string `json:"name"`
-			Key  string `json:"key"`
-		} `json:"list"`
+	// 通知写入发件箱，与工单流转一同提交
+	bodyData.SendTo = map[string]interface{}{
+		"userList": sendToUserList,
 	}
-	var (
-		sendToUserList   []system.SysUser
-		processInfo      process.Info
-		noticeList       []int
-		applyUserInfo    system.SysUser
-		workOrderInfo    process.WorkOrderInfo
-		workOrderTplData process.TplData
-		stateList        []interface{}
-		TplValue         map[string]interface{}
-		form_structure   FormStructure
-	)
-
-	// 查询tpl数据
-	err = orm.Eloquent.Model(&process.TplData{}).Where("work_order = ?", workOrderId).Find(&workOrderTplData).Error
-	if err != nil {
-		err = fmt.Errorf("获取tpl失败，%v", err.Error())
-		return
-	}
-	err = json.Unmarshal(workOrderTplData.FormData, &TplValue)
+	bodyData.Subject = sendSubject
+	bodyData.Description = sendDescription
+	bodyData.Event = sendEvent
+	err = notify.Enqueue(h.tx, &bodyData)
 	if err != nil {
-		fmt.Println("error2 : ", err.Error())
 		return
 	}
-	fmt.Println("dasdasdform_data3 : ", TplValue)
 
-	err = json.Unmarshal(workOrderTplData.FormStructure, &form_structure)
-	if err != nil {
-		fmt.Println("error2 : ", err.Error())
-		return
-	}
-	fmt.Println("dasdasdform_data4 : ", form_structure)
-	foundValue := ""
-	problem_text := ""
-	phoneNumber := ""
-
-	for _, item := range form_structure.List {
-		if item.Name == "故障现象" {
-			foundValue = item.Key
-			key := "input_" + foundValue
-			// 获取值
-			if value, exists := TplValue[key]; exists {
-				if str, ok := value.(string); ok {
-					problem_text = str
-				} else {
-					fmt.Println("表单项的值不是字符串类型")
-				}
-			} else {
-				fmt.Println("找不到键为", key, "的值")
-			}
-		}
-		if item.Name == "联系方式" {
-			foundValue = item.Key
-			key := "input_" + foundValue
-			// 获取值
-			if value, exists := TplValue[key]; exists {
-				if str, ok := value.(string); ok {
-					phoneNumber = str
-				} else {
-					fmt.Println("表单项的值不是字符串类型")
-				}
-			} else {
-				fmt.Println("找不到键为", key, "的值")
-			}
+	// 子工单结束时检查父工单的子流程节点是否可以继续流转
+	if h.circulated && h.targetStateValue.Clazz == process.NodeEnd {
+		err = CompleteSubWorkOrder(h.tx, &h.workOrderDetails)
+		if err != nil {
+			return
 		}
 	}
-	fmt.Printf("找到的'测试'表单项的值： %s\n  phone ： %s\n", problem_text, phoneNumber)
 
-	// 查询工单数据
-	err = orm.Eloquent.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrderId).Find(&workOrderInfo).Error
-	if err != nil {
-		err = fmt.Errorf("获取所有处理人的用户信息失败，%v", err.Error())
-		return
-	}
-	err = json.Unmarshal(workOrderInfo.State, &stateList)
-	if err != nil {
-		err = fmt.Errorf("获取所有处理人的用户信息json失败，%v", err.Error())
-		return
-	}
-	sendToUserList, err = GetPrincipalUserInfo(stateList, workOrderInfo.Creator)
-	if err != nil {
-		err = fmt.Errorf("获取所有处理人的用户信息失败，%v", err.Error())
-		return
-	}
-	// 获取流程信息
-	err = orm.Eloquent.Model(&process.Info{}).Where("id = ?", workOrderInfo.Process).Find(&processInfo).Error
-	if err != nil {
-		return
-	}
-	// 查询工单创建人信息
-	err = orm.Eloquent.Model(&system.SysUser{}).Where("user_id = ?", workOrderInfo.Creator).Find(&applyUserInfo).Error
-	if err != nil {
-		return
-	}
-	// 获取流程通知类型列表
-	err = json.Unmarshal(processInfo.Notice, &noticeList)
+	// 进入子流程节点时创建子工单
+	err = h.startSubProcesses()
 	if err != nil {
 		return
 	}
 
-	// return
-	// 获取需要抄送的邮件
-	// emailCCList := make([]string, 0)
-	// if currentNode["cc"] != nil && len(currentNode["cc"].([]interface{})) > 0 {
-	// 	err = orm.Eloquent.Model(&system.SysUser{}).
-	// 		Where("user_id in (?)", currentNode["cc"]).
-	// 		Pluck("email", &emailCCList).Error
-	// 	if err != nil {
-	// 		err = errors.New("查询邮件抄送人失败")
-	// 		return
-	// 	}
-	// }
-	// 发送通知
-	go func() {
-		bodyData := notify.BodyData{
-			SendTo: map[string]interface{}{
-				"userList": sendToUserList,
-			},
-			// EmailCcTo:   emailCCList,
-			Subject:     "您有一条待办工单，请及时处理",
-			Description: "您有一条待办工单请及时处理，工单描述如下",
-			Classify:    noticeList,
-			ProcessId:   workOrderInfo.Process,
-			Id:          workOrderInfo.Id,
-			Title:       workOrderInfo.Title,
-			ProblemText: problem_text,
-			PhoneNumber: phoneNumber,
-			Creator:     applyUserInfo.NickName,
-			Priority:    workOrderInfo.Priority,
-			CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
-		}
-		err = bodyData.SendNotify()
-		if err != nil {
-			fmt.Println("通知发送失败", err.Error())
-			return
-		}
-	}()
 	return
 }
+
+// 事务提交后执行流程公共任务及节点任务
+func (h *Handle) ExecTasks(cmd *HandleCommand) (err error) {
+	var (
+		execTasks []string
+		formData  []interface{}
+	)
+
+	tasks := append(append([]string{}, cmd.Tasks...), h.stateValue.Task...)
+continueTag:
+	for _, task := range tasks {
+		for _, t := range execTasks {
+			if t == task {
+				continue continueTag
+			}
+		}
+		execTasks = append(execTasks, task)
+	}
+	for _, t := range cmd.Tpls {
+		formData = append(formData, t["tplValue"])
+	}
+	return ExecWorkOrderTasks(execTasks, &h.workOrderDetails, formData)
+}
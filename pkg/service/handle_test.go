@@ -0,0 +1,100 @@
+package service
+
+import (
+	"ferry/models/process"
+	"ferry/pkg/testdb"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// 并行：开始 -> 并行网关 -> 审批 A1 -> 审批 A2(可退回 A1)(用户 2)、审批 B(用户 3) -> 聚合网关 -> 结束
+var unevenParallelStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "fork", "label": "并行网关", "clazz": process.GatewayParallel, "sort": 2},
+		{"id": "a1", "label": "审批 A1", "clazz": process.NodeUserTask, "sort": 3, "assignType": process.AssignPerson, "assignValue": []int{2}},
+		{"id": "a2", "label": "审批 A2", "clazz": process.NodeUserTask, "sort": 4, "assignType": process.AssignPerson, "assignValue": []int{2}},
+		{"id": "b", "label": "审批 B", "clazz": process.NodeUserTask, "sort": 5, "assignType": process.AssignPerson, "assignValue": []int{3}},
+		{"id": "join", "label": "聚合网关", "clazz": process.GatewayParallel, "sort": 6},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 7},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "fork"},
+		{"id": "e2", "source": "fork", "target": "a1"},
+		{"id": "e3", "source": "fork", "target": "b"},
+		{"id": "e4", "source": "a1", "target": "a2"},
+		{"id": "e5", "source": "a2", "target": "a1"},
+		{"id": "e6", "source": "a2", "target": "join"},
+		{"id": "e7", "source": "b", "target": "join"},
+		{"id": "e8", "source": "join", "target": "end"},
+	},
+}
+
+func assertState(t *testing.T, workOrder process.WorkOrderInfo, expected ...string) {
+	t.Helper()
+	ids := stateIds(t, workOrder)
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("期望工单停留在 %v，实际为 %v", expected, ids)
+	}
+}
+
+// 分支经过的节点数量不同且分支内有退回时，所有分支到达聚合网关后才流转
+func TestJoinGatewayUnevenBranches(t *testing.T) {
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, unevenParallelStructure)
+	workOrder := testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{
+		{Id: "a1", Label: "审批 A1", Processor: []int{2}, ProcessMethod: process.AssignPerson},
+		{Id: "b", Label: "审批 B", Processor: []int{3}, ProcessMethod: process.AssignPerson},
+	})
+
+	steps := []struct {
+		userId   int
+		action   approval
+		expected []string
+	}{
+		{2, approve(workOrder.Id, "a1", "a2", nil), []string{"a2", "b"}},
+		{2, deny(workOrder.Id, "a2", "a1"), []string{"a1", "b"}},
+		{2, approve(workOrder.Id, "a1", "a2", nil), []string{"a2", "b"}},
+		{3, approve(workOrder.Id, "b", "join", nil), []string{"a2"}},
+		{2, approve(workOrder.Id, "a2", "join", nil), []string{"end"}},
+	}
+	for i, step := range steps {
+		err := handleWorkOrder(db, step.userId, step.action)
+		if err != nil {
+			t.Fatalf("第 %v 步处理失败，%v", i+1, err)
+		}
+		current := testdb.GetWorkOrder(t, db, workOrder.Id)
+		assertState(t, current, step.expected...)
+		if isEnd := step.expected[0] == "end"; (current.IsEnd == 1) != isEnd {
+			t.Fatalf("第 %v 步后工单是否结束不正确，%v", i+1, current.IsEnd)
+		}
+	}
+}
+
+// 分支退回到并行网关之前时，其他分支不再保留
+func TestRejectBeforeFork(t *testing.T) {
+	structure := map[string]interface{}{
+		"nodes": unevenParallelStructure["nodes"],
+		"edges": append([]map[string]interface{}{
+			{"id": "e9", "source": "b", "target": "start"},
+		}, unevenParallelStructure["edges"].([]map[string]interface{})...),
+	}
+
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, structure)
+	workOrder := testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{
+		{Id: "a2", Label: "审批 A2", Processor: []int{2}, ProcessMethod: process.AssignPerson},
+		{Id: "b", Label: "审批 B", Processor: []int{3}, ProcessMethod: process.AssignPerson},
+	})
+
+	err := handleWorkOrder(db, 3, deny(workOrder.Id, "b", "start"))
+	if err != nil {
+		t.Fatalf("处理工单失败，%v", err)
+	}
+	assertState(t, testdb.GetWorkOrder(t, db, workOrder.Id), "start")
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/notify"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 转交工单
+*/
+
+// 将工单指定节点的处理人转交给其他用户并通知转交后的处理人，在调用方的事务中写入，actor 为空时表示由系统转交
+func InversionWorkOrder(tx *gorm.DB, actor *Actor, cmd *InversionCommand) (err error) {
+	err = inversionWorkOrder(tx, actor, cmd)
+	if err != nil {
+		return
+	}
+	return sendTransferNotify(tx, cmd.WorkOrderId)
+}
+
+func inversionWorkOrder(tx *gorm.DB, actor *Actor, cmd *InversionCommand) (err error) {
+	var (
+		cirHistoryValue   []process.CirculationHistory
+		workOrderInfo     process.WorkOrderInfo
+		stateList         []*process.StateItem
+		stateValue        []byte
+		currentState      *process.StateItem
+		userInfo          system.SysUser
+		costDurationValue int64
+		workOrderId       = cmd.WorkOrderId
+		remarks           = cmd.Remarks
+	)
+
+	// 查询工单信息
+	err = tx.Model(&workOrderInfo).
+		Where("id = ?", workOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询工单信息失败，%v", err.Error())
+	}
+	if workOrderInfo.IsEnd == 1 {
+		return errors.New("工单已结束，无法转交")
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+
+	// 序列化节点数据
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		return fmt.Errorf("节点数据反序列化失败，%v", err.Error())
+	}
+
+	currentState = process.GetStateItem(stateList, cmd.NodeId)
+	if currentState == nil {
+		return errors.New("工单当前不在此节点，无法转交")
+	}
+	currentState.Processor = []int{cmd.UserId}
+	currentState.ProcessMethod = process.AssignPerson
+	currentState.Claim = nil
+
+	stateValue, err = json.Marshal(stateList)
+	if err != nil {
+		return fmt.Errorf("节点数据序列化失败，%v", err.Error())
+	}
+
+	// 查询用户信息
+	err = tx.Model(&system.SysUser{}).
+		Where("user_id = ?", cmd.UserId).
+		Find(&userInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询用户信息失败，%v", err.Error())
+	}
+
+	// 流转历史
+	err = tx.Model(&cirHistoryValue).
+		Where("work_order = ?", workOrderId).
+		Order("create_time desc").
+		Find(&cirHistoryValue).Error
+	if err != nil {
+		return
+	}
+	for _, t := range cirHistoryValue {
+		if t.Source != currentState.Id {
+			costDuration := time.Since(t.CreatedAt.Time)
+			costDurationValue = int64(costDuration) / 1000 / 1000 / 1000
+		}
+	}
+
+	if remarks == "" {
+		remarks = fmt.Sprintf("此阶段负责人已转交给《%v》", userInfo.NickName)
+	}
+
+	// 更新数据
+	err = UpdateWorkOrder(tx, &workOrderInfo, map[string]interface{}{
+		"state": stateValue,
+	})
+	if err != nil {
+		return
+	}
+
+	// 添加转交历史
+	history := process.CirculationHistory{
+		Title:        workOrderInfo.Title,
+		WorkOrder:    workOrderInfo.Id,
+		State:        currentState.Label,
+		Circulation:  "转交工单",
+		Remarks:      remarks,
+		Status:       2, // 其他
+		CostDuration: costDurationValue,
+	}
+	history.ProcessorId, history.Processor = actor.processor()
+	err = tx.Create(&history).Error
+	if err != nil {
+		return fmt.Errorf("新建转交历史失败，%v", err.Error())
+	}
+	return
+}
+
+// 通知工单当前的处理人
+func sendTransferNotify(db *gorm.DB, workOrderId int) (err error) {
+	var (
+		processInfo process.Info
+		noticeList  []*notify.Channel
+		bodyData    *notify.BodyData
+	)
+
+	bodyData, err = WorkOrderNotifyData(db, workOrderId)
+	if err != nil {
+		return
+	}
+
+	// 获取流程信息
+	err = db.Model(&process.Info{}).Where("id = ?", bodyData.ProcessId).Find(&processInfo).Error
+	if err != nil {
+		return
+	}
+	// 获取流程通知类型列表
+	noticeList, err = notify.ParseNotice(processInfo.Notice)
+	if err != nil {
+		return
+	}
+
+	// 通知写入发件箱
+	bodyData.Subject = "您有一条待办工单，请及时处理"
+	bodyData.Description = "您有一条待办工单请及时处理，工单描述如下"
+	bodyData.Channels = noticeList
+	bodyData.Event = notify.EventTransferred
+	err = notify.Enqueue(db, bodyData)
+	if err != nil {
+		err = fmt.Errorf("通知发送失败，%v", err.Error())
+	}
+	return
+}
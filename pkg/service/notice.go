@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/notify"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流程通知渠道及通知数据
+*/
+
+// 获取流程启用的通知渠道，流程未配置通知时返回默认渠道
+func GetNoticeChannels(processId int) (channels []*notify.Channel, err error) {
+	var processInfo process.Info
+
+	err = orm.Eloquent.Model(&process.Info{}).
+		Where("id = ?", processId).
+		Find(&processInfo).Error
+	if err != nil {
+		return
+	}
+
+	channels, err = notify.ParseNotice(processInfo.Notice)
+	if err != nil {
+		return
+	}
+	if len(channels) == 0 {
+		channels = notify.DefaultChannels()
+	}
+	return
+}
+
+// 获取工单的表单数据，formData 以字段标识为键，form 以字段名称为键
+func WorkOrderForm(db *gorm.DB, workOrderId int) (formData map[string]interface{}, form map[string]interface{}, err error) {
+	var tplDataList []*process.TplData
+
+	formData = make(map[string]interface{})
+	form = make(map[string]interface{})
+
+	err = db.Model(&process.TplData{}).
+		Where("work_order = ?", workOrderId).
+		Order("id").
+		Find(&tplDataList).Error
+	if err != nil {
+		err = fmt.Errorf("获取工单表单数据失败，%v", err.Error())
+		return
+	}
+
+	for _, tplData := range tplDataList {
+		var (
+			values        map[string]interface{}
+			formStructure struct {
+				List []struct {
+					Name  string `json:"name"`
+					Key   string `json:"key"`
+					Model string `json:"model"`
+				} `json:"list"`
+			}
+		)
+
+		if len(tplData.FormData) == 0 || json.Unmarshal(tplData.FormData, &values) != nil {
+			continue
+		}
+		for key, value := range values {
+			formData[key] = value
+		}
+
+		if len(tplData.FormStructure) == 0 || json.Unmarshal(tplData.FormStructure, &formStructure) != nil {
+			continue
+		}
+		for _, item := range formStructure.List {
+			model := item.Model
+			if model == "" {
+				model = "input_" + item.Key
+			}
+			if value, ok := values[model]; ok && item.Name != "" {
+				form[item.Name] = value
+			}
+		}
+	}
+	return
+}
+
+// 将工单表单数据填充到通知数据中
+func fillNotifyForm(db *gorm.DB, bodyData *notify.BodyData) (err error) {
+	bodyData.FormData, bodyData.Form, err = WorkOrderForm(db, bodyData.Id)
+	if err != nil {
+		return
+	}
+	if value, ok := bodyData.Form["故障现象"].(string); ok && value != "" {
+		bodyData.ProblemText = value
+	}
+	if value, ok := bodyData.Form["联系方式"].(string); ok && value != "" {
+		bodyData.PhoneNumber = value
+	}
+	return
+}
+
+// 根据工单生成通知数据，接收人为工单当前的处理人
+func WorkOrderNotifyData(db *gorm.DB, workOrderId int) (bodyData *notify.BodyData, err error) {
+	var (
+		workOrderInfo  process.WorkOrderInfo
+		applyUserInfo  system.SysUser
+		stateList      []*process.StateItem
+		sendToUserList []system.SysUser
+	)
+
+	// 查询工单数据
+	err = db.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrderId).Find(&workOrderInfo).Error
+	if err != nil {
+		err = fmt.Errorf("查询工单信息失败，%v", err.Error())
+		return
+	}
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		err = fmt.Errorf("获取所有处理人的用户信息json失败，%v", err.Error())
+		return
+	}
+	sendToUserList, err = GetPrincipalUserInfo(stateList, workOrderInfo.Creator)
+	if err != nil {
+		err = fmt.Errorf("获取所有处理人的用户信息失败，%v", err.Error())
+		return
+	}
+	// 查询工单创建人信息
+	err = db.Model(&system.SysUser{}).Where("user_id = ?", workOrderInfo.Creator).Find(&applyUserInfo).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return
+	}
+
+	bodyData = &notify.BodyData{
+		SendTo: map[string]interface{}{
+			"userList": sendToUserList,
+		},
+		ProcessId: workOrderInfo.Process,
+		Id:        workOrderInfo.Id,
+		Title:     workOrderInfo.Title,
+		Creator:   applyUserInfo.NickName,
+		Priority:  workOrderInfo.Priority,
+		CreatedAt: workOrderInfo.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	err = fillNotifyForm(db, bodyData)
+	return
+}
@@ -5,11 +5,7 @@ import (
 	"errors"
 	"ferry/global/orm"
 	"ferry/models/process"
-	"ferry/tools"
 	"fmt"
-	"strconv"
-
-	"github.com/gin-gonic/gin"
 )
 
 /*
@@ -21,16 +17,18 @@ type WorkOrderData struct {
 	CurrentState string `json:"current_state"`
 }
 
-func ProcessStructure(c *gin.Context, processId int, workOrderId int) (result map[string]interface{}, err error) {
+func ProcessStructure(actor *Actor, processId int, workOrderId int) (result map[string]interface{}, err error) {
 	var (
-		processValue            process.Info
-		processStructureDetails map[string]interface{}
-		processNode             []map[string]interface{}
-		tplDetails              []*process.TplInfo
-		workOrderInfo           WorkOrderData
-		workOrderTpls           []*process.TplData
-		workOrderHistory        []*process.CirculationHistory
-		stateList               []map[string]interface{}
+		processValue     process.Info
+		raw              *process.RawStructure
+		processNode      []map[string]interface{}
+		processEdges     []map[string]interface{}
+		tplDetails       []*process.TplInfo
+		workOrderInfo    WorkOrderData
+		workOrderTpls    []*process.TplData
+		workOrderHistory []*process.CirculationHistory
+		stateList        []*process.StateItem
+		processState     *ProcessState
 	)
 
 	err = orm.Eloquent.Model(&processValue).Where("id = ?", processId).Find(&processValue).Error
@@ -39,42 +37,45 @@ func ProcessStructure(c *gin.Context, processId int, workOrderId int) (result ma
 	//	return
 	//}
 
+	// 新建工单时使用当前发布的版本，查看工单时使用工单绑定的版本
+	version := processValue.Version
+	if workOrderId != 0 {
+		var workOrder process.WorkOrderInfo
+		err = orm.Eloquent.Model(&process.WorkOrderInfo{}).
+			Where("id = ?", workOrderId).
+			Find(&workOrder).Error
+		if err != nil {
+			return
+		}
+		version = workOrder.ProcessVersion
+	}
+	err = applyVersion(orm.Eloquent, &processValue, version)
+	if err != nil {
+		return
+	}
+
 	if processValue.Structure != nil && len(processValue.Structure) > 0 {
-		err = json.Unmarshal([]byte(processValue.Structure), &processStructureDetails)
+		processState, err = NewProcessState(processValue.Structure)
 		if err != nil {
-			err = fmt.Errorf("json转map失败，%v", err.Error())
 			return
 		}
 
-		// 排序，使用冒泡
-		p := processStructureDetails["nodes"].([]interface{})
-		if len(p) > 1 {
-			for i := 0; i < len(p); i++ {
-				for j := 1; j < len(p)-i; j++ {
-					if p[j].(map[string]interface{})["sort"] == nil || p[j-1].(map[string]interface{})["sort"] == nil {
-						return nil, errors.New("流程未定义顺序属性，请确认")
-					}
-					leftInt, _ := strconv.Atoi(p[j].(map[string]interface{})["sort"].(string))
-					rightInt, _ := strconv.Atoi(p[j-1].(map[string]interface{})["sort"].(string))
-					if leftInt < rightInt {
-						//交换
-						p[j], p[j-1] = p[j-1], p[j]
-					}
-				}
-			}
-			for _, node := range processStructureDetails["nodes"].([]interface{}) {
-				processNode = append(processNode, node.(map[string]interface{}))
-			}
-		} else {
-			processNode = processStructureDetails["nodes"].([]map[string]interface{})
+		raw, err = process.ParseRawStructure(processValue.Structure)
+		if err != nil {
+			return
 		}
+
+		// 按照节点的排序值排序
+		raw.SortNodes(processState.Structure)
+		processNode = raw.Nodes
+		processEdges = raw.Edges
 	}
 
 	processValue.Structure = nil
 	result = map[string]interface{}{
 		"process": processValue,
 		"nodes":   processNode,
-		"edges":   processStructureDetails["edges"],
+		"edges":   processEdges,
 	}
 
 	// 获取历史记录
@@ -112,7 +113,7 @@ func ProcessStructure(c *gin.Context, processId int, workOrderId int) (result ma
 			return
 		}
 		// 获取当前节点
-		err = json.Unmarshal(workOrderInfo.State, &stateList)
+		stateList, err = process.ParseState(workOrderInfo.State)
 		if err != nil {
 			err = fmt.Errorf("序列化节点列表失败，%v", err.Error())
 			return
@@ -122,53 +123,33 @@ func ProcessStructure(c *gin.Context, processId int, workOrderId int) (result ma
 			return
 		}
 
-		// 整理需要并行处理的数据
-		if len(stateList) > 1 {
-		continueHistoryTag:
-			for _, v := range workOrderHistory {
-				status := false
-				for i, s := range stateList {
-					if v.Source == s["id"].(string) && v.Target != "" {
-						status = true
-						stateList = append(stateList[:i], stateList[i+1:]...)
-						continue continueHistoryTag
-					}
-				}
-				if !status {
-					break
-				}
-			}
-		}
-
+		// 并行的分支完成后即从节点列表中移除，节点列表中均为待处理的节点
 		if len(stateList) > 0 {
 		breakStateTag:
 			for _, stateValue := range stateList {
-				if processStructureDetails["nodes"] != nil {
-					for _, processNodeValue := range processStructureDetails["nodes"].([]interface{}) {
-						if stateValue["id"].(string) == processNodeValue.(map[string]interface{})["id"] {
-							if _, ok := stateValue["processor"]; ok {
-								for _, userId := range stateValue["processor"].([]interface{}) {
-									if int(userId.(float64)) == tools.GetUserId(c) {
-										workOrderInfo.CurrentState = stateValue["id"].(string)
-										break breakStateTag
-									}
-								}
-							} else {
-								err = errors.New("未查询到对应的处理人字段，请确认。")
-								return
-							}
+				if processState != nil && processState.Structure.GetNode(stateValue.Id) != nil {
+					for _, userId := range stateValue.Processor {
+						if userId == actor.UserId {
+							workOrderInfo.CurrentState = stateValue.Id
+							break breakStateTag
 						}
 					}
 				}
 			}
 
 			if workOrderInfo.CurrentState == "" {
-				workOrderInfo.CurrentState = stateList[0]["id"].(string)
+				workOrderInfo.CurrentState = stateList[0].Id
 			}
 		}
 
 		result["workOrder"] = workOrderInfo
 
+		// 查询父工单及子工单
+		result["parent"], result["children"], err = SubProcessRelations(&workOrderInfo.WorkOrderInfo)
+		if err != nil {
+			return
+		}
+
 		// 查询工单表单数据
 		err = orm.Eloquent.Model(&workOrderTpls).
 			Where("work_order = ?", workOrderId).
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流程版本，保存流程时生成新版本，工单按照创建时的版本流转
+*/
+
+// 流程定义发生变化时生成新版本，并更新流程当前发布的版本，definition 为即将保存的流程定义。
+// 流程首次生成版本时，已有的工单绑定到保存前的流程定义，避免受到本次修改的影响。
+func PublishVersion(tx *gorm.DB, definition *process.Info, creator int) (version int, err error) {
+	var (
+		stored         process.Info
+		latest         *process.Version
+		workOrderCount int
+	)
+
+	err = tx.Model(&process.Info{}).
+		Where("id = ?", definition.Id).
+		Find(&stored).Error
+	if err != nil {
+		return 0, fmt.Errorf("查询流程信息失败，%v", err.Error())
+	}
+
+	if stored.Version == 0 {
+		err = tx.Model(&process.WorkOrderInfo{}).
+			Where("process = ? and process_version = 0", stored.Id).
+			Count(&workOrderCount).Error
+		if err != nil {
+			return 0, fmt.Errorf("查询工单数量失败，%v", err.Error())
+		}
+		if workOrderCount > 0 && len(stored.Structure) > 0 {
+			latest, err = createVersion(tx, &stored, 1, creator, "保存流程前的定义")
+			if err != nil {
+				return
+			}
+			err = tx.Model(&process.WorkOrderInfo{}).
+				Where("process = ? and process_version = 0", stored.Id).
+				Update("process_version", latest.Version).Error
+			if err != nil {
+				return 0, fmt.Errorf("绑定工单流程版本失败，%v", err.Error())
+			}
+		}
+	} else {
+		latest, err = GetVersion(tx, stored.Id, stored.Version)
+		if err != nil {
+			return
+		}
+	}
+
+	if latest != nil && latest.SameAs(definition) {
+		version = latest.Version
+	} else {
+		version = 1
+		if latest != nil {
+			version = latest.Version + 1
+		}
+		_, err = createVersion(tx, definition, version, creator, "")
+		if err != nil {
+			return
+		}
+	}
+
+	if version != stored.Version {
+		err = tx.Model(&process.Info{}).
+			Where("id = ?", stored.Id).
+			Update("version", version).Error
+		if err != nil {
+			return 0, fmt.Errorf("更新流程版本失败，%v", err.Error())
+		}
+	}
+	definition.Version = version
+	return
+}
+
+func createVersion(tx *gorm.DB, info *process.Info, version int, creator int, remarks string) (v *process.Version, err error) {
+	v = &process.Version{
+		Process:   info.Id,
+		Version:   version,
+		Structure: info.Structure,
+		Tpls:      info.Tpls,
+		Task:      info.Task,
+		Creator:   creator,
+		Remarks:   remarks,
+	}
+	err = tx.Create(v).Error
+	if err != nil {
+		return nil, fmt.Errorf("创建流程版本失败，%v", err.Error())
+	}
+	return
+}
+
+// 查询流程的指定版本
+func GetVersion(db *gorm.DB, processId int, version int) (v *process.Version, err error) {
+	var versionList []*process.Version
+
+	err = db.Model(&process.Version{}).
+		Where("process = ? and version = ?", processId, version).
+		Find(&versionList).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询流程版本失败，%v", err.Error())
+	}
+	if len(versionList) == 0 {
+		return nil, fmt.Errorf("流程 %v 的版本 %v 不存在", processId, version)
+	}
+	return versionList[0], nil
+}
+
+// 查询流程当前发布版本的定义，新建工单时使用
+func LatestProcess(db *gorm.DB, processId int) (processInfo process.Info, err error) {
+	err = db.Model(&process.Info{}).
+		Where("id = ?", processId).
+		Find(&processInfo).Error
+	if err != nil {
+		return processInfo, fmt.Errorf("查询流程信息失败，%v", err.Error())
+	}
+	err = applyVersion(db, &processInfo, processInfo.Version)
+	return
+}
+
+// 查询工单绑定版本的流程定义，未绑定版本的工单使用流程当前的定义
+func WorkOrderProcess(db *gorm.DB, workOrder *process.WorkOrderInfo) (processInfo process.Info, err error) {
+	err = db.Model(&process.Info{}).
+		Where("id = ?", workOrder.Process).
+		Find(&processInfo).Error
+	if err != nil {
+		return processInfo, fmt.Errorf("查询流程信息失败，%v", err.Error())
+	}
+	err = applyVersion(db, &processInfo, workOrder.ProcessVersion)
+	return
+}
+
+func applyVersion(db *gorm.DB, processInfo *process.Info, version int) (err error) {
+	if version == 0 {
+		return
+	}
+	v, err := GetVersion(db, processInfo.Id, version)
+	if err != nil {
+		return
+	}
+	v.Apply(processInfo)
+	return
+}
+
+// 将未结束的工单迁移到流程的指定版本，version 为 0 时迁移到当前发布的版本。
+// NodeMapping 的键为工单当前所在的节点，值为新版本中的节点，未配置映射的节点需要在新版本中存在。
+// 在调用方的事务中写入，actor 为空时表示由系统迁移
+func MigrateWorkOrders(tx *gorm.DB, actor *Actor, cmd *MigrateCommand) (err error) {
+	var (
+		processInfo   process.Info
+		processState  *ProcessState
+		workOrderList []*process.WorkOrderInfo
+		processId     = cmd.ProcessId
+		workOrderIds  = cmd.WorkOrderIds
+		version       = cmd.Version
+	)
+
+	if len(workOrderIds) == 0 {
+		return errors.New("请选择需要迁移的工单")
+	}
+
+	err = tx.Model(&process.Info{}).
+		Where("id = ?", processId).
+		Find(&processInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询流程信息失败，%v", err.Error())
+	}
+	if version == 0 {
+		version = processInfo.Version
+	}
+	if version == 0 {
+		return errors.New("流程尚未生成版本，无需迁移")
+	}
+	err = applyVersion(tx, &processInfo, version)
+	if err != nil {
+		return
+	}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
+	}
+
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id in (?) and process = ?", workOrderIds, processId).
+		Find(&workOrderList).Error
+	if err != nil {
+		return fmt.Errorf("查询工单失败，%v", err.Error())
+	}
+	if len(workOrderList) != len(workOrderIds) {
+		return errors.New("部分工单不存在或不属于此流程，请确认")
+	}
+
+	for _, workOrder := range workOrderList {
+		err = migrateWorkOrder(tx, actor, workOrder, processState, version, cmd.NodeMapping)
+		if err != nil {
+			return fmt.Errorf("工单 %v 迁移失败，%v", workOrder.Id, err.Error())
+		}
+	}
+	return
+}
+
+// 按照节点映射更新工单当前的节点，节点变化时重新生成处理人
+func migrateWorkOrder(tx *gorm.DB, actor *Actor, workOrder *process.WorkOrderInfo, processState *ProcessState, version int, nodeMapping map[string]string) (err error) {
+	var (
+		stateList   []*process.StateItem
+		newState    []*process.StateItem
+		entered     []*process.StateItem
+		stateValue  []byte
+		labels      []string
+		fromVersion = workOrder.ProcessVersion
+	)
+
+	if workOrder.IsEnd == 1 {
+		return errors.New("工单已结束，无法迁移")
+	}
+	if workOrder.ProcessVersion == version {
+		return nil
+	}
+
+	stateList, err = process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+	for _, state := range stateList {
+		nodeId := state.Id
+		if target, ok := nodeMapping[nodeId]; ok && target != "" {
+			nodeId = target
+		}
+		node := processState.Structure.GetNode(nodeId)
+		if node == nil {
+			return fmt.Errorf("节点《%v》在新版本中不存在，请配置节点映射", state.Label)
+		}
+		if process.GetStateItem(newState, node.Id) != nil {
+			continue
+		}
+
+		// 节点未变化时保留原有的处理人
+		item := state
+		if node.Id != state.Id {
+			item = process.NewStateItem(node)
+			entered = append(entered, item)
+		}
+		item.Label = node.Label
+		newState = append(newState, item)
+		labels = append(labels, node.Label)
+	}
+
+	assigneeContext, err := workOrderAssigneeContext(tx, workOrder, processState.Structure)
+	if err != nil {
+		return
+	}
+	err = ResolveAssignees(assigneeContext, entered)
+	if err != nil {
+		return
+	}
+	err = DelegateState(tx, workOrder.Process, entered)
+	if err != nil {
+		return
+	}
+	stateValue, err = json.Marshal(newState)
+	if err != nil {
+		return
+	}
+
+	// 退回记录中的节点属于旧版本，迁移后丢弃
+	err = UpdateWorkOrder(tx, workOrder, map[string]interface{}{
+		"state":           stateValue,
+		"process_version": version,
+		"return_stack":    gorm.Expr("null"),
+	})
+	if err != nil {
+		return
+	}
+	workOrder.ProcessVersion = version
+
+	err = RefreshDueTime(tx, workOrder, processState.Structure, newState)
+	if err != nil {
+		return
+	}
+	err = ScheduleTimers(tx, workOrder, processState, entered)
+	if err != nil {
+		return
+	}
+	err = ScheduleScripts(tx, workOrder, processState, entered)
+	if err != nil {
+		return
+	}
+	err = startSubProcesses(tx, workOrder, processState, newState, entered)
+	if err != nil {
+		return
+	}
+
+	history := process.CirculationHistory{
+		Title:       workOrder.Title,
+		WorkOrder:   workOrder.Id,
+		State:       strings.Join(labels, "，"),
+		Circulation: "迁移流程版本",
+		Status:      2, // 其他
+		Remarks:     fmt.Sprintf("流程版本由 %v 迁移至 %v", fromVersion, version),
+	}
+	history.ProcessorId, history.Processor = actor.processor()
+	return tx.Create(&history).Error
+}
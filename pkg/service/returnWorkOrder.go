@@ -0,0 +1,315 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"ferry/pkg/notify"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 退回工单
+*/
+
+// 可退回的节点
+type ReturnNode struct {
+	Id    string `json:"id"`
+	Label string `json:"label"`
+	Clazz string `json:"clazz"`
+}
+
+// 工单已经过的节点，按首次经过的顺序排列，不包含工单当前所在的节点
+func ReturnableNodes(db *gorm.DB, workOrderId int) (nodeList []*ReturnNode, err error) {
+	var (
+		workOrderInfo   process.WorkOrderInfo
+		processInfo     process.Info
+		processState    *ProcessState
+		stateList       []*process.StateItem
+		cirHistoryValue []process.CirculationHistory
+		nodeIds         = make(map[string]struct{})
+	)
+
+	nodeList = make([]*ReturnNode, 0)
+
+	err = db.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", workOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工单信息失败，%v", err.Error())
+	}
+
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		return
+	}
+	for _, state := range stateList {
+		nodeIds[state.Id] = struct{}{}
+	}
+
+	processInfo, err = WorkOrderProcess(db, &workOrderInfo)
+	if err != nil {
+		return
+	}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
+	}
+
+	err = db.Model(&process.CirculationHistory{}).
+		Where("work_order = ?", workOrderId).
+		Order("id").
+		Find(&cirHistoryValue).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询流转历史失败，%v", err.Error())
+	}
+
+	for _, history := range cirHistoryValue {
+		if history.Source == "" {
+			continue
+		}
+		if _, ok := nodeIds[history.Source]; ok {
+			continue
+		}
+		nodeIds[history.Source] = struct{}{}
+
+		node, err := processState.GetNode(history.Source)
+		if err != nil {
+			// 流程已修改，节点不存在时跳过
+			continue
+		}
+		if node.Clazz != process.NodeStart && !node.IsHumanTask() {
+			continue
+		}
+		nodeList = append(nodeList, &ReturnNode{
+			Id:    node.Id,
+			Label: node.Label,
+			Clazz: node.Clazz,
+		})
+	}
+	return
+}
+
+// 将工单退回到已经过的节点，恢复该节点原有的处理人，表单数据保持不变。
+// Resume 为 true 时，退回到的节点处理完成后直接返回当前节点，跳过中间的审批节点。
+// 在调用方的事务中写入，actor 为空时表示由系统退回
+func ReturnWorkOrder(tx *gorm.DB, actor *Actor, cmd *ReturnCommand) (err error) {
+	var (
+		workOrderInfo     process.WorkOrderInfo
+		processInfo       process.Info
+		structure         *process.Structure
+		stateList         []*process.StateItem
+		returnStack       []*process.ReturnItem
+		nodeList          []*ReturnNode
+		targetState       *process.StateItem
+		relatedPersonList []int
+		cirHistoryValue   []process.CirculationHistory
+		costDurationValue int64
+		stateValue        []byte
+		returnValue       []byte
+		relatedPerson     []byte
+		noticeList        []*notify.Channel
+		bodyData          *notify.BodyData
+		workOrderId       = cmd.WorkOrderId
+		targetNode        = cmd.TargetState
+		remarks           = cmd.Remarks
+	)
+
+	if remarks == "" {
+		return errors.New("请填写退回原因")
+	}
+
+	// 查询工单信息
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", workOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询工单信息失败，%v", err.Error())
+	}
+	if workOrderInfo.IsEnd == 1 {
+		return errors.New("工单已结束，无法退回")
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		return
+	}
+	if process.GetStateItem(stateList, cmd.SourceState) == nil {
+		return errors.New("工单当前不在此节点，无法退回")
+	}
+	if len(stateList) != 1 {
+		return errors.New("工单正在并行处理中，无法退回")
+	}
+
+	// 校验退回的节点
+	nodeList, err = ReturnableNodes(tx, workOrderId)
+	if err != nil {
+		return
+	}
+	found := false
+	for _, node := range nodeList {
+		if node.Id == targetNode {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("工单未经过此节点，无法退回")
+	}
+
+	processInfo, err = WorkOrderProcess(tx, &workOrderInfo)
+	if err != nil {
+		return
+	}
+	structure, err = process.ParseStructure(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	node := structure.GetNode(targetNode)
+	if node == nil {
+		return fmt.Errorf("节点 %v 不存在", targetNode)
+	}
+
+	// 恢复节点原有的处理人
+	if node.Clazz == process.NodeStart {
+		targetState = &process.StateItem{
+			Id:            node.Id,
+			Label:         node.Label,
+			Processor:     []int{workOrderInfo.Creator},
+			ProcessMethod: process.AssignPerson,
+		}
+	} else {
+		targetState = process.NewStateItem(node)
+	}
+	newState := []*process.StateItem{targetState}
+	assigneeContext, err := workOrderAssigneeContext(tx, &workOrderInfo, structure)
+	if err != nil {
+		return
+	}
+	err = ResolveAssignees(assigneeContext, newState)
+	if err != nil {
+		return
+	}
+	err = DelegateState(tx, workOrderInfo.Process, newState)
+	if err != nil {
+		return
+	}
+
+	returnStack, err = process.ParseReturnStack(workOrderInfo.ReturnStack)
+	if err != nil {
+		return
+	}
+	if cmd.Resume {
+		returnStack = append(returnStack, &process.ReturnItem{
+			Target: targetNode,
+			State:  stateList[0],
+		})
+	}
+
+	err = json.Unmarshal(workOrderInfo.RelatedPerson, &relatedPersonList)
+	if err != nil {
+		return
+	}
+	if actor != nil {
+		relatedPersonList = appendUnique(relatedPersonList, actor.UserId)
+	}
+
+	stateValue, err = json.Marshal(newState)
+	if err != nil {
+		return
+	}
+	returnValue, err = json.Marshal(returnStack)
+	if err != nil {
+		return
+	}
+	relatedPerson, err = json.Marshal(relatedPersonList)
+	if err != nil {
+		return
+	}
+
+	// 计算当前节点的处理时长
+	err = tx.Model(&process.CirculationHistory{}).
+		Where("work_order = ?", workOrderId).
+		Order("id desc").
+		Limit(1).
+		Find(&cirHistoryValue).Error
+	if err != nil {
+		return
+	}
+	if len(cirHistoryValue) > 0 {
+		costDurationValue = int64(time.Since(cirHistoryValue[0].CreatedAt.Time).Seconds())
+	}
+
+	noticeList, err = notify.ParseNotice(processInfo.Notice)
+	if err != nil {
+		return
+	}
+
+	err = UpdateWorkOrder(tx, &workOrderInfo, map[string]interface{}{
+		"state":          stateValue,
+		"is_denied":      1,
+		"return_stack":   returnValue,
+		"related_person": relatedPerson,
+	})
+	if err != nil {
+		return
+	}
+
+	// 重新计算截止时间
+	err = RefreshDueTime(tx, &workOrderInfo, structure, newState)
+	if err != nil {
+		return
+	}
+
+	// 退回记录不记录源节点，避免被计入会签及并行节点的处理记录
+	history := process.CirculationHistory{
+		Title:        workOrderInfo.Title,
+		WorkOrder:    workOrderInfo.Id,
+		State:        stateList[0].Label,
+		Target:       targetNode,
+		Circulation:  fmt.Sprintf("退回至《%v》", node.Label),
+		Remarks:      remarks,
+		Status:       0, // 拒绝
+		CostDuration: costDurationValue,
+	}
+	history.ProcessorId, history.Processor = actor.processor()
+	err = tx.Create(&history).Error
+	if err != nil {
+		return fmt.Errorf("新建退回历史失败，%v", err.Error())
+	}
+
+	// 通知退回到的节点的处理人
+	if len(noticeList) > 0 {
+		bodyData, err = WorkOrderNotifyData(tx, workOrderId)
+		if err != nil {
+			return
+		}
+		bodyData.Subject = "您有一条被退回的工单，请及时处理"
+		bodyData.Description = fmt.Sprintf("工单已被退回，退回原因：%v，工单描述如下", remarks)
+		bodyData.Channels = noticeList
+		bodyData.Event = notify.EventDenied
+		err = notify.Enqueue(tx, bodyData)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func appendUnique(list []int, value int) []int {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
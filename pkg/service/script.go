@@ -0,0 +1,560 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"ferry/models/process"
+	"ferry/pkg/jsonTime"
+	"ferry/pkg/task"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 阻塞的任务节点，进入节点时写入脚本任务，由后台任务执行脚本后按照执行结果流转工单
+*/
+
+const (
+	scriptBatchSize   = 20
+	scriptOutputLimit = 64 * 1024
+)
+
+// 脚本执行结果
+type ScriptResult struct {
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+	Err      error // 脚本无法执行、执行超时或执行中断
+}
+
+// 记录的脚本输出，超出长度时截断
+func (r *ScriptResult) output() string {
+	output := append(append([]byte{}, r.Stdout...), r.Stderr...)
+	if len(output) > scriptOutputLimit {
+		output = output[:scriptOutputLimit]
+	}
+	return string(output)
+}
+
+// 为新进入的任务节点写入脚本任务，同一节点未执行的脚本任务会被取消
+func ScheduleScripts(tx *gorm.DB, workOrder *process.WorkOrderInfo, processState *ProcessState, entered []*process.StateItem) (err error) {
+	for _, state := range entered {
+		node := processState.Structure.GetNode(state.Id)
+		if node == nil || node.Clazz != process.NodeScriptTask || node.Script == nil {
+			continue
+		}
+
+		err = tx.Model(&process.WorkOrderScript{}).
+			Where("work_order = ? and node = ? and status = ?", workOrder.Id, node.Id, process.ScriptStatusPending).
+			Update("status", process.ScriptStatusCancelled).Error
+		if err != nil {
+			return fmt.Errorf("取消脚本任务失败，%v", err.Error())
+		}
+
+		err = tx.Create(&process.WorkOrderScript{
+			WorkOrder: workOrder.Id,
+			Node:      node.Id,
+			Task:      node.Script.Task,
+			Status:    process.ScriptStatusPending,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("写入脚本任务失败，%v", err.Error())
+		}
+	}
+	return
+}
+
+// 服务停止时仍在执行中的脚本任务，超过截止时间后按照执行失败处理
+var ErrScriptInterrupted = errors.New("脚本执行中断")
+
+// 执行中断的脚本任务
+func InterruptedScripts(db *gorm.DB) (scriptList []*process.WorkOrderScript, err error) {
+	err = db.Model(&process.WorkOrderScript{}).
+		Where("status = ? and deadline < ?", process.ScriptStatusRunning, time.Now().Add(-time.Minute)).
+		Find(&scriptList).Error
+	if err != nil {
+		err = fmt.Errorf("查询执行中断的脚本任务失败，%v", err.Error())
+	}
+	return
+}
+
+// 待执行的脚本任务
+func PendingScripts(db *gorm.DB) (scriptList []*process.WorkOrderScript, err error) {
+	err = db.Model(&process.WorkOrderScript{}).
+		Where("status = ?", process.ScriptStatusPending).
+		Order("id").
+		Limit(scriptBatchSize).
+		Find(&scriptList).Error
+	if err != nil {
+		err = fmt.Errorf("查询脚本任务失败，%v", err.Error())
+	}
+	return
+}
+
+// 执行单个脚本任务，返回的执行结果由调用方通过 FinishScript 流转工单，
+// 任务已被取消或已被其他实例领取时执行结果为空
+func RunScript(db *gorm.DB, script *process.WorkOrderScript) (res *ScriptResult, err error) {
+	var (
+		workOrder   process.WorkOrderInfo
+		processInfo process.Info
+		stateList   []*process.StateItem
+		node        *process.Node
+		formData    []json.RawMessage
+		params      []byte
+	)
+
+	err = db.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", script.WorkOrder).
+		Find(&workOrder).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, cancelScript(db, script)
+		}
+		return nil, fmt.Errorf("查询工单失败，%v", err.Error())
+	}
+	stateList, err = process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+	if workOrder.IsEnd == 1 || process.GetStateItem(stateList, script.Node) == nil {
+		return nil, cancelScript(db, script)
+	}
+
+	processInfo, err = WorkOrderProcess(db, &workOrder)
+	if err != nil {
+		return
+	}
+	structure, err := process.ParseStructure(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	node = structure.GetNode(script.Node)
+	if node == nil || node.Clazz != process.NodeScriptTask || node.Script == nil {
+		return nil, cancelScript(db, script)
+	}
+
+	timeout := time.Duration(node.Script.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = viper.GetDuration("settings.scripttask.timeout")
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	// 仅执行未被其他实例领取的脚本任务
+	result := db.Model(&process.WorkOrderScript{}).
+		Where("id = ? and status = ?", script.Id, process.ScriptStatusPending).
+		Updates(map[string]interface{}{
+			"status":   process.ScriptStatusRunning,
+			"deadline": jsonTime.JSONTime{Time: time.Now().Add(timeout)},
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+
+	// 脚本参数与节点任务相同
+	err = db.Model(&process.TplData{}).
+		Where("work_order = ?", workOrder.Id).
+		Pluck("form_data", &formData).Error
+	if err != nil {
+		return &ScriptResult{Err: fmt.Errorf("查询工单表单数据失败，%v", err.Error())}, nil
+	}
+	params, err = json.Marshal(map[string]interface{}{
+		"id":        workOrder.Id,
+		"title":     workOrder.Title,
+		"priority":  workOrder.Priority,
+		"form_data": formData,
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	scriptPath := fmt.Sprintf("%v/%v", viper.GetString("script.path"), node.Script.Task)
+	res = &ScriptResult{}
+	res.Stdout, res.Stderr, res.ExitCode, res.Err = task.Run(ctx, scriptPath, string(params))
+	if errors.Is(res.Err, context.DeadlineExceeded) {
+		res.Err = fmt.Errorf("脚本执行超过 %v", timeout)
+	}
+	return res, nil
+}
+
+// 任务节点流转失败，由调用方在新的事务中通过 FailScript 将任务标记为执行失败
+var ErrScriptRoute = errors.New("任务节点流转失败")
+
+// 锁定脚本任务所在的工单，工单已删除、已结束或已离开任务节点时返回的节点为空
+func lockScriptWorkOrder(tx *gorm.DB, script *process.WorkOrderScript) (workOrder process.WorkOrderInfo, processInfo process.Info, processState *ProcessState, node *process.Node, err error) {
+	var stateList []*process.StateItem
+
+	// 锁定工单，避免与人工处理同时流转
+	err = forUpdate(tx).
+		Model(&process.WorkOrderInfo{}).
+		Where("id = ?", script.WorkOrder).
+		Find(&workOrder).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("查询工单失败，%v", err.Error())
+		return
+	}
+	stateList, err = process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+
+	processInfo, err = WorkOrderProcess(tx, &workOrder)
+	if err != nil {
+		return
+	}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	node = processState.Structure.GetNode(script.Node)
+	if workOrder.IsEnd == 1 || process.GetStateItem(stateList, script.Node) == nil || node == nil || node.Script == nil {
+		node = nil
+	}
+	return
+}
+
+// 按照脚本的执行结果流转工单，工单已结束或已离开任务节点时取消任务，在调用方的事务中写入。
+// 无法流转到选择的节点时返回 ErrScriptRoute
+func FinishScript(tx *gorm.DB, script *process.WorkOrderScript, status int, res *ScriptResult) (err error) {
+	var (
+		workOrder    process.WorkOrderInfo
+		processInfo  process.Info
+		processState *ProcessState
+		node         *process.Node
+		h            *Handle
+		target       string
+		failure      error
+	)
+
+	workOrder, processInfo, processState, node, err = lockScriptWorkOrder(tx, script)
+	if err != nil {
+		return
+	}
+	if node == nil {
+		return cancelScript(tx, script)
+	}
+
+	h, err = newSystemHandle(tx, &workOrder, processState, node)
+	if err != nil {
+		return
+	}
+	target, failure, err = h.scriptTarget(node, res)
+	if err != nil {
+		return fmt.Errorf("%w，%v", ErrScriptRoute, err.Error())
+	}
+
+	updateValue := map[string]interface{}{
+		"status":     process.ScriptStatusSucceeded,
+		"exit_code":  res.ExitCode,
+		"output":     res.output(),
+		"last_error": "",
+	}
+	history := process.CirculationHistory{
+		Title:       workOrder.Title,
+		WorkOrder:   workOrder.Id,
+		State:       node.Label,
+		Source:      node.Id,
+		Circulation: "任务执行完成",
+		Processor:   systemProcessor,
+		Status:      1, // 同意
+		Remarks:     fmt.Sprintf("脚本 %v 执行完成，退出码 %v", node.Script.Task, res.ExitCode),
+	}
+	if failure != nil {
+		updateValue["status"] = process.ScriptStatusFailed
+		updateValue["last_error"] = failure.Error()
+		history.Circulation = "任务执行失败"
+		history.Status = 0 // 拒绝
+		history.Remarks = fmt.Sprintf("脚本 %v 执行失败，%v", node.Script.Task, failure.Error())
+		target = node.Script.ErrorTarget
+		h.flowProperties = 0
+	}
+
+	// 执行失败时流转到配置的节点，工单不会停留在无人处理的任务节点
+	err = h.scriptRoute(target)
+	if err != nil {
+		return fmt.Errorf("%w，%v", ErrScriptRoute, err.Error())
+	}
+	history.Target = target
+	updateValue["target"] = target
+
+	err = updateScript(tx, script, status, updateValue)
+	if err != nil {
+		return
+	}
+
+	err = tx.Create(&history).Error
+	if err != nil {
+		return
+	}
+	return h.systemCirculated(processInfo.Notice)
+}
+
+// 流转到脚本选择的节点
+func (h *Handle) scriptRoute(target string) (err error) {
+	h.targetStateValue, err = h.processState.GetNode(target)
+	if err != nil {
+		return
+	}
+	err = checkAssignee(h.targetStateValue)
+	if err != nil {
+		return
+	}
+	return h.jump()
+}
+
+// 无法按照执行结果流转时将任务标记为执行失败，工单直接停留在执行失败时流转到的人工处理节点，
+// 该节点同样无法处理时工单停留在任务节点，由管理员转交或结束，在调用方的事务中写入
+func FailScript(tx *gorm.DB, script *process.WorkOrderScript, status int, cause error) (err error) {
+	var (
+		workOrder    process.WorkOrderInfo
+		processState *ProcessState
+		node         *process.Node
+		target       string
+	)
+
+	workOrder, _, processState, node, err = lockScriptWorkOrder(tx, script)
+	if err != nil {
+		return
+	}
+	if node == nil {
+		return cancelScript(tx, script)
+	}
+
+	history := process.CirculationHistory{
+		Title:       workOrder.Title,
+		WorkOrder:   workOrder.Id,
+		State:       node.Label,
+		Source:      node.Id,
+		Circulation: "任务执行失败",
+		Processor:   systemProcessor,
+		Status:      0, // 拒绝
+		Remarks:     fmt.Sprintf("脚本 %v 执行失败，%v", node.Script.Task, cause.Error()),
+	}
+
+	routeErr := scriptErrorState(tx, &workOrder, processState.Structure, node)
+	if routeErr == nil {
+		target = node.Script.ErrorTarget
+	} else {
+		history.Remarks = fmt.Sprintf("%v，无法流转到执行失败时的节点，%v，请转交或结束工单", history.Remarks, routeErr.Error())
+	}
+	history.Target = target
+
+	err = updateScript(tx, script, status, map[string]interface{}{
+		"status":     process.ScriptStatusFailed,
+		"last_error": cause.Error(),
+		"target":     target,
+	})
+	if err != nil {
+		return
+	}
+	return tx.Create(&history).Error
+}
+
+// 将工单的任务节点替换为执行失败时流转到的人工处理节点，不经过后续的网关及任务
+func scriptErrorState(tx *gorm.DB, workOrder *process.WorkOrderInfo, structure *process.Structure, node *process.Node) (err error) {
+	errorNode := structure.GetNode(node.Script.ErrorTarget)
+	if errorNode == nil || !errorNode.IsHumanTask() {
+		return fmt.Errorf("节点 %v 不是人工处理节点", node.Script.ErrorTarget)
+	}
+	err = checkAssignee(errorNode)
+	if err != nil {
+		return
+	}
+
+	stateList, err := process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+	errorState := process.NewStateItem(errorNode)
+	assigneeContext, err := workOrderAssigneeContext(tx, workOrder, structure)
+	if err != nil {
+		return
+	}
+	err = ResolveAssignees(assigneeContext, []*process.StateItem{errorState})
+	if err != nil {
+		return
+	}
+	err = DelegateState(tx, workOrder.Process, []*process.StateItem{errorState})
+	if err != nil {
+		return
+	}
+	for i, state := range stateList {
+		if state.Id == node.Id {
+			stateList[i] = errorState
+		}
+	}
+
+	stateValue, err := json.Marshal(stateList)
+	if err != nil {
+		return
+	}
+	err = UpdateWorkOrder(tx, workOrder, map[string]interface{}{
+		"state": stateValue,
+	})
+	if err != nil {
+		return
+	}
+	return RefreshDueTime(tx, workOrder, structure, stateList)
+}
+
+// 更新仍处于 status 状态的脚本任务
+func updateScript(tx *gorm.DB, script *process.WorkOrderScript, status int, updateValue map[string]interface{}) error {
+	result := tx.Model(&process.WorkOrderScript{}).
+		Where("id = ? and status = ?", script.Id, status).
+		Updates(updateValue)
+	if result.Error != nil {
+		return fmt.Errorf("更新脚本任务失败，%v", result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("脚本任务已被处理")
+	}
+	return nil
+}
+
+// 根据脚本的执行结果选择流转到的节点，failure 不为空时表示执行失败。
+// 按照脚本输出的 target、退出码对应的节点、流转的条件表达式依次选择
+func (h *Handle) scriptTarget(node *process.Node, res *ScriptResult) (target string, failure error, err error) {
+	var output process.ScriptOutput
+
+	if res.Err != nil {
+		return "", res.Err, nil
+	}
+
+	stdout := bytes.TrimSpace(res.Stdout)
+	if bytes.HasPrefix(stdout, []byte("{")) && json.Unmarshal(stdout, &output) == nil {
+		if node.Script.MergeForm && len(output.Form) > 0 {
+			err = h.mergeScriptForm(output.Form)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	sourceEdges := h.processState.Structure.SourceEdges(node.Id)
+	isTarget := func(nodeId string) bool {
+		for _, edge := range sourceEdges {
+			if edge.Target == nodeId {
+				return true
+			}
+		}
+		return false
+	}
+
+	if output.Target != "" {
+		if !isTarget(output.Target) {
+			return "", fmt.Errorf("脚本输出的节点 %v 不是任务节点的流转目标", output.Target), nil
+		}
+		return output.Target, nil, nil
+	}
+	if exitTarget, ok := node.Script.ExitTarget(res.ExitCode); ok {
+		if !isTarget(exitTarget) {
+			return "", fmt.Errorf("退出码 %v 对应的节点 %v 不是任务节点的流转目标", res.ExitCode, exitTarget), nil
+		}
+		return exitTarget, nil, nil
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("脚本退出码为 %v", res.ExitCode), nil
+	}
+
+	// 执行成功时不使用指向失败时节点的流转
+	candidates := make([]*process.Edge, 0, len(sourceEdges))
+	for _, edge := range sourceEdges {
+		if edge.Target != node.Script.ErrorTarget {
+			candidates = append(candidates, edge)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("任务节点 %v 未配置流转", node.Label), nil
+	case 1:
+		return candidates[0].Target, nil, nil
+	}
+	activeEdge, matchErr := h.ExclusiveEdge(candidates)
+	if matchErr != nil {
+		return "", matchErr, nil
+	}
+	return activeEdge.Target, nil, nil
+}
+
+// 将脚本输出的表单数据合并到工单表单，字段所在的模版不存在时写入第一个模版
+func (h *Handle) mergeScriptForm(form map[string]interface{}) (err error) {
+	var (
+		tplDataList []*process.TplData
+		formDataMap = make(map[int]map[string]interface{})
+		changed     = make(map[int]bool)
+	)
+
+	err = h.tx.Model(&process.TplData{}).
+		Where("work_order = ?", h.workOrderId).
+		Order("id").
+		Find(&tplDataList).Error
+	if err != nil {
+		return fmt.Errorf("获取工单表单数据失败，%v", err.Error())
+	}
+	if len(tplDataList) == 0 {
+		return
+	}
+
+	for _, tplData := range tplDataList {
+		values := make(map[string]interface{})
+		if len(tplData.FormData) > 0 {
+			err = json.Unmarshal(tplData.FormData, &values)
+			if err != nil {
+				return fmt.Errorf("解析工单表单数据失败，%v", err.Error())
+			}
+		}
+		formDataMap[tplData.Id] = values
+	}
+
+continueField:
+	for key, value := range form {
+		for _, tplData := range tplDataList {
+			if _, ok := formDataMap[tplData.Id][key]; ok {
+				formDataMap[tplData.Id][key] = value
+				changed[tplData.Id] = true
+				continue continueField
+			}
+		}
+		formDataMap[tplDataList[0].Id][key] = value
+		changed[tplDataList[0].Id] = true
+	}
+
+	h.WorkOrderData = make([][]byte, 0, len(tplDataList))
+	for _, tplData := range tplDataList {
+		var formData []byte
+		formData, err = json.Marshal(formDataMap[tplData.Id])
+		if err != nil {
+			return
+		}
+		if changed[tplData.Id] {
+			err = h.tx.Model(&process.TplData{}).
+				Where("id = ?", tplData.Id).
+				Update("form_data", formData).Error
+			if err != nil {
+				return fmt.Errorf("更新工单表单数据失败，%v", err.Error())
+			}
+		}
+		h.WorkOrderData = append(h.WorkOrderData, formData)
+	}
+	return
+}
+
+func cancelScript(db *gorm.DB, script *process.WorkOrderScript) error {
+	return db.Model(&process.WorkOrderScript{}).
+		Where("id = ?", script.Id).
+		Update("status", process.ScriptStatusCancelled).Error
+}
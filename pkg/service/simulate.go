@@ -0,0 +1,416 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流程模拟，在内存中按照流程结构流转，不写入任何数据
+*/
+
+const (
+	SimulateApprove = "approve" // 同意
+	SimulateDeny    = "deny"    // 拒绝
+	SimulateEdge    = "edge"    // 选择流转
+
+	simulateMaxSteps = 200
+)
+
+// 模拟参数
+type SimulateParams struct {
+	ProcessId int                    `json:"process_id"` // 已保存的流程，未传递流程结构时使用
+	Structure json.RawMessage        `json:"structure"`  // 未保存的流程结构
+	Creator   int                    `json:"creator"`    // 工单创建人
+	Title     string                 `json:"title"`      // 工单标题
+	Priority  int                    `json:"priority"`   // 工单优先级
+	FormData  map[string]interface{} `json:"form_data"`  // 表单数据
+	Actions   []*SimulateAction      `json:"actions"`    // 依次执行的处理动作
+}
+
+// 处理动作，未指定节点时处理当前第一个等待处理的节点，节点只有一个流转时可不指定流转
+type SimulateAction struct {
+	Node   string `json:"node"`   // 处理的节点
+	Action string `json:"action"` // 动作 approve，同意 deny，拒绝 edge，选择流转
+	Edge   string `json:"edge"`   // 流转ID
+}
+
+// 模拟经过的节点
+type SimulateStep struct {
+	Node       string               `json:"node"`                 // 节点ID
+	Label      string               `json:"label"`                // 节点名称
+	Clazz      string               `json:"clazz"`                // 节点类型
+	Edge       string               `json:"edge,omitempty"`       // 进入节点或离开节点的流转
+	Action     string               `json:"action,omitempty"`     // 处理动作，为空时表示进入节点
+	Processors []*SimulateProcessor `json:"processors,omitempty"` // 节点的处理人
+	Remarks    string               `json:"remarks,omitempty"`    // 备注
+}
+
+type SimulateProcessor struct {
+	UserId   int    `json:"user_id"`
+	NickName string `json:"nick_name"`
+}
+
+// 模拟结果，出错时返回已经过的节点及错误信息
+type SimulateResult struct {
+	Path    []*SimulateStep `json:"path"`    // 经过的节点
+	Current []string        `json:"current"` // 模拟结束时工单所在的节点
+	IsEnd   bool            `json:"is_end"`  // 是否已流转到结束节点
+	Error   string          `json:"error"`   // 错误信息
+}
+
+type simulator struct {
+	h       *Handle
+	creator int
+	active  []*process.StateItem // 等待处理的节点
+	waiting map[string]bool      // 等待其他分支的聚合网关
+	forking int                  // 网关入口尚未进入的分支数量
+	result  *SimulateResult
+	steps   int
+}
+
+// 模拟工单流转
+func SimulateProcess(params *SimulateParams) (result *SimulateResult, err error) {
+	var (
+		structure    json.RawMessage
+		processState *ProcessState
+		formData     []byte
+		processInfo  process.Info
+	)
+
+	structure = params.Structure
+	if len(structure) == 0 || string(structure) == "null" {
+		if params.ProcessId == 0 {
+			return nil, errors.New("请传递流程结构或流程ID")
+		}
+		processInfo, err = LatestProcess(orm.Eloquent, params.ProcessId)
+		if err != nil {
+			return
+		}
+		structure = processInfo.Structure
+	}
+	_, err = ValidateStructure(structure)
+	if err != nil {
+		return
+	}
+	processState, err = NewProcessState(structure)
+	if err != nil {
+		return
+	}
+
+	formData, err = json.Marshal(params.FormData)
+	if err != nil {
+		return
+	}
+
+	s := &simulator{
+		h: &Handle{
+			workOrderDetails: process.WorkOrderInfo{
+				Title:    params.Title,
+				Priority: params.Priority,
+				Process:  params.ProcessId,
+				Creator:  params.Creator,
+			},
+			WorkOrderData:  [][]byte{formData},
+			processState:   processState,
+			flowProperties: 1,
+		},
+		creator: params.Creator,
+		waiting: make(map[string]bool),
+		result: &SimulateResult{
+			Path:    make([]*SimulateStep, 0),
+			Current: make([]string, 0),
+		},
+	}
+
+	err = s.run(params.Actions)
+	if err != nil {
+		s.result.Error = err.Error()
+	}
+	for _, state := range s.active {
+		s.result.Current = append(s.result.Current, state.Id)
+	}
+	return s.result, nil
+}
+
+func (s *simulator) run(actions []*SimulateAction) (err error) {
+	startNode := s.h.processState.Structure.StartNode()
+	if startNode == nil {
+		return errors.New("流程未定义开始节点")
+	}
+	err = s.enter(startNode, "")
+	if err != nil {
+		return
+	}
+
+	for _, action := range actions {
+		if s.result.IsEnd {
+			return errors.New("工单已结束，无法继续处理")
+		}
+		err = s.apply(action)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 进入节点，网关及无需人工处理的节点继续流转
+func (s *simulator) enter(node *process.Node, edgeId string) (err error) {
+	s.steps++
+	if s.steps > simulateMaxSteps {
+		return errors.New("流转次数超过限制，流程中可能存在循环")
+	}
+
+	step := &SimulateStep{
+		Node:  node.Id,
+		Label: node.Label,
+		Clazz: node.Clazz,
+		Edge:  edgeId,
+	}
+	s.result.Path = append(s.result.Path, step)
+	sourceEdges := s.h.processState.Structure.SourceEdges(node.Id)
+
+	switch node.Clazz {
+	case process.NodeStart:
+		state := &process.StateItem{
+			Id:            node.Id,
+			Label:         node.Label,
+			Processor:     []int{s.creator},
+			ProcessMethod: process.AssignPerson,
+		}
+		step.Processors, err = s.processors(state)
+		if err != nil {
+			return
+		}
+		s.active = append(s.active, state)
+		// 开始节点只有一个流转时直接提交
+		if len(sourceEdges) == 1 {
+			return s.leave(state.Id, sourceEdges[0], "")
+		}
+	case process.NodeUserTask, process.NodeReceiveTask:
+		state := process.NewStateItem(node)
+		assigneeContext := s.h.assigneeContext()
+		assigneeContext.DryRun = true
+		err = ResolveAssignees(assigneeContext, []*process.StateItem{state})
+		if err != nil {
+			return
+		}
+		step.Processors, err = s.processors(state)
+		if err != nil {
+			return
+		}
+		if len(step.Processors) == 0 {
+			return fmt.Errorf("节点《%v》未找到对应的处理人", node.Label)
+		}
+		if node.IsCounterSign {
+			step.Remarks = "会签节点，模拟时任意处理人处理即视为全部处理完成"
+		}
+		s.active = append(s.active, &process.StateItem{Id: node.Id, Label: node.Label})
+	case process.NodeScriptTask, process.NodeSubProcess, process.NodeTimer:
+		// 无需人工处理的节点，只有一个流转时自动流转，否则等待指定流转
+		s.active = append(s.active, &process.StateItem{Id: node.Id, Label: node.Label})
+		if node.Clazz == process.NodeScriptTask && node.Script != nil {
+			step.Remarks = "阻塞任务节点，模拟时不执行脚本，同意为执行成功，拒绝为执行失败"
+			return
+		}
+		if len(sourceEdges) == 1 {
+			step.Remarks = "自动流转"
+			return s.leave(node.Id, sourceEdges[0], "")
+		}
+		step.Remarks = "需要指定流转"
+	case process.GatewayExclusive:
+		var activeEdge *process.Edge
+		activeEdge, err = s.h.ExclusiveEdge(sourceEdges)
+		if err != nil {
+			return
+		}
+		step.Edge = activeEdge.Id
+		return s.follow(activeEdge)
+	case process.GatewayParallel, process.GatewayInclusive:
+		targetEdges := s.h.processState.Structure.TargetEdges(node.Id)
+		if len(sourceEdges) > 1 && len(targetEdges) == 1 {
+			// 入口
+			activeEdges := sourceEdges
+			if node.Clazz == process.GatewayInclusive {
+				activeEdges, err = s.h.InclusiveEdges(sourceEdges)
+				if err != nil {
+					return
+				}
+			}
+			s.forking += len(activeEdges)
+			for _, edge := range activeEdges {
+				s.forking--
+				err = s.follow(edge)
+				if err != nil {
+					return
+				}
+			}
+		} else if len(sourceEdges) == 1 && len(targetEdges) > 1 {
+			// 出口，其他分支均已到达后继续流转
+			if !s.branchesDone() {
+				s.waiting[node.Id] = true
+				step.Remarks = "等待其他分支完成"
+				return
+			}
+			delete(s.waiting, node.Id)
+			return s.follow(sourceEdges[0])
+		} else {
+			return fmt.Errorf("网关《%v》的流转不正确", node.Label)
+		}
+	case process.NodeEnd:
+		s.active = nil
+		s.waiting = make(map[string]bool)
+		s.forking = 0
+		s.result.IsEnd = true
+	}
+	return
+}
+
+// 沿流转进入下一个节点
+func (s *simulator) follow(edge *process.Edge) (err error) {
+	target, err := s.h.processState.GetNode(edge.Target)
+	if err != nil {
+		return
+	}
+	return s.enter(target, edge.Id)
+}
+
+// 离开节点，所有分支均到达聚合网关后继续流转
+func (s *simulator) leave(nodeId string, edge *process.Edge, action string) (err error) {
+	for i, state := range s.active {
+		if state.Id == nodeId {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+	if action != "" {
+		node, _ := s.h.processState.GetNode(nodeId)
+		s.result.Path = append(s.result.Path, &SimulateStep{
+			Node:   node.Id,
+			Label:  node.Label,
+			Clazz:  node.Clazz,
+			Edge:   edge.Id,
+			Action: action,
+		})
+	}
+
+	err = s.follow(edge)
+	if err != nil {
+		return
+	}
+
+	// 最后一个分支到达后，等待中的聚合网关继续流转
+	for gatewayId := range s.waiting {
+		if !s.branchesDone() {
+			break
+		}
+		gateway, _ := s.h.processState.GetNode(gatewayId)
+		delete(s.waiting, gatewayId)
+		err = s.follow(s.h.processState.Structure.SourceEdges(gateway.Id)[0])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 所有分支均已到达聚合网关
+func (s *simulator) branchesDone() bool {
+	return len(s.active) == 0 && s.forking == 0
+}
+
+// 执行处理动作
+func (s *simulator) apply(action *SimulateAction) (err error) {
+	var (
+		state *process.StateItem
+		edge  *process.Edge
+	)
+
+	if len(s.active) == 0 {
+		return errors.New("没有等待处理的节点")
+	}
+	state = s.active[0]
+	if action.Node != "" {
+		state = process.GetStateItem(s.active, action.Node)
+		if state == nil {
+			return fmt.Errorf("节点 %v 当前无需处理", action.Node)
+		}
+	}
+	node, err := s.h.processState.GetNode(state.Id)
+	if err != nil {
+		return
+	}
+
+	sourceEdges := s.h.processState.Structure.SourceEdges(node.Id)
+	switch action.Action {
+	case SimulateApprove, SimulateDeny, SimulateEdge:
+	default:
+		return fmt.Errorf("不支持的处理动作 %v", action.Action)
+	}
+	if action.Edge != "" {
+		for _, e := range sourceEdges {
+			if e.Id == action.Edge {
+				edge = e
+				break
+			}
+		}
+		if edge == nil {
+			return fmt.Errorf("节点《%v》没有流转 %v", node.Label, action.Edge)
+		}
+	} else if node.Clazz == process.NodeSubProcess && node.SubProcess != nil && node.SubProcess.DeniedTarget != "" {
+		// 子流程节点按照子工单是否被拒绝选择流转
+		for _, e := range sourceEdges {
+			if (e.Target == node.SubProcess.DeniedTarget) == (action.Action == SimulateDeny) {
+				edge = e
+				break
+			}
+		}
+	} else if node.Clazz == process.NodeScriptTask && node.Script != nil {
+		// 阻塞任务节点执行失败时按照失败时节点的流转，执行成功时只有一个正常的流转才可以自动选择
+		var candidates []*process.Edge
+		for _, e := range sourceEdges {
+			if (e.Target == node.Script.ErrorTarget) == (action.Action == SimulateDeny) {
+				candidates = append(candidates, e)
+			}
+		}
+		if len(candidates) == 1 {
+			edge = candidates[0]
+		}
+	} else if len(sourceEdges) == 1 {
+		edge = sourceEdges[0]
+	}
+	if edge == nil {
+		return fmt.Errorf("节点《%v》有多个流转，请指定流转", node.Label)
+	}
+
+	return s.leave(node.Id, edge, action.Action)
+}
+
+// 节点处理人
+func (s *simulator) processors(state *process.StateItem) (processors []*SimulateProcessor, err error) {
+	var userList []system.SysUser
+
+	userList, err = GetPrincipalUserInfo([]*process.StateItem{state}, s.creator)
+	if err != nil {
+		return
+	}
+	processors = make([]*SimulateProcessor, 0, len(userList))
+	seen := make(map[int]struct{}, len(userList))
+	for _, user := range userList {
+		if _, ok := seen[user.UserId]; ok {
+			continue
+		}
+		seen[user.UserId] = struct{}{}
+		processors = append(processors, &SimulateProcessor{
+			UserId:   user.UserId,
+			NickName: user.NickName,
+		})
+	}
+	return
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/jsonTime"
+	"ferry/pkg/logger"
+	"ferry/pkg/notify"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 工单时效，计算截止时间并对即将超时及已超时的工单进行升级处理
+*/
+
+const slaCirculation = "工单超时"
+
+// 重新计算工单的截止时间，工单每次流转后调用
+// 节点时效从进入节点开始计算，流程时效从工单创建开始计算，取最早的截止时间；
+// 工单仍停留在原时效节点时（如会签未完成）保留原有的截止时间。
+func RefreshDueTime(tx *gorm.DB, workOrder *process.WorkOrderInfo, structure *process.Structure, stateList []*process.StateItem) (err error) {
+	var (
+		now      = time.Now()
+		dueTime  *time.Time
+		slaNode  string
+		isEnd    bool
+		deadline time.Time
+	)
+
+	for _, state := range stateList {
+		node := structure.GetNode(state.Id)
+		if node == nil {
+			continue
+		}
+		if node.Clazz == process.NodeEnd {
+			isEnd = true
+			break
+		}
+		if !node.Sla.Enabled() {
+			continue
+		}
+		deadline = node.Sla.Deadline(now)
+		if workOrder.SlaNode == node.Id && workOrder.DueTime != nil {
+			deadline = workOrder.DueTime.Time
+		}
+		if dueTime == nil || deadline.Before(*dueTime) {
+			dueTime = &deadline
+			slaNode = node.Id
+		}
+	}
+
+	if !isEnd && structure.Sla.Enabled() {
+		createdAt := workOrder.CreatedAt.Time
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		deadline = structure.Sla.Deadline(createdAt)
+		if dueTime == nil || deadline.Before(*dueTime) {
+			dueTime = &deadline
+			slaNode = ""
+		}
+	}
+
+	if isEnd {
+		dueTime = nil
+	}
+	if dueTime == nil {
+		slaNode = ""
+	}
+
+	// 截止时间及时效节点未变化时保留原有的时效状态，避免已升级的工单重复升级
+	if slaNode == workOrder.SlaNode && sameDueTime(workOrder.DueTime, dueTime) {
+		return
+	}
+
+	updateValue := map[string]interface{}{
+		"due_time":   nil,
+		"sla_node":   slaNode,
+		"sla_status": process.SlaStatusNormal,
+	}
+	if dueTime != nil {
+		updateValue["due_time"] = *dueTime
+	}
+
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", workOrder.Id).
+		Updates(updateValue).Error
+	if err != nil {
+		err = fmt.Errorf("更新工单截止时间失败，%v", err.Error())
+	}
+	return
+}
+
+// 截止时间是否相同，数据库中的时间精确到秒
+func sameDueTime(current *jsonTime.JSONTime, dueTime *time.Time) bool {
+	if current == nil || dueTime == nil {
+		return current == nil && dueTime == nil
+	}
+	return current.Time.Truncate(time.Second).Equal(dueTime.Truncate(time.Second))
+}
+
+// 待升级的工单时效
+type SlaEscalation struct {
+	WorkOrder *process.WorkOrderInfo
+	Sla       *process.Sla
+	Status    int // 升级后的时效状态
+}
+
+// 检查所有未结束工单的时效，返回时效状态需要升级的工单
+func SlaEscalations(db *gorm.DB) (escalationList []*SlaEscalation, err error) {
+	var (
+		workOrderList []process.WorkOrderInfo
+		structureMap  = make(map[[2]int]*process.Structure)
+		now           = time.Now()
+	)
+
+	err = db.Model(&process.WorkOrderInfo{}).
+		Where("is_end = 0 and due_time is not null and sla_status < ?", process.SlaStatusBreached).
+		Find(&workOrderList).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工单列表失败，%v", err.Error())
+	}
+
+	for i := range workOrderList {
+		workOrder := &workOrderList[i]
+
+		// 按照流程及工单绑定的版本缓存流程结构
+		structureKey := [2]int{workOrder.Process, workOrder.ProcessVersion}
+		structure, ok := structureMap[structureKey]
+		if !ok {
+			var processInfo process.Info
+			processInfo, err = WorkOrderProcess(db, workOrder)
+			if err == nil {
+				structure, err = process.ParseStructure(processInfo.Structure)
+			}
+			if err != nil {
+				logger.Errorf("工单 %v 的流程解析失败，%v", workOrder.Id, err.Error())
+				structure = nil
+			}
+			structureMap[structureKey] = structure
+		}
+		if structure == nil {
+			continue
+		}
+
+		sla := structure.Sla
+		if workOrder.SlaNode != "" {
+			node := structure.GetNode(workOrder.SlaNode)
+			if node == nil {
+				continue
+			}
+			sla = node.Sla
+		}
+		if !sla.Enabled() {
+			continue
+		}
+
+		status := sla.Status(workOrder.DueTime.Time, now)
+		if status <= workOrder.SlaStatus {
+			continue
+		}
+		escalationList = append(escalationList, &SlaEscalation{
+			WorkOrder: workOrder,
+			Sla:       sla,
+			Status:    status,
+		})
+	}
+
+	return escalationList, nil
+}
+
+// 在调用方的事务中更新时效状态并执行升级动作，升级失败时由调用方回滚，下次检查时重新升级
+func EscalateSla(tx *gorm.DB, escalation *SlaEscalation) (err error) {
+	workOrder := escalation.WorkOrder
+
+	// 仅更新状态未被修改且未结束的工单，避免多个实例重复升级
+	result := tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ? and sla_status = ? and is_end = 0", workOrder.Id, workOrder.SlaStatus).
+		Update("sla_status", escalation.Status)
+	if result.Error != nil {
+		return fmt.Errorf("更新时效状态失败，%v", result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	return escalateSla(tx, workOrder, escalation.Sla, escalation.Status)
+}
+
+// 执行时效升级动作，即将超时仅通知处理人，已超时按照配置的动作处理
+func escalateSla(tx *gorm.DB, workOrder *process.WorkOrderInfo, sla *process.Sla, status int) (err error) {
+	var (
+		stateList      []*process.StateItem
+		slaStateList   []*process.StateItem
+		processorList  []system.SysUser
+		leaderList     []system.SysUser
+		deptIdList     []int
+		leaderIdList   []int
+		actions        = sla.Actions
+		subject        = "您有一条工单即将超时，请及时处理"
+		description    = "您有一条工单即将超时，请及时处理，工单描述如下"
+		leaderSubject  = "您的部门有一条工单已超时，请关注"
+		leaderDescribe = "您的部门有一条工单已超时，请关注，工单描述如下"
+	)
+
+	stateList, err = process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+
+	// 节点时效仅处理对应节点，流程时效处理当前所有节点
+	for _, state := range stateList {
+		if workOrder.SlaNode == "" || state.Id == workOrder.SlaNode {
+			slaStateList = append(slaStateList, state)
+		}
+	}
+	if len(slaStateList) == 0 {
+		return
+	}
+
+	processorList, err = GetPrincipalUserInfo(slaStateList, workOrder.Creator)
+	if err != nil {
+		return
+	}
+
+	if status == process.SlaStatusAtRisk {
+		return sendSlaNotify(tx, workOrder, processorList, subject, description)
+	}
+
+	// 已超时
+	subject = "您有一条工单已超时，请尽快处理"
+	description = "您有一条工单已超时，请尽快处理，工单描述如下"
+	if len(actions) == 0 {
+		actions = []string{process.SlaActionNotifyProcessor}
+	}
+
+	err = tx.Create(&process.CirculationHistory{
+		Title:       workOrder.Title,
+		WorkOrder:   workOrder.Id,
+		State:       slaStateList[0].Label,
+		Circulation: slaCirculation,
+		Processor:   "系统",
+		Remarks:     fmt.Sprintf("工单已超过截止时间 %v", workOrder.DueTime.Format("2006-01-02 15:04:05")),
+		Status:      2, // 其他
+	}).Error
+	if err != nil {
+		return
+	}
+
+	for _, action := range actions {
+		switch action {
+		case process.SlaActionNotifyProcessor:
+			err = sendSlaNotify(tx, workOrder, processorList, subject, description)
+		case process.SlaActionNotifyLeader:
+			for _, processor := range processorList {
+				if processor.DeptId != 0 {
+					deptIdList = append(deptIdList, processor.DeptId)
+				}
+			}
+			if len(deptIdList) == 0 {
+				continue
+			}
+			err = tx.Model(&system.Dept{}).
+				Where("dept_id in (?) and leader != 0", deptIdList).
+				Pluck("leader", &leaderIdList).Error
+			if err != nil {
+				return
+			}
+			if len(leaderIdList) == 0 {
+				continue
+			}
+			err = tx.Model(&system.SysUser{}).
+				Where("user_id in (?)", leaderIdList).
+				Find(&leaderList).Error
+			if err != nil {
+				return
+			}
+			err = sendSlaNotify(tx, workOrder, leaderList, leaderSubject, leaderDescribe)
+		case process.SlaActionReassign:
+			for _, state := range slaStateList {
+				err = inversionWorkOrder(tx, nil, &InversionCommand{
+					WorkOrderId: workOrder.Id,
+					NodeId:      state.Id,
+					UserId:      sla.ReassignTo,
+					Remarks:     "工单已超时，系统自动转交处理人",
+				})
+				if err != nil {
+					return
+				}
+			}
+			err = sendTransferNotify(tx, workOrder.Id)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// 发送时效通知，流程未配置通知方式时默认使用邮件通知
+func sendSlaNotify(tx *gorm.DB, workOrder *process.WorkOrderInfo, userList []system.SysUser, subject string, description string) (err error) {
+	var (
+		creatorInfo system.SysUser
+		noticeList  []*notify.Channel
+	)
+
+	if len(userList) == 0 {
+		return
+	}
+
+	noticeList, err = GetNoticeChannels(workOrder.Process)
+	if err != nil {
+		return
+	}
+
+	err = tx.Model(&system.SysUser{}).
+		Where("user_id = ?", workOrder.Creator).
+		Find(&creatorInfo).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return
+	}
+
+	bodyData := notify.BodyData{
+		SendTo: map[string]interface{}{
+			"userList": userList,
+		},
+		Subject:     subject,
+		Description: description,
+		Channels:    noticeList,
+		Event:       notify.EventUrged,
+		ProcessId:   workOrder.Process,
+		Id:          workOrder.Id,
+		Title:       workOrder.Title,
+		Creator:     creatorInfo.NickName,
+		Priority:    workOrder.Priority,
+		CreatedAt:   workOrder.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	return notify.Enqueue(tx, &bodyData)
+}
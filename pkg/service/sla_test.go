@@ -0,0 +1,165 @@
+package service
+
+import (
+	"ferry/models/process"
+	"ferry/pkg/testdb"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 开始 -> 审批(用户 2，时效 60 分钟，超时转交用户 3) -> 结束
+var slaStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "approve", "label": "审批", "clazz": process.NodeUserTask, "sort": 2, "assignType": process.AssignPerson, "assignValue": []int{2},
+			"sla": map[string]interface{}{"duration": 60, "actions": []string{process.SlaActionReassign}, "reassignTo": 3}},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 3},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "approve"},
+		{"id": "e2", "source": "approve", "target": "end"},
+	},
+}
+
+// 创建停留在审批节点且已超时的工单
+func newBreachedWorkOrder(t *testing.T, values map[string]interface{}) (db *gorm.DB, workOrder process.WorkOrderInfo, structure *process.Structure) {
+	db = testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, slaStructure)
+	structure, err := process.ParseStructure(processInfo.Structure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workOrder = testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{{
+		Id:            "approve",
+		Label:         "审批",
+		Processor:     []int{2},
+		ProcessMethod: process.AssignPerson,
+	}})
+
+	updateValue := map[string]interface{}{
+		"due_time":   time.Now().Add(-time.Minute),
+		"sla_node":   "approve",
+		"sla_status": process.SlaStatusNormal,
+	}
+	for k, v := range values {
+		updateValue[k] = v
+	}
+	err = db.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrder.Id).Updates(updateValue).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	workOrder = testdb.GetWorkOrder(t, db, workOrder.Id)
+	return
+}
+
+// 工单仍停留在时效节点时保留已升级的时效状态，离开时效节点后重置
+func TestRefreshDueTimeKeepsSlaStatus(t *testing.T) {
+	db, workOrder, structure := newBreachedWorkOrder(t, map[string]interface{}{
+		"sla_status": process.SlaStatusBreached,
+	})
+
+	stateList, err := process.ParseState(workOrder.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RefreshDueTime(db, &workOrder, structure, stateList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.SlaStatus != process.SlaStatusBreached || result.SlaNode != "approve" {
+		t.Errorf("截止时间未变化时不应重置时效状态，时效节点 %q，时效状态 %v", result.SlaNode, result.SlaStatus)
+	}
+
+	err = RefreshDueTime(db, &workOrder, structure, []*process.StateItem{{Id: "end", Label: "结束"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.SlaStatus != process.SlaStatusNormal || result.SlaNode != "" || result.DueTime != nil {
+		t.Errorf("工单结束后应清空时效，时效节点 %q，时效状态 %v", result.SlaNode, result.SlaStatus)
+	}
+}
+
+// 检查工单时效，每个工单的升级在单独的事务中执行
+func checkSla(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	escalationList, err := SlaEscalations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, escalation := range escalationList {
+		tx := db.Begin()
+		err = EscalateSla(tx, escalation)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("工单 %v 的时效升级失败，%v", escalation.WorkOrder.Id, err)
+		}
+		tx.Commit()
+	}
+}
+
+// 超时后自动转交处理人，时效状态、超时历史及转交历史在同一事务中写入
+func TestCheckSlaReassign(t *testing.T) {
+	db, workOrder, _ := newBreachedWorkOrder(t, nil)
+
+	checkSla(t, db)
+
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.SlaStatus != process.SlaStatusBreached {
+		t.Errorf("期望时效状态为已超时，实际为 %v", result.SlaStatus)
+	}
+	stateList, err := process.ParseState(result.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stateList) != 1 || len(stateList[0].Processor) != 1 || stateList[0].Processor[0] != 3 {
+		t.Errorf("期望转交给用户 3，实际节点为 %s", result.State)
+	}
+	historyList := testdb.Histories(t, db, workOrder.Id)
+	if len(historyList) != 2 || historyList[0].Circulation != slaCirculation || historyList[1].Circulation != "转交工单" {
+		t.Errorf("期望超时及转交历史各一条，实际为 %+v", historyList)
+	}
+
+	// 已升级的工单不再重复升级
+	checkSla(t, db)
+	if historyList = testdb.Histories(t, db, workOrder.Id); len(historyList) != 2 {
+		t.Errorf("工单被重复升级，流转历史 %v 条", len(historyList))
+	}
+}
+
+// 已结束的工单不执行升级动作
+func TestCheckSlaSkipsEndedWorkOrder(t *testing.T) {
+	db, workOrder, _ := newBreachedWorkOrder(t, nil)
+
+	sla := &process.Sla{Duration: 60, Actions: []string{process.SlaActionReassign}, ReassignTo: 3}
+	err := db.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrder.Id).Update("is_end", 1).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟检查时工单尚未结束，升级前工单已被处理结束
+	tx := db.Begin()
+	err = EscalateSla(tx, &SlaEscalation{WorkOrder: &workOrder, Sla: sla, Status: process.SlaStatusBreached})
+	tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.SlaStatus != process.SlaStatusNormal || result.Version != workOrder.Version {
+		t.Errorf("已结束的工单被修改，时效状态 %v，版本 %v", result.SlaStatus, result.Version)
+	}
+	if historyList := testdb.Histories(t, db, workOrder.Id); len(historyList) != 0 {
+		t.Errorf("期望没有流转历史，实际为 %v 条", len(historyList))
+	}
+
+	tx = db.Begin()
+	err = InversionWorkOrder(tx, nil, &InversionCommand{WorkOrderId: workOrder.Id, NodeId: "approve", UserId: 3})
+	tx.Rollback()
+	if err == nil {
+		t.Error("已结束的工单不应允许转交")
+	}
+}
@@ -0,0 +1,478 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/notify"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 子流程节点，进入节点时创建子工单，所有子工单结束后父工单继续流转
+*/
+
+// 本次流转进入子流程节点时创建子工单
+func (h *Handle) startSubProcesses() (err error) {
+	if !h.circulated {
+		return
+	}
+	return startSubProcesses(h.tx, &h.workOrderDetails, h.processState, h.stateList, h.enteredStates())
+}
+
+// 为新进入的子流程节点创建子工单，子工单ID记录在父工单对应的节点中
+func startSubProcesses(tx *gorm.DB, workOrder *process.WorkOrderInfo, processState *ProcessState, stateList []*process.StateItem, entered []*process.StateItem) (err error) {
+	var (
+		node       *process.Node
+		childId    int
+		formData   map[string]interface{}
+		stateValue []byte
+		started    []string
+	)
+
+	for _, state := range entered {
+		node, err = processState.GetNode(state.Id)
+		if err != nil {
+			return
+		}
+		if node.Clazz != process.NodeSubProcess || node.SubProcess == nil {
+			continue
+		}
+
+		if formData == nil {
+			formData, _, err = WorkOrderForm(tx, workOrder.Id)
+			if err != nil {
+				return
+			}
+		}
+
+		state.Children = make([]int, 0, len(node.SubProcess.Items))
+		for _, item := range node.SubProcess.Items {
+			childId, err = createSubWorkOrder(tx, workOrder, node, item, formData)
+			if err != nil {
+				return fmt.Errorf("创建子工单失败，%v", err.Error())
+			}
+			state.Children = append(state.Children, childId)
+		}
+		started = append(started, state.Id)
+	}
+	if len(started) == 0 {
+		return
+	}
+
+	stateValue, err = json.Marshal(stateList)
+	if err != nil {
+		return
+	}
+	err = UpdateWorkOrder(tx, workOrder, map[string]interface{}{
+		"state": stateValue,
+	})
+	if err != nil {
+		return
+	}
+	workOrder.State = stateValue
+
+	// 子工单创建后即已结束时，父工单直接继续流转
+	for _, nodeId := range started {
+		err = completeSubProcess(tx, workOrder.Id, nodeId)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 创建子工单，表单数据按照字段映射从父工单复制，并从子流程的开始节点开始流转
+func createSubWorkOrder(tx *gorm.DB, parent *process.WorkOrderInfo, node *process.Node, item *process.SubProcessItem, parentForm map[string]interface{}) (childId int, err error) {
+	var (
+		processInfo   process.Info
+		processState  *ProcessState
+		tplIdList     []int
+		tplList       []*process.TplInfo
+		creatorInfo   system.SysUser
+		stateValue    []byte
+		relatedPerson []byte
+		formData      []byte
+		noticeList    []*notify.Channel
+		bodyData      *notify.BodyData
+		h             *Handle
+	)
+
+	processInfo, err = LatestProcess(tx, item.Process)
+	if err != nil {
+		return 0, fmt.Errorf("查询子流程 %v 失败，%v", item.Process, err.Error())
+	}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	startNode := processState.Structure.StartNode()
+	if startNode == nil {
+		return 0, fmt.Errorf("子流程《%v》未定义开始节点", processInfo.Name)
+	}
+	sourceEdges := processState.Structure.SourceEdges(startNode.Id)
+	if len(sourceEdges) == 0 {
+		return 0, fmt.Errorf("子流程《%v》的开始节点没有流转", processInfo.Name)
+	}
+
+	err = tx.Model(&system.SysUser{}).
+		Where("user_id = ?", parent.Creator).
+		Find(&creatorInfo).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return 0, fmt.Errorf("查询工单创建人信息失败，%v", err.Error())
+	}
+
+	stateValue, err = json.Marshal([]*process.StateItem{{
+		Id:            startNode.Id,
+		Label:         startNode.Label,
+		Processor:     []int{parent.Creator},
+		ProcessMethod: process.AssignPerson,
+	}})
+	if err != nil {
+		return
+	}
+	relatedPerson, err = json.Marshal([]int{parent.Creator})
+	if err != nil {
+		return
+	}
+
+	child := process.WorkOrderInfo{
+		Title:          item.Title,
+		Priority:       parent.Priority,
+		Process:        processInfo.Id,
+		ProcessVersion: processInfo.Version,
+		Classify:       processInfo.Classify,
+		State:          stateValue,
+		RelatedPerson:  relatedPerson,
+		Creator:        parent.Creator,
+		ParentId:       parent.Id,
+		ParentNode:     node.Id,
+	}
+	if child.Title == "" {
+		child.Title = parent.Title
+	}
+	err = tx.Create(&child).Error
+	if err != nil {
+		return
+	}
+
+	// 按照子流程绑定的模版创建表单数据
+	if len(processInfo.Tpls) > 0 {
+		err = json.Unmarshal(processInfo.Tpls, &tplIdList)
+		if err != nil {
+			return 0, fmt.Errorf("子流程模版格式不正确，%v", err.Error())
+		}
+	}
+	if len(tplIdList) > 0 {
+		err = tx.Model(&process.TplInfo{}).
+			Where("id in (?)", tplIdList).
+			Find(&tplList).Error
+		if err != nil {
+			return 0, fmt.Errorf("查询子流程模版失败，%v", err.Error())
+		}
+	}
+	for _, tpl := range tplList {
+		formData, err = json.Marshal(subProcessFormData(tpl.FormStructure, item.Mapping, parentForm))
+		if err != nil {
+			return
+		}
+		err = tx.Create(&process.TplData{
+			WorkOrder:     child.Id,
+			FormStructure: tpl.FormStructure,
+			FormData:      formData,
+		}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	// 从开始节点流转到第一个节点
+	h, err = newSystemHandle(tx, &child, processState, startNode)
+	if err != nil {
+		return
+	}
+	h.targetStateValue, err = processState.GetNode(sourceEdges[0].Target)
+	if err != nil {
+		return
+	}
+	err = h.jump()
+	if err != nil {
+		return
+	}
+
+	err = tx.Create(&process.CirculationHistory{
+		Title:       child.Title,
+		WorkOrder:   child.Id,
+		State:       startNode.Label,
+		Source:      startNode.Id,
+		Target:      h.targetStateValue.Id,
+		Circulation: "新建",
+		Processor:   creatorInfo.NickName,
+		ProcessorId: parent.Creator,
+		Status:      2, // 其他
+		Remarks:     fmt.Sprintf("由工单 %v 的子流程节点《%v》创建", parent.Id, node.Label),
+	}).Error
+	if err != nil {
+		return
+	}
+
+	err = tx.Model(&process.Info{}).
+		Where("id = ?", processInfo.Id).
+		Update("submit_count", gorm.Expr("submit_count + 1")).Error
+	if err != nil {
+		return
+	}
+
+	// 通知子工单的处理人
+	noticeList, err = notify.ParseNotice(processInfo.Notice)
+	if err != nil {
+		return
+	}
+	if len(noticeList) > 0 {
+		bodyData, err = WorkOrderNotifyData(tx, child.Id)
+		if err != nil {
+			return
+		}
+		err = fillNotifyForm(tx, bodyData)
+		if err != nil {
+			return
+		}
+		bodyData.Subject = "您有一条待办工单，请及时处理"
+		bodyData.Description = "您有一条待办工单请及时处理，工单描述如下"
+		bodyData.Channels = noticeList
+		bodyData.Event = notify.EventCreated
+		err = notify.Enqueue(tx, bodyData)
+		if err != nil {
+			return
+		}
+	}
+
+	// 子流程中嵌套的子流程
+	err = h.startSubProcesses()
+	if err != nil {
+		return
+	}
+	return child.Id, nil
+}
+
+// 按照字段映射生成子工单模版的表单数据
+func subProcessFormData(formStructure json.RawMessage, mapping map[string]string, parentForm map[string]interface{}) map[string]interface{} {
+	var structure struct {
+		List []struct {
+			Key   string `json:"key"`
+			Model string `json:"model"`
+		} `json:"list"`
+	}
+
+	formData := make(map[string]interface{})
+	if len(formStructure) == 0 || json.Unmarshal(formStructure, &structure) != nil {
+		return formData
+	}
+	for _, field := range structure.List {
+		model := field.Model
+		if model == "" {
+			model = "input_" + field.Key
+		}
+		parentKey, ok := mapping[model]
+		if !ok {
+			continue
+		}
+		if value, ok := parentForm[parentKey]; ok {
+			formData[model] = value
+		}
+	}
+	return formData
+}
+
+// 父子工单的概要信息
+type SubProcessWorkOrder struct {
+	Id          int    `json:"id"`
+	Title       string `json:"title"`
+	Process     int    `json:"process"`
+	ProcessName string `json:"process_name"`
+	ParentNode  string `json:"parent_node"`
+	IsEnd       int    `json:"is_end"`
+	IsWithdrawn int    `json:"is_withdrawn"`
+}
+
+// 查询工单的父工单及子工单，没有父工单时 parent 为 nil
+func SubProcessRelations(workOrder *process.WorkOrderInfo) (parent *SubProcessWorkOrder, children []*SubProcessWorkOrder, err error) {
+	selectList := `p_work_order_info.id,
+		p_work_order_info.title,
+		p_work_order_info.process,
+		p_process_info.name as process_name,
+		p_work_order_info.parent_node,
+		p_work_order_info.is_end,
+		p_work_order_info.is_withdrawn`
+	db := orm.Eloquent.Model(&process.WorkOrderInfo{}).
+		Select(selectList).
+		Joins("left join p_process_info on p_process_info.id = p_work_order_info.process")
+
+	if workOrder.ParentId != 0 {
+		var parentList []*SubProcessWorkOrder
+		err = db.Where("p_work_order_info.id = ?", workOrder.ParentId).
+			Scan(&parentList).Error
+		if err != nil {
+			return nil, nil, fmt.Errorf("查询父工单失败，%v", err.Error())
+		}
+		if len(parentList) > 0 {
+			parent = parentList[0]
+		}
+	}
+
+	children = make([]*SubProcessWorkOrder, 0)
+	err = db.Where("p_work_order_info.parent_id = ?", workOrder.Id).
+		Order("p_work_order_info.id").
+		Scan(&children).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询子工单失败，%v", err.Error())
+	}
+	return
+}
+
+// 子工单结束后，检查父工单子流程节点的子工单是否全部结束
+func CompleteSubWorkOrder(tx *gorm.DB, workOrder *process.WorkOrderInfo) (err error) {
+	if workOrder.ParentId == 0 {
+		return
+	}
+	return completeSubProcess(tx, workOrder.ParentId, workOrder.ParentNode)
+}
+
+// 子流程节点的子工单全部结束后父工单继续流转，任意子工单被拒绝时流转到拒绝时的节点
+func completeSubProcess(tx *gorm.DB, parentId int, nodeId string) (err error) {
+	var (
+		parent       process.WorkOrderInfo
+		processInfo  process.Info
+		processState *ProcessState
+		stateList    []*process.StateItem
+		children     []*process.WorkOrderInfo
+		target       *process.Edge
+		denied       bool
+		h            *Handle
+	)
+
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", parentId).
+		Find(&parent).Error
+	if err != nil {
+		return fmt.Errorf("查询父工单失败，%v", err.Error())
+	}
+	if parent.IsEnd == 1 {
+		return
+	}
+
+	stateList, err = process.ParseState(parent.State)
+	if err != nil {
+		return
+	}
+	state := process.GetStateItem(stateList, nodeId)
+	if state == nil || len(state.Children) == 0 {
+		return
+	}
+
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id in (?)", state.Children).
+		Find(&children).Error
+	if err != nil {
+		return fmt.Errorf("查询子工单失败，%v", err.Error())
+	}
+	for _, child := range children {
+		if child.IsEnd != 1 {
+			return
+		}
+		var childDenied bool
+		childDenied, err = subWorkOrderDenied(tx, child)
+		if err != nil {
+			return
+		}
+		denied = denied || childDenied
+	}
+
+	processInfo, err = WorkOrderProcess(tx, &parent)
+	if err != nil {
+		return
+	}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	node, err := processState.GetNode(nodeId)
+	if err != nil {
+		return
+	}
+
+	// 选择流转，被拒绝且配置了拒绝时的节点时流转到该节点
+	deniedTarget := ""
+	if node.SubProcess != nil {
+		deniedTarget = node.SubProcess.DeniedTarget
+	}
+	useDenied := denied && deniedTarget != ""
+	for _, edge := range processState.Structure.SourceEdges(nodeId) {
+		if (edge.Target == deniedTarget) == useDenied {
+			target = edge
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("子流程节点 %v 未配置流转", node.Label)
+	}
+
+	h, err = newSystemHandle(tx, &parent, processState, node)
+	if err != nil {
+		return
+	}
+	if denied {
+		h.flowProperties = 0
+	}
+	h.targetStateValue, err = processState.GetNode(target.Target)
+	if err != nil {
+		return
+	}
+	err = h.jump()
+	if err != nil {
+		return
+	}
+
+	history := process.CirculationHistory{
+		Title:       parent.Title,
+		WorkOrder:   parent.Id,
+		State:       node.Label,
+		Source:      node.Id,
+		Target:      h.targetStateValue.Id,
+		Circulation: "子流程完成",
+		Processor:   systemProcessor,
+		Status:      1, // 同意
+		Remarks:     fmt.Sprintf("子工单 %v 已全部结束", state.Children),
+	}
+	if denied {
+		history.Circulation = "子流程被拒绝"
+		history.Status = 0 // 拒绝
+	}
+	err = tx.Create(&history).Error
+	if err != nil {
+		return
+	}
+	return h.systemCirculated(processInfo.Notice)
+}
+
+// 子工单是否被拒绝，撤回的工单以及最后一次处理为拒绝的工单视为被拒绝
+func subWorkOrderDenied(tx *gorm.DB, child *process.WorkOrderInfo) (denied bool, err error) {
+	var historyList []process.CirculationHistory
+
+	if child.IsWithdrawn == 1 {
+		return true, nil
+	}
+	err = tx.Model(&process.CirculationHistory{}).
+		Where("work_order = ? and source != '' and status in (?)", child.Id, []int{0, 1}).
+		Order("id desc").
+		Limit(1).
+		Find(&historyList).Error
+	if err != nil {
+		return false, fmt.Errorf("查询子工单流转历史失败，%v", err.Error())
+	}
+	return len(historyList) > 0 && historyList[0].Status == 0, nil
+}
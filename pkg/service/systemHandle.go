@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/notify"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 系统自动流转工单，用于子流程、定时节点等无需人工处理的节点
+*/
+
+const systemProcessor = "系统"
+
+// 系统自动流转工单时使用的处理对象
+func newSystemHandle(tx *gorm.DB, workOrder *process.WorkOrderInfo, processState *ProcessState, node *process.Node) (h *Handle, err error) {
+	h = &Handle{
+		workOrderId:      workOrder.Id,
+		workOrderDetails: *workOrder,
+		processState:     processState,
+		stateValue:       node,
+		relatedPerson:    workOrder.RelatedPerson,
+		flowProperties:   1,
+		endHistory:       true,
+		tx:               tx,
+	}
+
+	err = tx.Model(&process.TplData{}).
+		Where("work_order = ?", workOrder.Id).
+		Pluck("form_data", &h.WorkOrderData).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工单表单数据失败，%v", err.Error())
+	}
+
+	err = tx.Model(&process.CirculationHistory{}).
+		Where("work_order = ?", workOrder.Id).
+		Order("id desc").
+		Find(&h.cirHistoryList).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询流转历史失败，%v", err.Error())
+	}
+	return
+}
+
+// 系统流转完成后的处理，通知新节点的处理人或创建人，工单结束时检查父工单，进入子流程节点时创建子工单
+func (h *Handle) systemCirculated(notice json.RawMessage) (err error) {
+	var (
+		noticeList     []*notify.Channel
+		bodyData       *notify.BodyData
+		sendToUserList []system.SysUser
+	)
+
+	if !h.circulated {
+		return
+	}
+
+	noticeList, err = notify.ParseNotice(notice)
+	if err != nil {
+		return
+	}
+	if len(noticeList) > 0 {
+		bodyData, err = WorkOrderNotifyData(h.tx, h.workOrderId)
+		if err != nil {
+			return
+		}
+		err = fillNotifyForm(h.tx, bodyData)
+		if err != nil {
+			return
+		}
+		bodyData.Channels = noticeList
+	}
+
+	if h.targetStateValue.Clazz == process.NodeEnd {
+		err = h.tx.Create(&process.CirculationHistory{
+			Title:       h.workOrderDetails.Title,
+			WorkOrder:   h.workOrderId,
+			State:       h.targetStateValue.Label,
+			Source:      h.targetStateValue.Id,
+			Processor:   systemProcessor,
+			Circulation: "工单结束",
+			Remarks:     "工单已结束",
+			Status:      2, // 其他
+		}).Error
+		if err != nil {
+			return
+		}
+
+		// 通知创建人
+		if bodyData != nil {
+			err = h.tx.Model(&system.SysUser{}).
+				Where("user_id = ?", h.workOrderDetails.Creator).
+				Find(&sendToUserList).Error
+			if err != nil {
+				return
+			}
+			bodyData.SendTo = map[string]interface{}{
+				"userList": sendToUserList,
+			}
+			bodyData.Subject = "您的工单已处理完成"
+			bodyData.Description = "您的工单已处理完成，工单描述如下"
+			bodyData.Event = notify.EventEnded
+			err = notify.Enqueue(h.tx, bodyData)
+			if err != nil {
+				return
+			}
+		}
+
+		// 工单为子工单时检查父工单是否可以继续流转
+		return CompleteSubWorkOrder(h.tx, &h.workOrderDetails)
+	}
+
+	// 通知新进入节点的处理人
+	if bodyData != nil {
+		sendToUserList, err = GetPrincipalUserInfo(h.newStateItems(), h.workOrderDetails.Creator)
+		if err != nil {
+			return
+		}
+		bodyData.SendTo = map[string]interface{}{
+			"userList": sendToUserList,
+		}
+		bodyData.Subject = "您有一条待办工单，请及时处理"
+		bodyData.Description = "您有一条待办工单请及时处理，工单描述如下"
+		bodyData.Event = notify.EventAssigned
+		if h.flowProperties == 0 {
+			bodyData.Event = notify.EventDenied
+		}
+		err = notify.Enqueue(h.tx, bodyData)
+		if err != nil {
+			return
+		}
+	}
+
+	return h.startSubProcesses()
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"encoding/json"
+	"ferry/models/process"
 	"ferry/pkg/task"
 	"fmt"
 	"strings"
@@ -22,3 +24,31 @@ func ExecTask(taskList []string, params string) {
 		}
 	}
 }
+
+// 工单提交后异步执行任务，任务参数为工单信息及表单数据
+func ExecWorkOrderTasks(taskList []string, workOrder *process.WorkOrderInfo, formData []interface{}) (err error) {
+	var (
+		params      []byte
+		paramsValue struct {
+			Id       int           `json:"id"`
+			Title    string        `json:"title"`
+			Priority int           `json:"priority"`
+			FormData []interface{} `json:"form_data"`
+		}
+	)
+
+	if len(taskList) == 0 {
+		return
+	}
+	paramsValue.Id = workOrder.Id
+	paramsValue.Title = workOrder.Title
+	paramsValue.Priority = workOrder.Priority
+	paramsValue.FormData = formData
+	params, err = json.Marshal(paramsValue)
+	if err != nil {
+		return
+	}
+
+	go ExecTask(taskList, string(params))
+	return
+}
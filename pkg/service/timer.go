@@ -0,0 +1,197 @@
+package service
+
+import (
+	"ferry/models/process"
+	"ferry/pkg/jsonTime"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 定时节点，进入节点时写入定时任务，由后台任务到期后自动流转工单
+*/
+
+const (
+	timerBatchSize   = 100
+	timerMaxAttempts = 5
+)
+
+// 为新进入的定时节点写入定时任务，同一节点未触发的定时任务会被取消
+func ScheduleTimers(tx *gorm.DB, workOrder *process.WorkOrderInfo, processState *ProcessState, entered []*process.StateItem) (err error) {
+	var (
+		now      = time.Now()
+		formData map[string]interface{}
+		fireTime time.Time
+	)
+
+	for _, state := range entered {
+		node := processState.Structure.GetNode(state.Id)
+		if node == nil || node.Clazz != process.NodeTimer || node.Timer == nil {
+			continue
+		}
+
+		if formData == nil && node.Timer.Field != "" {
+			formData, _, err = WorkOrderForm(tx, workOrder.Id)
+			if err != nil {
+				return
+			}
+		}
+		fireTime, err = node.Timer.FireTime(now, formData)
+		if err != nil {
+			return fmt.Errorf("定时节点 %v 计算触发时间失败，%v", node.Label, err.Error())
+		}
+
+		err = tx.Model(&process.WorkOrderTimer{}).
+			Where("work_order = ? and node = ? and status = ?", workOrder.Id, node.Id, process.TimerStatusPending).
+			Update("status", process.TimerStatusCancelled).Error
+		if err != nil {
+			return fmt.Errorf("取消定时任务失败，%v", err.Error())
+		}
+
+		err = tx.Create(&process.WorkOrderTimer{
+			WorkOrder: workOrder.Id,
+			Node:      node.Id,
+			FireTime:  jsonTime.JSONTime{Time: fireTime},
+			Status:    process.TimerStatusPending,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("写入定时任务失败，%v", err.Error())
+		}
+	}
+	return
+}
+
+// 到期的定时任务，服务停止期间到期的任务在重启后触发
+func DueTimers(db *gorm.DB) (timerList []*process.WorkOrderTimer, err error) {
+	err = db.Model(&process.WorkOrderTimer{}).
+		Where("status = ? and fire_time <= ?", process.TimerStatusPending, time.Now()).
+		Order("fire_time").
+		Limit(timerBatchSize).
+		Find(&timerList).Error
+	if err != nil {
+		err = fmt.Errorf("查询定时任务失败，%v", err.Error())
+	}
+	return
+}
+
+// 触发单个定时任务，任务状态与工单流转在调用方的同一事务中提交
+func FireTimer(tx *gorm.DB, timer *process.WorkOrderTimer) (err error) {
+	// 仅触发未被其他实例领取的定时任务
+	result := tx.Model(&process.WorkOrderTimer{}).
+		Where("id = ? and status = ?", timer.Id, process.TimerStatusPending).
+		Updates(map[string]interface{}{
+			"status":     process.TimerStatusFired,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": "",
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	return advanceTimer(tx, timer)
+}
+
+// 定时任务触发失败且事务回滚后按次数推迟重试，超过最大次数后标记为失败
+func RetryTimer(db *gorm.DB, timer *process.WorkOrderTimer, cause error) error {
+	maxAttempts := viper.GetInt("settings.timer.maxattempts")
+	if maxAttempts <= 0 {
+		maxAttempts = timerMaxAttempts
+	}
+	attempts := timer.Attempts + 1
+	updateValue := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": cause.Error(),
+		"fire_time":  time.Now().Add(time.Duration(attempts) * time.Minute),
+	}
+	if attempts >= maxAttempts {
+		updateValue["status"] = process.TimerStatusFailed
+	}
+	return db.Model(&process.WorkOrderTimer{}).
+		Where("id = ? and status = ?", timer.Id, process.TimerStatusPending).
+		Updates(updateValue).Error
+}
+
+// 定时任务到期后工单从定时节点流转到下一节点，工单已结束或已离开定时节点时取消任务
+func advanceTimer(tx *gorm.DB, timer *process.WorkOrderTimer) (err error) {
+	var (
+		workOrder    process.WorkOrderInfo
+		processInfo  process.Info
+		processState *ProcessState
+		stateList    []*process.StateItem
+		node         *process.Node
+		h            *Handle
+	)
+
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", timer.WorkOrder).
+		Find(&workOrder).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return cancelTimer(tx, timer)
+		}
+		return fmt.Errorf("查询工单失败，%v", err.Error())
+	}
+	stateList, err = process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+	if workOrder.IsEnd == 1 || process.GetStateItem(stateList, timer.Node) == nil {
+		return cancelTimer(tx, timer)
+	}
+
+	processInfo, err = WorkOrderProcess(tx, &workOrder)
+	if err != nil {
+		return
+	}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
+	}
+	node = processState.Structure.GetNode(timer.Node)
+	if node == nil || node.Clazz != process.NodeTimer {
+		return cancelTimer(tx, timer)
+	}
+	sourceEdges := processState.Structure.SourceEdges(node.Id)
+	if len(sourceEdges) == 0 {
+		return fmt.Errorf("定时节点 %v 未配置流转", node.Label)
+	}
+
+	h, err = newSystemHandle(tx, &workOrder, processState, node)
+	if err != nil {
+		return
+	}
+	h.targetStateValue, err = processState.GetNode(sourceEdges[0].Target)
+	if err != nil {
+		return
+	}
+	err = h.jump()
+	if err != nil {
+		return
+	}
+
+	err = tx.Create(&process.CirculationHistory{
+		Title:       workOrder.Title,
+		WorkOrder:   workOrder.Id,
+		State:       node.Label,
+		Source:      node.Id,
+		Target:      h.targetStateValue.Id,
+		Circulation: "定时流转",
+		Processor:   systemProcessor,
+		Status:      1, // 同意
+		Remarks:     fmt.Sprintf("已到达触发时间 %v", timer.FireTime.Format("2006-01-02 15:04:05")),
+	}).Error
+	if err != nil {
+		return
+	}
+	return h.systemCirculated(processInfo.Notice)
+}
+
+func cancelTimer(tx *gorm.DB, timer *process.WorkOrderTimer) error {
+	return tx.Model(&process.WorkOrderTimer{}).
+		Where("id = ?", timer.Id).
+		Update("status", process.TimerStatusCancelled).Error
+}
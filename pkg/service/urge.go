@@ -0,0 +1,232 @@
+package service
+
+import (
+	"ferry/global/orm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"ferry/pkg/logger"
+	"ferry/pkg/notify"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/spf13/viper"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 催办工单
+*/
+
+const urgeCirculation = "自动催办"
+
+// 向工单当前处理人发送催办提醒，流程未配置通知时默认使用邮件通知
+func SendUrgeNotify(workOrderInfo *process.WorkOrderInfo, subject string) (err error) {
+	var (
+		sendToUserList []system.SysUser
+		stateList      []*process.StateItem
+		userInfo       system.SysUser
+		noticeList     []*notify.Channel
+	)
+
+	// 获取当前工单处理人信息
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		return
+	}
+	sendToUserList, err = GetPrincipalUserInfo(stateList, workOrderInfo.Creator)
+	if err != nil {
+		return fmt.Errorf("查询处理人信息失败，%v", err.Error())
+	}
+
+	// 查询创建人信息
+	err = orm.Eloquent.Model(&system.SysUser{}).Where("user_id = ?", workOrderInfo.Creator).Find(&userInfo).Error
+	if err != nil {
+		return fmt.Errorf("创建人信息查询失败，%v", err.Error())
+	}
+
+	noticeList, err = GetNoticeChannels(workOrderInfo.Process)
+	if err != nil {
+		return
+	}
+
+	// 发送催办提醒
+	bodyData := notify.BodyData{
+		SendTo: map[string]interface{}{
+			"userList": sendToUserList,
+		},
+		Subject:     subject,
+		Description: "您有一条待办工单，请及时处理，工单描述如下",
+		Channels:    noticeList,
+		Event:       notify.EventUrged,
+		ProcessId:   workOrderInfo.Process,
+		Id:          workOrderInfo.Id,
+		Title:       workOrderInfo.Title,
+		Creator:     userInfo.NickName,
+		Priority:    workOrderInfo.Priority,
+		CreatedAt:   workOrderInfo.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	err = notify.Enqueue(orm.Eloquent, &bodyData)
+	if err != nil {
+		return fmt.Errorf("催办提醒发送失败，%v", err.Error())
+	}
+	return
+}
+
+// 定时按照催办规则自动催办
+func StartUrgeScheduler() {
+	interval := viper.GetDuration("settings.urge.interval")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := CheckUrge()
+		if err != nil {
+			logger.Errorf("自动催办失败，%v", err.Error())
+		}
+	}
+}
+
+// 检查所有未结束的工单，对停留在同一节点超过催办间隔的工单进行催办
+func CheckUrge() (err error) {
+	var (
+		ruleList      []*process.UrgeRule
+		workOrderList []process.WorkOrderInfo
+		now           = time.Now()
+	)
+
+	err = orm.Eloquent.Model(&process.UrgeRule{}).
+		Where("status = 1").
+		Order("urge_interval").
+		Find(&ruleList).Error
+	if err != nil {
+		return fmt.Errorf("查询催办规则失败，%v", err.Error())
+	}
+	if len(ruleList) == 0 {
+		return
+	}
+
+	err = orm.Eloquent.Model(&process.WorkOrderInfo{}).
+		Where("is_end = 0").
+		Find(&workOrderList).Error
+	if err != nil {
+		return fmt.Errorf("查询工单列表失败，%v", err.Error())
+	}
+
+	for i := range workOrderList {
+		workOrder := &workOrderList[i]
+
+		rule := matchUrgeRule(ruleList, workOrder)
+		if rule == nil || rule.InQuietHours(now) {
+			continue
+		}
+
+		err = urgeWorkOrder(workOrder, rule, now)
+		if err != nil {
+			logger.Errorf("工单 %v 自动催办失败，%v", workOrder.Id, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// 选择最匹配的催办规则，匹配程度相同时使用催办间隔最短的规则
+func matchUrgeRule(ruleList []*process.UrgeRule, workOrder *process.WorkOrderInfo) (rule *process.UrgeRule) {
+	bestScore := -1
+	for _, r := range ruleList {
+		if score := r.Match(workOrder); score > bestScore {
+			rule = r
+			bestScore = score
+		}
+	}
+	return
+}
+
+// 按照规则催办单个工单
+func urgeWorkOrder(workOrder *process.WorkOrderInfo, rule *process.UrgeRule, now time.Time) (err error) {
+	var (
+		lastHistory process.CirculationHistory
+		urgeCount   int
+		stateList   []*process.StateItem
+		lastTime    time.Time
+	)
+
+	// 最近一次非系统产生的流转即为进入当前节点的时间
+	err = orm.Eloquent.Model(&process.CirculationHistory{}).
+		Where("work_order = ? and circulation not in (?)", workOrder.Id, []string{urgeCirculation, slaCirculation}).
+		Order("id desc").
+		Limit(1).
+		Find(&lastHistory).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return
+	}
+	lastTime = lastHistory.CreatedAt.Time
+	if lastTime.IsZero() {
+		lastTime = workOrder.CreatedAt.Time
+	}
+
+	// 当前节点已催办的次数
+	if rule.MaxCount > 0 {
+		err = orm.Eloquent.Model(&process.CirculationHistory{}).
+			Where("work_order = ? and circulation = ? and id > ?", workOrder.Id, urgeCirculation, lastHistory.Id).
+			Count(&urgeCount).Error
+		if err != nil {
+			return
+		}
+		if urgeCount >= rule.MaxCount {
+			return
+		}
+	}
+
+	if workOrder.UrgeLastTime != 0 {
+		urgeLastTime := time.Unix(int64(workOrder.UrgeLastTime), 0)
+		if urgeLastTime.After(lastTime) {
+			lastTime = urgeLastTime
+		}
+	}
+	if now.Sub(lastTime) < time.Duration(rule.Interval)*time.Minute {
+		return
+	}
+
+	// 仅更新催办时间未被修改的工单，避免多个实例重复催办
+	result := orm.Eloquent.Model(&process.WorkOrderInfo{}).
+		Where("id = ? and urge_last_time = ?", workOrder.Id, workOrder.UrgeLastTime).
+		Updates(map[string]interface{}{
+			"urge_count":     workOrder.UrgeCount + 1,
+			"urge_last_time": int(now.Unix()),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	stateList, err = process.ParseState(workOrder.State)
+	if err != nil {
+		return
+	}
+	stateLabel := ""
+	if len(stateList) > 0 {
+		stateLabel = stateList[0].Label
+	}
+
+	err = orm.Eloquent.Create(&process.CirculationHistory{
+		Title:       workOrder.Title,
+		WorkOrder:   workOrder.Id,
+		State:       stateLabel,
+		Circulation: urgeCirculation,
+		Processor:   "系统",
+		Remarks:     fmt.Sprintf("根据催办规则《%v》自动催办", rule.Name),
+		Status:      2, // 其他
+	}).Error
+	if err != nil {
+		return
+	}
+
+	return SendUrgeNotify(workOrder, "您有一条待办工单长时间未处理，请及时处理。")
+}
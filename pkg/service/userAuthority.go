@@ -1,13 +1,8 @@
 package service
 
 import (
-	"encoding/json"
 	"ferry/global/orm"
 	"ferry/models/process"
-	"ferry/models/system"
-	"ferry/tools"
-
-	"github.com/gin-gonic/gin"
 )
 
 /*
@@ -15,7 +10,7 @@ import (
   @todo: 添加新的处理人时候，需要修改（先完善功能，后续有时间的时候优化一下这部分。）
 */
 
-func JudgeUserAuthority(c *gin.Context, workOrderId int, currentState string) (status bool, err error) {
+func JudgeUserAuthority(actor *Actor, workOrderId int, currentState string) (status bool, err error) {
 	/*
 		person 人员
 		persongroup 人员组
@@ -23,16 +18,14 @@ func JudgeUserAuthority(c *gin.Context, workOrderId int, currentState string) (s
 		variable 变量
 	*/
 	var (
-		userDept          system.Dept
 		workOrderInfo     process.WorkOrderInfo
-		userInfo          system.SysUser
 		cirHistoryList    []process.CirculationHistory
-		stateValue        map[string]interface{}
+		stateValue        *process.Node
 		processInfo       process.Info
-		processState      ProcessState
-		currentStateList  []map[string]interface{}
-		currentStateValue map[string]interface{}
-		currentUserInfo   system.SysUser
+		processState      *ProcessState
+		currentStateList  []*process.StateItem
+		currentStateValue *process.StateItem
+		progress          *counterSignProgress
 	)
 	// 获取工单信息
 	err = orm.Eloquent.Model(&workOrderInfo).
@@ -42,17 +35,15 @@ func JudgeUserAuthority(c *gin.Context, workOrderId int, currentState string) (s
 		return
 	}
 
-	// 获取流程信息
-	err = orm.Eloquent.Model(&process.Info{}).Where("id = ?", workOrderInfo.Process).Find(&processInfo).Error
+	// 获取工单绑定版本的流程信息
+	processInfo, err = WorkOrderProcess(orm.Eloquent, &workOrderInfo)
 	//if err != nil {
 	//	return
 	//}
 
-	if processInfo.Structure != nil && len(processInfo.Structure) > 0 {
-		err = json.Unmarshal(processInfo.Structure, &processState.Structure)
-		if err != nil {
-			return
-		}
+	processState, err = NewProcessState(processInfo.Structure)
+	if err != nil {
+		return
 	}
 
 	stateValue, err = processState.GetNode(currentState)
@@ -60,134 +51,96 @@ func JudgeUserAuthority(c *gin.Context, workOrderId int, currentState string) (s
 		return
 	}
 
-	err = json.Unmarshal(workOrderInfo.State, &currentStateList)
+	currentStateList, err = process.ParseState(workOrderInfo.State)
 	if err != nil {
 		return
 	}
 
-	for _, v := range currentStateList {
-		if v["id"].(string) == currentState {
-			currentStateValue = v
-			break
-		}
-	}
-
-	// 获取当前用户信息
-	err = orm.Eloquent.Model(&currentUserInfo).
-		Where("user_id = ?", tools.GetUserId(c)).
-		Find(&currentUserInfo).
-		Error
-	if err != nil {
+	currentStateValue = process.GetStateItem(currentStateList, currentState)
+	if currentStateValue == nil {
 		return
 	}
 
-	// 会签
-	if currentStateValue["processor"] != nil && len(currentStateValue["processor"].([]interface{})) >= 1 {
-		if isCounterSign, ok := stateValue["isCounterSign"]; ok {
-			if isCounterSign.(bool) {
-				err = orm.Eloquent.Model(&process.CirculationHistory{}).
-					Where("work_order = ?", workOrderId).
-					Order("id desc").
-					Find(&cirHistoryList).Error
-				if err != nil {
-					return
-				}
-				for _, cirHistoryValue := range cirHistoryList {
-					if cirHistoryValue.Source != stateValue["id"] {
-						break
-					} else if cirHistoryValue.Source == stateValue["id"] {
-						if currentStateValue["process_method"].(string) == "person" {
-							// 验证个人会签
-							if cirHistoryValue.ProcessorId == tools.GetUserId(c) {
-								return
-							}
-						} else if currentStateValue["process_method"].(string) == "role" {
-							// 验证角色会签
-							if stateValue["fullHandle"].(bool) {
-								if cirHistoryValue.ProcessorId == tools.GetUserId(c) {
-									return
-								}
-							} else {
-								var roleUserInfo system.SysUser
-								err = orm.Eloquent.Model(&roleUserInfo).
-									Where("user_id = ?", cirHistoryValue.ProcessorId).
-									Find(&roleUserInfo).
-									Error
-								if err != nil {
-									return
-								}
-								if roleUserInfo.RoleId == tools.GetRoleId(c) {
-									return
-								}
-							}
-						} else if currentStateValue["process_method"].(string) == "department" {
-							// 部门会签
-							if stateValue["fullHandle"].(bool) {
-								if cirHistoryValue.ProcessorId == tools.GetUserId(c) {
-									return
-								}
-							} else {
-								var (
-									deptUserInfo system.SysUser
-								)
-								err = orm.Eloquent.Model(&deptUserInfo).
-									Where("user_id = ?", cirHistoryValue.ProcessorId).
-									Find(&deptUserInfo).
-									Error
-								if err != nil {
-									return
-								}
-
-								if deptUserInfo.DeptId == currentUserInfo.DeptId {
-									return
-								}
-							}
-						}
-					}
-				}
+	// 加签，前加签的处理人全部处理完成前原处理人无法处理，
+	// 后加签时仅会签节点的其他原处理人可以继续处理
+	if currentStateValue.HasSigners() {
+		for _, signer := range currentStateValue.PendingSigners() {
+			if signer == actor.UserId {
+				status = true
+				return
 			}
 		}
+		if len(currentStateValue.BeforeSigners) > 0 || !stateValue.IsCounterSign {
+			return
+		}
 	}
 
-	switch currentStateValue["process_method"].(string) {
-	case "person":
-		for _, processorValue := range currentStateValue["processor"].([]interface{}) {
-			if int(processorValue.(float64)) == tools.GetUserId(c) {
+	// 会签，已处理或依次会签时尚未轮到的处理人无法处理
+	if len(currentStateValue.Processor) >= 1 && stateValue.IsCounterSign {
+		err = orm.Eloquent.Model(&process.CirculationHistory{}).
+			Where("work_order = ?", workOrderId).
+			Order("id desc").
+			Find(&cirHistoryList).Error
+		if err != nil {
+			return
+		}
+		progress, err = newCounterSignProgress(stateValue, currentStateValue, currentStateList, cirHistoryList)
+		if err != nil {
+			return
+		}
+		if unit, ok := progress.userUnit(actor.UserId); ok && !progress.pending(unit) {
+			return
+		}
+	}
+
+	switch currentStateValue.ProcessMethod {
+	case process.AssignPerson:
+		for _, processorValue := range currentStateValue.Processor {
+			if processorValue == actor.UserId {
 				status = true
 			}
 		}
-	case "role":
-		for _, processorValue := range currentStateValue["processor"].([]interface{}) {
-			if int(processorValue.(float64)) == tools.GetRoleId(c) {
+		// 代理委托人已有的待办工单，会签节点委托人已处理或尚未轮到时无需处理
+		if !status {
+			var delegator int
+			delegator, err = OnBehalfOf(&workOrderInfo, currentStateValue, actor.UserId)
+			if err != nil || delegator == 0 {
+				return
+			}
+			status = true
+			if progress != nil {
+				if unit, ok := progress.userUnit(delegator); ok && !progress.pending(unit) {
+					status = false
+				}
+			}
+		}
+	case process.AssignRole:
+		for _, processorValue := range currentStateValue.Processor {
+			if processorValue == actor.RoleId {
 				status = true
 			}
 		}
-	case "department":
-		for _, processorValue := range currentStateValue["processor"].([]interface{}) {
-			if int(processorValue.(float64)) == currentUserInfo.DeptId {
+	case process.AssignDepartment:
+		for _, processorValue := range currentStateValue.Processor {
+			if processorValue == actor.DeptId {
 				status = true
 			}
 		}
-	case "variable":
-		for _, p := range currentStateValue["processor"].([]interface{}) {
-			switch int(p.(float64)) {
-			case 1:
-				if workOrderInfo.Creator == tools.GetUserId(c) {
-					status = true
-				}
-			case 2:
-				err = orm.Eloquent.Model(&userInfo).Where("user_id = ?", workOrderInfo.Creator).Find(&userInfo).Error
-				if err != nil {
-					return
-				}
-				err = orm.Eloquent.Model(&userDept).Where("dept_id = ?", userInfo.DeptId).Find(&userDept).Error
-				if err != nil {
-					return
-				}
-
-				if userDept.Leader == tools.GetUserId(c) {
-					status = true
-				}
+	default:
+		// 未解析的处理人，按照流转时相同的方式解析
+		var users []int
+		users, err = resolveProcessor(&AssigneeContext{
+			Process:   workOrderInfo.Process,
+			Creator:   workOrderInfo.Creator,
+			Structure: processState.Structure,
+			DryRun:    true,
+		}, currentStateValue)
+		if err != nil {
+			return
+		}
+		for _, user := range users {
+			if user == actor.UserId {
+				status = true
 			}
 		}
 	}
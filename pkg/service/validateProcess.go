@@ -0,0 +1,288 @@
+package service
+
+import (
+	"encoding/json"
+	"ferry/models/process"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 流程结构校验
+*/
+
+// 校验流程结构，返回的错误为 *process.StructureError，包含所有有问题的节点与流转
+func ValidateStructure(structureValue json.RawMessage) (structure *process.Structure, err error) {
+	structure, err = process.ParseStructure(structureValue)
+	if err != nil {
+		return
+	}
+
+	structureErr := &process.StructureError{}
+	validateNodes(structure, structureErr)
+	validateEdges(structure, structureErr)
+	validateReachable(structure, structureErr)
+	validateGateways(structure, structureErr)
+
+	if structureErr.HasError() {
+		return nil, structureErr
+	}
+	return
+}
+
+// 校验开始、结束节点及处理人
+func validateNodes(structure *process.Structure, structureErr *process.StructureError) {
+	var (
+		startCount int
+		endCount   int
+	)
+
+	for _, node := range structure.Nodes {
+		switch node.Clazz {
+		case process.NodeStart:
+			startCount++
+			if startCount > 1 {
+				structureErr.AddNode(node.Id, "流程只能有一个开始节点")
+			}
+		case process.NodeEnd:
+			endCount++
+		case process.NodeUserTask, process.NodeReceiveTask:
+			if err := node.ValidateAssignee(); err != nil {
+				structureErr.AddNode(node.Id, err.Error())
+			}
+		case process.NodeSubProcess:
+			validateSubProcess(structure, node, structureErr)
+		case process.NodeTimer:
+			if len(structure.SourceEdges(node.Id)) != 1 {
+				structureErr.AddNode(node.Id, "定时节点只能有一个流出的流转")
+			}
+		case process.NodeScriptTask:
+			validateScript(structure, node, structureErr)
+		}
+	}
+
+	if startCount == 0 {
+		structureErr.AddProcess("流程缺少开始节点")
+	}
+	if endCount == 0 {
+		structureErr.AddProcess("流程缺少结束节点")
+	}
+}
+
+// 子流程节点仅有一个流出的流转，配置了拒绝时流转的节点时，需要另有一个流转指向该节点
+func validateSubProcess(structure *process.Structure, node *process.Node, structureErr *process.StructureError) {
+	sourceEdges := structure.SourceEdges(node.Id)
+	if node.SubProcess == nil || node.SubProcess.DeniedTarget == "" {
+		if len(sourceEdges) != 1 {
+			structureErr.AddNode(node.Id, "子流程节点只能有一个流出的流转")
+		}
+		return
+	}
+
+	deniedCount := 0
+	for _, edge := range sourceEdges {
+		if edge.Target == node.SubProcess.DeniedTarget {
+			deniedCount++
+		}
+	}
+	if len(sourceEdges) != 2 || deniedCount != 1 {
+		structureErr.AddNode(node.Id, "子流程节点需要一个正常的流转，以及一个指向拒绝时流转节点的流转")
+	}
+}
+
+// 阻塞任务节点需要配置执行的脚本，退出码对应的节点需要是节点的流转目标，执行失败时的节点必须配置，可以是流转目标或人工处理节点
+func validateScript(structure *process.Structure, node *process.Node, structureErr *process.StructureError) {
+	if node.Script == nil || node.Script.Task == "" {
+		structureErr.AddNode(node.Id, "任务节点未配置执行的脚本")
+		return
+	}
+
+	sourceEdges := structure.SourceEdges(node.Id)
+	if len(sourceEdges) == 0 {
+		structureErr.AddNode(node.Id, "任务节点未配置流出的流转")
+		return
+	}
+	targets := make(map[string]struct{}, len(sourceEdges))
+	for _, edge := range sourceEdges {
+		targets[edge.Target] = struct{}{}
+	}
+	for code, target := range node.Script.ExitCodes {
+		if _, ok := targets[target]; !ok {
+			structureErr.AddNode(node.Id, "退出码 %v 对应的节点 %v 不是任务节点的流转目标", code, target)
+		}
+	}
+	if _, ok := targets[node.Script.ErrorTarget]; !ok {
+		errorNode := structure.GetNode(node.Script.ErrorTarget)
+		if errorNode == nil || !errorNode.IsHumanTask() {
+			structureErr.AddNode(node.Id, "执行失败时流转到的节点需要是任务节点的流转目标或人工处理节点")
+		}
+	}
+}
+
+// 校验排他网关的条件表达式
+func validateEdges(structure *process.Structure, structureErr *process.StructureError) {
+	for _, node := range structure.Nodes {
+		if node.Clazz != process.GatewayExclusive {
+			continue
+		}
+		for _, edge := range structure.SourceEdges(node.Id) {
+			if len(edge.Conditions) == 0 {
+				structureErr.AddEdge(edge.Id, "排他网关的流转未配置条件表达式")
+			}
+		}
+	}
+}
+
+// 校验是否存在无法到达的节点，以及无法到达结束节点的节点
+func validateReachable(structure *process.Structure, structureErr *process.StructureError) {
+	var (
+		reachable = make(map[string]struct{})
+		canFinish = make(map[string]struct{})
+		queue     []string
+	)
+
+	// 从开始节点正向遍历
+	startNode := structure.StartNode()
+	if startNode != nil {
+		reachable[startNode.Id] = struct{}{}
+		queue = append(queue, startNode.Id)
+	}
+	for len(queue) > 0 {
+		nodeId := queue[0]
+		queue = queue[1:]
+		for _, edge := range structure.SourceEdges(nodeId) {
+			if _, ok := reachable[edge.Target]; !ok {
+				reachable[edge.Target] = struct{}{}
+				queue = append(queue, edge.Target)
+			}
+		}
+	}
+
+	// 从结束节点反向遍历
+	for _, node := range structure.Nodes {
+		if node.Clazz == process.NodeEnd {
+			canFinish[node.Id] = struct{}{}
+			queue = append(queue, node.Id)
+		}
+	}
+	for len(queue) > 0 {
+		nodeId := queue[0]
+		queue = queue[1:]
+		for _, edge := range structure.TargetEdges(nodeId) {
+			if _, ok := canFinish[edge.Source]; !ok {
+				canFinish[edge.Source] = struct{}{}
+				queue = append(queue, edge.Source)
+			}
+		}
+	}
+
+	for _, node := range structure.Nodes {
+		if startNode != nil {
+			if _, ok := reachable[node.Id]; !ok {
+				structureErr.AddNode(node.Id, "从开始节点无法到达此节点")
+				continue
+			}
+		}
+		if _, ok := canFinish[node.Id]; !ok {
+			structureErr.AddNode(node.Id, "此节点无法到达结束节点")
+		}
+	}
+}
+
+// 校验并行网关与包容网关是否成对出现
+func validateGateways(structure *process.Structure, structureErr *process.StructureError) {
+	matchedJoin := make(map[string]struct{})
+
+	for _, node := range structure.Nodes {
+		if node.Clazz != process.GatewayParallel && node.Clazz != process.GatewayInclusive {
+			continue
+		}
+
+		sourceCount := len(structure.SourceEdges(node.Id))
+		targetCount := len(structure.TargetEdges(node.Id))
+		if sourceCount > 1 && targetCount == 1 {
+			// 入口，所有分支必须汇聚到同一个出口
+			joinList, balanced := findJoinGateway(structure, node)
+			if !balanced || len(joinList) != 1 {
+				structureErr.AddNode(node.Id, "网关的分支未汇聚到同一个同类型的聚合网关")
+				continue
+			}
+			for joinId := range joinList {
+				matchedJoin[joinId] = struct{}{}
+			}
+		} else if !(sourceCount == 1 && targetCount > 1) {
+			structureErr.AddNode(node.Id, "网关必须是一进多出的分支网关或多进一出的聚合网关")
+		}
+	}
+
+	for _, node := range structure.Nodes {
+		if node.Clazz != process.GatewayParallel && node.Clazz != process.GatewayInclusive {
+			continue
+		}
+		if len(structure.SourceEdges(node.Id)) == 1 && len(structure.TargetEdges(node.Id)) > 1 {
+			if _, ok := matchedJoin[node.Id]; !ok {
+				structureErr.AddNode(node.Id, "聚合网关没有对应的分支网关")
+			}
+		}
+	}
+}
+
+// 沿分支网关的每个分支查找第一个同类型的聚合网关，嵌套的同类型网关会被跳过
+func findJoinGateway(structure *process.Structure, fork *process.Node) (joinList map[string]struct{}, balanced bool) {
+	type position struct {
+		nodeId string
+		depth  int
+	}
+
+	var (
+		visited = make(map[position]struct{})
+		walk    func(nodeId string, depth int) bool
+	)
+
+	joinList = make(map[string]struct{})
+	walk = func(nodeId string, depth int) bool {
+		if _, ok := visited[position{nodeId, depth}]; ok {
+			return true
+		}
+		visited[position{nodeId, depth}] = struct{}{}
+
+		// 回退到分支网关之前的流转，以及直接结束工单的流转，不参与汇聚的判断
+		if nodeId == fork.Id || depth > len(structure.Nodes) {
+			return true
+		}
+
+		node := structure.GetNode(nodeId)
+		if node == nil {
+			return false
+		}
+		if node.Clazz == process.NodeEnd {
+			return true
+		}
+		if node.Clazz == fork.Clazz {
+			sourceCount := len(structure.SourceEdges(node.Id))
+			targetCount := len(structure.TargetEdges(node.Id))
+			if sourceCount == 1 && targetCount > 1 {
+				if depth == 0 {
+					joinList[node.Id] = struct{}{}
+					return true
+				}
+				depth--
+			} else if sourceCount > 1 {
+				depth++
+			}
+		}
+		for _, edge := range structure.SourceEdges(node.Id) {
+			if !walk(edge.Target, depth) {
+				return false
+			}
+		}
+		return true
+	}
+
+	balanced = true
+	for _, edge := range structure.SourceEdges(fork.Id) {
+		if !walk(edge.Target, 0) {
+			balanced = false
+		}
+	}
+	return
+}
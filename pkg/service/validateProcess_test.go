@@ -0,0 +1,24 @@
+package service
+
+import (
+	"ferry/models/process"
+	"testing"
+)
+
+// 任务节点需要配置执行的脚本
+func TestValidateScriptRequiresTask(t *testing.T) {
+	structure := &process.Structure{
+		Nodes: []*process.Node{
+			{Id: "task", Clazz: process.NodeScriptTask, Script: &process.Script{ErrorTarget: "end"}},
+			{Id: "end", Clazz: process.NodeEnd},
+		},
+	}
+	for _, script := range []*process.Script{nil, {ErrorTarget: "end"}} {
+		structure.Nodes[0].Script = script
+		structureErr := &process.StructureError{}
+		validateScript(structure, structure.Nodes[0], structureErr)
+		if ids := structureErr.NodeIds(); len(ids) != 1 || ids[0] != "task" {
+			t.Errorf("脚本 %+v：期望任务节点校验失败，实际为 %v", script, structureErr.Items)
+		}
+	}
+}
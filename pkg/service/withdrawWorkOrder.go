@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+	"ferry/models/process"
+	"ferry/pkg/notify"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 创建人撤回工单
+*/
+
+// 创建人撤回工单，撤回的工单标记为已结束并保留流转历史，同时通知当前节点的处理人。
+// 在调用方的事务中写入
+func WithdrawWorkOrder(tx *gorm.DB, actor *Actor, cmd *WithdrawCommand) (err error) {
+	var (
+		workOrderInfo process.WorkOrderInfo
+		processInfo   process.Info
+		stateList     []*process.StateItem
+		stateLabels   []string
+		noticeList    []*notify.Channel
+		bodyData      *notify.BodyData
+		workOrderId   = cmd.WorkOrderId
+	)
+
+	// 查询工单信息
+	err = tx.Model(&process.WorkOrderInfo{}).
+		Where("id = ?", workOrderId).
+		Find(&workOrderInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询工单信息失败，%v", err.Error())
+	}
+	if actor == nil || workOrderInfo.Creator != actor.UserId {
+		return errors.New("仅工单创建人可以撤回工单")
+	}
+	if workOrderInfo.IsEnd == 1 {
+		return errors.New("工单已结束，无法撤回")
+	}
+	err = checkWorkOrderVersion(&workOrderInfo, cmd.Version)
+	if err != nil {
+		return
+	}
+
+	// 校验流程的撤回策略
+	err = tx.Model(&process.Info{}).
+		Where("id = ?", workOrderInfo.Process).
+		Find(&processInfo).Error
+	if err != nil {
+		return fmt.Errorf("查询流程信息失败，%v", err.Error())
+	}
+	switch processInfo.Withdraw {
+	case process.WithdrawDisabled:
+		return errors.New("当前流程不允许撤回工单")
+	case process.WithdrawUnhandled:
+		var handled bool
+		handled, err = workOrderHandled(tx, &workOrderInfo)
+		if err != nil {
+			return
+		}
+		if handled {
+			return errors.New("工单已被处理，无法撤回")
+		}
+	}
+
+	stateList, err = process.ParseState(workOrderInfo.State)
+	if err != nil {
+		return
+	}
+	for _, state := range stateList {
+		stateLabels = append(stateLabels, state.Label)
+	}
+
+	noticeList, err = notify.ParseNotice(processInfo.Notice)
+	if err != nil {
+		return
+	}
+
+	err = UpdateWorkOrder(tx, &workOrderInfo, map[string]interface{}{
+		"is_end":       1,
+		"is_withdrawn": 1,
+	})
+	if err != nil {
+		return fmt.Errorf("撤回工单失败，%v", err.Error())
+	}
+
+	// 撤回记录不记录源节点，避免被计入会签及并行节点的处理记录
+	err = tx.Create(&process.CirculationHistory{
+		Title:       workOrderInfo.Title,
+		WorkOrder:   workOrderInfo.Id,
+		State:       strings.Join(stateLabels, "，"),
+		Circulation: "撤回工单",
+		Processor:   actor.Name,
+		ProcessorId: actor.UserId,
+		Remarks:     cmd.Remarks,
+		Status:      2, // 其他
+	}).Error
+	if err != nil {
+		return fmt.Errorf("新建撤回历史失败，%v", err.Error())
+	}
+
+	// 通知当前节点的处理人
+	if len(noticeList) > 0 {
+		bodyData, err = WorkOrderNotifyData(tx, workOrderId)
+		if err != nil {
+			return
+		}
+		bodyData.Subject = "您的待办工单已被撤回"
+		bodyData.Description = "工单已被创建人撤回，无需继续处理，工单描述如下"
+		bodyData.Channels = noticeList
+		bodyData.Event = notify.EventWithdrawn
+		err = notify.Enqueue(tx, bodyData)
+		if err != nil {
+			return
+		}
+	}
+
+	// 撤回的子工单视为被拒绝
+	err = CompleteSubWorkOrder(tx, &workOrderInfo)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// 工单是否已被处理，新建记录及系统自动生成的记录不计入
+func workOrderHandled(db *gorm.DB, workOrderInfo *process.WorkOrderInfo) (handled bool, err error) {
+	var historyList []process.CirculationHistory
+
+	err = db.Model(&process.CirculationHistory{}).
+		Where("work_order = ?", workOrderInfo.Id).
+		Order("id").
+		Find(&historyList).Error
+	if err != nil {
+		return false, fmt.Errorf("查询流转历史失败，%v", err.Error())
+	}
+
+	for i, history := range historyList {
+		// 第一条为新建工单的记录
+		if i == 0 {
+			continue
+		}
+		if history.ProcessorId != 0 {
+			return true, nil
+		}
+	}
+	return
+}
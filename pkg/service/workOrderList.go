@@ -1,13 +1,13 @@
 package service
 
 import (
-	"encoding/json"
 	"ferry/global/orm"
 	"ferry/models/process"
 	"ferry/models/system"
 	"ferry/pkg/pagination"
 	"ferry/tools"
 	"fmt"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -46,16 +46,19 @@ func (w *WorkOrder) PureWorkOrderList() (result interface{}, err error) {
 	personSelectValue := "(JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('processor', %v)) and JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('process_method', 'person')))"
 	roleSelectValue := "(JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('processor', %v)) and JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('process_method', 'role')))"
 	departmentSelectValue := "(JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('processor', %v)) and JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('process_method', 'department')))"
+	signerSelectValue := "(JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('before_signers', %v)) or JSON_CONTAINS(p_work_order_info.state, JSON_OBJECT('after_signers', %v)))"
 
 	title := w.GinObj.DefaultQuery("title", "")
 	startTime := w.GinObj.DefaultQuery("startTime", "")
 	endTime := w.GinObj.DefaultQuery("endTime", "")
 	isEnd := w.GinObj.DefaultQuery("isEnd", "")
+	isWithdrawn := w.GinObj.DefaultQuery("isWithdrawn", "")
 	processor := w.GinObj.DefaultQuery("processor", "")
 	priority := w.GinObj.DefaultQuery("priority", "")
 	creator := w.GinObj.DefaultQuery("creator", "")
 	processParam := w.GinObj.DefaultQuery("process", "")
 	formData := w.GinObj.DefaultQuery("formData", "")
+	slaStatus := w.GinObj.DefaultQuery("slaStatus", "")
 	db := orm.Eloquent.Model(&process.WorkOrderInfo{}).
 		Where("p_work_order_info.title like ?", fmt.Sprintf("%%%v%%", title))
 
@@ -68,6 +71,9 @@ func (w *WorkOrder) PureWorkOrderList() (result interface{}, err error) {
 	if isEnd != "" {
 		db = db.Where("p_work_order_info.is_end = ?", isEnd)
 	}
+	if isWithdrawn != "" {
+		db = db.Where("p_work_order_info.is_withdrawn = ?", isWithdrawn)
+	}
 	if creator != "" {
 		db = db.Where("p_work_order_info.creator = ?", creator)
 	}
@@ -95,6 +101,9 @@ func (w *WorkOrder) PureWorkOrderList() (result interface{}, err error) {
 	if priority != "" {
 		db = db.Where("p_work_order_info.priority = ?", priority)
 	}
+	if slaStatus != "" {
+		db = db.Where("p_work_order_info.sla_status = ? and p_work_order_info.due_time is not null and p_work_order_info.is_end = 0", slaStatus)
+	}
 
 	// 获取当前用户信息
 	switch w.Classify {
@@ -116,9 +125,28 @@ func (w *WorkOrder) PureWorkOrderList() (result interface{}, err error) {
 		}
 		departmentSelect := fmt.Sprintf(departmentSelectValue, userInfo.DeptId)
 
-		// 4. 变量会转成个人数据
+		// 4. 加签
+		signerSelect := fmt.Sprintf(signerSelectValue, tools.GetUserId(w.GinObj), tools.GetUserId(w.GinObj))
+
+		selectList := []string{personSelect, roleSelect, departmentSelect, signerSelect}
+
+		// 5. 代理的委托人已有的待办工单
+		var delegateRules []*process.DelegateRule
+		delegateRules, err = PendingDelegateRules(tools.GetUserId(w.GinObj))
+		if err != nil {
+			return
+		}
+		for _, rule := range delegateRules {
+			delegateSelect := fmt.Sprintf(personSelectValue, rule.UserId)
+			if rule.Process != 0 {
+				delegateSelect = fmt.Sprintf("(%v and p_work_order_info.process = %v)", delegateSelect, rule.Process)
+			}
+			selectList = append(selectList, delegateSelect)
+		}
+
+		// 6. 变量、部门负责人、岗位、表单字段及角色成员分配的处理人在流转时已解析为个人数据，按照个人匹配
 		//db = db.Where(fmt.Sprintf("(%v or %v or %v or %v) and is_end = 0", personSelect, personGroupSelect, departmentSelect, variableSelect))
-		db = db.Where(fmt.Sprintf("(%v or %v or %v) and p_work_order_info.is_end = 0", personSelect, roleSelect, departmentSelect))
+		db = db.Where(fmt.Sprintf("(%v) and p_work_order_info.is_end = 0", strings.Join(selectList, " or ")))
 	case 2:
 		// 我创建的
 		db = db.Where("p_work_order_info.creator = ?", tools.GetUserId(w.GinObj))
@@ -149,9 +177,10 @@ func (w *WorkOrder) WorkOrderList() (result interface{}, err error) {
 
 	var (
 		principals        string
-		StateList         []map[string]interface{}
+		StateList         []*process.StateItem
 		workOrderInfoList []workOrderInfo
 		minusTotal        int
+		actor             *Actor
 	)
 
 	result, err = w.PureWorkOrderList()
@@ -159,27 +188,40 @@ func (w *WorkOrder) WorkOrderList() (result interface{}, err error) {
 		return
 	}
 
+	// 待办工单需要验证当前用户的处理权限
+	if w.Classify == 1 {
+		actor, err = LoadActor(tools.GetUserId(w.GinObj))
+		if err != nil {
+			return
+		}
+	}
+
 	for i, v := range *result.(*pagination.Paginator).Data.(*[]workOrderInfo) {
 		var (
 			stateName    string
 			structResult map[string]interface{}
 			authStatus   bool
 		)
-		err = json.Unmarshal(v.State, &StateList)
+		StateList, err = process.ParseState(v.State)
 		if err != nil {
 			err = fmt.Errorf("json反序列化失败，%v", err.Error())
 			return
 		}
-		if len(StateList) != 0 {
+		if v.IsWithdrawn == 1 {
+			// 撤回的工单不再显示处理人
+			principals = ""
+			stateName = "已撤回"
+			authStatus = true
+		} else if len(StateList) != 0 {
 			// 仅待办工单需要验证
 			// todo：还需要找最优解决方案
 			if w.Classify == 1 {
-				structResult, err = ProcessStructure(w.GinObj, v.Process, v.Id)
+				structResult, err = ProcessStructure(actor, v.Process, v.Id)
 				if err != nil {
 					return
 				}
 
-				authStatus, err = JudgeUserAuthority(w.GinObj, v.Id, structResult["workOrder"].(WorkOrderData).CurrentState)
+				authStatus, err = JudgeUserAuthority(actor, v.Id, structResult["workOrder"].(WorkOrderData).CurrentState)
 				if err != nil {
 					return
 				}
@@ -194,24 +236,22 @@ func (w *WorkOrder) WorkOrderList() (result interface{}, err error) {
 			processorList := make([]int, 0)
 			if len(StateList) > 1 {
 				for _, s := range StateList {
-					for _, p := range s["processor"].([]interface{}) {
-						if int(p.(float64)) == tools.GetUserId(w.GinObj) {
-							processorList = append(processorList, int(p.(float64)))
+					for _, p := range s.Processor {
+						if p == tools.GetUserId(w.GinObj) {
+							processorList = append(processorList, p)
 						}
 					}
 					if len(processorList) > 0 {
-						stateName = s["label"].(string)
+						stateName = s.Label
 						break
 					}
 				}
 			}
 			if len(processorList) == 0 {
-				for _, v := range StateList[0]["processor"].([]interface{}) {
-					processorList = append(processorList, int(v.(float64)))
-				}
-				stateName = StateList[0]["label"].(string)
+				processorList = append(processorList, StateList[0].Processor...)
+				stateName = StateList[0].Label
 			}
-			principals, err = GetPrincipal(processorList, StateList[0]["process_method"].(string))
+			principals, err = GetPrincipal(processorList, StateList[0].ProcessMethod)
 			if err != nil {
 				err = fmt.Errorf("查询处理人名称失败，%v", err.Error())
 				return
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"ferry/models/process"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 工单版本，修改工单节点数据时校验并递增版本，避免并发处理时相互覆盖
+*/
+
+// 工单在读取后已被修改
+var ErrWorkOrderChanged = errors.New("工单已被他人处理或修改，请刷新后重试")
+
+// 按照读取时的版本更新工单，版本不一致时返回 ErrWorkOrderChanged，更新成功后版本加一
+func UpdateWorkOrder(db *gorm.DB, workOrder *process.WorkOrderInfo, values map[string]interface{}) (err error) {
+	values["version"] = gorm.Expr("version + 1")
+	result := db.Model(&process.WorkOrderInfo{}).
+		Where("id = ? and version = ?", workOrder.Id, workOrder.Version).
+		Updates(values)
+	if result.Error != nil {
+		return fmt.Errorf("更新工单失败，%v", result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkOrderChanged
+	}
+	workOrder.Version += 1
+	return
+}
+
+// 校验客户端读取到的工单版本，version 为空时不校验
+func checkWorkOrderVersion(workOrder *process.WorkOrderInfo, version *int) error {
+	if version != nil && *version != workOrder.Version {
+		return ErrWorkOrderChanged
+	}
+	return nil
+}
+
+// 查询时锁定记录直到事务结束，SQLite 不支持 FOR UPDATE，由事务锁定整个数据库
+func forUpdate(db *gorm.DB) *gorm.DB {
+	if db.Dialect().GetName() == "sqlite3" {
+		return db
+	}
+	return db.Set("gorm:query_option", "FOR UPDATE")
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"errors"
+	"ferry/models/process"
+	"ferry/pkg/testdb"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 会签：开始 -> 审批(用户 2、3 会签) -> 结束
+var counterSignStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "approve", "label": "会签", "clazz": process.NodeUserTask, "sort": 2, "assignType": process.AssignPerson, "assignValue": []int{2, 3}, "isCounterSign": true},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 3},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "approve"},
+		{"id": "e2", "source": "approve", "target": "end"},
+	},
+}
+
+// 并行：开始 -> 并行网关 -> 审批 A(用户 2)、审批 B(用户 3) -> 聚合网关 -> 结束
+var parallelStructure = map[string]interface{}{
+	"nodes": []map[string]interface{}{
+		{"id": "start", "label": "开始", "clazz": process.NodeStart, "sort": 1},
+		{"id": "fork", "label": "并行网关", "clazz": process.GatewayParallel, "sort": 2},
+		{"id": "a", "label": "审批 A", "clazz": process.NodeUserTask, "sort": 3, "assignType": process.AssignPerson, "assignValue": []int{2}},
+		{"id": "b", "label": "审批 B", "clazz": process.NodeUserTask, "sort": 4, "assignType": process.AssignPerson, "assignValue": []int{3}},
+		{"id": "join", "label": "聚合网关", "clazz": process.GatewayParallel, "sort": 5},
+		{"id": "end", "label": "结束", "clazz": process.NodeEnd, "sort": 6},
+	},
+	"edges": []map[string]interface{}{
+		{"id": "e1", "source": "start", "target": "fork"},
+		{"id": "e2", "source": "fork", "target": "a"},
+		{"id": "e3", "source": "fork", "target": "b"},
+		{"id": "e4", "source": "a", "target": "join"},
+		{"id": "e5", "source": "b", "target": "join"},
+		{"id": "e6", "source": "join", "target": "end"},
+	},
+}
+
+// 处理请求，version 为客户端读取到的工单版本
+type approval struct {
+	workOrderId int
+	source      string
+	target      string
+	version     *int
+	denied      bool
+}
+
+func approve(workOrderId int, source string, target string, version *int) approval {
+	return approval{
+		workOrderId: workOrderId,
+		source:      source,
+		target:      target,
+		version:     version,
+	}
+}
+
+func deny(workOrderId int, source string, target string) approval {
+	a := approve(workOrderId, source, target, nil)
+	a.denied = true
+	return a
+}
+
+func versionOf(workOrder process.WorkOrderInfo) *int {
+	version := workOrder.Version
+	return &version
+}
+
+// 以 userId 的身份在 db 上处理工单
+func handleOn(db *gorm.DB, userId int, a approval) (err error) {
+	var (
+		actor  *Actor
+		handle Handle
+	)
+
+	actor, err = LoadActor(userId)
+	if err != nil {
+		return
+	}
+	circulation, flowProperties := "同意", 1
+	if a.denied {
+		circulation, flowProperties = "拒绝", 0
+	}
+	return handle.HandleWorkOrder(db, actor, &HandleCommand{
+		WorkOrderId:    a.workOrderId,
+		SourceState:    a.source,
+		TargetState:    a.target,
+		Circulation:    circulation,
+		FlowProperties: flowProperties,
+		Version:        a.version,
+	})
+}
+
+// 以 userId 的身份在独立的事务中处理工单
+func handleWorkOrder(db *gorm.DB, userId int, a approval) (err error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err = handleOn(tx, userId, a)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit().Error
+}
+
+// 多个处理人同时提交，期望一个处理成功，其他的因工单已被修改而失败，返回成功的处理人及失败的处理人
+func handleConcurrently(t *testing.T, db *gorm.DB, approvals map[int]approval, handle func(db *gorm.DB, userId int, a approval) error) (winner int, loser int) {
+	t.Helper()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		start   = make(chan struct{})
+		results = make(map[int]error, len(approvals))
+	)
+
+	for userId, a := range approvals {
+		wg.Add(1)
+		go func(userId int, a approval) {
+			defer wg.Done()
+			<-start
+			err := handle(db, userId, a)
+			mu.Lock()
+			results[userId] = err
+			mu.Unlock()
+		}(userId, a)
+	}
+	close(start)
+	wg.Wait()
+
+	for userId, err := range results {
+		switch {
+		case err == nil:
+			if winner != 0 {
+				t.Fatalf("用户 %v 与用户 %v 均处理成功", winner, userId)
+			}
+			winner = userId
+		case errors.Is(err, ErrWorkOrderChanged):
+			if loser != 0 {
+				t.Fatalf("用户 %v 与用户 %v 均处理失败", loser, userId)
+			}
+			loser = userId
+		default:
+			t.Fatalf("用户 %v 处理工单失败，%v", userId, err)
+		}
+	}
+	if winner == 0 || loser == 0 {
+		t.Fatalf("期望一个处理成功、一个版本冲突，实际为 %v", results)
+	}
+	return
+}
+
+func stateIds(t *testing.T, workOrder process.WorkOrderInfo) (ids []string) {
+	t.Helper()
+	stateList, err := process.ParseState(workOrder.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range stateList {
+		ids = append(ids, state.Id)
+	}
+	return
+}
+
+func newCounterSignWorkOrder(t *testing.T) (db *gorm.DB, workOrder process.WorkOrderInfo) {
+	db = testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, counterSignStructure)
+	workOrder = testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{{
+		Id:            "approve",
+		Label:         "会签",
+		Processor:     []int{2, 3},
+		ProcessMethod: process.AssignPerson,
+	}})
+	return
+}
+
+// 校验会签节点只计入了 winner 的一票，loser 重新提交后会签完成，每个处理人各计一票
+func assertCounterSign(t *testing.T, db *gorm.DB, workOrderId int, winner int, loser int, version func(process.WorkOrderInfo) *int) {
+	t.Helper()
+
+	current := testdb.GetWorkOrder(t, db, workOrderId)
+	if current.IsEnd != 0 {
+		t.Fatal("只有一人同意时会签节点不应流转")
+	}
+	historyList := testdb.Histories(t, db, workOrderId)
+	if len(historyList) != 1 || historyList[0].ProcessorId != winner {
+		t.Fatalf("期望只记录用户 %v 的处理，实际为 %+v", winner, historyList)
+	}
+
+	// 失败的处理人基于最新的工单重新提交
+	err := handleWorkOrder(db, loser, approve(workOrderId, "approve", "end", version(current)))
+	if err != nil {
+		t.Fatalf("重新提交失败，%v", err)
+	}
+
+	current = testdb.GetWorkOrder(t, db, workOrderId)
+	if current.IsEnd != 1 {
+		t.Fatalf("会签完成后工单应结束，当前节点 %v", stateIds(t, current))
+	}
+	votes := make(map[int]int)
+	for _, history := range testdb.Histories(t, db, workOrderId) {
+		if history.Source == "approve" && history.Status == 1 {
+			votes[history.ProcessorId]++
+		}
+	}
+	if len(votes) != 2 || votes[winner] != 1 || votes[loser] != 1 {
+		t.Fatalf("期望用户 %v、%v 各同意一次，实际为 %v", winner, loser, votes)
+	}
+}
+
+// 按照读取时的版本更新，工单已被修改时不更新任何数据
+func TestUpdateWorkOrder(t *testing.T) {
+	db, workOrder := newCounterSignWorkOrder(t)
+
+	first := testdb.GetWorkOrder(t, db, workOrder.Id)
+	second := testdb.GetWorkOrder(t, db, workOrder.Id)
+
+	err := UpdateWorkOrder(db, &first, map[string]interface{}{"title": "第一次修改"})
+	if err != nil {
+		t.Fatalf("更新工单失败，%v", err)
+	}
+	if first.Version != workOrder.Version+1 {
+		t.Fatalf("期望版本为 %v，实际为 %v", workOrder.Version+1, first.Version)
+	}
+
+	err = UpdateWorkOrder(db, &second, map[string]interface{}{"title": "第二次修改"})
+	if !errors.Is(err, ErrWorkOrderChanged) {
+		t.Fatalf("期望工单版本冲突，实际为 %v", err)
+	}
+	if second.Version != workOrder.Version {
+		t.Fatalf("更新失败时不应修改读取到的版本，实际为 %v", second.Version)
+	}
+
+	current := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if current.Title != "第一次修改" || current.Version != first.Version {
+		t.Fatalf("工单被覆盖，标题 %v，版本 %v", current.Title, current.Version)
+	}
+}
+
+// 两个处理人读取到同一版本的工单且均未提交版本，后写入的一方由 UpdateWorkOrder 检测到冲突。
+// SQLite 同一时间只能有一个写事务，因此不开启事务，使两个处理人在任何一方写入前都读取到工单；
+// 更新工单是处理时的第一次写入，冲突的一方不会留下任何数据
+func TestConcurrentHandleWithoutVersion(t *testing.T) {
+	db, workOrder := newCounterSignWorkOrder(t)
+	testdb.ReadBarrier(db, process.WorkOrderInfo{}.TableName(), 2)
+
+	winner, loser := handleConcurrently(t, db, map[int]approval{
+		2: approve(workOrder.Id, "approve", "end", nil),
+		3: approve(workOrder.Id, "approve", "end", nil),
+	}, handleOn)
+
+	assertCounterSign(t, db, workOrder.Id, winner, loser, func(process.WorkOrderInfo) *int {
+		return nil
+	})
+}
+
+// 会签节点的两个处理人基于同一版本同时同意，后提交的一方版本冲突，重新提交后会签完成
+func TestConcurrentCounterSign(t *testing.T) {
+	db, workOrder := newCounterSignWorkOrder(t)
+
+	winner, loser := handleConcurrently(t, db, map[int]approval{
+		2: approve(workOrder.Id, "approve", "end", versionOf(workOrder)),
+		3: approve(workOrder.Id, "approve", "end", versionOf(workOrder)),
+	}, handleWorkOrder)
+
+	assertCounterSign(t, db, workOrder.Id, winner, loser, versionOf)
+}
+
+// 并行的两个分支同时到达聚合网关，后提交的一方版本冲突，重新提交后聚合完成
+func TestConcurrentParallelJoin(t *testing.T) {
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, parallelStructure)
+	workOrder := testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{
+		{Id: "a", Label: "审批 A", Processor: []int{2}, ProcessMethod: process.AssignPerson},
+		{Id: "b", Label: "审批 B", Processor: []int{3}, ProcessMethod: process.AssignPerson},
+	})
+	sources := map[int]string{2: "a", 3: "b"}
+
+	winner, loser := handleConcurrently(t, db, map[int]approval{
+		2: approve(workOrder.Id, sources[2], "join", versionOf(workOrder)),
+		3: approve(workOrder.Id, sources[3], "join", versionOf(workOrder)),
+	}, handleWorkOrder)
+
+	// 只有一个分支完成，工单仍等待另一个分支
+	current := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if current.IsEnd != 0 {
+		t.Fatal("只有一个分支完成时聚合网关不应流转")
+	}
+	if ids := stateIds(t, current); len(ids) != 1 || ids[0] != sources[loser] {
+		t.Fatalf("期望只剩余分支 %v，实际为 %v", sources[loser], ids)
+	}
+	historyList := testdb.Histories(t, db, workOrder.Id)
+	if len(historyList) != 1 || historyList[0].Source != sources[winner] {
+		t.Fatalf("期望只记录分支 %v 的处理，实际为 %+v", sources[winner], historyList)
+	}
+
+	// 版本冲突的分支基于最新的工单重新提交
+	err := handleWorkOrder(db, loser, approve(workOrder.Id, sources[loser], "join", versionOf(current)))
+	if err != nil {
+		t.Fatalf("重新提交失败，%v", err)
+	}
+
+	current = testdb.GetWorkOrder(t, db, workOrder.Id)
+	if ids := stateIds(t, current); current.IsEnd != 1 || len(ids) != 1 || ids[0] != "end" {
+		t.Fatalf("两个分支均完成后应聚合到结束节点，实际为 %v", ids)
+	}
+	branches := make(map[string]int)
+	for _, history := range testdb.Histories(t, db, workOrder.Id) {
+		if history.Source == "a" || history.Source == "b" {
+			branches[history.Source]++
+		}
+	}
+	if branches["a"] != 1 || branches["b"] != 1 {
+		t.Fatalf("期望两个分支各完成一次，实际为 %v", branches)
+	}
+}
+
+// 转交、退回、加签、撤回、认领、释放、结束及重开均校验客户端读取到的工单版本
+func TestStaleVersionRejected(t *testing.T) {
+	db := testdb.Open(t)
+	testdb.Users(t, db, 1, 2, 3)
+	processInfo := testdb.Process(t, db, counterSignStructure)
+	workOrder := testdb.WorkOrder(t, db, processInfo.Id, 1, []*process.StateItem{{
+		Id:            "approve",
+		Label:         "会签",
+		Processor:     []int{1},
+		ProcessMethod: process.AssignRole,
+	}})
+
+	creator := &Actor{UserId: 1}
+	stale := workOrder.Version + 1
+
+	operations := map[string]func(tx *gorm.DB) error{
+		"转交": func(tx *gorm.DB) error {
+			return InversionWorkOrder(tx, creator, &InversionCommand{WorkOrderId: workOrder.Id, NodeId: "approve", UserId: 3, Version: &stale})
+		},
+		"退回": func(tx *gorm.DB) error {
+			return ReturnWorkOrder(tx, creator, &ReturnCommand{WorkOrderId: workOrder.Id, SourceState: "approve", TargetState: "start", Remarks: "退回", Version: &stale})
+		},
+		"加签": func(tx *gorm.DB) error {
+			return AddSigner(tx, creator, &AddSignerCommand{WorkOrderId: workOrder.Id, SourceState: "approve", Mode: process.AddSignerBefore, Users: []int{3}, Version: &stale})
+		},
+		"撤回": func(tx *gorm.DB) error {
+			return WithdrawWorkOrder(tx, creator, &WithdrawCommand{WorkOrderId: workOrder.Id, Version: &stale})
+		},
+		"认领": func(tx *gorm.DB) error {
+			return ClaimWorkOrder(tx, creator, &ClaimCommand{WorkOrderId: workOrder.Id, NodeId: "approve", Version: &stale})
+		},
+		"释放": func(tx *gorm.DB) error {
+			return ReleaseWorkOrder(tx, creator, &ClaimCommand{WorkOrderId: workOrder.Id, NodeId: "approve", Version: &stale})
+		},
+		"结束": func(tx *gorm.DB) error {
+			return EndWorkOrder(tx, creator, &WorkOrderCommand{WorkOrderId: workOrder.Id, Version: &stale})
+		},
+		"重开": func(tx *gorm.DB) error {
+			_, err := ReopenWorkOrder(tx, creator, &WorkOrderCommand{WorkOrderId: workOrder.Id, Version: &stale})
+			return err
+		},
+	}
+	for name, operation := range operations {
+		tx := db.Begin()
+		err := operation(tx)
+		tx.Rollback()
+		if !errors.Is(err, ErrWorkOrderChanged) {
+			t.Errorf("%v：期望工单版本冲突，实际为 %v", name, err)
+		}
+	}
+
+	result := testdb.GetWorkOrder(t, db, workOrder.Id)
+	if result.Version != workOrder.Version {
+		t.Errorf("工单版本被修改，处理前 %v，处理后 %v", workOrder.Version, result.Version)
+	}
+	if historyList := testdb.Histories(t, db, workOrder.Id); len(historyList) != 0 {
+		t.Errorf("期望没有流转历史，实际为 %v 条", len(historyList))
+	}
+}
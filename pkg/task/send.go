@@ -12,3 +12,8 @@ import (
 func Send(classify string, scriptPath string, params string) {
 	worker.SendTask(context.Background(), classify, scriptPath, params)
 }
+
+// 同步执行脚本，用于需要等待执行结果的任务节点
+func Run(ctx context.Context, scriptPath string, params string) (stdout []byte, stderr []byte, exitCode int, err error) {
+	return worker.RunScript(ctx, scriptPath, params)
+}
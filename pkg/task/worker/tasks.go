@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"ferry/pkg/logger"
@@ -25,6 +26,23 @@ func executeTaskBase(scriptPath string, params string) (err error) {
 	return
 }
 
+// RunScript 同步执行脚本，返回标准输出及退出码，脚本以非 0 退出码结束时不视为错误
+func RunScript(ctx context.Context, scriptPath string, params string) (stdout []byte, stderr []byte, exitCode int, err error) {
+	var outBuf, errBuf bytes.Buffer
+
+	command := exec.CommandContext(ctx, scriptPath, params)
+	command.Stdout = &outBuf
+	command.Stderr = &errBuf
+	err = command.Run()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+		err = nil
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), exitCode, err
+}
+
 // ExecCommand 异步任务
 func ExecCommand(classify string, scriptPath string, params string) (err error) {
 	if classify == "shell" {
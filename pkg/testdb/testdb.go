@@ -0,0 +1,149 @@
+package testdb
+
+import (
+	"encoding/json"
+	"ferry/global/orm"
+	migration "ferry/models/gorm"
+	"ferry/models/process"
+	"ferry/models/system"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+/*
+  @Author : lanyulei
+  @Desc : 测试使用的 SQLite 数据库及流程、工单数据，替换全局的数据库连接
+*/
+
+// 打开临时的 SQLite 数据库并创建数据表，测试结束后恢复全局的数据库连接。
+// 事务在开启时即获取整个数据库的写锁，并发的事务依次执行，避免 SQLite 在事务中由读锁升级为写锁时死锁
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "ferry.db") + "?_busy_timeout=10000&_txlock=immediate"
+	db, err := gorm.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("打开测试数据库失败，%v", err)
+	}
+	err = migration.AutoMigrate(db)
+	if err != nil {
+		db.Close()
+		t.Fatalf("创建数据表失败，%v", err)
+	}
+
+	previous := orm.Eloquent
+	orm.Eloquent = db
+	t.Cleanup(func() {
+		orm.Eloquent = previous
+		db.Close()
+	})
+	return db
+}
+
+// 创建用户，用户名及昵称为 user 加用户ID
+func Users(t testing.TB, db *gorm.DB, userIds ...int) {
+	t.Helper()
+	for _, userId := range userIds {
+		user := system.SysUser{}
+		user.UserId = userId
+		user.Username = fmt.Sprintf("user%d", userId)
+		user.NickName = user.Username
+		err := db.Create(&user).Error
+		if err != nil {
+			t.Fatalf("创建用户失败，%v", err)
+		}
+	}
+}
+
+// 创建流程，structure 为流程结构
+func Process(t testing.TB, db *gorm.DB, structure map[string]interface{}) (processInfo process.Info) {
+	t.Helper()
+	processInfo = process.Info{
+		Name:      "测试流程",
+		Structure: jsonRaw(t, structure),
+		Tpls:      json.RawMessage("[]"),
+		Task:      json.RawMessage("[]"),
+		Notice:    json.RawMessage("[]"),
+	}
+	err := db.Create(&processInfo).Error
+	if err != nil {
+		t.Fatalf("创建流程失败，%v", err)
+	}
+	return
+}
+
+// 创建停留在 stateList 节点的工单
+func WorkOrder(t testing.TB, db *gorm.DB, processId int, creator int, stateList []*process.StateItem) (workOrder process.WorkOrderInfo) {
+	t.Helper()
+	workOrder = process.WorkOrderInfo{
+		Title:         "测试工单",
+		Process:       processId,
+		State:         jsonRaw(t, stateList),
+		RelatedPerson: jsonRaw(t, []int{creator}),
+		ReturnStack:   json.RawMessage("[]"),
+		Creator:       creator,
+	}
+	err := db.Create(&workOrder).Error
+	if err != nil {
+		t.Fatalf("创建工单失败，%v", err)
+	}
+	return
+}
+
+// 查询工单
+func GetWorkOrder(t testing.TB, db *gorm.DB, workOrderId int) (workOrder process.WorkOrderInfo) {
+	t.Helper()
+	err := db.Model(&process.WorkOrderInfo{}).Where("id = ?", workOrderId).Find(&workOrder).Error
+	if err != nil {
+		t.Fatalf("查询工单失败，%v", err)
+	}
+	return
+}
+
+// 查询工单的流转历史，按照写入顺序排列
+func Histories(t testing.TB, db *gorm.DB, workOrderId int) (historyList []process.CirculationHistory) {
+	t.Helper()
+	err := db.Model(&process.CirculationHistory{}).Where("work_order = ?", workOrderId).Order("id").Find(&historyList).Error
+	if err != nil {
+		t.Fatalf("查询流转历史失败，%v", err)
+	}
+	return
+}
+
+// 前 parties 次查询表 table 后等待，直到 parties 次查询均已完成，用于模拟并发的请求读取到同一份数据
+func ReadBarrier(db *gorm.DB, table string, parties int) {
+	var (
+		mu      sync.Mutex
+		arrived int
+		ready   = make(chan struct{})
+	)
+	db.Callback().Query().After("gorm:query").Register("testdb:read_barrier", func(scope *gorm.Scope) {
+		if scope.TableName() != table {
+			return
+		}
+		mu.Lock()
+		arrived++
+		current := arrived
+		if current == parties {
+			close(ready)
+		}
+		mu.Unlock()
+		if current <= parties {
+			<-ready
+		}
+	})
+}
+
+func jsonRaw(t testing.TB, value interface{}) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("json序列化失败，%v", err)
+	}
+	return data
+}
@@ -0,0 +1,23 @@
+package process
+
+/*
+  @Author : lanyulei
+*/
+
+import (
+	"ferry/apis/process"
+	"ferry/middleware"
+	jwt "ferry/pkg/jwtauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterDelegateRuleRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) {
+	delegateRule := v1.Group("/delegate-rule").Use(authMiddleware.MiddlewareFunc()).Use(middleware.AuthCheckRole())
+	{
+		delegateRule.GET("", process.DelegateRuleList)
+		delegateRule.POST("", process.CreateDelegateRule)
+		delegateRule.PUT("", process.UpdateDelegateRule)
+		delegateRule.DELETE("", process.DeleteDelegateRule)
+	}
+}
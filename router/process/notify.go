@@ -0,0 +1,22 @@
+package process
+
+/*
+  @Author : lanyulei
+*/
+
+import (
+	"ferry/apis/process"
+	"ferry/middleware"
+	jwt "ferry/pkg/jwtauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterNotifyRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) {
+	notifyOutbox := v1.Group("/notify-outbox").Use(authMiddleware.MiddlewareFunc()).Use(middleware.AuthCheckRole())
+	{
+		notifyOutbox.GET("", process.NotifyOutboxList)
+		notifyOutbox.GET("/:id", process.NotifyOutboxDetails)
+		notifyOutbox.POST("/resend/:id", process.ResendNotify)
+	}
+}
@@ -0,0 +1,24 @@
+package process
+
+/*
+  @Author : lanyulei
+*/
+
+import (
+	"ferry/apis/process"
+	"ferry/middleware"
+	jwt "ferry/pkg/jwtauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterNotifyTemplateRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) {
+	notifyTemplate := v1.Group("/notify-template").Use(authMiddleware.MiddlewareFunc()).Use(middleware.AuthCheckRole())
+	{
+		notifyTemplate.GET("", process.NotifyTemplateList)
+		notifyTemplate.POST("", process.CreateNotifyTemplate)
+		notifyTemplate.PUT("", process.UpdateNotifyTemplate)
+		notifyTemplate.DELETE("", process.DeleteNotifyTemplate)
+		notifyTemplate.POST("/preview", process.PreviewNotifyTemplate)
+	}
+}
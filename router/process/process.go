@@ -22,5 +22,11 @@ func RegisterProcessRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddle
 		processRouter.DELETE("", process.DeleteProcess)
 		processRouter.GET("/details", process.ProcessDetails)
 		processRouter.POST("/clone/:id", process.CloneProcess)
+		processRouter.POST("/validate", process.ValidateProcess)
+		processRouter.POST("/simulate", process.SimulateProcess)
+		processRouter.GET("/versions", process.ProcessVersionList)
+		processRouter.GET("/export", process.ExportProcess)
+		processRouter.POST("/import", process.ImportProcess)
+		processRouter.POST("/migrate", process.MigrateWorkOrderVersion)
 	}
 }
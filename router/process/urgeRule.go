@@ -0,0 +1,23 @@
+package process
+
+/*
+  @Author : lanyulei
+*/
+
+import (
+	"ferry/apis/process"
+	"ferry/middleware"
+	jwt "ferry/pkg/jwtauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterUrgeRuleRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) {
+	urgeRule := v1.Group("/urge-rule").Use(authMiddleware.MiddlewareFunc()).Use(middleware.AuthCheckRole())
+	{
+		urgeRule.GET("", process.UrgeRuleList)
+		urgeRule.POST("", process.CreateUrgeRule)
+		urgeRule.PUT("", process.UpdateUrgeRule)
+		urgeRule.DELETE("", process.DeleteUrgeRule)
+	}
+}
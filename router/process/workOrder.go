@@ -22,8 +22,13 @@ func RegisterWorkOrderRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMidd
 		workOrderRouter.POST("/handle", process.ProcessWorkOrder)
 		workOrderRouter.GET("/unity", process.UnityWorkOrder)
 		workOrderRouter.POST("/inversion", process.InversionWorkOrder)
+		workOrderRouter.GET("/return-nodes", process.ReturnableNodes)
+		workOrderRouter.POST("/return", process.ReturnWorkOrder)
+		workOrderRouter.POST("/add-signer", process.AddSigner)
+		workOrderRouter.POST("/withdraw", process.WithdrawWorkOrder)
 		workOrderRouter.GET("/urge", process.UrgeWorkOrder)
 		workOrderRouter.PUT("/active-order/:id", process.ActiveOrder)
+		workOrderRouter.PUT("/release-order/:id", process.ReleaseOrder)
 		workOrderRouter.DELETE("/delete/:id", process.DeleteWorkOrder)
 		workOrderRouter.POST("/reopen/:id", process.ReopenWorkOrder)
 		workOrderRouter.POST("/decrypt-phone", process.DecryptPhone)
@@ -71,4 +71,8 @@ func sysCheckRoleRouterInit(r *gin.RouterGroup, authMiddleware *jwtauth.GinJWTMi
 	process.RegisterTaskRouter(v1, authMiddleware)
 	process.RegisterTplRouter(v1, authMiddleware)
 	process.RegisterWorkOrderRouter(v1, authMiddleware)
+	process.RegisterUrgeRuleRouter(v1, authMiddleware)
+	process.RegisterDelegateRuleRouter(v1, authMiddleware)
+	process.RegisterNotifyRouter(v1, authMiddleware)
+	process.RegisterNotifyTemplateRouter(v1, authMiddleware)
 }
@@ -60,6 +60,8 @@ func RegisterUserCenterRouter(v1 *gin.RouterGroup, authMiddleware *jwt.GinJWTMid
 		user.GET("/profile", system.GetSysUserProfile)
 		user.POST("/avatar", system.InsetSysUserAvatar)
 		user.PUT("/pwd", system.SysUserUpdatePwd)
+		user.GET("/notify-settings", system.GetNotifySettings)
+		user.PUT("/notify-settings", system.UpdateNotifySettings)
 	}
 }
 